@@ -2,6 +2,8 @@ package cke
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"net"
 	"strings"
 	"time"
@@ -46,6 +48,14 @@ type Agent interface {
 	// RunWithTimeout run command with given timeout.
 	// If timeout is 0, the command will run indefinitely.
 	RunWithTimeout(command, input string, timeout time.Duration) (stdout, stderr []byte, err error)
+
+	// RunWithReader run command with stdin read from input.
+	// Unlike RunWithTimeout, input is streamed and not held in memory.
+	// If timeout is 0, the command will run indefinitely.
+	RunWithReader(command string, input io.Reader, timeout time.Duration) (stdout, stderr []byte, err error)
+
+	// DialUnix connects to the unix domain socket at path on the node.
+	DialUnix(ctx context.Context, path string) (net.Conn, error)
 }
 
 type sshAgent struct {
@@ -100,7 +110,8 @@ func SSHAgent(node *Node, privkey string) (Agent, error) {
 		client: ssh.NewClient(clientConn, channelCh, reqCh),
 		conn:   conn,
 	}
-	_, _, err = a.Run("docker version")
+	// Nodes running system containers in containerd may not have docker.
+	_, _, err = a.Run("docker version || test -S " + ContainerdSocket)
 	if err != nil {
 		a.Close()
 		return nil, err
@@ -125,6 +136,14 @@ func (a *sshAgent) RunWithInput(command, input string) error {
 }
 
 func (a *sshAgent) RunWithTimeout(command, input string, timeout time.Duration) ([]byte, []byte, error) {
+	var r io.Reader
+	if len(input) > 0 {
+		r = strings.NewReader(input)
+	}
+	return a.RunWithReader(command, r, timeout)
+}
+
+func (a *sshAgent) RunWithReader(command string, input io.Reader, timeout time.Duration) ([]byte, []byte, error) {
 	if timeout > 0 {
 		err := a.conn.SetDeadline(time.Now().Add(defaultDialTimeout))
 		if err != nil {
@@ -150,8 +169,8 @@ func (a *sshAgent) RunWithTimeout(command, input string, timeout time.Duration)
 		}
 	}
 
-	if len(input) > 0 {
-		session.Stdin = strings.NewReader(input)
+	if input != nil {
+		session.Stdin = input
 	}
 
 	var stdoutBuff bytes.Buffer
@@ -171,3 +190,7 @@ func (a *sshAgent) RunWithTimeout(command, input string, timeout time.Duration)
 	}
 	return stdout, stderr, nil
 }
+
+func (a *sshAgent) DialUnix(ctx context.Context, path string) (net.Conn, error) {
+	return a.client.DialContext(ctx, "unix", path)
+}
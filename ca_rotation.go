@@ -0,0 +1,106 @@
+package cke
+
+import (
+	"strings"
+	"time"
+)
+
+// CARotationPhase represents the progress of a CA rotation.
+type CARotationPhase string
+
+// Phases of a CA rotation.
+const (
+	// CARotationAdded means that a new CA has been created in the CA backend.
+	// Certificates are still issued by the old CA.
+	CARotationAdded = CARotationPhase("added")
+
+	// CARotationBundled means that the CA certificate in etcd is the bundle
+	// of the old and the new CA, and components are restarted to trust both.
+	CARotationBundled = CARotationPhase("bundled")
+
+	// CARotationSwitched means that the new CA issues certificates, and
+	// components are restarted to reissue their certificates.
+	CARotationSwitched = CARotationPhase("switched")
+
+	// CARotationDropped means that the CA certificate in etcd is the new CA only,
+	// and components are restarted to stop trusting the old CA.
+	CARotationDropped = CARotationPhase("dropped")
+)
+
+// CARotationMinPhaseDuration is the minimum duration of each phase of a CA rotation
+// after the new CA is added.  This gives components that CKE does not restart,
+// such as webhook servers reloading Secrets, time to catch up with the phase.
+const CARotationMinPhaseDuration = 5 * time.Minute
+
+// CARotation is a request to rotate one of the CAs in CAKeys.
+// The request is created by "ckecli ca rotate" and removed by the leader
+// when the old CA is deleted from the CA backend.
+type CARotation struct {
+	// Name is the name of the CA in CAKeys.
+	Name string `json:"name"`
+
+	// Phase is the current phase of the rotation.
+	Phase CARotationPhase `json:"phase"`
+
+	// PhaseStarted is the time when the current phase began.
+	// Certificates issued before this time are reissued in the phase.
+	PhaseStarted time.Time `json:"phase_started"`
+
+	// OldIssuer and NewIssuer are the IDs of the issuers in the CA backend.
+	OldIssuer string `json:"old_issuer"`
+	NewIssuer string `json:"new_issuer"`
+
+	// OldCertificate and NewCertificate are the PEM encoded CA certificates.
+	OldCertificate string `json:"old_certificate"`
+	NewCertificate string `json:"new_certificate"`
+
+	// Author is the user who requested the rotation.
+	Author string `json:"author"`
+
+	// Timestamp is the time when the rotation was requested.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// caRotationCertificates maps CAs to the certificates in NodeStatus.Certificates
+// that are issued by the CA or whose components verify their peers with the CA.
+// Certificates for webhooks are stored in Kubernetes Secrets, so none for CAWebhook.
+var caRotationCertificates = map[string][]string{
+	CAServer:                {CertEtcdServer, CertAPIServerEtcdClient},
+	CAEtcdPeer:              {CertEtcdPeer},
+	CAEtcdClient:            {CertEtcdServer, CertAPIServerEtcdClient},
+	CAKubernetes:            {CertAPIServer, CertControllerManager, CertScheduler, CertProxy, CertKubelet},
+	CAKubernetesAggregation: {CertAggregation},
+}
+
+// Bundle returns the bundle of the old and the new CA certificates.
+func (r *CARotation) Bundle() string {
+	return strings.TrimRight(r.OldCertificate, "\n") + "\n" + r.NewCertificate
+}
+
+// Certificates returns the names of the certificates in NodeStatus.Certificates
+// whose components are restarted in each phase of the rotation.
+func (r *CARotation) Certificates() []string {
+	return caRotationCertificates[r.Name]
+}
+
+// Pending returns true if the certificate needs to be reissued in the current phase.
+// Components are restarted in every phase after the new CA is added because
+// some of them, such as kubelet on control plane nodes, share the CA file with others.
+//
+// NotBefore of certificates is backdated by CertificateBackdate, so it is
+// compared with PhaseStarted backdated by the same duration.
+func (r *CARotation) Pending(st CertificateStatus) bool {
+	if r.Phase == CARotationAdded {
+		return false
+	}
+	return st.NotBefore.Before(r.PhaseStarted.Add(-CertificateBackdate))
+}
+
+// PhaseElapsed returns true if the current phase has lasted for
+// CARotationMinPhaseDuration at `now`.  This is always true for CARotationAdded.
+func (r *CARotation) PhaseElapsed(now time.Time) bool {
+	if r.Phase == CARotationAdded {
+		return true
+	}
+	return !now.Before(r.PhaseStarted.Add(CARotationMinPhaseDuration))
+}
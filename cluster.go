@@ -1,13 +1,19 @@
 package cke
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/libcni"
 	corev1 "k8s.io/api/core/v1"
@@ -15,8 +21,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	v1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
 	proxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1 "k8s.io/kube-scheduler/config/v1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
@@ -102,18 +110,245 @@ func (s ServiceParams) Equal(o ServiceParams) bool {
 		compareStringMap(s.ExtraEnvvar, o.ExtraEnvvar)
 }
 
+// DefaultEtcdQuotaBackendBytes is the default value of etcd's --quota-backend-bytes.
+const DefaultEtcdQuotaBackendBytes = 2 * 1024 * 1024 * 1024
+
 // EtcdParams is a set of extra parameters for etcd.
 type EtcdParams struct {
 	ServiceParams `json:",inline"`
-	VolumeName    string `json:"volume_name"`
+	VolumeName    string           `json:"volume_name"`
+	Defrag        EtcdDefragParams `json:"defrag"`
+}
+
+// EtcdDefragParams is a set of parameters for automatic defragmentation of etcd.
+// Defragmentation is disabled if both thresholds are zero.
+type EtcdDefragParams struct {
+	// FragmentationThreshold is the ratio of the unused space to the database size.
+	// A member whose ratio exceeds this is defragmented.
+	FragmentationThreshold float64 `json:"fragmentation_threshold,omitempty"`
+
+	// QuotaThreshold is the ratio of the database size to the backend quota.
+	// A member whose ratio exceeds this is defragmented if defragmentation
+	// brings the ratio below this.
+	QuotaThreshold float64 `json:"quota_threshold,omitempty"`
+}
+
+// QuotaBackendBytes returns the backend quota given by --quota-backend-bytes
+// in the extra arguments, or DefaultEtcdQuotaBackendBytes.
+func (p EtcdParams) QuotaBackendBytes() int64 {
+	quota := int64(DefaultEtcdQuotaBackendBytes)
+	for _, arg := range p.ExtraArguments {
+		v, ok := strings.CutPrefix(arg, "--quota-backend-bytes=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && n > 0 {
+			quota = n
+		}
+	}
+	return quota
+}
+
+// NeedsDefrag returns true if the member needs to be defragmented.
+func (p EtcdParams) NeedsDefrag(st *EtcdMemberStatus) bool {
+	if st == nil || st.DBSize <= 0 || st.DBSizeInUse >= st.DBSize {
+		return false
+	}
+
+	if th := p.Defrag.FragmentationThreshold; th > 0 {
+		if float64(st.DBSize-st.DBSizeInUse)/float64(st.DBSize) >= th {
+			return true
+		}
+	}
+	if th := p.Defrag.QuotaThreshold; th > 0 {
+		limit := th * float64(p.QuotaBackendBytes())
+		if float64(st.DBSize) >= limit && float64(st.DBSizeInUse) < limit {
+			return true
+		}
+	}
+	return false
 }
 
 // APIServerParams is a set of extra parameters for kube-apiserver.
 type APIServerParams struct {
 	ServiceParams   `json:",inline"`
-	AuditLogEnabled bool   `json:"audit_log_enabled"`
-	AuditLogPolicy  string `json:"audit_log_policy"`
-	AuditLogPath    string `json:"audit_log_path"`
+	AuditLogEnabled bool             `json:"audit_log_enabled"`
+	AuditLogPolicy  string           `json:"audit_log_policy"`
+	AuditLogPath    string           `json:"audit_log_path"`
+	Encryption      EncryptionParams `json:"encryption"`
+
+	// AuditWebhook is the parameters for the audit webhook backend.
+	AuditWebhook AuditWebhookParams `json:"audit_webhook"`
+
+	// Authentication is AuthenticationConfiguration for structured authentication.
+	Authentication *unstructured.Unstructured `json:"authentication,omitempty"`
+
+	// Authorization is AuthorizationConfiguration for structured authorization.
+	Authorization *unstructured.Unstructured `json:"authorization,omitempty"`
+
+	// Admission is AdmissionConfiguration for admission plugins.
+	Admission *unstructured.Unstructured `json:"admission,omitempty"`
+}
+
+// AuthenticationConfig decodes Authentication.
+// This returns nil if Authentication is not specified.
+func (p APIServerParams) AuthenticationConfig() (*apiserverv1.AuthenticationConfiguration, error) {
+	if p.Authentication == nil {
+		return nil, nil
+	}
+
+	if p.Authentication.GetAPIVersion() != apiserverv1.SchemeGroupVersion.String() {
+		return nil, fmt.Errorf("unexpected authentication API version: %s", p.Authentication.GetAPIVersion())
+	}
+	if p.Authentication.GetKind() != "AuthenticationConfiguration" {
+		return nil, fmt.Errorf("wrong kind for authentication config: %s", p.Authentication.GetKind())
+	}
+
+	data, err := json.Marshal(p.Authentication)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(apiserverv1.AuthenticationConfiguration)
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// AuthorizationConfig decodes Authorization.
+// This returns nil if Authorization is not specified.
+func (p APIServerParams) AuthorizationConfig() (*apiserverv1.AuthorizationConfiguration, error) {
+	if p.Authorization == nil {
+		return nil, nil
+	}
+
+	if p.Authorization.GetAPIVersion() != apiserverv1.SchemeGroupVersion.String() {
+		return nil, fmt.Errorf("unexpected authorization API version: %s", p.Authorization.GetAPIVersion())
+	}
+	if p.Authorization.GetKind() != "AuthorizationConfiguration" {
+		return nil, fmt.Errorf("wrong kind for authorization config: %s", p.Authorization.GetKind())
+	}
+
+	data, err := json.Marshal(p.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(apiserverv1.AuthorizationConfiguration)
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// AdmissionConfig decodes Admission.
+// This returns nil if Admission is not specified.
+func (p APIServerParams) AdmissionConfig() (*apiserverv1.AdmissionConfiguration, error) {
+	if p.Admission == nil {
+		return nil, nil
+	}
+
+	if p.Admission.GetAPIVersion() != apiserverv1.SchemeGroupVersion.String() {
+		return nil, fmt.Errorf("unexpected admission API version: %s", p.Admission.GetAPIVersion())
+	}
+	if p.Admission.GetKind() != "AdmissionConfiguration" {
+		return nil, fmt.Errorf("wrong kind for admission config: %s", p.Admission.GetKind())
+	}
+
+	data, err := json.Marshal(p.Admission)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(apiserverv1.AdmissionConfiguration)
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Encryption providers for Kubernetes Secrets.
+const (
+	EncryptionProviderAESCBC = "aescbc"
+	EncryptionProviderKMS    = "kms"
+)
+
+// EncryptionParams is a set of parameters to encrypt Kubernetes Secrets at rest.
+type EncryptionParams struct {
+	// Provider is the provider to encrypt new data.
+	// Either "aescbc" (default) or "kms".
+	Provider string `json:"provider,omitempty"`
+
+	// KMSPlugin is the parameters for the KMS plugin container.
+	// This is used only when Provider is "kms".
+	KMSPlugin KMSPluginParams `json:"kms_plugin"`
+}
+
+// ProviderName returns the name of the encryption provider.
+func (p EncryptionParams) ProviderName() string {
+	if p.Provider == "" {
+		return EncryptionProviderAESCBC
+	}
+	return p.Provider
+}
+
+// KMSPluginParams is a set of parameters for the KMS v2 plugin backed by Vault transit engine.
+type KMSPluginParams struct {
+	ServiceParams `json:",inline"`
+	Image         string `json:"image"`
+}
+
+// Audit webhook modes
+const (
+	AuditWebhookModeBatch          = "batch"
+	AuditWebhookModeBlocking       = "blocking"
+	AuditWebhookModeBlockingStrict = "blocking-strict"
+)
+
+// AuditWebhookParams is a set of parameters for the audit webhook backend of kube-apiserver.
+// Audit events are selected by AuditLogPolicy of APIServerParams.
+type AuditWebhookParams struct {
+	// Enabled enables the audit webhook backend.
+	Enabled bool `json:"enabled"`
+
+	// Server is the URL of the audit event collector.
+	Server string `json:"server"`
+
+	// CACert is the PEM-encoded CA certificate to verify the collector.
+	// If empty, the system CA certificates are used.
+	CACert string `json:"ca_cert,omitempty"`
+
+	// Mode is the strategy for sending audit events.
+	// One of "batch" (default), "blocking", or "blocking-strict".
+	Mode string `json:"mode,omitempty"`
+
+	// BatchMaxSize is the maximum size of a batch.  Zero means the default.
+	BatchMaxSize int `json:"batch_max_size,omitempty"`
+
+	// BatchMaxWait is the amount of time to wait before force writing a batch.
+	BatchMaxWait string `json:"batch_max_wait,omitempty"`
+
+	// BatchThrottleEnable enables throttling of batches if not nil.
+	BatchThrottleEnable *bool `json:"batch_throttle_enable,omitempty"`
+
+	// BatchThrottleQPS is the maximum average number of batches per second.
+	BatchThrottleQPS float64 `json:"batch_throttle_qps,omitempty"`
+
+	// BatchThrottleBurst is the maximum number of requests sent at once.
+	BatchThrottleBurst int `json:"batch_throttle_burst,omitempty"`
+
+	// InitialBackoff is the amount of time to wait before retrying the first failed request.
+	InitialBackoff string `json:"initial_backoff,omitempty"`
+}
+
+// ModeName returns the mode of the audit webhook backend.
+func (p AuditWebhookParams) ModeName() string {
+	if p.Mode == "" {
+		return AuditWebhookModeBatch
+	}
+	return p.Mode
 }
 
 // CNIConfFile is a config file for CNI plugin deployed on worker nodes by CKE.
@@ -160,6 +395,68 @@ func (p SchedulerParams) MergeConfig(base *schedulerv1.KubeSchedulerConfiguratio
 	return &cfg, nil
 }
 
+// ControllerManagerParams is a set of extra parameters for kube-controller-manager.
+type ControllerManagerParams struct {
+	ServiceParams `json:",inline"`
+	Config        *ControllerManagerConfig `json:"config,omitempty"`
+}
+
+// ControllerManagerConfig is a typed configuration for kube-controller-manager.
+//
+// kube-controller-manager does not read a configuration file, so CKE
+// translates this into command-line flags.
+type ControllerManagerConfig struct {
+	// Controllers is the list of controllers to enable or disable.
+	// "*" enables all on-by-default controllers, "foo" enables foo, "-foo" disables foo.
+	Controllers []string `json:"controllers,omitempty"`
+
+	// FeatureGates is a map of feature names to enable or disable.
+	FeatureGates map[string]bool `json:"feature_gates,omitempty"`
+
+	// LeaderElection is the parameters for leader election.
+	LeaderElection ControllerManagerLeaderElection `json:"leader_election,omitempty"`
+
+	// KubeAPIQPS is the QPS to use while talking with kube-apiserver.
+	KubeAPIQPS float64 `json:"kube_api_qps,omitempty"`
+
+	// KubeAPIBurst is the burst to use while talking with kube-apiserver.
+	KubeAPIBurst int `json:"kube_api_burst,omitempty"`
+
+	// Concurrency is a map of controller names to the number of concurrent syncs.
+	// A key "foo" is passed as --concurrent-foo-syncs flag.
+	Concurrency map[string]int `json:"concurrency,omitempty"`
+}
+
+// ControllerManagerLeaderElection is a set of parameters for leader election of kube-controller-manager.
+// Leader election is always enabled because CKE runs kube-controller-manager on every control plane.
+type ControllerManagerLeaderElection struct {
+	LeaseDuration string `json:"lease_duration,omitempty"`
+	RenewDeadline string `json:"renew_deadline,omitempty"`
+	RetryPeriod   string `json:"retry_period,omitempty"`
+}
+
+// controllerManagerConcurrencyKeys is the set of valid keys of ControllerManagerConfig.Concurrency.
+var controllerManagerConcurrencyKeys = map[string]bool{
+	"cron-job":                           true,
+	"daemonset":                          true,
+	"deployment":                         true,
+	"endpoint":                           true,
+	"ephemeralvolume":                    true,
+	"gc":                                 true,
+	"horizontal-pod-autoscaler":          true,
+	"job":                                true,
+	"namespace":                          true,
+	"rc":                                 true,
+	"replicaset":                         true,
+	"resource-quota":                     true,
+	"service-endpoint":                   true,
+	"service":                            true,
+	"serviceaccount-token":               true,
+	"statefulset":                        true,
+	"ttl-after-finished":                 true,
+	"validating-admission-policy-status": true,
+}
+
 // ProxyParams is a set of extra parameters for kube-proxy.
 type ProxyParams struct {
 	ServiceParams `json:",inline"`
@@ -235,6 +532,120 @@ type KubeletParams struct {
 	Config        *unstructured.Unstructured `json:"config,omitempty"`
 	CRIEndpoint   string                     `json:"cri_endpoint"`
 	InPlaceUpdate bool                       `json:"in_place_update"`
+
+	// Overrides is a list of parameters for groups of nodes.
+	// Use ForNode to get the effective parameters for a node.
+	Overrides []KubeletOverride `json:"overrides,omitempty"`
+}
+
+// KubeletOverride is a set of kubelet parameters for a group of nodes.
+//
+// A node is selected if it matches all the specified conditions.
+// ServiceParams are appended to or merged with the base parameters, and
+// Config is merged into the base configuration recursively.
+type KubeletOverride struct {
+	// Name is the name of this override.
+	Name string `json:"name"`
+
+	// Selector selects nodes by labels.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Role selects nodes by the sabakan role, i.e. the value of "cke.cybozu.com/role" label.
+	Role string `json:"role,omitempty"`
+
+	// ControlPlane selects control plane nodes if true, or non control plane nodes if false.
+	ControlPlane *bool `json:"control_plane,omitempty"`
+
+	ServiceParams `json:",inline"`
+	Config        *unstructured.Unstructured `json:"config,omitempty"`
+}
+
+// Matches returns true if the node is selected by this override.
+// `o` must be validated beforehand.
+func (o KubeletOverride) Matches(n *Node) bool {
+	if o.ControlPlane != nil && *o.ControlPlane != n.ControlPlane {
+		return false
+	}
+	if len(o.Role) != 0 && n.Labels[kubeletOverrideRoleLabel] != o.Role {
+		return false
+	}
+	if o.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(o.Selector)
+		if err != nil {
+			return false
+		}
+		if !selector.Matches(labels.Set(n.Labels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// kubeletOverrideRoleLabel is the same as sabakan.CKELabelRole.
+const kubeletOverrideRoleLabel = "cke.cybozu.com/role"
+
+// ForNode returns the effective parameters for the node by applying
+// matching overrides in order.  The returned value has no overrides.
+func (p KubeletParams) ForNode(n *Node) KubeletParams {
+	ret := p
+	ret.Overrides = nil
+	for _, o := range p.Overrides {
+		if !o.Matches(n) {
+			continue
+		}
+
+		if len(o.ExtraArguments) > 0 {
+			ret.ExtraArguments = append(append([]string{}, ret.ExtraArguments...), o.ExtraArguments...)
+		}
+		if len(o.ExtraBinds) > 0 {
+			ret.ExtraBinds = append(append([]Mount{}, ret.ExtraBinds...), o.ExtraBinds...)
+		}
+		if len(o.ExtraEnvvar) > 0 {
+			env := make(map[string]string)
+			for k, v := range ret.ExtraEnvvar {
+				env[k] = v
+			}
+			for k, v := range o.ExtraEnvvar {
+				env[k] = v
+			}
+			ret.ExtraEnvvar = env
+		}
+
+		if o.Config != nil {
+			// apiVersion and kind may be omitted in overrides.
+			base := map[string]interface{}{
+				"apiVersion": kubeletv1beta1.SchemeGroupVersion.String(),
+				"kind":       "KubeletConfiguration",
+			}
+			if ret.Config != nil {
+				base = ret.Config.Object
+			}
+			ret.Config = &unstructured.Unstructured{
+				Object: mergeObject(base, o.Config.Object),
+			}
+		}
+	}
+	return ret
+}
+
+// mergeObject returns a new object made by merging `override` into `base` recursively.
+// Values other than maps, including lists, are replaced.
+// Neither `base` nor `override` is modified.
+func mergeObject(base, override map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		ret[k] = v
+	}
+	for k, v := range override {
+		bv, ok1 := ret[k].(map[string]interface{})
+		ov, ok2 := v.(map[string]interface{})
+		if ok1 && ok2 {
+			ret[k] = mergeObject(bv, ov)
+			continue
+		}
+		ret[k] = v
+	}
+	return ret
 }
 
 // MergeConfig merges the input struct with `base`.
@@ -286,6 +697,31 @@ type Reboot struct {
 const DefaultRebootEvictionTimeoutSeconds = 600
 const DefaultMaxConcurrentReboots = 1
 
+// CertRenewal is a set of configurations for proactive renewal of certificates on nodes.
+type CertRenewal struct {
+	Enabled bool `json:"enabled"`
+
+	// Threshold is the fraction of the lifetime after which certificates are renewed.
+	Threshold *float64 `json:"threshold,omitempty"`
+}
+
+// DefaultCertRenewalThreshold is the default value of CertRenewal.Threshold.
+const DefaultCertRenewalThreshold = 0.7
+
+// NeedsRenewal returns true if the certificate needs to be renewed at `now`.
+func (r CertRenewal) NeedsRenewal(st CertificateStatus, now time.Time) bool {
+	if !r.Enabled || st.NotAfter.IsZero() || !st.NotAfter.After(st.NotBefore) {
+		return false
+	}
+
+	th := DefaultCertRenewalThreshold
+	if r.Threshold != nil {
+		th = *r.Threshold
+	}
+	lifetime := st.NotAfter.Sub(st.NotBefore)
+	return !now.Before(st.NotBefore.Add(time.Duration(float64(lifetime) * th)))
+}
+
 type Repair struct {
 	RepairProcedures       []RepairProcedure     `json:"repair_procedures"`
 	MaxConcurrentRepairs   *int                  `json:"max_concurrent_repairs,omitempty"`
@@ -340,14 +776,14 @@ type TrustedRESTMapping struct {
 
 // Options is a set of optional parameters for k8s components.
 type Options struct {
-	Etcd              EtcdParams      `json:"etcd"`
-	Rivers            ServiceParams   `json:"rivers"`
-	EtcdRivers        ServiceParams   `json:"etcd-rivers"`
-	APIServer         APIServerParams `json:"kube-api"`
-	ControllerManager ServiceParams   `json:"kube-controller-manager"`
-	Scheduler         SchedulerParams `json:"kube-scheduler"`
-	Proxy             ProxyParams     `json:"kube-proxy"`
-	Kubelet           KubeletParams   `json:"kubelet"`
+	Etcd              EtcdParams              `json:"etcd"`
+	Rivers            ServiceParams           `json:"rivers"`
+	EtcdRivers        ServiceParams           `json:"etcd-rivers"`
+	APIServer         APIServerParams         `json:"kube-api"`
+	ControllerManager ControllerManagerParams `json:"kube-controller-manager"`
+	Scheduler         SchedulerParams         `json:"kube-scheduler"`
+	Proxy             ProxyParams             `json:"kube-proxy"`
+	Kubelet           KubeletParams           `json:"kubelet"`
 }
 
 // Cluster is a set of configurations for a etcd/Kubernetes cluster.
@@ -362,6 +798,9 @@ type Cluster struct {
 	Reboot              Reboot               `json:"reboot"`
 	Repair              Repair               `json:"repair"`
 	Sabakan             Sabakan              `json:"sabakan"`
+	CertRenewal         CertRenewal          `json:"cert_renewal"`
+	ContainerEngine     string               `json:"container_engine,omitempty"`
+	ControlPlaneMode    string               `json:"control_plane_mode,omitempty"`
 	Options             Options              `json:"options"`
 	TrustedRESTMappings []TrustedRESTMapping `json:"trusted_rest_mappings,omitempty"`
 }
@@ -416,6 +855,23 @@ func (c *Cluster) Validate(isTmpl bool) error {
 		return err
 	}
 
+	err = validateCertRenewal(c.CertRenewal)
+	if err != nil {
+		return err
+	}
+
+	switch c.ContainerEngine {
+	case "", ContainerEngineDocker, ContainerEngineContainerd:
+	default:
+		return errors.New("unknown container_engine: " + c.ContainerEngine)
+	}
+
+	switch c.ControlPlaneMode {
+	case "", ControlPlaneModeContainer, ControlPlaneModeStaticPod:
+	default:
+		return errors.New("unknown control_plane_mode: " + c.ControlPlaneMode)
+	}
+
 	err = validateOptions(c.Options)
 	if err != nil {
 		return err
@@ -596,6 +1052,57 @@ func validateReboot(reboot Reboot) error {
 	return nil
 }
 
+// ContainerEngineName returns the name of the container engine for system containers.
+func (c *Cluster) ContainerEngineName() string {
+	if c.ContainerEngine == "" {
+		return ContainerEngineDocker
+	}
+	return c.ContainerEngine
+}
+
+// ValidateTransition returns an error if the cluster configuration cannot
+// be changed from old.
+//
+// The container engine cannot be changed from containerd because CKE cannot
+// find system containers in containerd when docker is selected.
+func (c *Cluster) ValidateTransition(old *Cluster) error {
+	if old.ContainerEngineName() == ContainerEngineContainerd && c.ContainerEngineName() != ContainerEngineContainerd {
+		return errors.New("container_engine cannot be changed from containerd to " + c.ContainerEngineName())
+	}
+	return nil
+}
+
+// EffectiveKubeletParams returns the kubelet parameters for the cluster.
+// When the control plane runs as static pods, kubelet on every node is
+// configured to read static pod manifests from StaticPodManifestDir so
+// that kubelet on a node removed from the control plane stops them.
+func (c *Cluster) EffectiveKubeletParams() KubeletParams {
+	params := c.Options.Kubelet
+	if c.ControlPlaneMode != ControlPlaneModeStaticPod {
+		return params
+	}
+
+	override := KubeletOverride{
+		Name: "static-pods",
+		Config: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion":    kubeletv1beta1.SchemeGroupVersion.String(),
+				"kind":          "KubeletConfiguration",
+				"staticPodPath": StaticPodManifestDir,
+			},
+		},
+	}
+	params.Overrides = append(append([]KubeletOverride{}, params.Overrides...), override)
+	return params
+}
+
+func validateCertRenewal(r CertRenewal) error {
+	if r.Threshold != nil && (*r.Threshold <= 0 || *r.Threshold >= 1) {
+		return errors.New("cert_renewal.threshold must be greater than 0 and less than 1")
+	}
+	return nil
+}
+
 func validateOptions(opts Options) error {
 	v := func(binds []Mount) error {
 		for _, m := range binds {
@@ -613,6 +1120,12 @@ func validateOptions(opts Options) error {
 	if err != nil {
 		return err
 	}
+	if th := opts.Etcd.Defrag.FragmentationThreshold; th < 0 || th >= 1 {
+		return errors.New("etcd defrag fragmentation_threshold must be in [0, 1)")
+	}
+	if th := opts.Etcd.Defrag.QuotaThreshold; th < 0 || th > 1 {
+		return errors.New("etcd defrag quota_threshold must be in [0, 1]")
+	}
 	err = v(opts.APIServer.ExtraBinds)
 	if err != nil {
 		return err
@@ -676,6 +1189,10 @@ func validateOptions(opts Options) error {
 		}
 	}
 
+	if err := validateKubeletOverrides(opts.Kubelet, fldPath.Child("overrides"), v); err != nil {
+		return err
+	}
+
 	fldPath = fldPath.Child("boot_taints")
 	for i, taint := range opts.Kubelet.BootTaints {
 		err := validateTaint(taint, fldPath.Index(i))
@@ -696,6 +1213,56 @@ func validateOptions(opts Options) error {
 		}
 	}
 
+	if err := validateAuditWebhook(opts.APIServer); err != nil {
+		return err
+	}
+
+	authn, err := opts.APIServer.AuthenticationConfig()
+	if err != nil {
+		return err
+	}
+	if authn != nil {
+		if err := validateAuthenticationConfig(authn, field.NewPath("options", "kube-api", "authentication")); err != nil {
+			return err
+		}
+	}
+
+	authz, err := opts.APIServer.AuthorizationConfig()
+	if err != nil {
+		return err
+	}
+	if authz != nil {
+		if err := validateAuthorizationConfig(authz, field.NewPath("options", "kube-api", "authorization")); err != nil {
+			return err
+		}
+	}
+
+	admission, err := opts.APIServer.AdmissionConfig()
+	if err != nil {
+		return err
+	}
+	if admission != nil {
+		if err := validateAdmissionConfig(admission, field.NewPath("options", "kube-api", "admission")); err != nil {
+			return err
+		}
+	}
+
+	switch opts.APIServer.Encryption.ProviderName() {
+	case EncryptionProviderAESCBC:
+	case EncryptionProviderKMS:
+		if len(opts.APIServer.Encryption.KMSPlugin.Image) == 0 {
+			return errors.New("kms_plugin.image should not be empty")
+		}
+	default:
+		return errors.New("unknown encryption provider: " + opts.APIServer.Encryption.Provider)
+	}
+
+	if cfg := opts.ControllerManager.Config; cfg != nil {
+		if err := validateControllerManagerConfig(cfg); err != nil {
+			return err
+		}
+	}
+
 	if _, err := opts.Scheduler.MergeConfig(&schedulerv1.KubeSchedulerConfiguration{}); err != nil {
 		return err
 	}
@@ -712,3 +1279,285 @@ func validateOptions(opts Options) error {
 
 	return nil
 }
+
+func validateKubeletOverrides(params KubeletParams, fldPath *field.Path, validateBinds func([]Mount) error) error {
+	names := make(map[string]bool)
+	for i, o := range params.Overrides {
+		p := fldPath.Index(i)
+
+		if len(o.Name) == 0 {
+			return field.Required(p.Child("name"), "")
+		}
+		if names[o.Name] {
+			return field.Duplicate(p.Child("name"), o.Name)
+		}
+		names[o.Name] = true
+
+		if o.Selector == nil && len(o.Role) == 0 && o.ControlPlane == nil {
+			return field.Required(p, "one of selector, role, or control_plane is required")
+		}
+		if _, err := metav1.LabelSelectorAsSelector(o.Selector); err != nil {
+			return field.Invalid(p.Child("selector"), o.Selector, err.Error())
+		}
+
+		if err := validateBinds(o.ExtraBinds); err != nil {
+			return err
+		}
+
+		if o.Config == nil {
+			continue
+		}
+		// apiVersion and kind may be omitted as they are taken from the base config
+		// or defaulted by ForNode.
+		cfg := &unstructured.Unstructured{
+			Object: mergeObject(map[string]interface{}{
+				"apiVersion": kubeletv1beta1.SchemeGroupVersion.String(),
+				"kind":       "KubeletConfiguration",
+			}, o.Config.Object),
+		}
+		if _, err := (KubeletParams{Config: cfg}).MergeConfig(&kubeletv1beta1.KubeletConfiguration{}); err != nil {
+			return field.Invalid(p.Child("config"), "", err.Error())
+		}
+		// The cluster domain is shared by all nodes.
+		if _, ok := o.Config.Object["clusterDomain"]; ok {
+			return field.Forbidden(p.Child("config", "clusterDomain"), "cluster domain cannot be overridden")
+		}
+	}
+	return nil
+}
+
+var controllerNameRegexp = regexp.MustCompile(`^-?([a-z0-9][a-z0-9-]*|\*)$`)
+
+func validateControllerManagerConfig(cfg *ControllerManagerConfig) error {
+	for _, c := range cfg.Controllers {
+		if !controllerNameRegexp.MatchString(c) {
+			return errors.New("invalid controller name for kube-controller-manager: " + c)
+		}
+	}
+
+	for name := range cfg.FeatureGates {
+		if len(name) == 0 || strings.ContainsAny(name, ",= ") {
+			return errors.New("invalid feature gate for kube-controller-manager: " + name)
+		}
+	}
+
+	le := cfg.LeaderElection
+	durations := make(map[string]time.Duration)
+	for _, d := range []struct {
+		name  string
+		value string
+	}{
+		{"lease_duration", le.LeaseDuration},
+		{"renew_deadline", le.RenewDeadline},
+		{"retry_period", le.RetryPeriod},
+	} {
+		if len(d.value) == 0 {
+			continue
+		}
+		dur, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid leader_election.%s: %w", d.name, err)
+		}
+		if dur <= 0 {
+			return fmt.Errorf("leader_election.%s should be positive", d.name)
+		}
+		durations[d.name] = dur
+	}
+	lease, renew, retry := durations["lease_duration"], durations["renew_deadline"], durations["retry_period"]
+	if lease != 0 && renew != 0 && renew >= lease {
+		return errors.New("leader_election.renew_deadline should be less than lease_duration")
+	}
+	if renew != 0 && retry != 0 && retry >= renew {
+		return errors.New("leader_election.retry_period should be less than renew_deadline")
+	}
+
+	if cfg.KubeAPIQPS < 0 || cfg.KubeAPIBurst < 0 {
+		return errors.New("kube_api_qps and kube_api_burst should not be negative")
+	}
+
+	for key, n := range cfg.Concurrency {
+		if !controllerManagerConcurrencyKeys[key] {
+			return errors.New("unknown concurrency key for kube-controller-manager: " + key)
+		}
+		if n <= 0 {
+			return fmt.Errorf("concurrency of %s should be positive", key)
+		}
+	}
+
+	return nil
+}
+
+func validateAuditWebhook(params APIServerParams) error {
+	p := params.AuditWebhook
+	if !p.Enabled {
+		return nil
+	}
+
+	if len(params.AuditLogPolicy) == 0 {
+		return errors.New("audit_log_policy should not be empty to enable audit_webhook")
+	}
+
+	u, err := url.Parse(p.Server)
+	if err != nil {
+		return fmt.Errorf("invalid audit_webhook.server: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("audit_webhook.server should be an http or https URL")
+	}
+	if len(u.Host) == 0 {
+		return errors.New("audit_webhook.server should have a host")
+	}
+
+	if len(p.CACert) != 0 {
+		block, _ := pem.Decode([]byte(p.CACert))
+		if block == nil {
+			return errors.New("invalid PEM data in audit_webhook.ca_cert")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid audit_webhook.ca_cert: %w", err)
+		}
+	}
+
+	switch p.ModeName() {
+	case AuditWebhookModeBatch, AuditWebhookModeBlocking, AuditWebhookModeBlockingStrict:
+	default:
+		return errors.New("unknown audit_webhook.mode: " + p.Mode)
+	}
+
+	if p.BatchMaxSize < 0 || p.BatchThrottleBurst < 0 || p.BatchThrottleQPS < 0 {
+		return errors.New("audit_webhook batch parameters should not be negative")
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+	}{
+		{"batch_max_wait", p.BatchMaxWait},
+		{"initial_backoff", p.InitialBackoff},
+	} {
+		if len(d.value) == 0 {
+			continue
+		}
+		dur, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid audit_webhook.%s: %w", d.name, err)
+		}
+		if dur <= 0 {
+			return fmt.Errorf("audit_webhook.%s should be positive", d.name)
+		}
+	}
+
+	return nil
+}
+
+func validateAuthenticationConfig(cfg *apiserverv1.AuthenticationConfiguration, fldPath *field.Path) error {
+	issuers := make(map[string]bool)
+	for i, jwt := range cfg.JWT {
+		p := fldPath.Child("jwt").Index(i)
+
+		u, err := url.Parse(jwt.Issuer.URL)
+		if err != nil {
+			return field.Invalid(p.Child("issuer", "url"), jwt.Issuer.URL, err.Error())
+		}
+		if u.Scheme != "https" {
+			return field.Invalid(p.Child("issuer", "url"), jwt.Issuer.URL, "issuer URL must use https scheme")
+		}
+		if issuers[jwt.Issuer.URL] {
+			return field.Duplicate(p.Child("issuer", "url"), jwt.Issuer.URL)
+		}
+		issuers[jwt.Issuer.URL] = true
+
+		if len(jwt.Issuer.Audiences) == 0 {
+			return field.Required(p.Child("issuer", "audiences"), "")
+		}
+
+		username := jwt.ClaimMappings.Username
+		if (username.Claim == "") == (username.Expression == "") {
+			return field.Invalid(p.Child("claimMappings", "username"), username, "either claim or expression must be set")
+		}
+	}
+	return nil
+}
+
+var podSecurityLevels = []string{"privileged", "baseline", "restricted"}
+
+func validateAdmissionConfig(cfg *apiserverv1.AdmissionConfiguration, fldPath *field.Path) error {
+	fldPath = fldPath.Child("plugins")
+
+	names := make(map[string]bool)
+	for i, plugin := range cfg.Plugins {
+		p := fldPath.Index(i)
+
+		if len(plugin.Name) == 0 {
+			return field.Required(p.Child("name"), "")
+		}
+		if names[plugin.Name] {
+			return field.Duplicate(p.Child("name"), plugin.Name)
+		}
+		names[plugin.Name] = true
+
+		// CKE cannot detect changes of external files.
+		if len(plugin.Path) != 0 {
+			return field.Forbidden(p.Child("path"), "use configuration instead")
+		}
+		if plugin.Configuration == nil {
+			return field.Required(p.Child("configuration"), "")
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(plugin.Configuration.Raw); err != nil {
+			return field.Invalid(p.Child("configuration"), "", err.Error())
+		}
+
+		if plugin.Name != "PodSecurity" {
+			continue
+		}
+		for _, mode := range []string{"enforce", "audit", "warn"} {
+			level, _, _ := unstructured.NestedString(obj.Object, "defaults", mode)
+			if len(level) != 0 && !slices.Contains(podSecurityLevels, level) {
+				return field.NotSupported(p.Child("configuration", "defaults", mode), level, podSecurityLevels)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAuthorizationConfig(cfg *apiserverv1.AuthorizationConfiguration, fldPath *field.Path) error {
+	fldPath = fldPath.Child("authorizers")
+	if len(cfg.Authorizers) == 0 {
+		return field.Required(fldPath, "")
+	}
+
+	names := make(map[string]bool)
+	types := make(map[string]bool)
+	for i, a := range cfg.Authorizers {
+		p := fldPath.Index(i)
+
+		if len(a.Name) == 0 {
+			return field.Required(p.Child("name"), "")
+		}
+		if names[a.Name] {
+			return field.Duplicate(p.Child("name"), a.Name)
+		}
+		names[a.Name] = true
+
+		switch a.Type {
+		case "Node", "RBAC", "AlwaysAllow", "AlwaysDeny":
+			if a.Webhook != nil {
+				return field.Invalid(p.Child("webhook"), "", "webhook is only for Webhook type")
+			}
+		case string(apiserverv1.TypeWebhook):
+			if a.Webhook == nil {
+				return field.Required(p.Child("webhook"), "")
+			}
+		default:
+			return field.NotSupported(p.Child("type"), a.Type, []string{"Node", "RBAC", "Webhook", "AlwaysAllow", "AlwaysDeny"})
+		}
+		types[a.Type] = true
+	}
+
+	// CKE relies on Node and RBAC authorizers for kubelet and system components.
+	if !types["Node"] || !types["RBAC"] {
+		return field.Invalid(fldPath, "", "Node and RBAC authorizers are required")
+	}
+	return nil
+}
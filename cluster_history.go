@@ -0,0 +1,20 @@
+package cke
+
+import (
+	"time"
+)
+
+// Sources of cluster configuration changes
+const (
+	ClusterSourceCKECLI  = "ckecli"
+	ClusterSourceSabakan = "sabakan"
+)
+
+// ClusterHistoryEntry represents a revision of the cluster configuration.
+type ClusterHistoryEntry struct {
+	Revision  int64     `json:"revision,string"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author"`
+	Source    string    `json:"source"`
+	Cluster   *Cluster  `json:"cluster"`
+}
@@ -4,10 +4,12 @@ import (
 	"os"
 	"slices"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -134,6 +136,12 @@ func testClusterYAML(t *testing.T) {
 	if c.Reboot.ProtectedNamespaces.MatchLabels["app"] != "sample" {
 		t.Error(`c.Reboot.ProtectedNamespaces.MatchLabels["app"] != "sample"`)
 	}
+	if !c.CertRenewal.Enabled {
+		t.Error(`!c.CertRenewal.Enabled`)
+	}
+	if c.CertRenewal.Threshold == nil || *c.CertRenewal.Threshold != 0.5 {
+		t.Error(`c.CertRenewal.Threshold != 0.5`)
+	}
 	if len(c.Repair.RepairProcedures) != 1 {
 		t.Fatal(`len(c.Repair.RepairProcedures) != 1`)
 	}
@@ -224,6 +232,12 @@ func testClusterYAML(t *testing.T) {
 	if !cmp.Equal(c.Options.Etcd.ExtraArguments, []string{"arg1", "arg2"}) {
 		t.Error(`!cmp.Equal(c.Options.Etcd.ExtraArguments, []string{"arg1", "arg2"})`)
 	}
+	if c.Options.Etcd.Defrag.FragmentationThreshold != 0.5 {
+		t.Error(`c.Options.Etcd.Defrag.FragmentationThreshold != 0.5`)
+	}
+	if c.Options.Etcd.Defrag.QuotaThreshold != 0.8 {
+		t.Error(`c.Options.Etcd.Defrag.QuotaThreshold != 0.8`)
+	}
 	if !cmp.Equal(c.Options.APIServer.ExtraBinds, []Mount{{"src1", "target1", true, PropagationShared, LabelShared}}) {
 		t.Error(`!cmp.Equal(c.Options.APIServer.ExtraBinds, []Mount{{"src1", "target1", true}})`)
 	}
@@ -237,9 +251,48 @@ rules:
 ` {
 		t.Errorf(`wrong c.Options.APIServer.AuditLogPolicy: %s`, c.Options.APIServer.AuditLogPolicy)
 	}
+	authn, err := c.Options.APIServer.AuthenticationConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authn.JWT) != 1 {
+		t.Fatal(`len(authn.JWT) != 1`)
+	}
+	if authn.JWT[0].Issuer.URL != "https://issuer.example.com" {
+		t.Error(`authn.JWT[0].Issuer.URL != "https://issuer.example.com"`, authn.JWT[0].Issuer.URL)
+	}
+	if authn.JWT[0].ClaimMappings.Username.Claim != "sub" {
+		t.Error(`authn.JWT[0].ClaimMappings.Username.Claim != "sub"`, authn.JWT[0].ClaimMappings.Username.Claim)
+	}
+	authz, err := c.Options.APIServer.AuthorizationConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authz.Authorizers) != 2 {
+		t.Error(`len(authz.Authorizers) != 2`, len(authz.Authorizers))
+	}
+	admission, err := c.Options.APIServer.AdmissionConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(admission.Plugins) != 1 {
+		t.Fatal(`len(admission.Plugins) != 1`, len(admission.Plugins))
+	}
+	if admission.Plugins[0].Name != "PodSecurity" {
+		t.Error(`admission.Plugins[0].Name != "PodSecurity"`, admission.Plugins[0].Name)
+	}
 	if c.Options.ControllerManager.ExtraEnvvar["env1"] != "val1" {
 		t.Error(`c.Options.ControllerManager.ExtraEnvvar["env1"] != "val1"`)
 	}
+	if c.Options.ControllerManager.Config == nil {
+		t.Fatal(`c.Options.ControllerManager.Config == nil`)
+	}
+	if !c.Options.ControllerManager.Config.FeatureGates["Foo"] {
+		t.Error(`!c.Options.ControllerManager.Config.FeatureGates["Foo"]`)
+	}
+	if c.Options.ControllerManager.Config.Concurrency["deployment"] != 10 {
+		t.Error(`c.Options.ControllerManager.Config.Concurrency["deployment"] != 10`)
+	}
 	kubeSchedulerConfig, err := c.Options.Scheduler.MergeConfig(&schedulerv1.KubeSchedulerConfiguration{
 		Parallelism: ptr.To(int32(999)),
 	})
@@ -547,6 +600,199 @@ rules:
 			},
 			true,
 		},
+		{
+			"valid kubelet overrides",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name:     "gpu",
+								Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"gpu": "true"}},
+								ServiceParams: ServiceParams{
+									ExtraArguments: []string{"--v=2"},
+								},
+								Config: &unstructured.Unstructured{
+									Object: map[string]interface{}{
+										"apiVersion": "kubelet.config.k8s.io/v1beta1",
+										"kind":       "KubeletConfiguration",
+										"maxPods":    200,
+									},
+								},
+							},
+							{
+								Name: "ss",
+								Role: "ss",
+								Config: &unstructured.Unstructured{
+									Object: map[string]interface{}{
+										"maxPods": 50,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"kubelet override without name",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Role: "ss",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"duplicate kubelet override names",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name: "ss",
+								Role: "ss",
+							},
+							{
+								Name:         "ss",
+								ControlPlane: ptr.To(true),
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"kubelet override without selection",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name: "all",
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid kubelet override selector",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name: "invalid",
+								Selector: &metav1.LabelSelector{
+									MatchExpressions: []metav1.LabelSelectorRequirement{
+										{Key: "gpu", Operator: "Foo"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid kubelet override config",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name: "ss",
+								Role: "ss",
+								Config: &unstructured.Unstructured{
+									Object: map[string]interface{}{
+										"kind":    "KubeProxyConfiguration",
+										"maxPods": 200,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"kubelet override for cluster domain",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name: "ss",
+								Role: "ss",
+								Config: &unstructured.Unstructured{
+									Object: map[string]interface{}{
+										"apiVersion":    "kubelet.config.k8s.io/v1beta1",
+										"kind":          "KubeletConfiguration",
+										"clusterDomain": "example.com",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid kubelet override binds",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+						Overrides: []KubeletOverride{
+							{
+								Name: "ss",
+								Role: "ss",
+								ServiceParams: ServiceParams{
+									ExtraBinds: []Mount{{Source: "src", Destination: "/dst"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			true,
+		},
 		{
 			"invalid cri_endpoint",
 			Cluster{
@@ -761,84 +1007,793 @@ rules:
 			},
 			false,
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			c := tt.cluster
-			if err := c.Validate(false); (err != nil) != tt.wantErr {
-				t.Errorf("Cluster.Validate(false) error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func testClusterValidateNode(t *testing.T) {
-	t.Parallel()
-
-	tests := []struct {
-		name    string
-		node    Node
-		isTmpl  bool
-		wantErr bool
-	}{
-		{
-			name: "valid case",
-			node: Node{
-				Address:     "10.0.0.1",
-				User:        "testuser",
-				Labels:      map[string]string{"cybozu.com/foo": "bar"},
-				Annotations: map[string]string{"cybozu.com/fo_o": "こんにちは"},
-				Taints: []corev1.Taint{{
-					Key:    "cybozu.com/f_oo",
-					Value:  "bar",
-					Effect: "NoExecute",
-				}},
-			},
-			isTmpl:  false,
-			wantErr: false,
-		},
 		{
-			name: "invalid address",
-			node: Node{
-				Address: "10000",
-				User:    "testuser",
+			"invalid etcd defrag threshold",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					Etcd: EtcdParams{
+						Defrag: EtcdDefragParams{FragmentationThreshold: 1.5},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
 			},
-			isTmpl:  false,
-			wantErr: true,
+			true,
 		},
 		{
-			name: "no user",
-			node: Node{
-				Address: "10.0.0.1",
+			"valid kms encryption",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{
+							Provider:  "kms",
+							KMSPlugin: KMSPluginParams{Image: "kms-plugin:1.0.0"},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
 			},
-			isTmpl:  false,
-			wantErr: true,
+			false,
 		},
 		{
-			name: "bad label name",
-			node: Node{
-				Address: "10.0.0.1",
-				User:    "testuser",
-				Labels:  map[string]string{"a_b/c": "hello"},
+			"kms encryption without image",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{Provider: "kms"},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
 			},
-			isTmpl:  false,
-			wantErr: true,
+			true,
 		},
 		{
-			name: "bad label value",
-			node: Node{
-				Address: "10.0.0.1",
-				User:    "testuser",
-				Labels:  map[string]string{"a_b/c": "こんにちは"},
+			"valid controller manager config",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &ControllerManagerConfig{
+							Controllers:  []string{"*", "-bootstrapsigner"},
+							FeatureGates: map[string]bool{"Foo": true},
+							LeaderElection: ControllerManagerLeaderElection{
+								LeaseDuration: "30s",
+								RenewDeadline: "20s",
+								RetryPeriod:   "5s",
+							},
+							Concurrency: map[string]int{"deployment": 10},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
 			},
-			isTmpl:  false,
-			wantErr: true,
+			false,
 		},
 		{
-			name: "bad annotation",
-			node: Node{
-				Address:     "10.0.0.1",
-				User:        "testuser",
+			"invalid controller name",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &ControllerManagerConfig{
+							Controllers: []string{"Foo Bar"},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid feature gate",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &ControllerManagerConfig{
+							FeatureGates: map[string]bool{"Foo=true": true},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid leader election durations",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &ControllerManagerConfig{
+							LeaderElection: ControllerManagerLeaderElection{
+								LeaseDuration: "10s",
+								RenewDeadline: "20s",
+							},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"unknown concurrency key",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &ControllerManagerConfig{
+							Concurrency: map[string]int{"foo": 10},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"non-positive concurrency",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					ControllerManager: ControllerManagerParams{
+						Config: &ControllerManagerConfig{
+							Concurrency: map[string]int{"deployment": 0},
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid audit webhook",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogPolicy: "apiVersion: audit.k8s.io/v1\nkind: Policy\n",
+						AuditWebhook: AuditWebhookParams{
+							Enabled:        true,
+							Server:         "https://audit.example.com/events",
+							Mode:           "batch",
+							BatchMaxSize:   100,
+							BatchMaxWait:   "5s",
+							InitialBackoff: "1s",
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"audit webhook without policy",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditWebhook: AuditWebhookParams{
+							Enabled: true,
+							Server:  "https://audit.example.com/events",
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook with invalid server",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogPolicy: "apiVersion: audit.k8s.io/v1\nkind: Policy\n",
+						AuditWebhook: AuditWebhookParams{
+							Enabled: true,
+							Server:  "audit.example.com",
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook with invalid mode",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogPolicy: "apiVersion: audit.k8s.io/v1\nkind: Policy\n",
+						AuditWebhook: AuditWebhookParams{
+							Enabled: true,
+							Server:  "https://audit.example.com/events",
+							Mode:    "async",
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook with invalid duration",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogPolicy: "apiVersion: audit.k8s.io/v1\nkind: Policy\n",
+						AuditWebhook: AuditWebhookParams{
+							Enabled:      true,
+							Server:       "https://audit.example.com/events",
+							BatchMaxWait: "5",
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"audit webhook with invalid CA",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						AuditLogPolicy: "apiVersion: audit.k8s.io/v1\nkind: Policy\n",
+						AuditWebhook: AuditWebhookParams{
+							Enabled: true,
+							Server:  "https://audit.example.com/events",
+							CACert:  "invalid",
+						},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid authentication",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Authentication: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthenticationConfiguration",
+							"jwt": []interface{}{
+								map[string]interface{}{
+									"issuer": map[string]interface{}{
+										"url":       "https://issuer.example.com",
+										"audiences": []interface{}{"kubernetes"},
+									},
+									"claimMappings": map[string]interface{}{
+										"username": map[string]interface{}{"claim": "sub"},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"authentication with http issuer",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Authentication: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthenticationConfiguration",
+							"jwt": []interface{}{
+								map[string]interface{}{
+									"issuer": map[string]interface{}{
+										"url":       "http://issuer.example.com",
+										"audiences": []interface{}{"kubernetes"},
+									},
+									"claimMappings": map[string]interface{}{
+										"username": map[string]interface{}{"claim": "sub"},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"authentication without username claim",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Authentication: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthenticationConfiguration",
+							"jwt": []interface{}{
+								map[string]interface{}{
+									"issuer": map[string]interface{}{
+										"url":       "https://issuer.example.com",
+										"audiences": []interface{}{"kubernetes"},
+									},
+									"claimMappings": map[string]interface{}{
+										"username": map[string]interface{}{"claim": ""},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid authorization",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Authorization: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthorizationConfiguration",
+							"authorizers": []interface{}{
+								map[string]interface{}{"type": "Node", "name": "node"},
+								map[string]interface{}{"type": "RBAC", "name": "rbac"},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"authorization without RBAC",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Authorization: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthorizationConfiguration",
+							"authorizers": []interface{}{
+								map[string]interface{}{"type": "Node", "name": "node"},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"authorization with wrong kind",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Authorization: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthenticationConfiguration",
+							"authorizers": []interface{}{
+								map[string]interface{}{"type": "Node", "name": "node"},
+								map[string]interface{}{"type": "RBAC", "name": "rbac"},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid admission",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AdmissionConfiguration",
+							"plugins": []interface{}{
+								map[string]interface{}{
+									"name": "PodSecurity",
+									"configuration": map[string]interface{}{
+										"apiVersion": "pod-security.admission.config.k8s.io/v1",
+										"kind":       "PodSecurityConfiguration",
+										"defaults":   map[string]interface{}{"enforce": "baseline"},
+									},
+								},
+								map[string]interface{}{
+									"name": "EventRateLimit",
+									"configuration": map[string]interface{}{
+										"apiVersion": "eventratelimit.admission.k8s.io/v1alpha1",
+										"kind":       "Configuration",
+										"limits": []interface{}{
+											map[string]interface{}{"type": "Server", "qps": 50, "burst": 100},
+										},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"admission with invalid PodSecurity level",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AdmissionConfiguration",
+							"plugins": []interface{}{
+								map[string]interface{}{
+									"name": "PodSecurity",
+									"configuration": map[string]interface{}{
+										"apiVersion": "pod-security.admission.config.k8s.io/v1",
+										"kind":       "PodSecurityConfiguration",
+										"defaults":   map[string]interface{}{"enforce": "strict"},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission with duplicate plugins",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AdmissionConfiguration",
+							"plugins": []interface{}{
+								map[string]interface{}{
+									"name": "PodSecurity",
+									"configuration": map[string]interface{}{
+										"apiVersion": "pod-security.admission.config.k8s.io/v1",
+										"kind":       "PodSecurityConfiguration",
+										"defaults":   map[string]interface{}{"enforce": "baseline"},
+									},
+								},
+								map[string]interface{}{
+									"name": "PodSecurity",
+									"configuration": map[string]interface{}{
+										"apiVersion": "pod-security.admission.config.k8s.io/v1",
+										"kind":       "PodSecurityConfiguration",
+										"defaults":   map[string]interface{}{"enforce": "restricted"},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission with external file",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AdmissionConfiguration",
+							"plugins": []interface{}{
+								map[string]interface{}{
+									"name": "EventRateLimit",
+									"path": "/etc/kubernetes/eventratelimit.yaml",
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission without configuration kind",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AdmissionConfiguration",
+							"plugins": []interface{}{
+								map[string]interface{}{
+									"name":          "EventRateLimit",
+									"configuration": map[string]interface{}{"limits": []interface{}{}},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"admission with wrong kind",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Admission: &unstructured.Unstructured{Object: map[string]interface{}{
+							"apiVersion": "apiserver.config.k8s.io/v1",
+							"kind":       "AuthorizationConfiguration",
+							"plugins": []interface{}{
+								map[string]interface{}{
+									"name": "PodSecurity",
+									"configuration": map[string]interface{}{
+										"apiVersion": "pod-security.admission.config.k8s.io/v1",
+										"kind":       "PodSecurityConfiguration",
+										"defaults":   map[string]interface{}{"enforce": "baseline"},
+									},
+								},
+							},
+						}},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid encryption provider",
+			Cluster{
+				Name:          "testcluster",
+				ServiceSubnet: "10.0.0.0/14",
+				Options: Options{
+					APIServer: APIServerParams{
+						Encryption: EncryptionParams{Provider: "secretbox"},
+					},
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"valid container engine",
+			Cluster{
+				Name:            "testcluster",
+				ServiceSubnet:   "10.0.0.0/14",
+				ContainerEngine: "containerd",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"static pod control plane",
+			Cluster{
+				Name:             "testcluster",
+				ServiceSubnet:    "10.0.0.0/14",
+				ControlPlaneMode: "static-pod",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"invalid control plane mode",
+			Cluster{
+				Name:             "testcluster",
+				ServiceSubnet:    "10.0.0.0/14",
+				ControlPlaneMode: "systemd",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"invalid container engine",
+			Cluster{
+				Name:            "testcluster",
+				ServiceSubnet:   "10.0.0.0/14",
+				ContainerEngine: "podman",
+				Options: Options{
+					Kubelet: KubeletParams{
+						CRIEndpoint: "/var/run/k8s-containerd.sock",
+					},
+				},
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cluster
+			if err := c.Validate(false); (err != nil) != tt.wantErr {
+				t.Errorf("Cluster.Validate(false) error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func testClusterValidateNode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		node    Node
+		isTmpl  bool
+		wantErr bool
+	}{
+		{
+			name: "valid case",
+			node: Node{
+				Address:     "10.0.0.1",
+				User:        "testuser",
+				Labels:      map[string]string{"cybozu.com/foo": "bar"},
+				Annotations: map[string]string{"cybozu.com/fo_o": "こんにちは"},
+				Taints: []corev1.Taint{{
+					Key:    "cybozu.com/f_oo",
+					Value:  "bar",
+					Effect: "NoExecute",
+				}},
+			},
+			isTmpl:  false,
+			wantErr: false,
+		},
+		{
+			name: "invalid address",
+			node: Node{
+				Address: "10000",
+				User:    "testuser",
+			},
+			isTmpl:  false,
+			wantErr: true,
+		},
+		{
+			name: "no user",
+			node: Node{
+				Address: "10.0.0.1",
+			},
+			isTmpl:  false,
+			wantErr: true,
+		},
+		{
+			name: "bad label name",
+			node: Node{
+				Address: "10.0.0.1",
+				User:    "testuser",
+				Labels:  map[string]string{"a_b/c": "hello"},
+			},
+			isTmpl:  false,
+			wantErr: true,
+		},
+		{
+			name: "bad label value",
+			node: Node{
+				Address: "10.0.0.1",
+				User:    "testuser",
+				Labels:  map[string]string{"a_b/c": "こんにちは"},
+			},
+			isTmpl:  false,
+			wantErr: true,
+		},
+		{
+			name: "bad annotation",
+			node: Node{
+				Address:     "10.0.0.1",
+				User:        "testuser",
 				Annotations: map[string]string{"a.b/c_": "hello"},
 			},
 			isTmpl:  false,
@@ -1019,6 +1974,118 @@ func testClusterValidateReboot(t *testing.T) {
 	}
 }
 
+func testClusterValidateCertRenewal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		renewal CertRenewal
+		wantErr bool
+	}{
+		{
+			name:    "valid case",
+			renewal: CertRenewal{Enabled: true},
+			wantErr: false,
+		},
+		{
+			name:    "valid threshold",
+			renewal: CertRenewal{Enabled: true, Threshold: ptr.To(0.5)},
+			wantErr: false,
+		},
+		{
+			name:    "zero threshold",
+			renewal: CertRenewal{Threshold: ptr.To(0.0)},
+			wantErr: true,
+		},
+		{
+			name:    "threshold is one",
+			renewal: CertRenewal{Threshold: ptr.To(1.0)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCertRenewal(tt.renewal); (err != nil) != tt.wantErr {
+				t.Errorf("validateCertRenewal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func testCertRenewalNeedsRenewal(t *testing.T) {
+	t.Parallel()
+
+	notBefore := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(100 * time.Hour)
+	cert := CertificateStatus{NotBefore: notBefore, NotAfter: notAfter}
+
+	tests := []struct {
+		name    string
+		renewal CertRenewal
+		status  CertificateStatus
+		now     time.Time
+		want    bool
+	}{
+		{
+			"disabled",
+			CertRenewal{},
+			cert,
+			notAfter,
+			false,
+		},
+		{
+			"unknown",
+			CertRenewal{Enabled: true},
+			CertificateStatus{},
+			notAfter,
+			false,
+		},
+		{
+			"before default threshold",
+			CertRenewal{Enabled: true},
+			cert,
+			notBefore.Add(69 * time.Hour),
+			false,
+		},
+		{
+			"after default threshold",
+			CertRenewal{Enabled: true},
+			cert,
+			notBefore.Add(70 * time.Hour),
+			true,
+		},
+		{
+			"before threshold",
+			CertRenewal{Enabled: true, Threshold: ptr.To(0.5)},
+			cert,
+			notBefore.Add(49 * time.Hour),
+			false,
+		},
+		{
+			"after threshold",
+			CertRenewal{Enabled: true, Threshold: ptr.To(0.5)},
+			cert,
+			notBefore.Add(50 * time.Hour),
+			true,
+		},
+		{
+			"expired",
+			CertRenewal{Enabled: true},
+			cert,
+			notAfter.Add(time.Hour),
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.renewal.NeedsRenewal(tt.status, tt.now); got != tt.want {
+				t.Errorf("CertRenewal.NeedsRenewal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func testValidateTrustedRESTMappings(t *testing.T) {
 	t.Parallel()
 
@@ -1175,12 +2242,208 @@ func testLookupTrustedRESTMapping(t *testing.T) {
 	})
 }
 
+func testEtcdNeedsDefrag(t *testing.T) {
+	t.Parallel()
+
+	const mib = 1 << 20
+	tests := []struct {
+		name   string
+		params EtcdParams
+		status *EtcdMemberStatus
+		want   bool
+	}{
+		{
+			"disabled",
+			EtcdParams{},
+			&EtcdMemberStatus{DBSize: 100 * mib, DBSizeInUse: 10 * mib},
+			false,
+		},
+		{
+			"no status",
+			EtcdParams{Defrag: EtcdDefragParams{FragmentationThreshold: 0.5}},
+			nil,
+			false,
+		},
+		{
+			"fragmented",
+			EtcdParams{Defrag: EtcdDefragParams{FragmentationThreshold: 0.5}},
+			&EtcdMemberStatus{DBSize: 100 * mib, DBSizeInUse: 40 * mib},
+			true,
+		},
+		{
+			"not fragmented",
+			EtcdParams{Defrag: EtcdDefragParams{FragmentationThreshold: 0.5}},
+			&EtcdMemberStatus{DBSize: 100 * mib, DBSizeInUse: 60 * mib},
+			false,
+		},
+		{
+			"near quota",
+			EtcdParams{
+				ServiceParams: ServiceParams{ExtraArguments: []string{"--quota-backend-bytes=209715200"}},
+				Defrag:        EtcdDefragParams{QuotaThreshold: 0.5},
+			},
+			&EtcdMemberStatus{DBSize: 120 * mib, DBSizeInUse: 90 * mib},
+			true,
+		},
+		{
+			"near quota but in use",
+			EtcdParams{
+				ServiceParams: ServiceParams{ExtraArguments: []string{"--quota-backend-bytes=209715200"}},
+				Defrag:        EtcdDefragParams{QuotaThreshold: 0.5},
+			},
+			&EtcdMemberStatus{DBSize: 120 * mib, DBSizeInUse: 110 * mib},
+			false,
+		},
+		{
+			"default quota",
+			EtcdParams{Defrag: EtcdDefragParams{QuotaThreshold: 0.5}},
+			&EtcdMemberStatus{DBSize: 120 * mib, DBSizeInUse: 90 * mib},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.NeedsDefrag(tt.status); got != tt.want {
+				t.Errorf("EtcdParams.NeedsDefrag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testKubeletParamsForNode(t *testing.T) {
+	t.Parallel()
+
+	params := KubeletParams{
+		ServiceParams: ServiceParams{
+			ExtraArguments: []string{"--v=1"},
+			ExtraEnvvar:    map[string]string{"FOO": "foo"},
+		},
+		Config: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "kubelet.config.k8s.io/v1beta1",
+				"kind":       "KubeletConfiguration",
+				"maxPods":    int64(100),
+				"evictionHard": map[string]interface{}{
+					"memory.available": "100Mi",
+					"nodefs.available": "10%",
+				},
+			},
+		},
+		Overrides: []KubeletOverride{
+			{
+				Name:     "gpu",
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"gpu": "true"}},
+				ServiceParams: ServiceParams{
+					ExtraArguments: []string{"--v=2"},
+					ExtraEnvvar:    map[string]string{"BAR": "bar"},
+				},
+				Config: &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"maxPods": int64(200),
+						"evictionHard": map[string]interface{}{
+							"memory.available": "1Gi",
+						},
+					},
+				},
+			},
+			{
+				Name:         "ss",
+				Role:         "ss",
+				ControlPlane: ptr.To(false),
+				Config: &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"maxPods": int64(50),
+					},
+				},
+			},
+		},
+	}
+
+	got := params.ForNode(&Node{Address: "10.0.0.1"})
+	if got.Overrides != nil {
+		t.Error("overrides should be cleared")
+	}
+	if !cmp.Equal(got.ServiceParams, params.ServiceParams) {
+		t.Error("unexpected service params for unmatched node", cmp.Diff(got.ServiceParams, params.ServiceParams))
+	}
+	if !cmp.Equal(got.Config, params.Config) {
+		t.Error("unexpected config for unmatched node", cmp.Diff(got.Config, params.Config))
+	}
+
+	got = params.ForNode(&Node{Address: "10.0.0.2", Labels: map[string]string{"gpu": "true"}})
+	expectedParams := ServiceParams{
+		ExtraArguments: []string{"--v=1", "--v=2"},
+		ExtraEnvvar:    map[string]string{"FOO": "foo", "BAR": "bar"},
+	}
+	if !cmp.Equal(got.ServiceParams, expectedParams) {
+		t.Error("unexpected service params for gpu node", cmp.Diff(got.ServiceParams, expectedParams))
+	}
+	expectedConfig := map[string]interface{}{
+		"apiVersion": "kubelet.config.k8s.io/v1beta1",
+		"kind":       "KubeletConfiguration",
+		"maxPods":    int64(200),
+		"evictionHard": map[string]interface{}{
+			"memory.available": "1Gi",
+			"nodefs.available": "10%",
+		},
+	}
+	if !cmp.Equal(got.Config.Object, expectedConfig) {
+		t.Error("unexpected config for gpu node", cmp.Diff(got.Config.Object, expectedConfig))
+	}
+
+	// the base parameters must not be modified.
+	if params.Config.Object["maxPods"] != int64(100) || len(params.ExtraArguments) != 1 || len(params.ExtraEnvvar) != 1 {
+		t.Error("base parameters are modified")
+	}
+
+	// overrides are applied in order.
+	got = params.ForNode(&Node{Address: "10.0.0.3", Labels: map[string]string{"gpu": "true", "cke.cybozu.com/role": "ss"}})
+	if got.Config.Object["maxPods"] != int64(50) {
+		t.Error("later override should win", got.Config.Object["maxPods"])
+	}
+
+	got = params.ForNode(&Node{Address: "10.0.0.4", ControlPlane: true, Labels: map[string]string{"cke.cybozu.com/role": "ss"}})
+	if got.Config.Object["maxPods"] != int64(100) {
+		t.Error("control plane node should not be selected", got.Config.Object["maxPods"])
+	}
+}
+
+func testEffectiveKubeletParams(t *testing.T) {
+	t.Parallel()
+
+	c := &Cluster{
+		Options: Options{
+			Kubelet: KubeletParams{
+				Overrides: []KubeletOverride{{Name: "foo"}},
+			},
+		},
+	}
+	got := c.EffectiveKubeletParams()
+	if len(got.Overrides) != 1 {
+		t.Error("overrides should not be added", got.Overrides)
+	}
+
+	c.ControlPlaneMode = ControlPlaneModeStaticPod
+	got = c.EffectiveKubeletParams().ForNode(&Node{Address: "10.0.0.1"})
+	if got.Config == nil || got.Config.Object["staticPodPath"] != StaticPodManifestDir {
+		t.Error("staticPodPath should be set", got.Config)
+	}
+	if len(c.Options.Kubelet.Overrides) != 1 {
+		t.Error("the cluster must not be modified")
+	}
+}
+
 func TestCluster(t *testing.T) {
 	t.Run("YAML", testClusterYAML)
 	t.Run("Validate", testClusterValidate)
 	t.Run("ValidateNode", testClusterValidateNode)
 	t.Run("Nodename", testNodename)
 	t.Run("ValidateReboot", testClusterValidateReboot)
+	t.Run("ValidateCertRenewal", testClusterValidateCertRenewal)
 	t.Run("ValidateTrustedRESTMappings", testValidateTrustedRESTMappings)
 	t.Run("LookupTrustedRESTMapping", testLookupTrustedRESTMapping)
+	t.Run("EtcdNeedsDefrag", testEtcdNeedsDefrag)
+	t.Run("CertRenewalNeedsRenewal", testCertRenewalNeedsRenewal)
+	t.Run("KubeletParamsForNode", testKubeletParamsForNode)
+	t.Run("EffectiveKubeletParams", testEffectiveKubeletParams)
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 
@@ -20,12 +21,16 @@ const (
 
 // ContainerEngine defines interfaces for a container engine.
 type ContainerEngine interface {
+	// Name returns the name of the container engine such as ContainerEngineDocker.
+	Name() string
 	// PullImage pulls an image.
 	PullImage(img Image) error
 	// Run runs a container as a foreground process.
 	Run(img Image, binds []Mount, command string, args ...string) error
 	// RunWithInput runs a container as a foreground process with stdin as a string.
 	RunWithInput(img Image, binds []Mount, command, input string, args ...string) error
+	// RunWithReader runs a container as a foreground process with stdin streamed from input.
+	RunWithReader(img Image, binds []Mount, command string, input io.Reader, args ...string) error
 	/// RunWithOutput runs a container as a foreground process and get stdout and stderr.
 	RunWithOutput(img Image, binds []Mount, command string, args ...string) ([]byte, []byte, error)
 	// RunSystem runs the named container as a system service.
@@ -62,6 +67,10 @@ type docker struct {
 	agent Agent
 }
 
+func (c docker) Name() string {
+	return ContainerEngineDocker
+}
+
 func (c docker) PullImage(img Image) error {
 	stdout, stderr, err := c.agent.Run("docker image list --format '{{.Repository}}:{{.Tag}}'")
 	if err != nil {
@@ -106,6 +115,18 @@ func (c docker) Run(img Image, binds []Mount, command string, args ...string) er
 }
 
 func (c docker) RunWithInput(img Image, binds []Mount, command, input string, args ...string) error {
+	return c.agent.RunWithInput(c.runWithInputCommand(img, binds, command, args), input)
+}
+
+func (c docker) RunWithReader(img Image, binds []Mount, command string, input io.Reader, args ...string) error {
+	_, stderr, err := c.agent.RunWithReader(c.runWithInputCommand(img, binds, command, args), input, DefaultRunTimeout)
+	if err != nil {
+		return fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+	return nil
+}
+
+func (c docker) runWithInputCommand(img Image, binds []Mount, command string, args []string) string {
 	runArgs := []string{
 		"docker",
 		"run",
@@ -125,8 +146,7 @@ func (c docker) RunWithInput(img Image, binds []Mount, command, input string, ar
 	}
 	runArgs = append(runArgs, img.Name(), command)
 	runArgs = append(runArgs, args...)
-
-	return c.agent.RunWithInput(strings.Join(runArgs, " "), input)
+	return strings.Join(runArgs, " ")
 }
 
 func (c docker) RunWithOutput(img Image, binds []Mount, command string, args ...string) ([]byte, []byte, error) {
@@ -0,0 +1,671 @@
+package cke
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	containerdapi "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/transfer/image"
+	"github.com/containerd/containerd/v2/core/transfer/registry"
+	"github.com/containerd/containerd/v2/defaults"
+	"github.com/containerd/containerd/v2/pkg/cio"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/containerd/containerd/v2/pkg/oci"
+	"github.com/containerd/containerd/v2/plugins"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Names of container engines for system containers.
+const (
+	ContainerEngineDocker     = "docker"
+	ContainerEngineContainerd = "containerd"
+)
+
+const (
+	// ContainerdNamespace is the containerd namespace for system containers.
+	// This is separated from the namespace of kubelet so that kubelet does not
+	// garbage collect system containers.
+	ContainerdNamespace = "cke"
+
+	// ContainerdSocket is the path of the socket of containerd on nodes.
+	ContainerdSocket = "/run/containerd/containerd.sock"
+
+	// ContainerdVolumeDir is the directory to hold volumes for containerd.
+	// containerd has no volumes, so they are emulated by bind mounted directories.
+	ContainerdVolumeDir = "/var/lib/cke/volumes"
+
+	containerdStopTimeout = 10 * time.Second
+)
+
+// ContainerdVolumePath returns the path of the directory for the named volume.
+func ContainerdVolumePath(name string) string {
+	return filepath.Join(ContainerdVolumeDir, name)
+}
+
+// Containerd is an implementation of ContainerEngine that uses the API of
+// containerd through ContainerdSocket forwarded by the agent.
+func Containerd(agent Agent) ContainerEngine {
+	return containerd{agent}
+}
+
+type containerd struct {
+	agent Agent
+}
+
+// do connects to containerd on the node and calls f with a client for ContainerdNamespace.
+// The connection is closed when f returns.
+func (c containerd) do(f func(ctx context.Context, cl *containerdapi.Client) error) error {
+	conn, err := grpc.NewClient("passthrough:///containerd",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return c.agent.DialUnix(ctx, ContainerdSocket)
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	cl, err := containerdapi.NewWithConn(conn, containerdapi.WithDefaultNamespace(ContainerdNamespace))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer cl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRunTimeout)
+	defer cancel()
+	return f(namespaces.WithNamespace(ctx, ContainerdNamespace), cl)
+}
+
+func (c containerd) Name() string {
+	return ContainerEngineContainerd
+}
+
+// containerdPlatform returns the platform of the node.
+func containerdPlatform(ctx context.Context, cl *containerdapi.Client) (ocispec.Platform, error) {
+	filter := fmt.Sprintf("type==%s, id==%s", plugins.SnapshotPlugin, defaults.DefaultSnapshotter)
+	resp, err := cl.IntrospectionService().Plugins(ctx, filter)
+	if err != nil {
+		return ocispec.Platform{}, err
+	}
+	if len(resp.Plugins) == 0 || len(resp.Plugins[0].Platforms) == 0 {
+		return ocispec.Platform{}, errors.New("no platform for snapshotter " + defaults.DefaultSnapshotter)
+	}
+	p := resp.Plugins[0].Platforms[0]
+	return ocispec.Platform{OS: p.OS, Architecture: p.Architecture, Variant: p.Variant}, nil
+}
+
+// containerdImage returns the image for the platform of the node.
+func containerdImage(ctx context.Context, cl *containerdapi.Client, img Image) (containerdapi.Image, error) {
+	i, err := cl.ImageService().Get(ctx, img.Name())
+	if err != nil {
+		return nil, err
+	}
+	p, err := containerdPlatform(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+	return containerdapi.NewImageWithPlatform(cl, i, platforms.Only(p)), nil
+}
+
+func (c containerd) PullImage(img Image) error {
+	return c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		_, err := cl.ImageService().Get(ctx, img.Name())
+		if err == nil {
+			return nil
+		}
+		if !errdefs.IsNotFound(err) {
+			return err
+		}
+
+		// The image is pulled and unpacked by containerd on the node.
+		p, err := containerdPlatform(ctx, cl)
+		if err != nil {
+			return err
+		}
+		src, err := registry.NewOCIRegistry(ctx, img.Name())
+		if err != nil {
+			return err
+		}
+		dst := image.NewStore(img.Name(), image.WithUnpack(p, ""))
+		err = cl.Transfer(ctx, src, dst)
+		if err != nil {
+			return fmt.Errorf("failed to pull %s: %w", img.Name(), err)
+		}
+		return nil
+	})
+}
+
+// containerdBind returns the mount for a bind mount.
+func containerdBind(m Mount) specs.Mount {
+	opts := []string{"rbind"}
+	if m.ReadOnly {
+		opts = append(opts, "ro")
+	} else {
+		opts = append(opts, "rw")
+	}
+	if len(m.Propagation) > 0 {
+		opts = append(opts, m.Propagation.String())
+	}
+	return specs.Mount{
+		Type:        "bind",
+		Source:      m.Source,
+		Destination: m.Destination,
+		Options:     opts,
+	}
+}
+
+// containerdTmpfs returns the mount for a tmpfs.
+func containerdTmpfs(dst string) specs.Mount {
+	return specs.Mount{
+		Type:        "tmpfs",
+		Source:      "tmpfs",
+		Destination: dst,
+		Options:     []string{"nosuid", "nodev"},
+	}
+}
+
+// containerdOptions is the translation of docker options given to RunSystem.
+type containerdOptions struct {
+	hostPID    bool
+	privileged bool
+	mounts     []specs.Mount
+}
+
+// containerdOpts translates docker options given to RunSystem.
+func containerdOpts(opts []string) (*containerdOptions, error) {
+	ret := &containerdOptions{}
+	for i := 0; i < len(opts); i++ {
+		o := opts[i]
+		switch {
+		case o == "--pid=host":
+			ret.hostPID = true
+		case o == "--privileged":
+			ret.privileged = true
+		case strings.HasPrefix(o, "--tmpfs="):
+			ret.mounts = append(ret.mounts, containerdTmpfs(strings.TrimPrefix(o, "--tmpfs=")))
+		case o == "--mount":
+			if i+1 >= len(opts) {
+				return nil, errors.New("no value for --mount")
+			}
+			i++
+			m, err := containerdMount(opts[i])
+			if err != nil {
+				return nil, err
+			}
+			ret.mounts = append(ret.mounts, m)
+		default:
+			return nil, errors.New("unsupported option for containerd: " + o)
+		}
+	}
+	return ret, nil
+}
+
+// containerdMount translates the value of docker --mount option.
+// Volumes are translated into bind mounts of the directories for them.
+func containerdMount(value string) (specs.Mount, error) {
+	fields := make(map[string]string)
+	for _, f := range strings.Split(value, ",") {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return specs.Mount{}, errors.New("invalid mount: " + value)
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	switch fields["type"] {
+	case "tmpfs":
+		return containerdTmpfs(fields["dst"]), nil
+	case "volume":
+		return containerdBind(Mount{Source: ContainerdVolumePath(fields["src"]), Destination: fields["dst"]}), nil
+	}
+	return specs.Mount{}, errors.New("unsupported mount for containerd: " + value)
+}
+
+func (o *containerdOptions) specOpts() []oci.SpecOpts {
+	ret := []oci.SpecOpts{oci.WithMounts(o.mounts)}
+	if o.hostPID {
+		ret = append(ret, oci.WithHostNamespace(specs.PIDNamespace))
+	}
+	if o.privileged {
+		// oci.WithPrivileged and oci.WithHostDevices cannot be used because
+		// they read the capabilities and the devices of CKE, not of the node.
+		ret = append(ret,
+			oci.WithAllKnownCapabilities,
+			oci.WithMaskedPaths(nil),
+			oci.WithReadonlyPaths(nil),
+			oci.WithWriteableSysfs,
+			oci.WithWriteableCgroupfs,
+			oci.WithSelinuxLabel(""),
+			oci.WithApparmorProfile(""),
+			oci.WithSeccompUnconfined,
+			oci.WithAllDevicesAllowed,
+			oci.WithMounts([]specs.Mount{containerdBind(Mount{Source: "/dev", Destination: "/dev"})}),
+		)
+	}
+	return ret
+}
+
+// newContainer creates a container that runs args in the same way as docker.
+// That is, args replace the CMD of the image, and the container uses
+// the network and UTS namespaces of the host with the read-only root filesystem.
+func newContainer(ctx context.Context, cl *containerdapi.Client, id string, img Image, args []string,
+	labels map[string]string, opts []oci.SpecOpts) (containerdapi.Container, error) {
+
+	i, err := containerdImage(ctx, cl, img)
+	if err != nil {
+		return nil, err
+	}
+	specOpts := []oci.SpecOpts{
+		oci.WithImageConfigArgs(i, args),
+		oci.WithHostNamespace(specs.NetworkNamespace),
+		oci.WithHostNamespace(specs.UTSNamespace),
+		oci.WithHostHostsFile,
+		oci.WithHostResolvconf,
+		oci.WithRootFSReadonly(),
+	}
+	specOpts = append(specOpts, opts...)
+	return cl.NewContainer(ctx, id,
+		containerdapi.WithNewSnapshot(id, i),
+		containerdapi.WithNewSpec(specOpts...),
+		containerdapi.WithContainerLabels(labels),
+	)
+}
+
+// containerdIO is cio.IO for files on the node.
+// containerd reads stdin from and writes stdout and stderr to the files.
+type containerdIO struct {
+	config cio.Config
+}
+
+func (i containerdIO) Config() cio.Config {
+	return i.config
+}
+
+func (containerdIO) Cancel() {}
+
+func (containerdIO) Wait() {}
+
+func (containerdIO) Close() error {
+	return nil
+}
+
+// containerdLogURI returns the URI of the logging binary that sends the
+// outputs of the named system container to journald as docker does.
+//
+// The binary receives stdout and stderr of the container as fd 3 and 4,
+// and closes fd 5 to tell containerd that it is ready.
+func containerdLogURI(name string) *url.URL {
+	script := fmt.Sprintf("PATH=/usr/sbin:/usr/bin:/sbin:/bin; "+
+		"systemd-cat -t %s -p info <&3 5>&- & systemd-cat -t %s -p err <&4 5>&- & exec 5>&-; wait",
+		name, name)
+	return &url.URL{
+		Scheme:   "binary",
+		Path:     "/bin/sh",
+		RawQuery: url.Values{"-c": {script}}.Encode(),
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	// crypto/rand.Read never returns an error.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// runOnce runs a container until it exits, and returns its stdout and stderr.
+//
+// containerd cannot use the files of CKE for stdio, so they are placed
+// in a temporary directory on the node.
+func (c containerd) runOnce(img Image, binds []Mount, input io.Reader, command string, args []string) ([]byte, []byte, error) {
+	cmdline := "d=$(mktemp -d) && touch $d/stdin $d/stdout $d/stderr && echo $d"
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, cmdline: %s, stdout: %s, stderr: %s", err, cmdline, stdout, stderr)
+	}
+	dir := strings.TrimSpace(string(stdout))
+	defer c.agent.Run("rm -rf " + dir)
+
+	if input != nil {
+		cmdline := "cat > " + dir + "/stdin"
+		_, stderr, err := c.agent.RunWithReader(cmdline, input, DefaultRunTimeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w, cmdline: %s, stderr: %s", err, cmdline, stderr)
+		}
+	}
+
+	var code uint32
+	err = c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		// The container and the task are deleted even if ctx is cancelled.
+		cleanupCtx := context.WithoutCancel(ctx)
+
+		var mounts []specs.Mount
+		for _, m := range binds {
+			mounts = append(mounts, containerdBind(m))
+		}
+		container, err := newContainer(ctx, cl, "cke-run-"+randomID(), img,
+			append([]string{command}, args...), nil, []oci.SpecOpts{oci.WithMounts(mounts)})
+		if err != nil {
+			return err
+		}
+		defer container.Delete(cleanupCtx, containerdapi.WithSnapshotCleanup)
+
+		task, err := container.NewTask(ctx, func(string) (cio.IO, error) {
+			return containerdIO{cio.Config{
+				Stdin:  dir + "/stdin",
+				Stdout: dir + "/stdout",
+				Stderr: dir + "/stderr",
+			}}, nil
+		})
+		if err != nil {
+			return err
+		}
+		// Deleting the task waits for the outputs to be written.
+		defer task.Delete(cleanupCtx, containerdapi.WithProcessKill)
+
+		statusC, err := task.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		err = task.Start(ctx)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case st := <-statusC:
+			code, _, err = st.Result()
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmdline = "cat " + dir + "/stdout"
+	stdout, stderr, err = c.agent.Run(cmdline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, cmdline: %s, stderr: %s", err, cmdline, stderr)
+	}
+	cmdline = "cat " + dir + "/stderr"
+	errout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, cmdline: %s, stderr: %s", err, cmdline, stderr)
+	}
+
+	if code != 0 {
+		return stdout, errout, fmt.Errorf("%s exited with status %d, stderr: %s", command, code, errout)
+	}
+	return stdout, errout, nil
+}
+
+func (c containerd) Run(img Image, binds []Mount, command string, args ...string) error {
+	_, _, err := c.runOnce(img, binds, nil, command, args)
+	return err
+}
+
+func (c containerd) RunWithInput(img Image, binds []Mount, command, input string, args ...string) error {
+	_, _, err := c.runOnce(img, binds, strings.NewReader(input), command, args)
+	return err
+}
+
+func (c containerd) RunWithReader(img Image, binds []Mount, command string, input io.Reader, args ...string) error {
+	_, _, err := c.runOnce(img, binds, input, command, args)
+	return err
+}
+
+func (c containerd) RunWithOutput(img Image, binds []Mount, command string, args ...string) ([]byte, []byte, error) {
+	return c.runOnce(img, binds, nil, command, args)
+}
+
+// shellQuote quotes s for the shell on nodes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (c containerd) RunSystem(name string, img Image, opts []string, params, extra ServiceParams) error {
+	ctrOpts, err := containerdOpts(opts)
+	if err != nil {
+		return err
+	}
+	specOpts := ctrOpts.specOpts()
+
+	var mounts []specs.Mount
+	for _, m := range append(params.ExtraBinds, extra.ExtraBinds...) {
+		mounts = append(mounts, containerdBind(m))
+	}
+	specOpts = append(specOpts, oci.WithMounts(mounts))
+
+	var envs []string
+	for k, v := range params.ExtraEnvvar {
+		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+	}
+	for k, v := range extra.ExtraEnvvar {
+		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+	}
+	specOpts = append(specOpts, oci.WithEnv(envs))
+
+	label := ckeLabel{
+		BuiltInParams: params,
+		ExtraParams:   extra,
+	}
+	data, err := json.Marshal(label)
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{CKELabelName: string(data)}
+
+	args := append(append([]string{}, params.ExtraArguments...), extra.ExtraArguments...)
+
+	return c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		err := removeContainer(ctx, cl, name)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return err
+		}
+
+		container, err := newContainer(ctx, cl, name, img, args, labels, specOpts)
+		if err != nil {
+			return err
+		}
+		task, err := container.NewTask(ctx, cio.LogURI(containerdLogURI(name)))
+		if err != nil {
+			container.Delete(ctx, containerdapi.WithSnapshotCleanup)
+			return err
+		}
+		return task.Start(ctx)
+	})
+}
+
+func (c containerd) Stop(name string) error {
+	return c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		container, err := cl.LoadContainer(ctx, name)
+		if err != nil {
+			return err
+		}
+		task, err := container.Task(ctx, nil)
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		statusC, err := task.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		err = task.Kill(ctx, syscall.SIGTERM)
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-statusC:
+			return nil
+		case <-time.After(containerdStopTimeout):
+		}
+		return task.Kill(ctx, syscall.SIGKILL)
+	})
+}
+
+func (c containerd) Kill(name string) error {
+	return c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		container, err := cl.LoadContainer(ctx, name)
+		if err != nil {
+			return err
+		}
+		task, err := container.Task(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return task.Kill(ctx, syscall.SIGKILL)
+	})
+}
+
+// removeContainer removes the container and its task, if any.
+func removeContainer(ctx context.Context, cl *containerdapi.Client, name string) error {
+	container, err := cl.LoadContainer(ctx, name)
+	if err != nil {
+		return err
+	}
+	task, err := container.Task(ctx, nil)
+	switch {
+	case err == nil:
+		_, err = task.Delete(ctx, containerdapi.WithProcessKill)
+		if err != nil {
+			return err
+		}
+	case !errdefs.IsNotFound(err):
+		return err
+	}
+	return container.Delete(ctx, containerdapi.WithSnapshotCleanup)
+}
+
+func (c containerd) Remove(name string) error {
+	return c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		return removeContainer(ctx, cl, name)
+	})
+}
+
+func (c containerd) Exists(name string) (bool, error) {
+	var exists bool
+	err := c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		_, err := cl.LoadContainer(ctx, name)
+		switch {
+		case err == nil:
+			exists = true
+		case errdefs.IsNotFound(err):
+		default:
+			return err
+		}
+		return nil
+	})
+	return exists, err
+}
+
+func (c containerd) Inspect(names []string) (map[string]ServiceStatus, error) {
+	statuses := make(map[string]ServiceStatus)
+	err := c.do(func(ctx context.Context, cl *containerdapi.Client) error {
+		for _, name := range names {
+			container, err := cl.LoadContainer(ctx, name)
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			info, err := container.Info(ctx, containerdapi.WithoutRefreshedMetadata)
+			if err != nil {
+				return err
+			}
+
+			var params ckeLabel
+			err = json.Unmarshal([]byte(info.Labels[CKELabelName]), &params)
+			if err != nil {
+				return err
+			}
+
+			running := false
+			task, err := container.Task(ctx, nil)
+			switch {
+			case err == nil:
+				st, err := task.Status(ctx)
+				if err != nil {
+					return err
+				}
+				running = st.Status == containerdapi.Running
+			case !errdefs.IsNotFound(err):
+				return err
+			}
+
+			statuses[name] = ServiceStatus{
+				Running:       running,
+				Image:         info.Image,
+				BuiltInParams: params.BuiltInParams,
+				ExtraParams:   params.ExtraParams,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	return statuses, nil
+}
+
+func (c containerd) VolumeCreate(name string) error {
+	cmdline := "mkdir -p " + ContainerdVolumePath(name)
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return fmt.Errorf("%w, cmdline: %s, stdout: %s, stderr: %s", err, cmdline, stdout, stderr)
+	}
+	return nil
+}
+
+func (c containerd) VolumeRemove(name string) error {
+	cmdline := "rm -rf " + ContainerdVolumePath(name)
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return fmt.Errorf("%w, cmdline: %s, stdout: %s, stderr: %s", err, cmdline, stdout, stderr)
+	}
+	return nil
+}
+
+func (c containerd) VolumeExists(name string) (bool, error) {
+	cmdline := "ls -1 " + ContainerdVolumeDir + " 2>/dev/null || true"
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return false, fmt.Errorf("%w, cmdline: %s, stdout: %s, stderr: %s", err, cmdline, stdout, stderr)
+	}
+
+	for _, n := range strings.Split(string(stdout), "\n") {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
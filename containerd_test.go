@@ -0,0 +1,128 @@
+package cke
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestContainerdOpts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		opts    []string
+		want    *containerdOptions
+		wantErr bool
+	}{
+		{
+			"empty",
+			nil,
+			&containerdOptions{},
+			false,
+		},
+		{
+			"namespaces",
+			[]string{"--pid=host", "--privileged"},
+			&containerdOptions{hostPID: true, privileged: true},
+			false,
+		},
+		{
+			"tmpfs",
+			[]string{"--tmpfs=/run", "--mount", "type=tmpfs,dst=/run/kubernetes"},
+			&containerdOptions{mounts: []specs.Mount{
+				{Type: "tmpfs", Source: "tmpfs", Destination: "/run", Options: []string{"nosuid", "nodev"}},
+				{Type: "tmpfs", Source: "tmpfs", Destination: "/run/kubernetes", Options: []string{"nosuid", "nodev"}},
+			}},
+			false,
+		},
+		{
+			"volume",
+			[]string{"--mount", "type=volume,src=etcd-cke,dst=/var/lib/etcd"},
+			&containerdOptions{mounts: []specs.Mount{
+				{Type: "bind", Source: "/var/lib/cke/volumes/etcd-cke", Destination: "/var/lib/etcd", Options: []string{"rbind", "rw"}},
+			}},
+			false,
+		},
+		{
+			"missing mount value",
+			[]string{"--mount"},
+			nil,
+			true,
+		},
+		{
+			"unsupported mount",
+			[]string{"--mount", "type=npipe,src=foo,dst=/foo"},
+			nil,
+			true,
+		},
+		{
+			"unsupported option",
+			[]string{"--network=bridge"},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := containerdOpts(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("containerdOpts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("containerdOpts() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerdBind(t *testing.T) {
+	t.Parallel()
+
+	m := Mount{
+		Source:      "/var/lib/kubelet",
+		Destination: "/var/lib/kubelet",
+		ReadOnly:    true,
+		Propagation: PropagationRShared,
+	}
+	want := specs.Mount{
+		Type:        "bind",
+		Source:      "/var/lib/kubelet",
+		Destination: "/var/lib/kubelet",
+		Options:     []string{"rbind", "ro", "rshared"},
+	}
+	if got := containerdBind(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("containerdBind() = %#v, want %#v", got, want)
+	}
+}
+
+func TestContainerdLogURI(t *testing.T) {
+	t.Parallel()
+
+	u, err := url.Parse(containerdLogURI("kube-apiserver").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "binary" || u.Path != "/bin/sh" {
+		t.Errorf("unexpected logging binary: %s", u)
+	}
+
+	// containerd passes the query as the arguments of the binary.
+	q := u.Query()
+	if len(q) != 1 {
+		t.Fatalf("unexpected arguments: %v", q)
+	}
+	script := q.Get("-c")
+	for _, s := range []string{
+		"systemd-cat -t kube-apiserver -p info <&3",
+		"systemd-cat -t kube-apiserver -p err <&4",
+		"exec 5>&-",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("%q is not in the script: %s", s, script)
+		}
+	}
+}
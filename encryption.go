@@ -0,0 +1,40 @@
+package cke
+
+import "time"
+
+// EncryptionKeyRotationPhase represents the progress of an encryption key rotation.
+type EncryptionKeyRotationPhase string
+
+// Phases of an encryption key rotation.
+const (
+	// EncryptionKeyAdded means that a new key has been added.
+	// For aescbc, the new key is not yet used to encrypt data.
+	// For kms, the new version of the transit key is used to encrypt data.
+	EncryptionKeyAdded = EncryptionKeyRotationPhase("added")
+
+	// EncryptionKeyPromoted means that the new aescbc key is used to encrypt data.
+	EncryptionKeyPromoted = EncryptionKeyRotationPhase("promoted")
+
+	// EncryptionKeyRewritten means that all Secrets have been re-encrypted with the new key.
+	EncryptionKeyRewritten = EncryptionKeyRotationPhase("rewritten")
+)
+
+// EncryptionKeyRotation is a request to rotate the encryption key for Kubernetes Secrets.
+// The request is created by "ckecli vault enckey rotate" and removed by the leader
+// when the old keys are retired.
+type EncryptionKeyRotation struct {
+	// Provider is the encryption provider whose key is rotated.
+	Provider string `json:"provider"`
+
+	// KeyName is the name of the new aescbc key.
+	KeyName string `json:"key_name,omitempty"`
+
+	// Phase is the current phase of the rotation.
+	Phase EncryptionKeyRotationPhase `json:"phase"`
+
+	// Author is the user who requested the rotation.
+	Author string `json:"author"`
+
+	// Timestamp is the time when the rotation was requested.
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,144 @@
+package cke
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/etcd/etcdutl/v3/snapshot"
+	"go.uber.org/zap"
+)
+
+// EtcdRestoreRevisionBump is the amount to increase the revision of
+// the restored etcd so that clients such as kube-apiserver never see
+// the revision decreasing.
+const EtcdRestoreRevisionBump = 1000000000
+
+// EtcdRestore is a request to rebuild the CKE-managed etcd cluster from a snapshot.
+// The request is created by "ckecli etcd restore" and removed by the leader
+// when the restoration completes.
+type EtcdRestore struct {
+	// Snapshot is the name of the snapshot in the etcd snapshot store.
+	Snapshot string `json:"snapshot"`
+
+	// Node is the address of the control plane node to restore the snapshot.
+	// Other control planes are added back as new members after restoration.
+	Node string `json:"node"`
+
+	// Author is the user who requested the restoration.
+	Author string `json:"author"`
+
+	// Timestamp is the time when the restoration was requested.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Freeze is true if the freeze was set for the restoration.
+	// The freeze is lifted when the restoration completes.
+	Freeze bool `json:"freeze,omitempty"`
+}
+
+// ClusterToken returns the initial cluster token for the restored etcd.
+// A new token gives a new cluster ID to the restored etcd.
+func (r *EtcdRestore) ClusterToken() string {
+	return fmt.Sprintf("cke-restore-%d", r.Timestamp.Unix())
+}
+
+// DownloadEtcdSnapshot copies the named snapshot in store to dst.
+// If the checksum of the snapshot is known, this verifies the copy.
+func DownloadEtcdSnapshot(ctx context.Context, store EtcdSnapshotStore, name, dst string) error {
+	snapshots, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	var info *EtcdSnapshotInfo
+	for _, s := range snapshots {
+		if s.Name == name {
+			info = s
+			break
+		}
+	}
+	if info == nil {
+		return fmt.Errorf("snapshot %s is not found", name)
+	}
+
+	if err := store.Get(ctx, name, dst); err != nil {
+		return err
+	}
+	if info.Checksum == "" {
+		return nil
+	}
+
+	sum, err := fileChecksum(dst)
+	if err != nil {
+		return err
+	}
+	if sum != info.Checksum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, actual %s", name, info.Checksum, sum)
+	}
+	return nil
+}
+
+// RestoreEtcdSnapshot creates a new etcd data directory dataDir from the
+// snapshot file for a single-member cluster consisting of the node.
+func RestoreEtcdSnapshot(snapshotPath, dataDir string, node *Node, token string) error {
+	peerURL := "https://" + node.Address + ":2380"
+	return snapshot.NewV3(zap.NewNop()).Restore(snapshot.RestoreConfig{
+		SnapshotPath:        snapshotPath,
+		Name:                node.Address,
+		OutputDataDir:       dataDir,
+		PeerURLs:            []string{peerURL},
+		InitialCluster:      node.Address + "=" + peerURL,
+		InitialClusterToken: token,
+		RevisionBump:        EtcdRestoreRevisionBump,
+		MarkCompacted:       true,
+	})
+}
+
+// WriteTarDirectory archives files under dir with their names prefixed by
+// prefix and writes the archive to w.  Files are streamed and not held in memory.
+func WriteTarDirectory(w io.Writer, dir, prefix string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return errors.New("not a regular file: " + p)
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name: filepath.Join(prefix, rel),
+			Mode: 0600,
+			Size: fi.Size(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,91 @@
+package cke
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreEtcdSnapshot(t *testing.T) {
+	client := newEtcdClient(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	_, err := client.Put(ctx, "restore-test", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.db")
+	_, checksum, err := SaveEtcdSnapshot(ctx, client, snapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewEtcdSnapshotStore(&EtcdSnapshotConfig{
+		Type:      EtcdSnapshotFile,
+		Directory: filepath.Join(dir, "snapshots"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := EtcdSnapshotName(time.Now())
+	if err := store.Put(ctx, name, snapshotPath, checksum); err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded := filepath.Join(dir, "downloaded.db")
+	if err := DownloadEtcdSnapshot(ctx, store, "etcd-20000101-000000.backup", downloaded); err == nil {
+		t.Error("missing snapshot should not be downloaded")
+	}
+	if err := DownloadEtcdSnapshot(ctx, store, name, downloaded); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &EtcdRestore{Snapshot: name, Node: "10.0.0.11", Timestamp: time.Now()}
+	dataDir := filepath.Join(dir, "data")
+	err = RestoreEtcdSnapshot(downloaded, dataDir, &Node{Address: r.Node}, r.ClusterToken())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = WriteTarDirectory(buf, dataDir, "/var/lib/etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == "/var/lib/etcd/member/snap/db" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("member/snap/db is not archived")
+	}
+
+	if err := os.WriteFile(filepath.Join(dataDir, "link-target"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("link-target", filepath.Join(dataDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteTarDirectory(io.Discard, dataDir, "/var/lib/etcd"); err == nil {
+		t.Error("symbolic links should not be archived")
+	}
+}
@@ -0,0 +1,349 @@
+package cke
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/etcdutl/v3/snapshot"
+)
+
+// etcd snapshot store types
+const (
+	EtcdSnapshotFile = "file"
+	EtcdSnapshotS3   = "s3"
+)
+
+// Default values of EtcdSnapshotConfig
+const (
+	DefaultEtcdSnapshotIntervalSeconds = 3600
+	DefaultEtcdSnapshotMaxSnapshots    = 24
+)
+
+// EtcdSnapshotConfig is the configuration of scheduled snapshots of
+// the CKE-managed etcd cluster.
+type EtcdSnapshotConfig struct {
+	// Type is either "file" or "s3".
+	Type string `json:"type"`
+
+	// Directory is the directory to store snapshots for "file" type.
+	Directory string `json:"directory,omitempty"`
+
+	// S3Config is the configuration of the bucket for "s3" type.
+	S3Config
+
+	// IntervalSeconds is the interval between snapshots.
+	IntervalSeconds int `json:"interval-seconds,omitempty"`
+
+	// MaxSnapshots is the maximum number of snapshots to keep.
+	MaxSnapshots int `json:"max-snapshots,omitempty"`
+
+	// MaxAgeSeconds is the maximum age of snapshots to keep.
+	// If zero, snapshots are not removed by age.
+	MaxAgeSeconds int `json:"max-age-seconds,omitempty"`
+}
+
+// Validate validates the etcd snapshot configuration.
+func (c *EtcdSnapshotConfig) Validate() error {
+	if c.IntervalSeconds < 0 {
+		return errors.New("interval-seconds must not be negative")
+	}
+	if c.MaxSnapshots < 0 {
+		return errors.New("max-snapshots must not be negative")
+	}
+	if c.MaxAgeSeconds < 0 {
+		return errors.New("max-age-seconds must not be negative")
+	}
+
+	switch c.Type {
+	case EtcdSnapshotFile:
+		if len(c.Directory) == 0 {
+			return errors.New("directory is empty")
+		}
+		if !filepath.IsAbs(c.Directory) {
+			return errors.New("directory must be an absolute path")
+		}
+	case EtcdSnapshotS3:
+		return c.S3Config.Validate()
+	default:
+		return fmt.Errorf("unknown type: %s", c.Type)
+	}
+	return nil
+}
+
+// GetInterval returns the interval between snapshots.
+func (c *EtcdSnapshotConfig) GetInterval() time.Duration {
+	if c.IntervalSeconds == 0 {
+		return DefaultEtcdSnapshotIntervalSeconds * time.Second
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// GetMaxSnapshots returns the maximum number of snapshots to keep.
+func (c *EtcdSnapshotConfig) GetMaxSnapshots() int {
+	if c.MaxSnapshots == 0 {
+		return DefaultEtcdSnapshotMaxSnapshots
+	}
+	return c.MaxSnapshots
+}
+
+// EtcdSnapshotInfo describes a stored snapshot.
+type EtcdSnapshotInfo struct {
+	Name     string    `json:"name"`
+	Time     time.Time `json:"time"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"sha256,omitempty"`
+}
+
+// EtcdSnapshotStore is a storage of etcd snapshots.
+type EtcdSnapshotStore interface {
+	// Put stores the snapshot file at src as name.
+	// src may be moved or left as it is.
+	// checksum is the hex-encoded SHA-256 digest of the file.
+	Put(ctx context.Context, name, src, checksum string) error
+
+	// Get copies the named snapshot to the local file dst.
+	Get(ctx context.Context, name, dst string) error
+
+	// List returns stored snapshots sorted by time in increasing order.
+	List(ctx context.Context) ([]*EtcdSnapshotInfo, error)
+
+	// Remove removes the named snapshot.
+	Remove(ctx context.Context, name string) error
+}
+
+// NewEtcdSnapshotStore creates an EtcdSnapshotStore from the configuration.
+func NewEtcdSnapshotStore(c *EtcdSnapshotConfig) (EtcdSnapshotStore, error) {
+	switch c.Type {
+	case EtcdSnapshotFile:
+		return &fileEtcdSnapshotStore{dir: c.Directory}, nil
+	case EtcdSnapshotS3:
+		return newS3EtcdSnapshotStore(&c.S3Config)
+	}
+	return nil, errors.New("unknown etcd snapshot type: " + c.Type)
+}
+
+const etcdSnapshotTimeFormat = "20060102-150405"
+
+// EtcdSnapshotName returns the name of a snapshot taken at t.
+// The name is "etcd-YYYYMMDD-hhmmss.backup" in UTC.
+func EtcdSnapshotName(t time.Time) string {
+	return fmt.Sprintf("etcd-%s.backup", t.UTC().Format(etcdSnapshotTimeFormat))
+}
+
+// parseEtcdSnapshotName returns the time encoded in a snapshot name.
+func parseEtcdSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, "etcd-") || !strings.HasSuffix(name, ".backup") {
+		return time.Time{}, false
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(name, "etcd-"), ".backup")
+	t, err := time.Parse(etcdSnapshotTimeFormat, ts)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// SaveEtcdSnapshot takes a snapshot of etcd and saves it as filename.
+// The snapshot is verified with the hash embedded by etcd.
+// This returns the size and the hex-encoded SHA-256 digest of the file.
+func SaveEtcdSnapshot(ctx context.Context, etcd *clientv3.Client, filename string) (int64, string, error) {
+	r, err := etcd.Snapshot(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	w, err := os.Create(filename)
+	if err != nil {
+		return 0, "", err
+	}
+	defer w.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		os.Remove(filename)
+		return 0, "", err
+	}
+
+	if err := w.Sync(); err != nil {
+		os.Remove(filename)
+		return 0, "", err
+	}
+
+	ss := snapshot.NewV3(nil)
+	if _, err := ss.Status(filename); err != nil {
+		os.Remove(filename)
+		return 0, "", fmt.Errorf("failed to check status of the snapshot: %w", err)
+	}
+
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ExpiredEtcdSnapshots returns snapshots to be removed by the retention policy.
+// snapshots must be sorted by time in increasing order.
+func ExpiredEtcdSnapshots(snapshots []*EtcdSnapshotInfo, c *EtcdSnapshotConfig, now time.Time) []*EtcdSnapshotInfo {
+	var expired []*EtcdSnapshotInfo
+	toRemove := len(snapshots) - c.GetMaxSnapshots()
+	for i, s := range snapshots {
+		// always keep the latest snapshot
+		if i == len(snapshots)-1 {
+			break
+		}
+		if i < toRemove {
+			expired = append(expired, s)
+			continue
+		}
+		if c.MaxAgeSeconds > 0 && now.Sub(s.Time) > time.Duration(c.MaxAgeSeconds)*time.Second {
+			expired = append(expired, s)
+		}
+	}
+	return expired
+}
+
+// fileEtcdSnapshotStore stores snapshots in a directory.
+// The SHA-256 digest of each snapshot is stored in a file with ".sha256" suffix.
+type fileEtcdSnapshotStore struct {
+	dir string
+}
+
+const etcdSnapshotChecksumSuffix = ".sha256"
+
+func (s *fileEtcdSnapshotStore) Put(ctx context.Context, name, src, checksum string) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	target := filepath.Join(s.dir, name)
+	if err := os.Rename(src, target); err != nil {
+		// src may be in another file system.
+		if err := copyFile(target, src); err != nil {
+			os.Remove(target)
+			return err
+		}
+	}
+
+	sum, err := fileChecksum(target)
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	if sum != checksum {
+		os.Remove(target)
+		return fmt.Errorf("checksum mismatch for %s: expected %s, actual %s", name, checksum, sum)
+	}
+
+	err = os.WriteFile(target+etcdSnapshotChecksumSuffix, []byte(checksum+"  "+name+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func (s *fileEtcdSnapshotStore) Get(ctx context.Context, name, dst string) error {
+	if err := copyFile(dst, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func (s *fileEtcdSnapshotStore) List(ctx context.Context) ([]*EtcdSnapshotInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*EtcdSnapshotInfo
+	for _, e := range entries {
+		t, ok := parseEtcdSnapshotName(e.Name())
+		if !ok {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		info := &EtcdSnapshotInfo{Name: e.Name(), Time: t, Size: fi.Size()}
+		data, err := os.ReadFile(filepath.Join(s.dir, e.Name()+etcdSnapshotChecksumSuffix))
+		if err == nil {
+			info.Checksum, _, _ = strings.Cut(string(data), " ")
+		}
+		snapshots = append(snapshots, info)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+func (s *fileEtcdSnapshotStore) Remove(ctx context.Context, name string) error {
+	target := filepath.Join(s.dir, name)
+	if err := os.Remove(target); err != nil {
+		return err
+	}
+	err := os.Remove(target + etcdSnapshotChecksumSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func copyFile(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, bufio.NewReader(r)); err != nil {
+		return err
+	}
+	if err := w.Sync(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func fileChecksum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,103 @@
+package cke
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3EtcdSnapshotStore stores snapshots as objects in a bucket.
+// The SHA-256 digest of each snapshot is stored as user metadata, and
+// the integrity of uploads is verified by the service with Content-MD5.
+type s3EtcdSnapshotStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+const etcdSnapshotChecksumMeta = "Sha256"
+
+// s3Checksum returns the checksum in user metadata.  StatObject returns
+// metadata keys without "X-Amz-Meta-" while ListObjects may not.
+func s3Checksum(meta map[string]string) string {
+	if sum, ok := meta[etcdSnapshotChecksumMeta]; ok {
+		return sum
+	}
+	return meta["X-Amz-Meta-"+etcdSnapshotChecksumMeta]
+}
+
+func newS3EtcdSnapshotStore(c *S3Config) (EtcdSnapshotStore, error) {
+	client, err := NewS3Client(c)
+	if err != nil {
+		return nil, err
+	}
+	return &s3EtcdSnapshotStore{
+		client: client,
+		bucket: c.Bucket,
+		prefix: c.Prefix,
+	}, nil
+}
+
+func (s *s3EtcdSnapshotStore) Put(ctx context.Context, name, src, checksum string) error {
+	info, err := s.client.FPutObject(ctx, s.bucket, s.prefix+name, src, minio.PutObjectOptions{
+		ContentType:    "application/octet-stream",
+		UserMetadata:   map[string]string{etcdSnapshotChecksumMeta: checksum},
+		SendContentMd5: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	obj, err := s.client.StatObject(ctx, s.bucket, info.Key, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if obj.Size != info.Size {
+		return fmt.Errorf("size mismatch for %s: expected %d, actual %d", name, info.Size, obj.Size)
+	}
+	if sum := s3Checksum(obj.UserMetadata); sum != checksum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, actual %s", name, checksum, sum)
+	}
+	return nil
+}
+
+func (s *s3EtcdSnapshotStore) Get(ctx context.Context, name, dst string) error {
+	return s.client.FGetObject(ctx, s.bucket, s.prefix+name, dst, minio.GetObjectOptions{})
+}
+
+func (s *s3EtcdSnapshotStore) List(ctx context.Context) ([]*EtcdSnapshotInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var snapshots []*EtcdSnapshotInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:       s.prefix + "etcd-",
+		WithMetadata: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		name := strings.TrimPrefix(obj.Key, s.prefix)
+		t, ok := parseEtcdSnapshotName(name)
+		if !ok {
+			continue
+		}
+		snapshots = append(snapshots, &EtcdSnapshotInfo{
+			Name:     name,
+			Time:     t,
+			Size:     obj.Size,
+			Checksum: s3Checksum(obj.UserMetadata),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+func (s *s3EtcdSnapshotStore) Remove(ctx context.Context, name string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+name, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,219 @@
+package cke
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEtcdSnapshotConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     EtcdSnapshotConfig
+		wantErr bool
+	}{
+		{
+			name: "file",
+			cfg:  EtcdSnapshotConfig{Type: EtcdSnapshotFile, Directory: "/var/cke/etcd-snapshots"},
+		},
+		{
+			name:    "file with relative directory",
+			cfg:     EtcdSnapshotConfig{Type: EtcdSnapshotFile, Directory: "snapshots"},
+			wantErr: true,
+		},
+		{
+			name: "s3",
+			cfg: EtcdSnapshotConfig{
+				Type: EtcdSnapshotS3,
+				S3Config: S3Config{
+					Endpoint:        "minio.example.com:9000",
+					Bucket:          "cke",
+					AccessKeyID:     "id",
+					SecretAccessKey: "secret",
+				},
+				IntervalSeconds: 600,
+				MaxSnapshots:    10,
+				MaxAgeSeconds:   86400,
+			},
+		},
+		{
+			name: "s3 without credentials",
+			cfg: EtcdSnapshotConfig{
+				Type:     EtcdSnapshotS3,
+				S3Config: S3Config{Endpoint: "minio.example.com:9000", Bucket: "cke"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "negative interval",
+			cfg:     EtcdSnapshotConfig{Type: EtcdSnapshotFile, Directory: "/var/cke/etcd-snapshots", IntervalSeconds: -1},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			cfg:     EtcdSnapshotConfig{Type: "tape"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("error is expected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Error("unexpected error:", err)
+			}
+		})
+	}
+}
+
+func TestEtcdSnapshotName(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	name := EtcdSnapshotName(ts)
+	if name != "etcd-20240102-030405.backup" {
+		t.Error("unexpected name:", name)
+	}
+	parsed, ok := parseEtcdSnapshotName(name)
+	if !ok || !parsed.Equal(ts) {
+		t.Error("failed to parse:", name, parsed)
+	}
+	if _, ok := parseEtcdSnapshotName("etcd-20240102-030405.backup.sha256"); ok {
+		t.Error("checksum file should not be parsed")
+	}
+}
+
+func TestExpiredEtcdSnapshots(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	var snapshots []*EtcdSnapshotInfo
+	for i := 9; i >= 0; i-- {
+		ts := now.Add(-time.Duration(i) * 24 * time.Hour)
+		snapshots = append(snapshots, &EtcdSnapshotInfo{Name: EtcdSnapshotName(ts), Time: ts})
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      EtcdSnapshotConfig
+		input    []*EtcdSnapshotInfo
+		expected int
+	}{
+		{
+			name:     "by count",
+			cfg:      EtcdSnapshotConfig{MaxSnapshots: 3},
+			input:    snapshots,
+			expected: 7,
+		},
+		{
+			name:     "by age",
+			cfg:      EtcdSnapshotConfig{MaxSnapshots: 100, MaxAgeSeconds: 5 * 86400},
+			input:    snapshots,
+			expected: 4,
+		},
+		{
+			name:     "keep the latest",
+			cfg:      EtcdSnapshotConfig{MaxSnapshots: 100, MaxAgeSeconds: 1},
+			input:    snapshots[:1],
+			expected: 0,
+		},
+		{
+			name:     "default",
+			cfg:      EtcdSnapshotConfig{},
+			input:    snapshots,
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expired := ExpiredEtcdSnapshots(tc.input, &tc.cfg, now)
+			if len(expired) != tc.expected {
+				t.Fatalf("expected %d, actual %d", tc.expected, len(expired))
+			}
+			for i, s := range expired {
+				if s != tc.input[i] {
+					t.Error("older snapshots should be removed first:", s.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestFileEtcdSnapshotStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewEtcdSnapshotStore(&EtcdSnapshotConfig{
+		Type:      EtcdSnapshotFile,
+		Directory: filepath.Join(dir, "snapshots"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	snapshots, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 0 {
+		t.Error("unexpected snapshots:", snapshots)
+	}
+
+	data := []byte("snapshot data")
+	digest := sha256.Sum256(data)
+	checksum := hex.EncodeToString(digest[:])
+
+	t1 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	for _, ts := range []time.Time{t2, t1} {
+		src := filepath.Join(dir, "src")
+		if err := os.WriteFile(src, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(ctx, EtcdSnapshotName(ts), src, checksum); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, EtcdSnapshotName(t2.Add(time.Hour)), src, "invalid"); err == nil {
+		t.Error("checksum mismatch should be detected")
+	}
+
+	snapshots, err = store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatal("unexpected snapshots:", snapshots)
+	}
+	if !snapshots[0].Time.Equal(t1) || !snapshots[1].Time.Equal(t2) {
+		t.Error("snapshots are not sorted:", snapshots[0].Name, snapshots[1].Name)
+	}
+	if snapshots[0].Size != int64(len(data)) {
+		t.Error("unexpected size:", snapshots[0].Size)
+	}
+	if snapshots[0].Checksum != checksum {
+		t.Error("unexpected checksum:", snapshots[0].Checksum)
+	}
+
+	if err := store.Remove(ctx, snapshots[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "snapshots", snapshots[0].Name+etcdSnapshotChecksumSuffix)); !os.IsNotExist(err) {
+		t.Error("checksum file is not removed:", err)
+	}
+	snapshots, err = store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || !snapshots[0].Time.Equal(t2) {
+		t.Error("unexpected snapshots after removal:", snapshots)
+	}
+}
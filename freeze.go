@@ -0,0 +1,29 @@
+package cke
+
+import (
+	"slices"
+	"time"
+)
+
+// Freeze represents the operation freeze set by administrators.
+// While the freeze is in effect, CKE does not run operations.
+type Freeze struct {
+	Reason    string    `json:"reason"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	// Phases is a list of phases whose operations are blocked.
+	// If empty, operations are blocked in all phases.
+	Phases []OperationPhase `json:"phases,omitempty"`
+}
+
+// Blocks returns true if operations in the phase are blocked by the freeze.
+// The etcd restoration is never blocked because it runs under the freeze.
+func (f *Freeze) Blocks(phase OperationPhase) bool {
+	if phase == PhaseEtcdRestore {
+		return false
+	}
+	if len(f.Phases) == 0 {
+		return true
+	}
+	return slices.Contains(f.Phases, phase)
+}
@@ -0,0 +1,29 @@
+package cke
+
+import "testing"
+
+func TestFreezeBlocks(t *testing.T) {
+	f := &Freeze{Reason: "test"}
+	for _, phase := range AllOperationPhases {
+		if phase == PhaseEtcdRestore {
+			if f.Blocks(phase) {
+				t.Error("etcd-restore should not be blocked")
+			}
+			continue
+		}
+		if !f.Blocks(phase) {
+			t.Error("phase should be blocked", phase)
+		}
+	}
+
+	f.Phases = []OperationPhase{PhaseEtcdMaintain, PhaseRebootNodes}
+	if !f.Blocks(PhaseEtcdMaintain) {
+		t.Error("etcd-maintain should be blocked")
+	}
+	if !f.Blocks(PhaseRebootNodes) {
+		t.Error("reboot-nodes should be blocked")
+	}
+	if f.Blocks(PhaseK8sMaintain) {
+		t.Error("k8s-maintain should not be blocked")
+	}
+}
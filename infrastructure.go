@@ -1,6 +1,7 @@
 package cke
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -52,46 +53,52 @@ func (c *certCache) get(issue func() (cert, key []byte, err error)) (cert, key [
 // KubeHTTP provides TLS client certificate to access kube-apiserver.
 // The certificate is cached in memory in order to avoid excessive certificate issuance.
 type KubeHTTP struct {
-	once   sync.Once
+	mu     sync.Mutex
 	cache  *certCache
-	err    error
 	ca     string
 	client *well.HTTPClient
 }
 
 // Init initializes KubeHTTP.
+//
+// The CA certificate is reloaded every time so that the rotation of the
+// Kubernetes CA takes effect.  When it is changed, the cached client
+// certificate is discarded as it may be issued by the old CA.
 func (k *KubeHTTP) Init(ctx context.Context, inf Infrastructure) error {
-	k.once.Do(func() {
-		cache := &certCache{
-			lifetime: time.Hour * 24,
-		}
-		k.cache = cache
+	ca, err := inf.Storage().GetCACertificate(ctx, CAKubernetes)
+	if err != nil {
+		return err
+	}
 
-		ca, err := inf.Storage().GetCACertificate(ctx, CAKubernetes)
-		if err != nil {
-			k.err = err
-			return
-		}
-		k.ca = ca
-
-		cp := x509.NewCertPool()
-		cp.AppendCertsFromPEM([]byte(k.ca))
-		k.client = &well.HTTPClient{
-			Client: &http.Client{
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						RootCAs: cp,
-					},
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.cache != nil && k.ca == ca {
+		return nil
+	}
+
+	k.cache = &certCache{
+		lifetime: time.Hour * 24,
+	}
+	k.ca = ca
+
+	cp := x509.NewCertPool()
+	cp.AppendCertsFromPEM([]byte(k.ca))
+	k.client = &well.HTTPClient{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs: cp,
 				},
 			},
-		}
-	})
-
-	return k.err
+		},
+	}
+	return nil
 }
 
 // CACert returns the CA certificate of kube-apiserver.
 func (k *KubeHTTP) CACert() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	return k.ca
 }
 
@@ -104,11 +111,16 @@ func (k *KubeHTTP) GetCert(ctx context.Context, inf Infrastructure) (cert, key [
 		}
 		return []byte(c), []byte(k), nil
 	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	return k.cache.get(issue)
 }
 
 // Client returns a HTTP client to acess kube-apiserver.
 func (k *KubeHTTP) Client() *well.HTTPClient {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	return k.client
 }
 
@@ -146,8 +158,17 @@ type Infrastructure interface {
 var kubeHTTP KubeHTTP
 
 type ckeInfrastructure struct {
-	agents  map[string]Agent
-	storage Storage
+	// agents is guarded by agentsMu because operators running
+	// concurrently may release agents.
+	agentsMu sync.RWMutex
+	agents   map[string]Agent
+	storage  Storage
+
+	engine      string
+	staticPods  bool
+	criEndpoint string
+	enginesMu   sync.Mutex
+	engines     map[string]ContainerEngine
 
 	etcdOnce sync.Once
 	etcdErr  error
@@ -159,40 +180,42 @@ type ckeInfrastructure struct {
 	// they need to be guarded by sync.Once.
 	once     sync.Once
 	initErr  error
+	kubeCA   string
 	kubeCert []byte
 	kubeKey  []byte
+	kubeHTTP *well.HTTPClient
 }
 
 func (i *ckeInfrastructure) init(ctx context.Context) error {
-	if err := kubeHTTP.Init(ctx, i); err != nil {
-		return err
-	}
-
 	i.once.Do(func() {
+		if err := kubeHTTP.Init(ctx, i); err != nil {
+			i.initErr = err
+			return
+		}
+
 		cert, key, err := kubeHTTP.GetCert(ctx, i)
 		if err != nil {
 			i.initErr = err
 			return
 		}
 
+		i.kubeCA = kubeHTTP.CACert()
 		i.kubeCert = cert
 		i.kubeKey = key
+		i.kubeHTTP = kubeHTTP.Client()
 	})
 	return i.initErr
 }
 
 // NewInfrastructure creates a new Infrastructure instance
 func NewInfrastructure(ctx context.Context, c *Cluster, s Storage) (Infrastructure, error) {
-	vc, err := getVaultClient()
+	privkeys, err := readSecret(ctx, s, getVaultClient, SSHSecret)
 	if err != nil {
 		return nil, err
 	}
-
-	secret, err := vc.Logical().Read(SSHSecret)
-	if err != nil {
-		return nil, err
+	if privkeys == nil {
+		return nil, errors.New("no ssh private keys")
 	}
-	privkeys := secret.Data
 
 	agents := make(map[string]Agent)
 	defer func() {
@@ -237,17 +260,91 @@ func NewInfrastructure(ctx context.Context, c *Cluster, s Storage) (Infrastructu
 	}
 
 	// This assignment of the `agent` must be placed last.
-	inf := &ckeInfrastructure{agents: agents, storage: s}
+	inf := &ckeInfrastructure{
+		agents:      agents,
+		storage:     s,
+		engine:      c.ContainerEngineName(),
+		staticPods:  c.ControlPlaneMode == ControlPlaneModeStaticPod,
+		criEndpoint: c.Options.Kubelet.CRIEndpoint,
+		engines:     make(map[string]ContainerEngine),
+	}
 	agents = nil
 	return inf, nil
 }
 
+// NewInfrastructureWithoutSSH creates a new Infrastructure instance that has no SSH agents.
+// This is for tasks that need only etcd or the Kubernetes API.
+func NewInfrastructureWithoutSSH(ctx context.Context, c *Cluster, s Storage) Infrastructure {
+	return &ckeInfrastructure{
+		agents:      make(map[string]Agent),
+		storage:     s,
+		engine:      c.ContainerEngineName(),
+		staticPods:  c.ControlPlaneMode == ControlPlaneModeStaticPod,
+		criEndpoint: c.Options.Kubelet.CRIEndpoint,
+		engines:     make(map[string]ContainerEngine),
+	}
+}
+
 func (i *ckeInfrastructure) Agent(addr string) Agent {
+	i.agentsMu.RLock()
+	defer i.agentsMu.RUnlock()
 	return i.agents[addr]
 }
 
+// Engine returns the container engine for system containers on the node.
+//
+// When the control plane runs as static pods, the returned engine runs
+// StaticPodComponents as static pods and other containers by the container engine.
 func (i *ckeInfrastructure) Engine(addr string) ContainerEngine {
-	return Docker(i.agents[addr])
+	ce := i.containerEngine(addr)
+	if i.staticPods {
+		return StaticPods(i.Agent(addr), ce, i.criEndpoint)
+	}
+	return ce
+}
+
+// containerEngine returns the container engine on the node.
+//
+// When containerd is selected, docker is still returned for nodes having
+// system containers in docker until they are migrated to containerd.
+func (i *ckeInfrastructure) containerEngine(addr string) ContainerEngine {
+	agent := i.Agent(addr)
+	if i.engine != ContainerEngineContainerd {
+		return Docker(agent)
+	}
+	if agent == nil {
+		return Containerd(agent)
+	}
+
+	i.enginesMu.Lock()
+	defer i.enginesMu.Unlock()
+	if ce, ok := i.engines[addr]; ok {
+		return ce
+	}
+
+	ce := Containerd(agent)
+	if hasDockerSystemContainers(addr, agent) {
+		ce = Docker(agent)
+	}
+	i.engines[addr] = ce
+	return ce
+}
+
+// hasDockerSystemContainers returns true if the node has system containers
+// in docker.  This returns true if it cannot be determined, so that CKE
+// never runs system containers in both engines.
+func hasDockerSystemContainers(addr string, agent Agent) bool {
+	cmdline := "if [ -S /var/run/docker.sock ]; then docker ps -a -q --filter label=" + CKELabelName + "; fi"
+	stdout, stderr, err := agent.Run(cmdline)
+	if err != nil {
+		log.Warn("failed to list docker containers", map[string]interface{}{
+			log.FnError: err,
+			"node":      addr,
+			"stderr":    string(stderr),
+		})
+		return true
+	}
+	return len(bytes.TrimSpace(stdout)) != 0
 }
 
 func (i *ckeInfrastructure) Vault() (*vault.Client, error) {
@@ -259,6 +356,8 @@ func (i *ckeInfrastructure) Storage() Storage {
 }
 
 func (i *ckeInfrastructure) Close() {
+	i.agentsMu.Lock()
+	defer i.agentsMu.Unlock()
 	for _, a := range i.agents {
 		a.Close()
 	}
@@ -307,7 +406,7 @@ func (i *ckeInfrastructure) K8sConfig(ctx context.Context, n *Node) (*rest.Confi
 		TLSClientConfig: rest.TLSClientConfig{
 			CertData: i.kubeCert,
 			KeyData:  i.kubeKey,
-			CAData:   []byte(kubeHTTP.CACert()),
+			CAData:   []byte(i.kubeCA),
 		},
 		Timeout: 5 * time.Second,
 	}, nil
@@ -330,13 +429,20 @@ func (i *ckeInfrastructure) HTTPSClient(ctx context.Context) (*well.HTTPClient,
 	if err != nil {
 		return nil, err
 	}
-	return kubeHTTP.Client(), nil
+	return i.kubeHTTP, nil
 }
 
 func (i *ckeInfrastructure) ReleaseAgent(addr string) {
+	i.agentsMu.Lock()
+	defer i.agentsMu.Unlock()
 	a := i.agents[addr]
 	if a != nil {
 		delete(i.agents, addr)
+
+		i.enginesMu.Lock()
+		delete(i.engines, addr)
+		i.enginesMu.Unlock()
+
 		go func() {
 			a.Close()
 		}()
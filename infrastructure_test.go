@@ -0,0 +1,76 @@
+package cke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopAgent struct{}
+
+func (nopAgent) Close() error { return nil }
+
+func (nopAgent) Run(command string) ([]byte, []byte, error) { return nil, nil, nil }
+
+func (nopAgent) RunWithInput(command, input string) error { return nil }
+
+func (nopAgent) RunWithTimeout(command, input string, timeout time.Duration) ([]byte, []byte, error) {
+	return nil, nil, nil
+}
+
+func (nopAgent) RunWithReader(command string, input io.Reader, timeout time.Duration) ([]byte, []byte, error) {
+	return nil, nil, nil
+}
+
+func (nopAgent) DialUnix(ctx context.Context, path string) (net.Conn, error) {
+	return nil, errors.New("not supported")
+}
+
+// TestReleaseAgent tests that agents can be released while other operators
+// are using agents, as the reboot operator does.  Run this with -race.
+func TestReleaseAgent(t *testing.T) {
+	t.Parallel()
+
+	const numNodes = 10
+	for _, engine := range []string{ContainerEngineDocker, ContainerEngineContainerd} {
+		agents := make(map[string]Agent)
+		for i := 0; i < numNodes; i++ {
+			agents[fmt.Sprintf("10.0.0.%d", i)] = nopAgent{}
+		}
+		inf := &ckeInfrastructure{
+			agents:     agents,
+			engine:     engine,
+			staticPods: true,
+			engines:    make(map[string]ContainerEngine),
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < numNodes; i++ {
+			addr := fmt.Sprintf("10.0.0.%d", i)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				inf.ReleaseAgent(addr)
+			}()
+			go func() {
+				defer wg.Done()
+				inf.Agent(addr)
+				inf.Engine(addr)
+			}()
+		}
+		wg.Wait()
+
+		for i := 0; i < numNodes; i++ {
+			addr := fmt.Sprintf("10.0.0.%d", i)
+			if inf.Agent(addr) != nil {
+				t.Errorf("%s: agent for %s is not released", engine, addr)
+			}
+		}
+		inf.Close()
+	}
+}
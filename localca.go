@@ -0,0 +1,408 @@
+package cke
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// localCAKeyBits is the size of RSA keys generated by the local CA backend.
+// This is the same as the default of Vault PKI.
+const localCAKeyBits = 2048
+
+// LocalCAConfig is the configuration of the local CA backend.
+//
+// When this is stored in etcd, CKE signs certificates in-process with
+// the CA keys stored in etcd instead of using Vault PKI.  Other secrets
+// such as SSH private keys are also stored in etcd, so CKE runs without Vault.
+type LocalCAConfig struct {
+	// KeyFile is the path of the file that holds the key to encrypt CA private keys.
+	// The file must be present on every host running CKE.
+	KeyFile string `json:"key-file"`
+}
+
+// Validate validates the local CA configuration.
+func (c *LocalCAConfig) Validate() error {
+	if len(c.KeyFile) == 0 {
+		return errors.New("key-file is empty")
+	}
+	if !filepath.IsAbs(c.KeyFile) {
+		return errors.New("key-file must be an absolute path")
+	}
+	return nil
+}
+
+// LocalCA is a CA of the local CA backend stored in etcd.
+// A CA may have multiple issuers during a CA rotation.
+type LocalCA struct {
+	// Default is the ID of the issuer that signs certificates.
+	Default string `json:"default"`
+
+	// Issuers are the issuers of the CA keyed by their IDs.
+	Issuers map[string]*LocalCAIssuer `json:"issuers"`
+}
+
+// LocalCAIssuer is a pair of a CA certificate and its encrypted private key.
+type LocalCAIssuer struct {
+	// Certificate is the PEM encoded CA certificate.
+	Certificate string `json:"certificate"`
+
+	// EncryptedKey is the DER encoded private key encrypted with AES-256-GCM.
+	// The nonce is prepended to the cipher text.
+	EncryptedKey []byte `json:"encrypted_key"`
+}
+
+// GenerateLocalCAKey generates a key to encrypt CA private keys.
+// The returned string is the base64 encoded 256-bit key.
+func GenerateLocalCAKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadLocalCAKey loads the key to encrypt CA private keys from the key file.
+func (c *LocalCAConfig) LoadLocalCAKey() (cipher.AEAD, error) {
+	data, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %s: %w", c.KeyFile, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid key length in %s: %d", c.KeyFile, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewLocalCAIssuer generates a self-signed CA and returns it with a new issuer ID.
+func NewLocalCAIssuer(aead cipher.AEAD, commonName string, ttl time.Duration) (string, *LocalCAIssuer, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, localCAKeyBits)
+	if err != nil {
+		return "", nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-CertificateBackdate),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encryptedKey, err := sealLocal(aead, x509.MarshalPKCS1PrivateKey(priv))
+	if err != nil {
+		return "", nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	return hex.EncodeToString(id), &LocalCAIssuer{
+		Certificate:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		EncryptedKey: encryptedKey,
+	}, nil
+}
+
+// DefaultIssuer returns the issuer that signs certificates.
+func (c *LocalCA) DefaultIssuer() (*LocalCAIssuer, error) {
+	i, ok := c.Issuers[c.Default]
+	if !ok {
+		return nil, errors.New("no default issuer: " + c.Default)
+	}
+	return i, nil
+}
+
+func (i *LocalCAIssuer) load(aead cipher.AEAD) (*x509.Certificate, *rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(i.Certificate))
+	if block == nil {
+		return nil, nil, errors.New("invalid PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := openLocal(aead, i.EncryptedKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt CA key: %w", err)
+	}
+	priv, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, priv, nil
+}
+
+// Issue signs a new certificate.
+//
+// roleOpts and certOpts are interpreted in the same way as the parameters
+// of Vault PKI roles and "issue" requests, so that both backends issue
+// the same certificates.
+func (i *LocalCAIssuer) Issue(aead cipher.AEAD, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+	caCert, caKey, err := i.load(aead)
+	if err != nil {
+		return "", "", err
+	}
+
+	opt := func(m map[string]interface{}, name string) string {
+		v, _ := m[name].(string)
+		return v
+	}
+	flag := func(name string) bool {
+		return opt(roleOpts, name) != "false"
+	}
+
+	ttl, err := localCATTL(opt(certOpts, "ttl"), opt(roleOpts, "ttl"), opt(roleOpts, "max_ttl"))
+	if err != nil {
+		return "", "", err
+	}
+
+	commonName := opt(certOpts, "common_name")
+	if commonName == "" {
+		return "", "", errors.New("common_name is empty")
+	}
+	var dnsNames []string
+	var ips []net.IP
+	if opt(certOpts, "exclude_cn_from_sans") != "true" {
+		if ip := net.ParseIP(commonName); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, commonName)
+		}
+	}
+	dnsNames = append(dnsNames, splitOpt(opt(certOpts, "alt_names"))...)
+	for _, s := range splitOpt(opt(certOpts, "ip_sans")) {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", "", errors.New("invalid IP address in ip_sans: " + s)
+		}
+		ips = append(ips, ip)
+	}
+
+	usage := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement | x509.KeyUsageKeyEncipherment
+	if ku := opt(roleOpts, "key_usage"); ku != "" {
+		usage = 0
+		for _, s := range splitOpt(ku) {
+			u, ok := localCAKeyUsages[s]
+			if !ok {
+				return "", "", errors.New("unknown key_usage: " + s)
+			}
+			usage |= u
+		}
+	}
+	var extUsage []x509.ExtKeyUsage
+	if flag("server_flag") {
+		extUsage = append(extUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if flag("client_flag") {
+		extUsage = append(extUsage, x509.ExtKeyUsageClientAuth)
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, localCAKeyBits)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(ttl)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: splitOpt(opt(roleOpts, "organization")),
+		},
+		NotBefore:             now.Add(-CertificateBackdate),
+		NotAfter:              notAfter,
+		KeyUsage:              usage,
+		ExtKeyUsage:           extUsage,
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &priv.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	crt = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	key = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}))
+	return crt, key, nil
+}
+
+var localCAKeyUsages = map[string]x509.KeyUsage{
+	"DigitalSignature":  x509.KeyUsageDigitalSignature,
+	"ContentCommitment": x509.KeyUsageContentCommitment,
+	"KeyEncipherment":   x509.KeyUsageKeyEncipherment,
+	"DataEncipherment":  x509.KeyUsageDataEncipherment,
+	"KeyAgreement":      x509.KeyUsageKeyAgreement,
+	"CertSign":          x509.KeyUsageCertSign,
+	"CRLSign":           x509.KeyUsageCRLSign,
+}
+
+// localCATTL returns the lifetime of a certificate.
+// As Vault does, the requested TTL defaults to the role TTL and is capped by the role max TTL.
+func localCATTL(requested, roleTTL, maxTTL string) (time.Duration, error) {
+	if requested == "" {
+		requested = roleTTL
+	}
+	if requested == "" {
+		requested = maxTTL
+	}
+	ttl, err := time.ParseDuration(requested)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	}
+	if maxTTL != "" {
+		limit, err := time.ParseDuration(maxTTL)
+		if err != nil {
+			return 0, fmt.Errorf("invalid max_ttl: %w", err)
+		}
+		if ttl > limit {
+			ttl = limit
+		}
+	}
+	return ttl, nil
+}
+
+func splitOpt(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// CreateLocalCA creates a CA of the local CA backend and returns its certificate.
+func CreateLocalCA(ctx context.Context, s Storage, cfg *LocalCAConfig, name, commonName, ttl string) (string, error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cfg.LoadLocalCAKey()
+	if err != nil {
+		return "", err
+	}
+	id, issuer, err := NewLocalCAIssuer(aead, commonName, d)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.PutLocalCA(ctx, name, &LocalCA{
+		Default: id,
+		Issuers: map[string]*LocalCAIssuer{id: issuer},
+	})
+	if err != nil {
+		return "", err
+	}
+	return issuer.Certificate, nil
+}
+
+func issueLocalCertificate(ctx context.Context, s Storage, cfg *LocalCAConfig, ca string, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+	aead, err := cfg.LoadLocalCAKey()
+	if err != nil {
+		return "", "", err
+	}
+	lca, err := s.GetLocalCA(ctx, ca)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get local CA %s: %w", ca, err)
+	}
+	issuer, err := lca.DefaultIssuer()
+	if err != nil {
+		return "", "", err
+	}
+	return issuer.Issue(aead, roleOpts, certOpts)
+}
+
+func addLocalCAIssuer(ctx context.Context, s Storage, cfg *LocalCAConfig, ca, commonName, ttl string) (oldIssuer, newIssuer, newCert string, err error) {
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return "", "", "", err
+	}
+	aead, err := cfg.LoadLocalCAKey()
+	if err != nil {
+		return "", "", "", err
+	}
+	id, issuer, err := NewLocalCAIssuer(aead, commonName, d)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	err = s.UpdateLocalCA(ctx, ca, func(lca *LocalCA) error {
+		lca.Issuers[id] = issuer
+		oldIssuer = lca.Default
+		return nil
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+	return oldIssuer, id, issuer.Certificate, nil
+}
+
+func setDefaultLocalCAIssuer(ctx context.Context, s Storage, ca, issuer string) error {
+	return s.UpdateLocalCA(ctx, ca, func(lca *LocalCA) error {
+		if _, ok := lca.Issuers[issuer]; !ok {
+			return errors.New("no such issuer: " + issuer)
+		}
+		lca.Default = issuer
+		return nil
+	})
+}
+
+func deleteLocalCAIssuer(ctx context.Context, s Storage, ca, issuer string) error {
+	return s.UpdateLocalCA(ctx, ca, func(lca *LocalCA) error {
+		if lca.Default == issuer {
+			return errors.New("cannot delete the default issuer: " + issuer)
+		}
+		delete(lca.Issuers, issuer)
+		return nil
+	})
+}
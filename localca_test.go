@@ -0,0 +1,159 @@
+package cke
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestLocalCAConfig(t *testing.T) *LocalCAConfig {
+	key, err := GenerateLocalCAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &LocalCAConfig{KeyFile: filepath.Join(t.TempDir(), "local-ca.key")}
+	err = os.WriteFile(cfg.KeyFile, []byte(key+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func parseTestCertificate(t *testing.T, data string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		t.Fatal("invalid PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestLocalCAConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     LocalCAConfig
+		wantErr bool
+	}{
+		{"valid", LocalCAConfig{KeyFile: "/etc/cke/local-ca.key"}, false},
+		{"empty", LocalCAConfig{}, true},
+		{"relative", LocalCAConfig{KeyFile: "local-ca.key"}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("error is expected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Error("unexpected error", err)
+			}
+		})
+	}
+}
+
+func TestLocalCAIssuer(t *testing.T) {
+	cfg := newTestLocalCAConfig(t)
+	aead, err := cfg.LoadLocalCAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, issuer, err := NewLocalCAIssuer(aead, "test CA", 100*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := parseTestCertificate(t, issuer.Certificate)
+	if !caCert.IsCA || caCert.Subject.CommonName != "test CA" {
+		t.Error("unexpected CA certificate", caCert.Subject, caCert.IsCA)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	crt, key, err := issuer.Issue(aead,
+		map[string]interface{}{
+			"ttl":          "2h",
+			"max_ttl":      "48h",
+			"organization": "system:nodes",
+			"client_flag":  "false",
+		},
+		map[string]interface{}{
+			"common_name": "node1",
+			"alt_names":   "localhost,node1.example.com",
+			"ip_sans":     "127.0.0.1,10.0.0.1",
+			"ttl":         "72h",
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode([]byte(key)); block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Error("unexpected private key")
+	}
+
+	cert := parseTestCertificate(t, crt)
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Error("failed to verify", err)
+	}
+	if cert.Subject.CommonName != "node1" || !cmp.Equal(cert.Subject.Organization, []string{"system:nodes"}) {
+		t.Error("unexpected subject", cert.Subject)
+	}
+	if !cmp.Equal(cert.DNSNames, []string{"node1", "localhost", "node1.example.com"}) {
+		t.Error("unexpected DNS names", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 2 || !cert.IPAddresses[1].Equal(net.ParseIP("10.0.0.1")) {
+		t.Error("unexpected IP addresses", cert.IPAddresses)
+	}
+	if !cmp.Equal(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Error("unexpected extended key usage", cert.ExtKeyUsage)
+	}
+	if lifetime := cert.NotAfter.Sub(cert.NotBefore); lifetime > 48*time.Hour+time.Minute {
+		t.Error("ttl should be capped by max_ttl", lifetime)
+	}
+
+	crt, _, err = issuer.Issue(aead,
+		map[string]interface{}{
+			"ttl":         "87600h",
+			"max_ttl":     "87600h",
+			"server_flag": "false",
+			"client_flag": "false",
+			"key_usage":   "DigitalSignature,CertSign",
+		},
+		map[string]interface{}{
+			"common_name":          "service-account",
+			"exclude_cn_from_sans": "true",
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert = parseTestCertificate(t, crt)
+	if len(cert.DNSNames) != 0 || len(cert.ExtKeyUsage) != 0 {
+		t.Error("unexpected SANs or extended key usage", cert.DNSNames, cert.ExtKeyUsage)
+	}
+	if cert.KeyUsage != x509.KeyUsageDigitalSignature|x509.KeyUsageCertSign {
+		t.Error("unexpected key usage", cert.KeyUsage)
+	}
+	if !cert.NotAfter.Equal(caCert.NotAfter) {
+		t.Error("lifetime should be capped by the CA", cert.NotAfter, caCert.NotAfter)
+	}
+
+	otherCfg := newTestLocalCAConfig(t)
+	otherAEAD, err := otherCfg.LoadLocalCAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = issuer.Issue(otherAEAD, nil, map[string]interface{}{"common_name": "foo", "ttl": "1h"})
+	if err == nil {
+		t.Error("CA key should not be decrypted by another key")
+	}
+}
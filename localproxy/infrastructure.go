@@ -111,6 +111,11 @@ type localDocker struct{}
 
 var _ cke.ContainerEngine = localDocker{}
 
+// Name returns the name of the container engine.
+func (l localDocker) Name() string {
+	return cke.ContainerEngineDocker
+}
+
 // PullImage pulls an image.
 func (l localDocker) PullImage(img cke.Image) error {
 	cmd := exec.Command("docker", "image", "list", "--format={{.Repository}}:{{.Tag}}")
@@ -157,6 +162,11 @@ func (l localDocker) Run(img cke.Image, binds []cke.Mount, command string, args
 
 // RunWithInput runs a container as a foreground process with stdin as a string.
 func (l localDocker) RunWithInput(img cke.Image, binds []cke.Mount, command, input string, args ...string) error {
+	return l.RunWithReader(img, binds, command, bytes.NewReader([]byte(input)), args...)
+}
+
+// RunWithReader runs a container as a foreground process with stdin streamed from input.
+func (l localDocker) RunWithReader(img cke.Image, binds []cke.Mount, command string, input io.Reader, args ...string) error {
 	runArgs := []string{
 		"run",
 		"--log-driver=journald",
@@ -177,7 +187,7 @@ func (l localDocker) RunWithInput(img cke.Image, binds []cke.Mount, command, inp
 	runArgs = append(runArgs, args...)
 
 	cmd := exec.Command("docker", runArgs...)
-	cmd.Stdin = bytes.NewReader([]byte(input))
+	cmd.Stdin = input
 
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -0,0 +1,127 @@
+package cke
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// sealLocal encrypts data with aead.  The nonce is prepended to the cipher text.
+func sealLocal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// openLocal decrypts data encrypted by sealLocal.
+func openLocal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted data")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// ReadLocalSecret reads a secret of the local CA backend.
+// name is the path of the secret in Vault such as SSHSecret.
+// This returns (nil, nil) if the secret does not exist.
+func ReadLocalSecret(ctx context.Context, s Storage, cfg *LocalCAConfig, name string) (map[string]interface{}, error) {
+	data, err := s.GetLocalSecret(ctx, name)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	aead, err := cfg.LoadLocalCAKey()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openLocal(aead, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	var secret map[string]interface{}
+	err = json.Unmarshal(plain, &secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// WriteLocalSecret writes a secret of the local CA backend.
+// The secret is encrypted with the same key as CA private keys.
+func WriteLocalSecret(ctx context.Context, s Storage, cfg *LocalCAConfig, name string, secret map[string]interface{}) error {
+	aead, err := cfg.LoadLocalCAKey()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	data, err := sealLocal(aead, plain)
+	if err != nil {
+		return err
+	}
+	return s.PutLocalSecret(ctx, name, data)
+}
+
+// ReadSecret reads a secret such as SSH private keys.
+// The secret is read from etcd if the local CA backend is configured,
+// or from Vault otherwise.
+// This returns (nil, nil) if the secret does not exist.
+func ReadSecret(ctx context.Context, inf Infrastructure, name string) (map[string]interface{}, error) {
+	return readSecret(ctx, inf.Storage(), inf.Vault, name)
+}
+
+// WriteSecret writes a secret to the same backend as ReadSecret.
+func WriteSecret(ctx context.Context, inf Infrastructure, name string, secret map[string]interface{}) error {
+	cfg, err := localCAConfig(ctx, inf)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		return WriteLocalSecret(ctx, inf.Storage(), cfg, name, secret)
+	}
+
+	vc, err := inf.Vault()
+	if err != nil {
+		return err
+	}
+	_, err = vc.Logical().Write(name, secret)
+	return err
+}
+
+func readSecret(ctx context.Context, s Storage, vaultClient func() (*vault.Client, error), name string) (map[string]interface{}, error) {
+	cfg, err := s.GetLocalCAConfig(ctx)
+	switch err {
+	case nil:
+		return ReadLocalSecret(ctx, s, cfg, name)
+	case ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	vc, err := vaultClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := vc.Logical().Read(name)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	return secret.Data, nil
+}
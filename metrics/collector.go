@@ -59,12 +59,32 @@ func NewCollector(storage storage) prometheus.Collector {
 				isAvailable: alwaysAvailable,
 			},
 			"operation_phase": {
-				collectors:  []prometheus.Collector{operationPhase, operationPhaseTimestampSeconds},
-				isAvailable: isOperationPhaseAvailable,
+				collectors:  []prometheus.Collector{operationPhase, operationPhaseTimestampSeconds, operationFrozen, lastCompletedTimestampSeconds},
+				isAvailable: leaderAvailable,
+			},
+			"operation": {
+				collectors:  []prometheus.Collector{operationDurationSeconds, commandDurationSeconds},
+				isAvailable: leaderAvailable,
+			},
+			"etcd_snapshot": {
+				collectors:  []prometheus.Collector{etcdSnapshotLastSuccessTimestampSeconds, etcdSnapshotLastSizeBytes, etcdSnapshotFailuresTotal},
+				isAvailable: leaderAvailable,
+			},
+			"record_archive": {
+				collectors:  []prometheus.Collector{recordArchiveFailuresTotal},
+				isAvailable: leaderAvailable,
+			},
+			"etcd": {
+				collectors:  []prometheus.Collector{etcdDBSizeBytes, etcdDBSizeInUseBytes, etcdDefragTotal, etcdDefragFailuresTotal, etcdDefragReclaimedBytesTotal},
+				isAvailable: leaderAvailable,
+			},
+			"certificate": {
+				collectors:  []prometheus.Collector{certificateExpiryTimestampSeconds},
+				isAvailable: leaderAvailable,
 			},
 			"node": {
 				collectors:  []prometheus.Collector{nodeMetricsCollector{storage}},
-				isAvailable: isNodeAvailable,
+				isAvailable: leaderAvailable,
 			},
 			"sabakan_integration": {
 				collectors:  []prometheus.Collector{sabakanIntegrationSuccessful, sabakanIntegrationTimestampSeconds, sabakanWorkers, sabakanUnusedMachines},
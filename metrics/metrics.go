@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"github.com/cybozu-go/cke"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -33,6 +34,131 @@ var operationPhaseTimestampSeconds = prometheus.NewGauge(
 	},
 )
 
+var operationFrozen = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operation_frozen",
+		Help:      "1 if operations in the current phase are blocked by the freeze.",
+	},
+)
+
+var lastCompletedTimestampSeconds = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_completed_timestamp_seconds",
+		Help:      "The Unix timestamp when the cluster was last found in the completed phase.",
+	},
+)
+
+var operationDurationSeconds = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "The time taken by operations.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16),
+	},
+	[]string{"operation", "status"},
+)
+
+var commandDurationSeconds = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "The time taken by commands of operations.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16),
+	},
+	[]string{"operation", "command"},
+)
+
+var etcdSnapshotLastSuccessTimestampSeconds = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etcd_snapshot_last_success_timestamp_seconds",
+		Help:      "The Unix timestamp when the last snapshot of etcd was stored successfully.",
+	},
+)
+
+var etcdSnapshotLastSizeBytes = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etcd_snapshot_last_size_bytes",
+		Help:      "The size of the last snapshot of etcd stored successfully.",
+	},
+)
+
+var etcdSnapshotFailuresTotal = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "etcd_snapshot_failures_total",
+		Help:      "The number of failures to take or store snapshots of etcd.",
+	},
+)
+
+var recordArchiveFailuresTotal = prometheus.NewCounterFunc(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_archive_failures_total",
+		Help:      "The number of failures to archive operation records.",
+	},
+	func() float64 {
+		return float64(cke.RecordArchiveFailures())
+	},
+)
+
+var etcdDBSizeBytes = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etcd_db_size_bytes",
+		Help:      "The size of the database of the etcd member.",
+	},
+	[]string{"member"},
+)
+
+var etcdDBSizeInUseBytes = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "etcd_db_size_in_use_bytes",
+		Help:      "The size of the database of the etcd member actually in use.",
+	},
+	[]string{"member"},
+)
+
+var etcdDefragTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "etcd_defrag_total",
+		Help:      "The number of successful defragmentations of the etcd member.",
+	},
+	[]string{"member"},
+)
+
+var etcdDefragFailuresTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "etcd_defrag_failures_total",
+		Help:      "The number of failed defragmentations of the etcd member.",
+	},
+	[]string{"member"},
+)
+
+var etcdDefragReclaimedBytesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "etcd_defrag_reclaimed_bytes_total",
+		Help:      "The total size of the database reclaimed by defragmentations of the etcd member.",
+	},
+	[]string{"member"},
+)
+
+var certificateExpiryTimestampSeconds = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "The Unix timestamp when the certificate on the node expires.",
+	},
+	[]string{"node", "certificate"},
+)
+
 var rebootQueueEnabled = prometheus.NewDesc(
 	prometheus.BuildFQName(namespace, "", "reboot_queue_enabled"),
 	"1 if reboot queue is enabled.",
@@ -33,13 +33,84 @@ func UpdateOperationPhase(phase cke.OperationPhase, ts time.Time) {
 		}
 	}
 	operationPhaseTimestampSeconds.Set(float64(ts.Unix()))
+	if phase == cke.PhaseCompleted {
+		lastCompletedTimestampSeconds.Set(float64(ts.Unix()))
+	}
 }
 
-func isOperationPhaseAvailable(_ context.Context, _ storage) (bool, error) {
-	return isLeader, nil
+// UpdateOperationFrozen updates "operation_frozen".
+func UpdateOperationFrozen(frozen bool) {
+	if frozen {
+		operationFrozen.Set(1)
+	} else {
+		operationFrozen.Set(0)
+	}
+}
+
+// Outcomes of operations used as the status label of "operation_duration_seconds".
+const (
+	OperationCompleted = "completed"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+)
+
+// ObserveOperation updates "operation_duration_seconds".
+// status is one of OperationCompleted, OperationFailed, or OperationCancelled.
+func ObserveOperation(op, status string, duration time.Duration) {
+	operationDurationSeconds.WithLabelValues(op, status).Observe(duration.Seconds())
+}
+
+// ObserveCommand updates "command_duration_seconds".
+func ObserveCommand(op, command string, duration time.Duration) {
+	commandDurationSeconds.WithLabelValues(op, command).Observe(duration.Seconds())
+}
+
+// ObserveEtcdSnapshot updates "etcd_snapshot_last_success_timestamp_seconds" and
+// "etcd_snapshot_last_size_bytes", or "etcd_snapshot_failures_total".
+func ObserveEtcdSnapshot(size int64, ts time.Time, succeeded bool) {
+	if !succeeded {
+		etcdSnapshotFailuresTotal.Inc()
+		return
+	}
+	etcdSnapshotLastSuccessTimestampSeconds.Set(float64(ts.Unix()))
+	etcdSnapshotLastSizeBytes.Set(float64(size))
+}
+
+// UpdateEtcdMemberStatuses updates "etcd_db_size_bytes" and "etcd_db_size_in_use_bytes".
+func UpdateEtcdMemberStatuses(statuses map[string]*cke.EtcdMemberStatus) {
+	etcdDBSizeBytes.Reset()
+	etcdDBSizeInUseBytes.Reset()
+	for member, st := range statuses {
+		etcdDBSizeBytes.WithLabelValues(member).Set(float64(st.DBSize))
+		etcdDBSizeInUseBytes.WithLabelValues(member).Set(float64(st.DBSizeInUse))
+	}
+}
+
+// ObserveEtcdDefrag updates "etcd_defrag_total" and "etcd_defrag_reclaimed_bytes_total",
+// or "etcd_defrag_failures_total".
+func ObserveEtcdDefrag(member string, reclaimed int64, succeeded bool) {
+	if !succeeded {
+		etcdDefragFailuresTotal.WithLabelValues(member).Inc()
+		return
+	}
+	etcdDefragTotal.WithLabelValues(member).Inc()
+	if reclaimed > 0 {
+		etcdDefragReclaimedBytesTotal.WithLabelValues(member).Add(float64(reclaimed))
+	}
+}
+
+// UpdateCertificates updates "certificate_expiry_timestamp_seconds".
+func UpdateCertificates(statuses map[string]*cke.NodeStatus) {
+	certificateExpiryTimestampSeconds.Reset()
+	for node, st := range statuses {
+		for name, cert := range st.Certificates {
+			certificateExpiryTimestampSeconds.WithLabelValues(node, name).Set(float64(cert.NotAfter.Unix()))
+		}
+	}
 }
 
-func isNodeAvailable(_ context.Context, _ storage) (bool, error) {
+// leaderAvailable makes metrics available only when the server is the leader.
+func leaderAvailable(_ context.Context, _ storage) (bool, error) {
 	return isLeader, nil
 }
 
@@ -103,6 +103,12 @@ type updateSabakanIntegrationTestCase struct {
 func TestMetricsUpdater(t *testing.T) {
 	t.Run("UpdateLeader", testUpdateLeader)
 	t.Run("UpdateOperationPhase", testUpdateOperationPhase)
+	t.Run("UpdateOperationFrozen", testUpdateOperationFrozen)
+	t.Run("UpdateLastCompleted", testUpdateLastCompleted)
+	t.Run("ObserveOperation", testObserveOperation)
+	t.Run("ObserveEtcdSnapshot", testObserveEtcdSnapshot)
+	t.Run("ObserveEtcdDefrag", testObserveEtcdDefrag)
+	t.Run("UpdateCertificates", testUpdateCertificates)
 	t.Run("UpdateRebootQueueEntries", testUpdateRebootQueueEntries)
 	t.Run("UpdateRebootQueueItems", testUpdateRebootQueueItems)
 	t.Run("UpdateNodeRebootStatus", testUpdateNodeRebootStatus)
@@ -275,6 +281,316 @@ func testUpdateOperationPhase(t *testing.T) {
 	}
 }
 
+func testUpdateOperationFrozen(t *testing.T) {
+	testCases := []struct {
+		name     string
+		isLeader bool
+		frozen   bool
+		returned bool
+		expected float64
+	}{
+		{
+			name:     "not leader",
+			isLeader: false,
+			frozen:   true,
+			returned: false,
+		},
+		{
+			name:     "frozen",
+			isLeader: true,
+			frozen:   true,
+			returned: true,
+			expected: 1,
+		},
+		{
+			name:     "not frozen",
+			isLeader: true,
+			frozen:   false,
+			returned: true,
+			expected: 0,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			collector, _ := newTestCollector()
+			handler := GetHandler(collector)
+
+			UpdateLeader(tt.isLeader)
+			UpdateOperationFrozen(tt.frozen)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			handler.ServeHTTP(w, req)
+
+			metricsFamily, err := parseMetrics(w.Result())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			metricsFamilyFound := false
+			for _, mf := range metricsFamily {
+				if *mf.Name != "cke_operation_frozen" {
+					continue
+				}
+				metricsFamilyFound = true
+				for _, m := range mf.Metric {
+					if *m.Gauge.Value != tt.expected {
+						t.Errorf("value for cke_operation_frozen is wrong.  expected: %f, actual: %f", tt.expected, *m.Gauge.Value)
+					}
+				}
+			}
+			if tt.returned && !metricsFamilyFound {
+				t.Errorf("metrics cke_operation_frozen was not found")
+			}
+			if !tt.returned && metricsFamilyFound {
+				t.Errorf("metrics cke_operation_frozen should not be returned")
+			}
+		})
+	}
+}
+
+func testUpdateLastCompleted(t *testing.T) {
+	collector, _ := newTestCollector()
+	handler := GetHandler(collector)
+
+	UpdateLeader(true)
+	completedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	UpdateOperationPhase(cke.PhaseCompleted, completedAt)
+	UpdateOperationPhase(cke.PhaseUpgrade, completedAt.Add(time.Minute))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(w, req)
+
+	metricsFamily, err := parseMetrics(w.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, mf := range metricsFamily {
+		if *mf.Name != "cke_last_completed_timestamp_seconds" {
+			continue
+		}
+		found = true
+		value := *mf.Metric[0].Gauge.Value
+		if value != float64(completedAt.Unix()) {
+			t.Errorf("value for cke_last_completed_timestamp_seconds is wrong.  expected: %d, actual: %f", completedAt.Unix(), value)
+		}
+	}
+	if !found {
+		t.Error("metrics cke_last_completed_timestamp_seconds was not found")
+	}
+}
+
+func testObserveOperation(t *testing.T) {
+	collector, _ := newTestCollector()
+	handler := GetHandler(collector)
+
+	UpdateLeader(true)
+	ObserveOperation("test-op", OperationCompleted, 3*time.Second)
+	ObserveOperation("test-op", OperationCompleted, 5*time.Second)
+	ObserveOperation("test-op", OperationFailed, time.Second)
+	ObserveCommand("test-op", "testCommand", 2*time.Second)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(w, req)
+
+	metricsFamily, err := parseMetrics(w.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, mf := range metricsFamily {
+		for _, m := range mf.Metric {
+			labels := labelToMap(m.Label)
+			switch *mf.Name {
+			case "cke_operation_duration_seconds":
+				switch {
+				case hasLabels(labels, map[string]string{"operation": "test-op", "status": OperationCompleted}):
+					found["completed"] = true
+					if *m.Histogram.SampleCount != 2 {
+						t.Errorf("sample count of completed cke_operation_duration_seconds is wrong: %d", *m.Histogram.SampleCount)
+					}
+					if *m.Histogram.SampleSum != 8 {
+						t.Errorf("sample sum of completed cke_operation_duration_seconds is wrong: %f", *m.Histogram.SampleSum)
+					}
+				case hasLabels(labels, map[string]string{"operation": "test-op", "status": OperationFailed}):
+					found["failed"] = true
+					if *m.Histogram.SampleCount != 1 {
+						t.Errorf("sample count of failed cke_operation_duration_seconds is wrong: %d", *m.Histogram.SampleCount)
+					}
+				}
+			case "cke_command_duration_seconds":
+				if !hasLabels(labels, map[string]string{"operation": "test-op", "command": "testCommand"}) {
+					continue
+				}
+				found[*mf.Name] = true
+				if *m.Histogram.SampleCount != 1 {
+					t.Errorf("sample count of cke_command_duration_seconds is wrong: %d", *m.Histogram.SampleCount)
+				}
+			}
+		}
+	}
+	for _, name := range []string{"completed", "failed", "cke_command_duration_seconds"} {
+		if !found[name] {
+			t.Errorf("metrics %s was not found", name)
+		}
+	}
+}
+
+func testObserveEtcdSnapshot(t *testing.T) {
+	collector, _ := newTestCollector()
+	handler := GetHandler(collector)
+
+	UpdateLeader(true)
+	takenAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ObserveEtcdSnapshot(1024, takenAt, true)
+	ObserveEtcdSnapshot(0, takenAt.Add(time.Hour), false)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(w, req)
+
+	metricsFamily, err := parseMetrics(w.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{
+		"cke_etcd_snapshot_last_success_timestamp_seconds": float64(takenAt.Unix()),
+		"cke_etcd_snapshot_last_size_bytes":                1024,
+		"cke_etcd_snapshot_failures_total":                 1,
+	}
+	found := map[string]bool{}
+	for _, mf := range metricsFamily {
+		want, ok := expected[*mf.Name]
+		if !ok {
+			continue
+		}
+		found[*mf.Name] = true
+		var value float64
+		if mf.Metric[0].Counter != nil {
+			value = *mf.Metric[0].Counter.Value
+		} else {
+			value = *mf.Metric[0].Gauge.Value
+		}
+		if value != want {
+			t.Errorf("value for %s is wrong.  expected: %f, actual: %f", *mf.Name, want, value)
+		}
+	}
+	for name := range expected {
+		if !found[name] {
+			t.Errorf("metrics %s was not found", name)
+		}
+	}
+}
+
+func testObserveEtcdDefrag(t *testing.T) {
+	collector, _ := newTestCollector()
+	handler := GetHandler(collector)
+
+	UpdateLeader(true)
+	UpdateEtcdMemberStatuses(map[string]*cke.EtcdMemberStatus{
+		"10.0.0.11": {DBSize: 4096, DBSizeInUse: 1024},
+	})
+	ObserveEtcdDefrag("10.0.0.11", 3072, true)
+	ObserveEtcdDefrag("10.0.0.11", 0, false)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(w, req)
+
+	metricsFamily, err := parseMetrics(w.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]float64{
+		"cke_etcd_db_size_bytes":                4096,
+		"cke_etcd_db_size_in_use_bytes":         1024,
+		"cke_etcd_defrag_total":                 1,
+		"cke_etcd_defrag_failures_total":        1,
+		"cke_etcd_defrag_reclaimed_bytes_total": 3072,
+	}
+	found := map[string]bool{}
+	for _, mf := range metricsFamily {
+		want, ok := expected[*mf.Name]
+		if !ok {
+			continue
+		}
+		found[*mf.Name] = true
+		if len(mf.Metric) != 1 {
+			t.Fatalf("metrics %s should have exactly one member: %d", *mf.Name, len(mf.Metric))
+		}
+		if lm := labelToMap(mf.Metric[0].Label); lm["member"] != "10.0.0.11" {
+			t.Errorf("unexpected labels for %s: %v", *mf.Name, lm)
+		}
+		var value float64
+		if mf.Metric[0].Counter != nil {
+			value = *mf.Metric[0].Counter.Value
+		} else {
+			value = *mf.Metric[0].Gauge.Value
+		}
+		if value != want {
+			t.Errorf("value for %s is wrong.  expected: %f, actual: %f", *mf.Name, want, value)
+		}
+	}
+	for name := range expected {
+		if !found[name] {
+			t.Errorf("metrics %s was not found", name)
+		}
+	}
+}
+
+func testUpdateCertificates(t *testing.T) {
+	collector, _ := newTestCollector()
+	handler := GetHandler(collector)
+
+	notAfter := time.Unix(1800000000, 0)
+	UpdateLeader(true)
+	UpdateCertificates(map[string]*cke.NodeStatus{
+		"10.0.0.11": {
+			Certificates: map[string]cke.CertificateStatus{
+				cke.CertKubelet: {NotBefore: notAfter.Add(-time.Hour), NotAfter: notAfter},
+			},
+		},
+		"10.0.0.12": {},
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(w, req)
+
+	metricsFamily, err := parseMetrics(w.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, mf := range metricsFamily {
+		if *mf.Name != "cke_certificate_expiry_timestamp_seconds" {
+			continue
+		}
+		found = true
+		if len(mf.Metric) != 1 {
+			t.Fatalf("metrics %s should have exactly one member: %d", *mf.Name, len(mf.Metric))
+		}
+		lm := labelToMap(mf.Metric[0].Label)
+		if lm["node"] != "10.0.0.11" || lm["certificate"] != cke.CertKubelet {
+			t.Errorf("unexpected labels for %s: %v", *mf.Name, lm)
+		}
+		if value := *mf.Metric[0].Gauge.Value; value != 1800000000 {
+			t.Errorf("value for %s is wrong.  expected: %d, actual: %f", *mf.Name, 1800000000, value)
+		}
+	}
+	if !found {
+		t.Error("metrics cke_certificate_expiry_timestamp_seconds was not found")
+	}
+}
+
 func testUpdateRebootQueueEntries(t *testing.T) {
 	testCases := []updateRebootQueueEntriesTestCase{
 		{
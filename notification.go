@@ -0,0 +1,296 @@
+package cke
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+)
+
+// NotificationEvent is the type of events sent to notification sinks.
+type NotificationEvent string
+
+// Notification events
+const (
+	EventOperationStarted   = NotificationEvent("operation-started")
+	EventOperationCompleted = NotificationEvent("operation-completed")
+	EventOperationFailed    = NotificationEvent("operation-failed")
+	EventRebootDrainFailed  = NotificationEvent("reboot-drain-failed")
+	EventRepairDrainFailed  = NotificationEvent("repair-drain-failed")
+	EventRepairSucceeded    = NotificationEvent("repair-succeeded")
+	EventRepairFailed       = NotificationEvent("repair-failed")
+)
+
+// AllNotificationEvents contains all kinds of NotificationEvent.
+var AllNotificationEvents = []NotificationEvent{
+	EventOperationStarted,
+	EventOperationCompleted,
+	EventOperationFailed,
+	EventRebootDrainFailed,
+	EventRepairDrainFailed,
+	EventRepairSucceeded,
+	EventRepairFailed,
+}
+
+// Notification is a message sent to notification sinks.
+type Notification struct {
+	Event       NotificationEvent `json:"event"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Message     string            `json:"message"`
+	Record      *Record           `json:"record,omitempty"`
+	RebootEntry *RebootQueueEntry `json:"reboot_entry,omitempty"`
+	RepairEntry *RepairQueueEntry `json:"repair_entry,omitempty"`
+}
+
+// Notifier is the interface to send notifications.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Notification sink types
+const (
+	NotificationSinkWebhook = "webhook"
+	NotificationSinkSlack   = "slack"
+)
+
+// NotificationSink is the configuration of a notification sink.
+type NotificationSink struct {
+	// Name is the name of the sink used in logs.
+	Name string `json:"name"`
+
+	// Type is either "webhook" or "slack".
+	Type string `json:"type"`
+
+	// URL is the URL to which notifications are POSTed.
+	URL string `json:"url"`
+
+	// Events is the list of events sent to the sink.
+	// If empty, all events are sent.
+	Events []NotificationEvent `json:"events,omitempty"`
+}
+
+// Accepts returns true if the sink should receive ev.
+func (s *NotificationSink) Accepts(ev NotificationEvent) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, ev)
+}
+
+// NotificationConfig is the configuration of notifications.
+type NotificationConfig struct {
+	Sinks []NotificationSink `json:"sinks"`
+}
+
+// Validate validates the notification configuration.
+func (c *NotificationConfig) Validate() error {
+	names := make(map[string]bool)
+	for i, s := range c.Sinks {
+		if len(s.Name) == 0 {
+			return fmt.Errorf("sinks[%d]: name is empty", i)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("sinks[%d]: duplicate name: %s", i, s.Name)
+		}
+		names[s.Name] = true
+
+		switch s.Type {
+		case NotificationSinkWebhook, NotificationSinkSlack:
+		default:
+			return fmt.Errorf("sinks[%d]: unknown type: %s", i, s.Type)
+		}
+
+		if len(s.URL) == 0 {
+			return fmt.Errorf("sinks[%d]: url is empty", i)
+		}
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return fmt.Errorf("sinks[%d]: %w", i, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("sinks[%d]: invalid url: %s", i, s.URL)
+		}
+
+		for _, ev := range s.Events {
+			if !slices.Contains(AllNotificationEvents, ev) {
+				return fmt.Errorf("sinks[%d]: unknown event: %s", i, ev)
+			}
+		}
+	}
+	return nil
+}
+
+// NewNotifier creates a Notifier for the sink.
+func NewNotifier(s NotificationSink) (Notifier, error) {
+	switch s.Type {
+	case NotificationSinkWebhook:
+		return webhookNotifier{url: s.URL}, nil
+	case NotificationSinkSlack:
+		return slackNotifier{url: s.URL}, nil
+	}
+	return nil, errors.New("unknown notification sink type: " + s.Type)
+}
+
+func postJSON(ctx context.Context, url string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookNotifier POSTs Notification as JSON.
+type webhookNotifier struct {
+	url string
+}
+
+func (w webhookNotifier) Notify(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, w.url, n)
+}
+
+// slackNotifier POSTs a message compatible with Slack incoming webhooks.
+type slackNotifier struct {
+	url string
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+func (s slackNotifier) Notify(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, s.url, slackPayload{
+		Text: fmt.Sprintf("[CKE] %s: %s", n.Event, n.Message),
+	})
+}
+
+const (
+	notificationTimeout   = 10 * time.Second
+	notificationQueueSize = 100
+)
+
+type notificationRequest struct {
+	storage Storage
+	n       *Notification
+}
+
+// notificationQueue is a bounded queue of notifications to be delivered.
+type notificationQueue struct {
+	ch   chan notificationRequest
+	once sync.Once
+}
+
+var defaultNotificationQueue = &notificationQueue{
+	ch: make(chan notificationRequest, notificationQueueSize),
+}
+
+// push adds a request to the queue.  This returns false if the queue is full.
+func (q *notificationQueue) push(req notificationRequest) bool {
+	select {
+	case q.ch <- req:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *notificationQueue) run() {
+	for req := range q.ch {
+		deliverNotification(context.Background(), req.storage, req.n)
+	}
+}
+
+// Notify queues n to be sent to the sinks configured in etcd.
+// Notifications are delivered asynchronously so that slow sinks do not
+// block operations.  If the queue is full, n is dropped.
+// Notifications are best-effort; failures are only logged.
+func Notify(ctx context.Context, s Storage, n *Notification) {
+	if n.Timestamp.IsZero() {
+		n.Timestamp = time.Now().UTC()
+	}
+
+	// copy the objects as callers may modify them after Notify returns.
+	copied := *n
+	if n.Record != nil {
+		r := *n.Record
+		copied.Record = &r
+	}
+	if n.RebootEntry != nil {
+		e := *n.RebootEntry
+		copied.RebootEntry = &e
+	}
+	if n.RepairEntry != nil {
+		e := *n.RepairEntry
+		copied.RepairEntry = &e
+	}
+
+	q := defaultNotificationQueue
+	q.once.Do(func() {
+		go q.run()
+	})
+	if !q.push(notificationRequest{storage: s, n: &copied}) {
+		log.Warn("notification queue is full; dropped a notification", map[string]interface{}{
+			"event": n.Event,
+		})
+	}
+}
+
+// deliverNotification sends n to the sinks configured in etcd.
+func deliverNotification(ctx context.Context, s Storage, n *Notification) {
+	cfg, err := s.GetNotificationConfig(ctx)
+	if err == ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Warn("failed to get notification config", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+
+	for _, sink := range cfg.Sinks {
+		if !sink.Accepts(n.Event) {
+			continue
+		}
+		notifier, err := NewNotifier(sink)
+		if err != nil {
+			log.Warn("invalid notification sink", map[string]interface{}{
+				log.FnError: err,
+				"sink":      sink.Name,
+			})
+			continue
+		}
+
+		err = func() error {
+			ctx, cancel := context.WithTimeout(ctx, notificationTimeout)
+			defer cancel()
+			return notifier.Notify(ctx, n)
+		}()
+		if err != nil {
+			log.Warn("failed to send notification", map[string]interface{}{
+				log.FnError: err,
+				"sink":      sink.Name,
+				"event":     n.Event,
+			})
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package cke
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotificationConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     NotificationConfig
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			cfg: NotificationConfig{
+				Sinks: []NotificationSink{
+					{Name: "hook", Type: NotificationSinkWebhook, URL: "https://example.com/hook"},
+					{Name: "slack", Type: NotificationSinkSlack, URL: "https://hooks.slack.com/services/xxx", Events: []NotificationEvent{EventRepairFailed}},
+				},
+			},
+		},
+		{
+			name: "empty",
+			cfg:  NotificationConfig{},
+		},
+		{
+			name: "no name",
+			cfg: NotificationConfig{
+				Sinks: []NotificationSink{{Type: NotificationSinkWebhook, URL: "https://example.com/hook"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate name",
+			cfg: NotificationConfig{
+				Sinks: []NotificationSink{
+					{Name: "hook", Type: NotificationSinkWebhook, URL: "https://example.com/hook1"},
+					{Name: "hook", Type: NotificationSinkWebhook, URL: "https://example.com/hook2"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown type",
+			cfg: NotificationConfig{
+				Sinks: []NotificationSink{{Name: "hook", Type: "email", URL: "https://example.com/hook"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid url",
+			cfg: NotificationConfig{
+				Sinks: []NotificationSink{{Name: "hook", Type: NotificationSinkWebhook, URL: "example.com/hook"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown event",
+			cfg: NotificationConfig{
+				Sinks: []NotificationSink{{Name: "hook", Type: NotificationSinkWebhook, URL: "https://example.com/hook", Events: []NotificationEvent{"foo"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("error is expected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Error("unexpected error:", err)
+			}
+		})
+	}
+}
+
+func TestDeliverNotification(t *testing.T) {
+	var mu sync.Mutex
+	var webhooks []Notification
+	var slacks []slackPayload
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/webhook":
+			var n Notification
+			if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+				t.Error(err)
+			}
+			webhooks = append(webhooks, n)
+		case "/slack":
+			var p slackPayload
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				t.Error(err)
+			}
+			slacks = append(slacks, p)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	// no configuration; nothing happens
+	deliverNotification(ctx, storage, &Notification{Event: EventOperationStarted, Message: "test"})
+
+	cfg := &NotificationConfig{
+		Sinks: []NotificationSink{
+			{Name: "hook", Type: NotificationSinkWebhook, URL: ts.URL + "/webhook"},
+			{Name: "slack", Type: NotificationSinkSlack, URL: ts.URL + "/slack", Events: []NotificationEvent{EventRepairFailed}},
+			{Name: "broken", Type: NotificationSinkWebhook, URL: ts.URL + "/broken"},
+		},
+	}
+	err := storage.PutNotificationConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliverNotification(ctx, storage, &Notification{
+		Event:     EventOperationStarted,
+		Timestamp: time.Now().UTC(),
+		Message:   "operation started",
+		Record:    NewRecord(1, "my-operation", []string{"10.0.0.1"}),
+	})
+	deliverNotification(ctx, storage, &Notification{
+		Event:       EventRepairFailed,
+		Message:     "repair failed",
+		RepairEntry: NewRepairQueueEntry("op1", "machine1", "10.0.0.1", "serial1"),
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(webhooks) != 2 {
+		t.Fatal("unexpected number of webhook notifications:", len(webhooks))
+	}
+	if webhooks[0].Event != EventOperationStarted || webhooks[0].Record == nil || webhooks[0].Record.Operation != "my-operation" {
+		t.Error("unexpected webhook notification:", webhooks[0])
+	}
+	if webhooks[0].Timestamp.IsZero() {
+		t.Error("timestamp is not set")
+	}
+	if webhooks[1].Event != EventRepairFailed || webhooks[1].RepairEntry == nil || webhooks[1].RepairEntry.Address != "10.0.0.1" {
+		t.Error("unexpected webhook notification:", webhooks[1])
+	}
+
+	if len(slacks) != 1 {
+		t.Fatal("unexpected number of slack notifications:", len(slacks))
+	}
+	if slacks[0].Text != "[CKE] repair-failed: repair failed" {
+		t.Error("unexpected slack notification:", slacks[0].Text)
+	}
+}
+
+func TestNotificationQueue(t *testing.T) {
+	q := &notificationQueue{ch: make(chan notificationRequest, 1)}
+
+	if !q.push(notificationRequest{n: &Notification{Event: EventOperationStarted}}) {
+		t.Error("failed to push a notification")
+	}
+	if q.push(notificationRequest{n: &Notification{Event: EventOperationCompleted}}) {
+		t.Error("notification should be dropped when the queue is full")
+	}
+
+	req := <-q.ch
+	if req.n.Event != EventOperationStarted {
+		t.Error("unexpected notification:", req.n)
+	}
+}
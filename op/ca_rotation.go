@@ -0,0 +1,173 @@
+package op
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+)
+
+type caRotationOp struct {
+	apiserver       *cke.Node
+	rotation        cke.CARotation
+	trustedMappings []cke.TrustedRESTMapping
+	done            bool
+}
+
+// CARotationOp returns an Operator to advance the CA rotation by one phase.
+//
+// The phases proceed as follows.  Components having certificates related
+// to the CA are restarted between the phases.
+//
+//  1. The bundle of the old and the new CA is distributed.
+//  2. The new CA becomes the default issuer of the CA backend.
+//  3. The new CA is distributed alone.
+//  4. The old CA is deleted from the CA backend.
+//
+// For the webhook CA, user-defined webhook configurations and Secrets are
+// re-applied in each phase instead of restarting components.
+func CARotationOp(apiserver *cke.Node, r *cke.CARotation, trustedMappings []cke.TrustedRESTMapping) cke.Operator {
+	return &caRotationOp{
+		apiserver:       apiserver,
+		rotation:        *r,
+		trustedMappings: trustedMappings,
+	}
+}
+
+func (o *caRotationOp) Name() string {
+	return "ca-rotation"
+}
+
+func (o *caRotationOp) NextCommand() cke.Commander {
+	if o.done {
+		return nil
+	}
+	o.done = true
+
+	switch o.rotation.Phase {
+	case cke.CARotationAdded:
+		return distributeCACommand{o, o.rotation.Bundle(), cke.CARotationBundled}
+	case cke.CARotationBundled:
+		return switchCAIssuerCommand{o}
+	case cke.CARotationSwitched:
+		return distributeCACommand{o, o.rotation.NewCertificate, cke.CARotationDropped}
+	case cke.CARotationDropped:
+		return retireCAIssuerCommand{o.rotation}
+	}
+
+	log.Warn("unknown CA rotation phase", map[string]interface{}{
+		"phase": o.rotation.Phase,
+	})
+	return nil
+}
+
+func (o *caRotationOp) Targets() []string {
+	return []string{o.apiserver.Address}
+}
+
+// reapplyWebhookResources re-applies user-defined resources that may have
+// the CA certificate or certificates issued by the webhook CA.
+func (o *caRotationOp) reapplyWebhookResources(ctx context.Context, inf cke.Infrastructure) error {
+	if o.rotation.Name != cke.CAWebhook {
+		return nil
+	}
+
+	resources, err := inf.Storage().GetAllResources(ctx)
+	if err != nil {
+		return err
+	}
+	dyn, mapper, err := resourceClients(ctx, inf, o.apiserver)
+	if err != nil {
+		return err
+	}
+	for _, res := range resources {
+		switch res.Kind {
+		case cke.KindSecret, cke.KindValidatingWebhookConfiguration, cke.KindMutatingWebhookConfiguration:
+		default:
+			continue
+		}
+		err := cke.ApplyResource(ctx, dyn, mapper, inf, res.Definition, res.Revision, o.trustedMappings, true)
+		if err != nil {
+			return fmt.Errorf("failed to re-apply %s: %w", res.String(), err)
+		}
+	}
+	return nil
+}
+
+// advance updates the rotation to the next phase.
+func (o *caRotationOp) advance(ctx context.Context, inf cke.Infrastructure, leaderKey string, phase cke.CARotationPhase) error {
+	r := o.rotation
+	r.Phase = phase
+	r.PhaseStarted = time.Now().UTC()
+	return inf.Storage().UpdateCARotation(ctx, leaderKey, &r)
+}
+
+type distributeCACommand struct {
+	op    *caRotationOp
+	pem   string
+	phase cke.CARotationPhase
+}
+
+func (c distributeCACommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := inf.Storage().PutCACertificate(ctx, c.op.rotation.Name, c.pem)
+	if err != nil {
+		return err
+	}
+	err = c.op.reapplyWebhookResources(ctx, inf)
+	if err != nil {
+		return err
+	}
+	return c.op.advance(ctx, inf, leaderKey, c.phase)
+}
+
+func (c distributeCACommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "distribute-ca",
+		Target: c.op.rotation.Name,
+	}
+}
+
+type switchCAIssuerCommand struct {
+	op *caRotationOp
+}
+
+func (c switchCAIssuerCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	err := cke.SetDefaultCAIssuer(ctx, inf, c.op.rotation.Name, c.op.rotation.NewIssuer)
+	if err != nil {
+		return err
+	}
+	err = c.op.reapplyWebhookResources(ctx, inf)
+	if err != nil {
+		return err
+	}
+	return c.op.advance(ctx, inf, leaderKey, cke.CARotationSwitched)
+}
+
+func (c switchCAIssuerCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "switch-ca-issuer",
+		Target: c.op.rotation.Name,
+	}
+}
+
+type retireCAIssuerCommand struct {
+	rotation cke.CARotation
+}
+
+func (c retireCAIssuerCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	// The issuer is already deleted if the previous attempt failed after deletion.
+	err := cke.DeleteCAIssuer(ctx, inf, c.rotation.Name, c.rotation.OldIssuer)
+	if err != nil {
+		return err
+	}
+	return inf.Storage().FinishCARotation(ctx, leaderKey)
+}
+
+func (c retireCAIssuerCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "retire-ca-issuer",
+		Target: c.rotation.Name,
+	}
+}
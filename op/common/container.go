@@ -13,11 +13,13 @@ type runContainerCommand struct {
 	nodes     []*cke.Node
 	name      string
 	img       cke.Image
+	imgMap    map[string]cke.Image
 	opts      []string
 	optsMap   map[string][]string
 	params    cke.ServiceParams
 	paramsMap map[string]cke.ServiceParams
 	extra     cke.ServiceParams
+	extraMap  map[string]cke.ServiceParams
 
 	restart bool
 }
@@ -39,6 +41,11 @@ func WithRestart() RunOption {
 	return func(c *runContainerCommand) { c.restart = true }
 }
 
+// WithImageMap returns RunOption to set the image for each node.
+func WithImageMap(imgMap map[string]cke.Image) RunOption {
+	return func(c *runContainerCommand) { c.imgMap = imgMap }
+}
+
 // WithOpts returns RunOption to set container engine options.
 func WithOpts(opts []string) RunOption {
 	return func(c *runContainerCommand) { c.opts = opts }
@@ -64,12 +71,21 @@ func WithExtra(params cke.ServiceParams) RunOption {
 	return func(c *runContainerCommand) { c.extra = params }
 }
 
+// WithExtraMap returns RunOption to set extra ServiceParams for each node.
+func WithExtraMap(extraMap map[string]cke.ServiceParams) RunOption {
+	return func(c *runContainerCommand) { c.extraMap = extraMap }
+}
+
 func (c runContainerCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
 	env := well.NewEnvironment(ctx)
 	for _, n := range c.nodes {
 		n := n
 		ce := inf.Engine(n.Address)
 		env.Go(func(ctx context.Context) error {
+			img, ok := c.imgMap[n.Address]
+			if !ok {
+				img = c.img
+			}
 			params, ok := c.paramsMap[n.Address]
 			if !ok {
 				params = c.params
@@ -78,6 +94,10 @@ func (c runContainerCommand) Run(ctx context.Context, inf cke.Infrastructure, _
 			if !ok {
 				opts = c.opts
 			}
+			extra, ok := c.extraMap[n.Address]
+			if !ok {
+				extra = c.extra
+			}
 			if c.restart {
 				err := ce.Kill(c.name)
 				if err != nil {
@@ -94,7 +114,7 @@ func (c runContainerCommand) Run(ctx context.Context, inf cke.Infrastructure, _
 					return err
 				}
 			}
-			return ce.RunSystem(c.name, c.img, opts, params, c.extra)
+			return ce.RunSystem(c.name, img, opts, params, extra)
 		})
 	}
 	env.Stop()
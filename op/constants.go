@@ -34,6 +34,8 @@ const (
 	RiversContainerName = "rivers"
 	// EtcdRiversContainerName is container name of etcd-rivers
 	EtcdRiversContainerName = "etcd-rivers"
+	// KMSPluginContainerName is container name of the KMS plugin for kube-apiserver
+	KMSPluginContainerName = "kms-plugin"
 
 	// RiversUpstreamPort is upstream port of rivers container
 	RiversUpstreamPort = 6443
@@ -73,6 +75,12 @@ const (
 	// SchedulerKubeConfigPath is a path for scheduler kubeconfig
 	SchedulerKubeConfigPath = "/etc/kubernetes/scheduler/kubeconfig"
 
+	// AuditWebhookCertPath is a path for the client certificate of kube-apiserver for the audit webhook backend
+	AuditWebhookCertPath = k8sPKIPath + "/audit-webhook.crt"
+
+	// KMSPluginConfigPath is a path for the KMS plugin config including AppRole credentials
+	KMSPluginConfigPath = "/etc/kubernetes/kms/vault.json"
+
 	// ControllerManagerKubeConfigPath is a path for controller-manager kubeconfig
 	ControllerManagerKubeConfigPath = "/etc/kubernetes/controller-manager/kubeconfig"
 )
@@ -0,0 +1,198 @@
+package op
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+)
+
+// engineMigrationContainers is the list of system containers to be migrated.
+// Containers are stopped in this order so that dependents stop first, except
+// that kubelet is stopped last so that it stops the static pods.
+var engineMigrationContainers = []string{
+	KubeProxyContainerName,
+	KubeSchedulerContainerName,
+	KubeControllerManagerContainerName,
+	KubeAPIServerContainerName,
+	KMSPluginContainerName,
+	RiversContainerName,
+	EtcdRiversContainerName,
+	EtcdContainerName,
+	KubeletContainerName,
+}
+
+type engineMigrationOp struct {
+	node    *cke.Node
+	volumes []string
+	step    int
+}
+
+// EngineMigrationOp returns an Operator to migrate system containers on
+// a node from docker to containerd.
+//
+// The operator stops the system containers in docker, copies the docker
+// volumes into containerd volume directories, and removes the containers
+// and volumes from docker.  The containers are then started in containerd
+// by the usual boot operators.
+func EngineMigrationOp(node *cke.Node, params cke.EtcdParams) cke.Operator {
+	return &engineMigrationOp{
+		node:    node,
+		volumes: []string{EtcdVolumeName(params), EtcdAddedMemberVolumeName},
+	}
+}
+
+func (o *engineMigrationOp) Name() string {
+	return "container-engine-migration"
+}
+
+func (o *engineMigrationOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return stopDockerContainersCommand{o.node}
+	case 1:
+		o.step++
+		return copyDockerVolumesCommand{o.node, o.volumes}
+	case 2:
+		o.step++
+		return removeDockerContainersCommand{o.node, o.volumes}
+	}
+	return nil
+}
+
+func (o *engineMigrationOp) Targets() []string {
+	return []string{o.node.Address}
+}
+
+func dockerEngine(inf cke.Infrastructure, node *cke.Node) (cke.Agent, cke.ContainerEngine, error) {
+	agent := inf.Agent(node.Address)
+	if agent == nil {
+		return nil, nil, errors.New("unable to prepare agent for " + node.Address)
+	}
+	return agent, cke.Docker(agent), nil
+}
+
+type stopDockerContainersCommand struct {
+	node *cke.Node
+}
+
+// Run stops the system containers.  The container engine of the node is
+// still docker, and static pods, if any, are stopped along with them
+// because their data volumes are migrated.
+func (c stopDockerContainersCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	ce := inf.Engine(c.node.Address)
+	statuses, err := ce.Inspect(engineMigrationContainers)
+	if err != nil {
+		return err
+	}
+	for _, name := range engineMigrationContainers {
+		if !statuses[name].Running {
+			continue
+		}
+		err := ce.Stop(name)
+		if err != nil {
+			return fmt.Errorf("failed to stop %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c stopDockerContainersCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "stop-docker-containers",
+		Target: c.node.Address,
+	}
+}
+
+type copyDockerVolumesCommand struct {
+	node    *cke.Node
+	volumes []string
+}
+
+// Run copies docker volumes to containerd volume directories.
+// The containers are kept in docker until the copy succeeds so that
+// CKE can restart them in docker in case of failures.
+func (c copyDockerVolumesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	agent, ce, err := dockerEngine(inf, c.node)
+	if err != nil {
+		return err
+	}
+	for _, name := range c.volumes {
+		exists, err := ce.VolumeExists(name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		stdout, stderr, err := agent.Run("docker volume inspect --format '{{.Mountpoint}}' " + name)
+		if err != nil {
+			return fmt.Errorf("failed to inspect volume %s: %w, stderr: %s", name, err, stderr)
+		}
+		src := strings.TrimSpace(string(stdout))
+		dst := cke.ContainerdVolumePath(name)
+		cmdline := fmt.Sprintf("mkdir -p %s && cp -a %s/. %s/", dst, src, dst)
+		_, stderr, err = agent.Run(cmdline)
+		if err != nil {
+			return fmt.Errorf("failed to copy volume %s: %w, stderr: %s", name, err, stderr)
+		}
+	}
+	return nil
+}
+
+func (c copyDockerVolumesCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "copy-docker-volumes",
+		Target: strings.Join(c.volumes, ","),
+	}
+}
+
+type removeDockerContainersCommand struct {
+	node    *cke.Node
+	volumes []string
+}
+
+func (c removeDockerContainersCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	_, ce, err := dockerEngine(inf, c.node)
+	if err != nil {
+		return err
+	}
+	for _, name := range engineMigrationContainers {
+		exists, err := ce.Exists(name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		err = ce.Remove(name)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	for _, name := range c.volumes {
+		exists, err := ce.VolumeExists(name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		err = ce.VolumeRemove(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c removeDockerContainersCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "remove-docker-containers",
+		Target: c.node.Address,
+	}
+}
@@ -1,6 +1,13 @@
 package op
 
-import "github.com/cybozu-go/cke"
+import (
+	"context"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
 
 // EtcdVolumeName returns etcd volume name
 func EtcdVolumeName(e cke.EtcdParams) string {
@@ -9,3 +16,117 @@ func EtcdVolumeName(e cke.EtcdParams) string {
 	}
 	return e.VolumeName
 }
+
+type moveEtcdLeaderCommand struct {
+	cpNodes []*cke.Node
+	targets []string
+}
+
+// MoveEtcdLeaderCommand returns a Commander to transfer the leadership of etcd
+// to another healthy in-sync member if a member on one of targets is the leader.
+// It does nothing if no member can take over the leadership.
+func MoveEtcdLeaderCommand(cpNodes []*cke.Node, targets []string) cke.Commander {
+	return moveEtcdLeaderCommand{
+		cpNodes: cpNodes,
+		targets: targets,
+	}
+}
+
+func (c moveEtcdLeaderCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	isTarget := make(map[string]bool)
+	for _, t := range c.targets {
+		isTarget[t] = true
+	}
+
+	endpoints := make([]string, len(c.cpNodes))
+	for i, n := range c.cpNodes {
+		endpoints[i] = etcdEndpoint(n.Address)
+	}
+	cli, err := inf.NewEtcdClient(ctx, endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	statuses := make(map[string]*clientv3.StatusResponse)
+	var leader string
+	for _, n := range c.cpNodes {
+		ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		resp, err := cli.Status(ct, etcdEndpoint(n.Address))
+		cancel()
+		if err != nil {
+			continue
+		}
+		statuses[n.Address] = resp
+		if resp.Leader == resp.Header.MemberId {
+			leader = n.Address
+		}
+	}
+	if leader == "" || !isTarget[leader] {
+		return nil
+	}
+
+	rev := statuses[leader].Header.Revision
+	var transferee string
+	for _, n := range c.cpNodes {
+		st := statuses[n.Address]
+		if st == nil || isTarget[n.Address] || st.IsLearner || len(st.Errors) > 0 {
+			continue
+		}
+		if !EtcdMemberInSync(ctx, inf, n.Address, rev, false) {
+			continue
+		}
+		transferee = n.Address
+		break
+	}
+	if transferee == "" {
+		log.Warn("no etcd member can take over the leadership", map[string]interface{}{
+			"leader": leader,
+		})
+		return nil
+	}
+
+	leaderCli, err := inf.NewEtcdClient(ctx, []string{etcdEndpoint(leader)})
+	if err != nil {
+		return err
+	}
+	defer leaderCli.Close()
+
+	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+	_, err = leaderCli.MoveLeader(ct, statuses[transferee].Header.MemberId)
+	if err != nil {
+		return err
+	}
+
+	log.Info("moved etcd leader", map[string]interface{}{
+		"from": leader,
+		"to":   transferee,
+	})
+	return nil
+}
+
+func (c moveEtcdLeaderCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "move-etcd-leader",
+		Target: strings.Join(c.targets, ","),
+	}
+}
+
+// controlPlaneTargets returns addresses in targets that are control planes.
+func controlPlaneTargets(cpNodes []*cke.Node, targets []string) []string {
+	var cps []string
+	for _, t := range targets {
+		for _, n := range cpNodes {
+			if n.Address == t {
+				cps = append(cps, t)
+				break
+			}
+		}
+	}
+	return cps
+}
+
+func etcdEndpoint(address string) string {
+	return "https://" + address + ":2379"
+}
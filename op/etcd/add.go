@@ -20,6 +20,7 @@ type addMemberOp struct {
 }
 
 // AddMemberOp returns an Operator to add member to etcd cluster.
+// The member is added as a learner and promoted after it catches up.
 func AddMemberOp(cp []*cke.Node, targetNode *cke.Node, params cke.EtcdParams) cke.Operator {
 	return &addMemberOp{
 		endpoints:  etcdEndpoints(cp),
@@ -69,8 +70,11 @@ func (o *addMemberOp) NextCommand() cke.Commander {
 		return addMemberCommand{o.endpoints, o.targetNode, opts, extra}
 	case 8:
 		o.step++
-		return waitEtcdSyncCommand{etcdEndpoints([]*cke.Node{o.targetNode}), false}
+		return promoteLearnerCommand{o.endpoints, o.targetNode}
 	case 9:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints([]*cke.Node{o.targetNode}), false}
+	case 10:
 		o.step++
 		return common.VolumeCreateCommand(nodes, op.EtcdAddedMemberVolumeName)
 	}
@@ -125,9 +129,11 @@ func (c addMemberCommand) Run(ctx context.Context, inf cke.Infrastructure, _ str
 		case <-time.After(10 * time.Second):
 		}
 
+		// Add the member as a learner so that the quorum size does not change
+		// until the member catches up with the leader.
 		ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
 		defer cancel()
-		resp, err := cli.MemberAdd(ct, []string{fmt.Sprintf("https://%s:2380", c.node.Address)})
+		resp, err := cli.MemberAddAsLearner(ct, []string{fmt.Sprintf("https://%s:2380", c.node.Address)})
 		if err != nil {
 			return err
 		}
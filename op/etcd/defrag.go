@@ -0,0 +1,98 @@
+package etcd
+
+import (
+	"context"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/metrics"
+	"github.com/cybozu-go/cke/op"
+)
+
+// defragTimeout is the timeout to defragment an etcd member.
+// Defragmentation blocks the member and may take long for large databases.
+const defragTimeout = 5 * time.Minute
+
+type etcdDefragOp struct {
+	cpNodes []*cke.Node
+	target  *cke.Node
+	step    int
+}
+
+// DefragOp returns an Operator to defragment an etcd member.
+func DefragOp(cpNodes []*cke.Node, target *cke.Node) cke.Operator {
+	return &etcdDefragOp{
+		cpNodes: cpNodes,
+		target:  target,
+	}
+}
+
+func (o *etcdDefragOp) Name() string {
+	return "etcd-defrag"
+}
+
+func (o *etcdDefragOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(o.cpNodes), true}
+	case 1:
+		o.step++
+		return defragCommand{o.target}
+	case 2:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(o.cpNodes), false}
+	}
+	return nil
+}
+
+func (o *etcdDefragOp) Targets() []string {
+	return []string{
+		o.target.Address,
+	}
+}
+
+type defragCommand struct {
+	target *cke.Node
+}
+
+func (c defragCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	endpoint := "https://" + c.target.Address + ":2379"
+	cli, err := inf.NewEtcdClient(ctx, []string{endpoint})
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	before, err := cli.Status(ct, endpoint)
+	if err != nil {
+		return err
+	}
+
+	ct2, cancel2 := context.WithTimeout(ctx, defragTimeout)
+	defer cancel2()
+	_, err = cli.Defragment(ct2, endpoint)
+	if err != nil {
+		metrics.ObserveEtcdDefrag(c.target.Address, 0, false)
+		return err
+	}
+
+	ct3, cancel3 := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel3()
+	after, err := cli.Status(ct3, endpoint)
+	if err != nil {
+		metrics.ObserveEtcdDefrag(c.target.Address, 0, true)
+		return nil
+	}
+	metrics.ObserveEtcdDefrag(c.target.Address, before.DbSize-after.DbSize, true)
+	return nil
+}
+
+func (c defragCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "defrag-etcd",
+		Target: c.target.Address,
+	}
+}
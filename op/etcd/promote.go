@@ -0,0 +1,146 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+	"github.com/cybozu-go/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// promoteRetries is the number of attempts to promote a learner.
+// A learner may take long to catch up if the database is large.
+const promoteRetries = 60
+
+type promoteMemberOp struct {
+	endpoints  []string
+	targetNode *cke.Node
+	step       int
+}
+
+// PromoteMemberOp returns an Operator to promote a learner to a voting member.
+func PromoteMemberOp(cp []*cke.Node, targetNode *cke.Node) cke.Operator {
+	return &promoteMemberOp{
+		endpoints:  etcdEndpoints(cp),
+		targetNode: targetNode,
+	}
+}
+
+func (o *promoteMemberOp) Name() string {
+	return "etcd-promote-member"
+}
+
+func (o *promoteMemberOp) NextCommand() cke.Commander {
+	nodes := []*cke.Node{o.targetNode}
+	switch o.step {
+	case 0:
+		o.step++
+		return promoteLearnerCommand{o.endpoints, o.targetNode}
+	case 1:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(nodes), false}
+	case 2:
+		o.step++
+		return common.VolumeCreateCommand(nodes, op.EtcdAddedMemberVolumeName)
+	}
+	return nil
+}
+
+func (o *promoteMemberOp) Targets() []string {
+	return []string{
+		o.targetNode.Address,
+	}
+}
+
+type promoteLearnerCommand struct {
+	endpoints []string
+	node      *cke.Node
+}
+
+func (c promoteLearnerCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	// Learners do not serve most requests, so exclude the target.
+	target := "https://" + c.node.Address + ":2379"
+	var endpoints []string
+	for _, ep := range c.endpoints {
+		if ep != target {
+			endpoints = append(endpoints, ep)
+		}
+	}
+
+	cli, err := inf.NewEtcdClient(ctx, endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	for i := 0; i < promoteRetries; i++ {
+		err = c.try(ctx, inf, cli)
+		if err == nil {
+			return nil
+		}
+		log.Info("waiting for etcd learner to catch up", map[string]interface{}{
+			"node":      c.node.Address,
+			log.FnError: err,
+		})
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	return err
+}
+
+func (c promoteLearnerCommand) try(ctx context.Context, inf cke.Infrastructure, cli *clientv3.Client) error {
+	ct, cancel := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel()
+	resp, err := cli.MemberList(ct)
+	if err != nil {
+		return err
+	}
+
+	var id uint64
+	var learner, found bool
+	for _, m := range resp.Members {
+		inMember, err := addressInURLs(c.node.Address, m.PeerURLs)
+		if err != nil {
+			return err
+		}
+		if inMember {
+			id, learner, found = m.ID, m.IsLearner, true
+			break
+		}
+	}
+	if !found {
+		return errors.New("etcd member is not found: " + c.node.Address)
+	}
+	if !learner {
+		return nil
+	}
+
+	ct2, cancel2 := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel2()
+	getResp, err := cli.Get(ct2, "health")
+	if err != nil {
+		return err
+	}
+	if !op.EtcdMemberInSync(ctx, inf, c.node.Address, getResp.Header.Revision, true) {
+		return errors.New("etcd learner is not in sync: " + c.node.Address)
+	}
+
+	ct3, cancel3 := context.WithTimeout(ctx, op.TimeoutDuration)
+	defer cancel3()
+	_, err = cli.MemberPromote(ct3, id)
+	return err
+}
+
+func (c promoteLearnerCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "promote-etcd-learner",
+		Target: c.node.Address,
+	}
+}
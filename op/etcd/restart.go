@@ -11,14 +11,17 @@ type etcdRestartOp struct {
 	target  *cke.Node
 	params  cke.EtcdParams
 	step    int
+	files   *common.FilesBuilder
 }
 
 // RestartOp returns an Operator to restart an etcd member.
+// The certificates of the member are reissued.
 func RestartOp(cpNodes []*cke.Node, target *cke.Node, params cke.EtcdParams) cke.Operator {
 	return &etcdRestartOp{
 		cpNodes: cpNodes,
 		target:  target,
 		params:  params,
+		files:   common.NewFilesBuilder([]*cke.Node{target}),
 	}
 }
 
@@ -36,8 +39,17 @@ func (o *etcdRestartOp) NextCommand() cke.Commander {
 		return common.ImagePullCommand([]*cke.Node{o.target}, cke.EtcdImage)
 	case 2:
 		o.step++
-		return common.StopContainerCommand(o.target, op.EtcdContainerName)
+		return prepareEtcdCertificatesCommand{o.files}
 	case 3:
+		o.step++
+		return o.files
+	case 4:
+		o.step++
+		return op.MoveEtcdLeaderCommand(o.cpNodes, []string{o.target.Address})
+	case 5:
+		o.step++
+		return common.StopContainerCommand(o.target, op.EtcdContainerName)
+	case 6:
 		o.step++
 		opts := []string{
 			"--mount",
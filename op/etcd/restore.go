@@ -0,0 +1,209 @@
+package etcd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+)
+
+type restorePrepareOp struct {
+	nodes  []*cke.Node
+	params cke.EtcdParams
+	step   int
+}
+
+// RestorePrepareOp returns an Operator to stop etcd and kube-apiserver and
+// remove etcd data on control plane nodes before restoring a snapshot.
+func RestorePrepareOp(nodes []*cke.Node, params cke.EtcdParams) cke.Operator {
+	return &restorePrepareOp{
+		nodes:  nodes,
+		params: params,
+	}
+}
+
+func (o *restorePrepareOp) Name() string {
+	return "etcd-restore-prepare"
+}
+
+func (o *restorePrepareOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return common.KillContainersCommand(o.nodes, op.KubeAPIServerContainerName)
+	case 1:
+		o.step++
+		return common.KillContainersCommand(o.nodes, op.EtcdContainerName)
+	case 2:
+		o.step++
+		return common.VolumeRemoveCommand(o.nodes, op.EtcdAddedMemberVolumeName)
+	case 3:
+		o.step++
+		return common.VolumeRemoveCommand(o.nodes, op.EtcdVolumeName(o.params))
+	}
+	return nil
+}
+
+func (o *restorePrepareOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+type restoreOp struct {
+	node    *cke.Node
+	params  cke.EtcdParams
+	restore *cke.EtcdRestore
+	step    int
+	files   *common.FilesBuilder
+}
+
+// RestoreOp returns an Operator to restore a snapshot on a node as
+// a single-member etcd cluster.  Other control plane nodes will be
+// added to the cluster by the usual maintenance operations.
+func RestoreOp(node *cke.Node, params cke.EtcdParams, restore *cke.EtcdRestore) cke.Operator {
+	nodes := []*cke.Node{node}
+	return &restoreOp{
+		node:    node,
+		params:  params,
+		restore: restore,
+		files:   common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *restoreOp) Name() string {
+	return "etcd-restore"
+}
+
+func (o *restoreOp) NextCommand() cke.Commander {
+	volname := op.EtcdVolumeName(o.params)
+	nodes := []*cke.Node{o.node}
+
+	switch o.step {
+	case 0:
+		o.step++
+		return common.ImagePullCommand(nodes, cke.EtcdImage)
+	case 1:
+		o.step++
+		return prepareEtcdCertificatesCommand{o.files}
+	case 2:
+		o.step++
+		return o.files
+	case 3:
+		o.step++
+		return common.VolumeCreateCommand(nodes, volname)
+	case 4:
+		o.step++
+		return restoreSnapshotCommand{o.node, volname, o.restore}
+	case 5:
+		o.step++
+		opts := []string{
+			"--mount",
+			"type=volume,src=" + volname + ",dst=/var/lib/etcd",
+		}
+		initialCluster := []string{o.node.Address + "=https://" + o.node.Address + ":2380"}
+		return common.RunContainerCommand(nodes, op.EtcdContainerName, cke.EtcdImage,
+			common.WithOpts(opts),
+			common.WithParams(BuiltInParams(o.node, initialCluster, "new")),
+			common.WithExtra(o.params.ServiceParams))
+	case 6:
+		o.step++
+		return waitEtcdSyncCommand{etcdEndpoints(nodes), false}
+	case 7:
+		o.step++
+		return common.VolumeCreateCommand(nodes, op.EtcdAddedMemberVolumeName)
+	case 8:
+		o.step++
+		return finishRestoreCommand{o.restore}
+	}
+	return nil
+}
+
+func (o *restoreOp) Targets() []string {
+	return []string{
+		o.node.Address,
+	}
+}
+
+type restoreSnapshotCommand struct {
+	node    *cke.Node
+	volname string
+	restore *cke.EtcdRestore
+}
+
+// Run downloads the snapshot to the leader, restores it into a new
+// data directory, and writes the directory into the etcd volume.
+func (c restoreSnapshotCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cfg, err := inf.Storage().GetEtcdSnapshotConfig(ctx)
+	if err != nil {
+		return err
+	}
+	store, err := cke.NewEtcdSnapshotStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "cke-etcd-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, c.restore.Snapshot)
+	err = cke.DownloadEtcdSnapshot(ctx, store, c.restore.Snapshot, snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	dataDir := filepath.Join(dir, "data")
+	err = cke.RestoreEtcdSnapshot(snapshotPath, dataDir, c.node, c.restore.ClusterToken())
+	if err != nil {
+		return err
+	}
+
+	// Stream the data directory as it can be as large as the etcd quota.
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(cke.WriteTarDirectory(pw, dataDir, "/var/lib/etcd"))
+		close(done)
+	}()
+	defer func() {
+		// unblock the writer if the command exits without reading all data.
+		pr.Close()
+		<-done
+	}()
+
+	binds := []cke.Mount{
+		{Source: c.volname, Destination: "/mnt/var/lib/etcd"},
+	}
+	return inf.Engine(c.node.Address).RunWithReader(cke.ToolsImage, binds, "write_files", pr, "/mnt")
+}
+
+func (c restoreSnapshotCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "restore-etcd-snapshot",
+		Target: c.restore.Snapshot,
+	}
+}
+
+type finishRestoreCommand struct {
+	restore *cke.EtcdRestore
+}
+
+func (c finishRestoreCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	return inf.Storage().FinishEtcdRestore(ctx, leaderKey, c.restore)
+}
+
+func (c finishRestoreCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "finish-etcd-restore",
+		Target: c.restore.Snapshot,
+	}
+}
@@ -3,15 +3,25 @@ package k8s
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
 	"github.com/cybozu-go/cke/op/common"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
 )
 
-const auditPolicyBasePath = "/etc/kubernetes/apiserver/audit-policy-%x.yaml"
+const (
+	auditPolicyBasePath          = "/etc/kubernetes/apiserver/audit-policy-%x.yaml"
+	authenticationConfigBasePath = "/etc/kubernetes/apiserver/authentication-config-%x.yaml"
+	authorizationConfigBasePath  = "/etc/kubernetes/apiserver/authorization-config-%x.yaml"
+	admissionConfigBasePath      = "/etc/kubernetes/apiserver/admission-config-%x.yaml"
+)
 
 var (
 	// admissionPlugins is our recommended list of admission plugins in addition to the default ones.
@@ -28,22 +38,24 @@ var (
 type apiServerRestartOp struct {
 	nodes []*cke.Node
 
-	serviceSubnet string
-	params        cke.APIServerParams
-	clusterDomain string
+	serviceSubnet  string
+	params         cke.APIServerParams
+	clusterDomain  string
+	encryptionHash string
 
 	step  int
 	files *common.FilesBuilder
 }
 
 // APIServerRestartOp returns an Operator to restart kube-apiserver
-func APIServerRestartOp(nodes []*cke.Node, serviceSubnet string, params cke.APIServerParams, clusterDomain string) cke.Operator {
+func APIServerRestartOp(nodes []*cke.Node, serviceSubnet string, params cke.APIServerParams, clusterDomain, encryptionHash string) cke.Operator {
 	return &apiServerRestartOp{
-		nodes:         nodes,
-		serviceSubnet: serviceSubnet,
-		clusterDomain: clusterDomain,
-		params:        params,
-		files:         common.NewFilesBuilder(nodes),
+		nodes:          nodes,
+		serviceSubnet:  serviceSubnet,
+		clusterDomain:  clusterDomain,
+		params:         params,
+		encryptionHash: encryptionHash,
+		files:          common.NewFilesBuilder(nodes),
 	}
 }
 
@@ -61,7 +73,7 @@ func (o *apiServerRestartOp) NextCommand() cke.Commander {
 		return common.MakeDirsCommandWithMode(o.nodes, []string{encryptionConfigDir}, "700")
 	case 2:
 		o.step++
-		return prepareAPIServerFilesCommand{o.files, o.serviceSubnet, o.clusterDomain, o.params}
+		return prepareAPIServerFilesCommand{o.files, o.serviceSubnet, o.clusterDomain, o.params, o.encryptionHash}
 	case 3:
 		o.step++
 		return o.files
@@ -75,13 +87,16 @@ func (o *apiServerRestartOp) NextCommand() cke.Commander {
 		}
 		paramsMap := make(map[string]cke.ServiceParams)
 		for _, n := range o.nodes {
-			paramsMap[n.Address] = APIServerParams(n.Address, o.serviceSubnet, o.params.AuditLogEnabled, o.params.AuditLogPolicy, o.params.AuditLogPath, o.clusterDomain)
+			paramsMap[n.Address] = APIServerParams(n.Address, o.serviceSubnet, o.params, o.clusterDomain, o.encryptionHash)
 		}
 		return common.RunContainerCommand(o.nodes,
 			op.KubeAPIServerContainerName, cke.KubernetesImage,
 			common.WithOpts(opts),
 			common.WithParamsMap(paramsMap),
 			common.WithExtra(o.params.ServiceParams))
+	case 6:
+		o.step++
+		return removeStaleEncryptionConfigsCommand{o.nodes, o.encryptionHash}
 	default:
 		return nil
 	}
@@ -96,10 +111,11 @@ func (o *apiServerRestartOp) Targets() []string {
 }
 
 type prepareAPIServerFilesCommand struct {
-	files         *common.FilesBuilder
-	serviceSubnet string
-	clusterDomain string
-	params        cke.APIServerParams
+	files          *common.FilesBuilder
+	serviceSubnet  string
+	clusterDomain  string
+	params         cke.APIServerParams
+	encryptionHash string
 }
 
 func (c prepareAPIServerFilesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
@@ -204,23 +220,68 @@ func (c prepareAPIServerFilesCommand) Run(ctx context.Context, inf cke.Infrastru
 	}
 
 	// EncryptionConfiguration
-	enccfg, err := getEncryptionConfiguration(ctx, inf)
+	enccfg, hash, err := getEncryptionConfiguration(ctx, inf, c.params.Encryption)
 	if err != nil {
 		return err
 	}
+	if hash != c.encryptionHash {
+		return errors.New("encryption configuration has been changed")
+	}
 	enccfgData, err := encodeToYAML(enccfg)
 	if err != nil {
 		return err
 	}
-	err = c.files.AddFile(ctx, encryptionConfigFile, func(ctx context.Context, node *cke.Node) ([]byte, error) {
+	err = c.files.AddFile(ctx, encryptionConfigFilePath(hash), func(ctx context.Context, node *cke.Node) ([]byte, error) {
 		return enccfgData, nil
 	})
 	if err != nil {
 		return err
 	}
 
-	// audit log policy
-	if c.params.AuditLogEnabled {
+	// structured authentication, authorization, and admission configurations
+	for _, cfg := range []struct {
+		obj      *unstructured.Unstructured
+		basePath string
+	}{
+		{c.params.Authentication, authenticationConfigBasePath},
+		{c.params.Authorization, authorizationConfigBasePath},
+		{c.params.Admission, admissionConfigBasePath},
+	} {
+		if cfg.obj == nil {
+			continue
+		}
+		data, err := yaml.Marshal(cfg.obj.Object)
+		if err != nil {
+			return err
+		}
+		err = c.files.AddFile(ctx, apiServerConfigFilePath(cfg.basePath, cfg.obj), func(context.Context, *cke.Node) ([]byte, error) {
+			return data, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// audit webhook kubeconfig and client certificate
+	if c.params.AuditWebhook.Enabled {
+		configPath, data, err := auditWebhookConfig(c.params.AuditWebhook)
+		if err != nil {
+			return err
+		}
+		err = c.files.AddFile(ctx, configPath, func(context.Context, *cke.Node) ([]byte, error) {
+			return data, nil
+		})
+		if err != nil {
+			return err
+		}
+		err = addAuditWebhookCertificate(ctx, inf, c.files)
+		if err != nil {
+			return err
+		}
+	}
+
+	// audit policy is shared by the log and webhook backends
+	if c.params.AuditLogEnabled || c.params.AuditWebhook.Enabled {
 		return c.files.AddFile(ctx, auditPolicyFilePath(c.params.AuditLogPolicy), func(context.Context, *cke.Node) ([]byte, error) {
 			return []byte(c.params.AuditLogPolicy), nil
 		})
@@ -239,8 +300,41 @@ func auditPolicyFilePath(policy string) string {
 	return fmt.Sprintf(auditPolicyBasePath, md5.Sum([]byte(policy)))
 }
 
+// apiServerConfigFilePath returns the path of a configuration file for API server.
+// The path contains the hash of the contents so that API servers are restarted
+// when the contents are changed.
+func apiServerConfigFilePath(basePath string, obj *unstructured.Unstructured) string {
+	// json.Marshal sorts map keys, so the result is stable.
+	data, _ := json.Marshal(obj.Object)
+	return fmt.Sprintf(basePath, md5.Sum(data))
+}
+
+// enabledAdmissionPlugins returns admissionPlugins and the plugins configured
+// in the admission configuration.  Plugins such as EventRateLimit are not
+// enabled by default, so configuring them implies enabling them.
+func enabledAdmissionPlugins(params cke.APIServerParams) []string {
+	plugins := append([]string{}, admissionPlugins...)
+
+	// params must be validated beforehand.
+	cfg, _ := params.AdmissionConfig()
+	if cfg == nil {
+		return plugins
+	}
+	for _, p := range cfg.Plugins {
+		if !slices.Contains(plugins, p.Name) {
+			plugins = append(plugins, p.Name)
+		}
+	}
+	return plugins
+}
+
 // APIServerParams returns parameters for API server.
-func APIServerParams(advertiseAddress, serviceSubnet string, auditLogEnabled bool, auditLogPolicy, auditLogPath string, clusterDomain string) cke.ServiceParams {
+func APIServerParams(advertiseAddress, serviceSubnet string, params cke.APIServerParams, clusterDomain, encryptionHash string) cke.ServiceParams {
+	authzArg := "--authorization-mode=Node,RBAC"
+	if params.Authorization != nil {
+		authzArg = "--authorization-config=" + apiServerConfigFilePath(authorizationConfigBasePath, params.Authorization)
+	}
+
 	args := []string{
 		"kube-apiserver",
 		"--allow-privileged",
@@ -258,7 +352,7 @@ func APIServerParams(advertiseAddress, serviceSubnet string, auditLogEnabled boo
 		"--kubelet-client-certificate=" + op.K8sPKIPath("apiserver.crt"),
 		"--kubelet-client-key=" + op.K8sPKIPath("apiserver.key"),
 
-		"--enable-admission-plugins=" + strings.Join(admissionPlugins, ","),
+		"--enable-admission-plugins=" + strings.Join(enabledAdmissionPlugins(params), ","),
 
 		// for service accounts
 		"--service-account-issuer=https://kubernetes.default.svc." + clusterDomain,
@@ -275,7 +369,7 @@ func APIServerParams(advertiseAddress, serviceSubnet string, auditLogEnabled boo
 		"--proxy-client-cert-file=" + op.K8sPKIPath("aggregation.crt"),
 		"--proxy-client-key-file=" + op.K8sPKIPath("aggregation.key"),
 
-		"--authorization-mode=Node,RBAC",
+		authzArg,
 
 		"--advertise-address=" + advertiseAddress,
 
@@ -283,38 +377,57 @@ func APIServerParams(advertiseAddress, serviceSubnet string, auditLogEnabled boo
 		"--endpoint-reconciler-type=none",
 
 		"--service-cluster-ip-range=" + serviceSubnet,
-		"--encryption-provider-config=" + encryptionConfigFile,
+		"--encryption-provider-config=" + encryptionConfigFilePath(encryptionHash),
 
 		// enable coordinated leader election for stable rolling restart of API server processes
 		"--feature-gates=CoordinatedLeaderElection=true",
 		"--runtime-config=coordination.k8s.io/v1beta1=true",
 	}
-	if auditLogEnabled {
+	if params.Authentication != nil {
+		args = append(args, "--authentication-config="+apiServerConfigFilePath(authenticationConfigBasePath, params.Authentication))
+	}
+	if params.Admission != nil {
+		args = append(args, "--admission-control-config-file="+apiServerConfigFilePath(admissionConfigBasePath, params.Admission))
+	}
+	if params.AuditLogEnabled {
 		logPath := "-"
-		if auditLogPath != "" {
-			logPath = auditLogPath
+		if params.AuditLogPath != "" {
+			logPath = params.AuditLogPath
 		}
 		args = append(args, "--audit-log-path="+logPath)
-		args = append(args, "--audit-policy-file="+auditPolicyFilePath(auditLogPolicy))
+	}
+	if params.AuditWebhook.Enabled {
+		args = append(args, auditWebhookArgs(params.AuditWebhook)...)
+	}
+	if params.AuditLogEnabled || params.AuditWebhook.Enabled {
+		args = append(args, "--audit-policy-file="+auditPolicyFilePath(params.AuditLogPolicy))
+	}
+
+	binds := []cke.Mount{
+		{
+			Source:      "/etc/machine-id",
+			Destination: "/etc/machine-id",
+			ReadOnly:    true,
+			Propagation: "",
+			Label:       "",
+		},
+		{
+			Source:      "/etc/kubernetes",
+			Destination: "/etc/kubernetes",
+			ReadOnly:    true,
+			Propagation: "",
+			Label:       cke.LabelShared,
+		},
+	}
+	if params.Encryption.ProviderName() == cke.EncryptionProviderKMS {
+		binds = append(binds, cke.Mount{
+			Source:      kmsPluginSocketDir,
+			Destination: kmsPluginSocketDir,
+		})
 	}
 
 	return cke.ServiceParams{
 		ExtraArguments: args,
-		ExtraBinds: []cke.Mount{
-			{
-				Source:      "/etc/machine-id",
-				Destination: "/etc/machine-id",
-				ReadOnly:    true,
-				Propagation: "",
-				Label:       "",
-			},
-			{
-				Source:      "/etc/kubernetes",
-				Destination: "/etc/kubernetes",
-				ReadOnly:    true,
-				Propagation: "",
-				Label:       cke.LabelShared,
-			},
-		},
+		ExtraBinds:     binds,
 	}
 }
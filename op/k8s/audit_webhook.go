@@ -0,0 +1,152 @@
+package k8s
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"strconv"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	auditWebhookConfigBasePath = "/etc/kubernetes/apiserver/audit-webhook-%x.kubeconfig"
+	auditWebhookKeyPair        = "audit-webhook"
+)
+
+// auditWebhookKubeconfig returns kubeconfig for the audit webhook backend.
+//
+// The client certificate is referenced by file paths rather than embedded
+// so that kube-apiserver reloads renewed certificates without restarting.
+func auditWebhookKubeconfig(params cke.AuditWebhookParams) *api.Config {
+	cfg := api.NewConfig()
+	c := api.NewCluster()
+	c.Server = params.Server
+	if len(params.CACert) != 0 {
+		c.CertificateAuthorityData = []byte(params.CACert)
+	}
+	cfg.Clusters["audit"] = c
+
+	auth := api.NewAuthInfo()
+	auth.ClientCertificate = op.AuditWebhookCertPath
+	auth.ClientKey = op.K8sPKIPath(auditWebhookKeyPair + ".key")
+	cfg.AuthInfos[cke.CNAuditWebhook] = auth
+
+	ctx := api.NewContext()
+	ctx.AuthInfo = cke.CNAuditWebhook
+	ctx.Cluster = "audit"
+	cfg.Contexts["default"] = ctx
+	cfg.CurrentContext = "default"
+
+	return cfg
+}
+
+// auditWebhookConfig returns the path and the contents of kubeconfig for the audit webhook backend.
+// The path contains the hash of the contents so that API servers are restarted
+// when the contents are changed.
+func auditWebhookConfig(params cke.AuditWebhookParams) (string, []byte, error) {
+	data, err := clientcmd.Write(*auditWebhookKubeconfig(params))
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf(auditWebhookConfigBasePath, md5.Sum(data)), data, nil
+}
+
+func auditWebhookArgs(params cke.AuditWebhookParams) []string {
+	// clientcmd.Write never fails for kubeconfig built by auditWebhookKubeconfig.
+	configPath, _, _ := auditWebhookConfig(params)
+	args := []string{
+		"--audit-webhook-config-file=" + configPath,
+		"--audit-webhook-mode=" + params.ModeName(),
+	}
+	if params.BatchMaxSize > 0 {
+		args = append(args, "--audit-webhook-batch-max-size="+strconv.Itoa(params.BatchMaxSize))
+	}
+	if params.BatchMaxWait != "" {
+		args = append(args, "--audit-webhook-batch-max-wait="+params.BatchMaxWait)
+	}
+	if params.BatchThrottleEnable != nil {
+		args = append(args, "--audit-webhook-batch-throttle-enable="+strconv.FormatBool(*params.BatchThrottleEnable))
+	}
+	if params.BatchThrottleQPS > 0 {
+		args = append(args, "--audit-webhook-batch-throttle-qps="+strconv.FormatFloat(params.BatchThrottleQPS, 'f', -1, 64))
+	}
+	if params.BatchThrottleBurst > 0 {
+		args = append(args, "--audit-webhook-batch-throttle-burst="+strconv.Itoa(params.BatchThrottleBurst))
+	}
+	if params.InitialBackoff != "" {
+		args = append(args, "--audit-webhook-initial-backoff="+params.InitialBackoff)
+	}
+	return args
+}
+
+func addAuditWebhookCertificate(ctx context.Context, inf cke.Infrastructure, files *common.FilesBuilder) error {
+	return files.AddKeyPair(ctx, op.K8sPKIPath(auditWebhookKeyPair), func(ctx context.Context, n *cke.Node) (cert, key []byte, err error) {
+		c, k, e := cke.KubernetesCA{}.IssueForAuditWebhook(ctx, inf)
+		if e != nil {
+			return nil, nil, e
+		}
+		return []byte(c), []byte(k), nil
+	})
+}
+
+type auditWebhookCertRenewOp struct {
+	nodes []*cke.Node
+
+	step  int
+	files *common.FilesBuilder
+}
+
+// AuditWebhookCertRenewOp returns an Operator to renew the client certificate
+// of kube-apiserver for the audit webhook backend.
+//
+// kube-apiserver reloads the certificate files, so it is not restarted.
+func AuditWebhookCertRenewOp(nodes []*cke.Node) cke.Operator {
+	return &auditWebhookCertRenewOp{
+		nodes: nodes,
+		files: common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *auditWebhookCertRenewOp) Name() string {
+	return "audit-webhook-cert-renew"
+}
+
+func (o *auditWebhookCertRenewOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return prepareAuditWebhookCertCommand{o.files}
+	case 1:
+		o.step++
+		return o.files
+	default:
+		return nil
+	}
+}
+
+func (o *auditWebhookCertRenewOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+type prepareAuditWebhookCertCommand struct {
+	files *common.FilesBuilder
+}
+
+func (c prepareAuditWebhookCertCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	return addAuditWebhookCertificate(ctx, inf, c.files)
+}
+
+func (c prepareAuditWebhookCertCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "prepare-audit-webhook-cert",
+	}
+}
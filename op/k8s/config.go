@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"bytes"
+	"encoding/json"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -61,6 +62,25 @@ func schedulerKubeconfig(cluster string, ca, clientCrt, clientKey string) *api.C
 	return cke.Kubeconfig(cluster, "system:kube-scheduler", ca, clientCrt, clientKey)
 }
 
+// GenerateControllerManagerConfiguration generates kube-controller-manager configuration.
+// `params` must be validated beforehand.
+func GenerateControllerManagerConfiguration(params cke.ControllerManagerParams) *cke.ControllerManagerConfig {
+	c := &cke.ControllerManagerConfig{}
+	if params.Config == nil {
+		return c
+	}
+
+	// Round-trip to make a deep copy of the config.
+	data, err := json.Marshal(params.Config)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		panic(err)
+	}
+	return c
+}
+
 // GenerateSchedulerConfiguration generates scheduler configuration.
 // `params` must be validated beforehand.
 func GenerateSchedulerConfiguration(params cke.SchedulerParams) *schedulerv1.KubeSchedulerConfiguration {
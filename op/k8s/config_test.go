@@ -14,6 +14,50 @@ import (
 	"k8s.io/utils/ptr"
 )
 
+func TestControllerManagerConfigArgs(t *testing.T) {
+	t.Parallel()
+
+	input := cke.ControllerManagerParams{
+		Config: &cke.ControllerManagerConfig{
+			Controllers:  []string{"*", "-bootstrapsigner"},
+			FeatureGates: map[string]bool{"Foo": true, "Bar": false},
+			LeaderElection: cke.ControllerManagerLeaderElection{
+				LeaseDuration: "30s",
+				RenewDeadline: "20s",
+			},
+			KubeAPIQPS:   50.5,
+			KubeAPIBurst: 100,
+			Concurrency:  map[string]int{"gc": 30, "deployment": 10},
+		},
+	}
+
+	expected := []string{
+		"--controllers=*,-bootstrapsigner",
+		"--feature-gates=Bar=false,Foo=true",
+		"--leader-elect-lease-duration=30s",
+		"--leader-elect-renew-deadline=20s",
+		"--kube-api-qps=50.5",
+		"--kube-api-burst=100",
+		"--concurrent-deployment-syncs=10",
+		"--concurrent-gc-syncs=30",
+	}
+
+	args := controllerManagerConfigArgs(GenerateControllerManagerConfiguration(input))
+	if !cmp.Equal(args, expected) {
+		t.Errorf("controllerManagerConfigArgs() generated unexpected result:\n%s", cmp.Diff(args, expected))
+	}
+
+	empty := GenerateControllerManagerConfiguration(cke.ControllerManagerParams{
+		Config: &cke.ControllerManagerConfig{FeatureGates: map[string]bool{}},
+	})
+	if !cmp.Equal(empty, &cke.ControllerManagerConfig{}) {
+		t.Errorf("GenerateControllerManagerConfiguration() did not normalize empty config: %#v", empty)
+	}
+	if args := controllerManagerConfigArgs(empty); len(args) != 0 {
+		t.Errorf("unexpected args for empty config: %v", args)
+	}
+}
+
 func TestGenerateSchedulerConfiguration(t *testing.T) {
 	t.Parallel()
 
@@ -2,6 +2,10 @@ package k8s
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
@@ -14,14 +18,14 @@ type controllerManagerBootOp struct {
 
 	cluster       string
 	serviceSubnet string
-	params        cke.ServiceParams
+	params        cke.ControllerManagerParams
 
 	step  int
 	files *common.FilesBuilder
 }
 
 // ControllerManagerBootOp returns an Operator to bootstrap kube-controller-manager
-func ControllerManagerBootOp(nodes []*cke.Node, cluster string, serviceSubnet string, params cke.ServiceParams) cke.Operator {
+func ControllerManagerBootOp(nodes []*cke.Node, cluster string, serviceSubnet string, params cke.ControllerManagerParams) cke.Operator {
 	return &controllerManagerBootOp{
 		nodes:         nodes,
 		cluster:       cluster,
@@ -50,8 +54,8 @@ func (o *controllerManagerBootOp) NextCommand() cke.Commander {
 		o.step++
 		return common.RunContainerCommand(o.nodes,
 			op.KubeControllerManagerContainerName, cke.KubernetesImage,
-			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet)),
-			common.WithExtra(o.params))
+			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet, o.params)),
+			common.WithExtra(o.params.ServiceParams))
 	default:
 		return nil
 	}
@@ -108,7 +112,7 @@ func (c prepareControllerManagerFilesCommand) Command() cke.Command {
 }
 
 // ControllerManagerParams returns parameters for kube-controller-manager.
-func ControllerManagerParams(clusterName, serviceSubnet string) cke.ServiceParams {
+func ControllerManagerParams(clusterName, serviceSubnet string, params cke.ControllerManagerParams) cke.ServiceParams {
 	args := []string{
 		"kube-controller-manager",
 		"--cluster-name=" + clusterName,
@@ -134,6 +138,7 @@ func ControllerManagerParams(clusterName, serviceSubnet string) cke.ServiceParam
 		"--service-account-private-key-file=" + op.K8sPKIPath("service-account.key"),
 		"--use-service-account-credentials=true",
 	}
+	args = append(args, controllerManagerConfigArgs(GenerateControllerManagerConfiguration(params))...)
 	return cke.ServiceParams{
 		ExtraArguments: args,
 		ExtraBinds: []cke.Mount{
@@ -154,3 +159,45 @@ func ControllerManagerParams(clusterName, serviceSubnet string) cke.ServiceParam
 		},
 	}
 }
+
+// controllerManagerConfigArgs translates the config into command-line flags.
+// The flags are sorted to keep them stable.
+func controllerManagerConfigArgs(cfg *cke.ControllerManagerConfig) []string {
+	var args []string
+	if len(cfg.Controllers) > 0 {
+		args = append(args, "--controllers="+strings.Join(cfg.Controllers, ","))
+	}
+	if len(cfg.FeatureGates) > 0 {
+		gates := make([]string, 0, len(cfg.FeatureGates))
+		for name, enabled := range cfg.FeatureGates {
+			gates = append(gates, name+"="+strconv.FormatBool(enabled))
+		}
+		sort.Strings(gates)
+		args = append(args, "--feature-gates="+strings.Join(gates, ","))
+	}
+	if d := cfg.LeaderElection.LeaseDuration; d != "" {
+		args = append(args, "--leader-elect-lease-duration="+d)
+	}
+	if d := cfg.LeaderElection.RenewDeadline; d != "" {
+		args = append(args, "--leader-elect-renew-deadline="+d)
+	}
+	if d := cfg.LeaderElection.RetryPeriod; d != "" {
+		args = append(args, "--leader-elect-retry-period="+d)
+	}
+	if cfg.KubeAPIQPS > 0 {
+		args = append(args, "--kube-api-qps="+strconv.FormatFloat(cfg.KubeAPIQPS, 'f', -1, 64))
+	}
+	if cfg.KubeAPIBurst > 0 {
+		args = append(args, "--kube-api-burst="+strconv.Itoa(cfg.KubeAPIBurst))
+	}
+
+	keys := make([]string, 0, len(cfg.Concurrency))
+	for key := range cfg.Concurrency {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("--concurrent-%s-syncs=%d", key, cfg.Concurrency[key]))
+	}
+	return args
+}
@@ -11,14 +11,14 @@ type controllerManagerRestartOp struct {
 
 	cluster       string
 	serviceSubnet string
-	params        cke.ServiceParams
+	params        cke.ControllerManagerParams
 
 	pulled   bool
 	finished bool
 }
 
 // ControllerManagerRestartOp returns an Operator to restart kube-controller-manager
-func ControllerManagerRestartOp(nodes []*cke.Node, cluster, serviceSubnet string, params cke.ServiceParams) cke.Operator {
+func ControllerManagerRestartOp(nodes []*cke.Node, cluster, serviceSubnet string, params cke.ControllerManagerParams) cke.Operator {
 	return &controllerManagerRestartOp{
 		nodes:         nodes,
 		cluster:       cluster,
@@ -40,8 +40,8 @@ func (o *controllerManagerRestartOp) NextCommand() cke.Commander {
 	if !o.finished {
 		o.finished = true
 		return common.RunContainerCommand(o.nodes, op.KubeControllerManagerContainerName, cke.KubernetesImage,
-			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet)),
-			common.WithExtra(o.params),
+			common.WithParams(ControllerManagerParams(o.cluster, o.serviceSubnet, o.params)),
+			common.WithExtra(o.params.ServiceParams),
 			common.WithRestart())
 	}
 	return nil
@@ -2,25 +2,74 @@ package k8s
 
 import (
 	"context"
+	"crypto/md5"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
 
 	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/well"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
 )
 
 const (
-	encryptionConfigDir  = "/etc/kubernetes/apiserver"
-	encryptionConfigFile = encryptionConfigDir + "/encryption.yml"
+	encryptionConfigDir      = "/etc/kubernetes/apiserver"
+	encryptionConfigBasePath = encryptionConfigDir + "/encryption-%s.yml"
+
+	kmsPluginConfigDir  = "/etc/kubernetes/kms"
+	kmsPluginConfigFile = op.KMSPluginConfigPath
+	kmsPluginSocketDir  = "/run/kmsplugin"
+	kmsPluginEndpoint   = "unix://" + kmsPluginSocketDir + "/kms.sock"
+	kmsProviderName     = "cke-vault-transit"
 )
 
-func getEncryptionSecret(ctx context.Context, inf cke.Infrastructure, key string) (string, error) {
-	vc, err := inf.Vault()
-	if err != nil {
-		return "", err
+func encryptionConfigFilePath(hash string) string {
+	return fmt.Sprintf(encryptionConfigBasePath, hash)
+}
+
+// removeStaleEncryptionConfigsCommand removes encryption configurations
+// other than the one for hash.  Old files would keep retired keys in plaintext.
+type removeStaleEncryptionConfigsCommand struct {
+	nodes []*cke.Node
+	hash  string
+}
+
+func (c removeStaleEncryptionConfigsCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	cmd := fmt.Sprintf("find %s -maxdepth 1 -type f -name 'encryption*.yml' ! -name %s -delete",
+		encryptionConfigDir, path.Base(encryptionConfigFilePath(c.hash)))
+
+	env := well.NewEnvironment(ctx)
+	for _, n := range c.nodes {
+		agent := inf.Agent(n.Address)
+		if agent == nil {
+			return errors.New("unable to prepare agent for " + n.Address)
+		}
+		env.Go(func(ctx context.Context) error {
+			_, stderr, err := agent.Run(cmd)
+			if err != nil {
+				return fmt.Errorf("failed to remove stale encryption configurations: %s: %w", stderr, err)
+			}
+			return nil
+		})
 	}
+	env.Stop()
+	return env.Wait()
+}
 
-	secret, err := vc.Logical().Read(cke.K8sSecret)
+func (c removeStaleEncryptionConfigsCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "remove-stale-encryption-configs",
+		Target: encryptionConfigDir,
+	}
+}
+
+func getEncryptionSecret(ctx context.Context, inf cke.Infrastructure, key string) (string, error) {
+	secret, err := cke.ReadSecret(ctx, inf, cke.K8sSecret)
 	if err != nil {
 		return "", err
 	}
@@ -28,15 +77,17 @@ func getEncryptionSecret(ctx context.Context, inf cke.Infrastructure, key string
 		return "", errors.New("no encryption secrets for API server")
 	}
 
-	data, ok := secret.Data[key]
+	data, ok := secret[key]
 	if !ok {
 		return "", errors.New("no secret data for " + key)
 	}
 	return data.(string), nil
 }
 
-func getEncryptionConfiguration(ctx context.Context, inf cke.Infrastructure) (*apiserverv1.EncryptionConfiguration, error) {
-	data, err := getEncryptionSecret(ctx, inf, "aescbc")
+// GetAESCBCConfiguration reads the aescbc keys.
+// The first key is used to encrypt new data.
+func GetAESCBCConfiguration(ctx context.Context, inf cke.Infrastructure) (*apiserverv1.AESConfiguration, error) {
+	data, err := getEncryptionSecret(ctx, inf, cke.EncryptionProviderAESCBC)
 	if err != nil {
 		return nil, err
 	}
@@ -46,16 +97,132 @@ func getEncryptionConfiguration(ctx context.Context, inf cke.Infrastructure) (*a
 	if err != nil {
 		return nil, err
 	}
+	return aescfg, nil
+}
+
+// PutAESCBCConfiguration stores the aescbc keys.
+func PutAESCBCConfiguration(ctx context.Context, inf cke.Infrastructure, aescfg *apiserverv1.AESConfiguration) error {
+	secret, err := cke.ReadSecret(ctx, inf, cke.K8sSecret)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return errors.New("no encryption secrets for API server")
+	}
+
+	data, err := json.Marshal(aescfg)
+	if err != nil {
+		return err
+	}
+	secret[cke.EncryptionProviderAESCBC] = string(data)
+	return cke.WriteSecret(ctx, inf, cke.K8sSecret, secret)
+}
+
+// TransitKeyVersions returns the latest version and the minimum decryption
+// version of the transit key for Kubernetes Secrets.
+func TransitKeyVersions(ctx context.Context, inf cke.Infrastructure) (latest, minDecryption int, err error) {
+	vc, err := inf.Vault()
+	if err != nil {
+		return 0, 0, err
+	}
 
-	return &apiserverv1.EncryptionConfiguration{
+	secret, err := vc.Logical().Read(path.Join(cke.VaultTransit, "keys", cke.VaultTransitKey))
+	if err != nil {
+		return 0, 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, 0, errors.New("no transit key for Kubernetes Secrets; run ckecli vault init")
+	}
+
+	latest, err = vaultInt(secret.Data["latest_version"])
+	if err != nil {
+		return 0, 0, err
+	}
+	minDecryption, err = vaultInt(secret.Data["min_decryption_version"])
+	if err != nil {
+		return 0, 0, err
+	}
+	return latest, minDecryption, nil
+}
+
+func vaultInt(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("unexpected number in Vault: %v", v)
+}
+
+// getEncryptionConfiguration builds EncryptionConfiguration for kube-apiserver
+// and returns it with its hash.
+//
+// The hash does not include secret keys.  For kms provider, it includes
+// the latest version of the transit key so that API servers are restarted
+// to use the new version after rotation.
+func getEncryptionConfiguration(ctx context.Context, inf cke.Infrastructure, params cke.EncryptionParams) (*apiserverv1.EncryptionConfiguration, string, error) {
+	aescfg, err := GetAESCBCConfiguration(ctx, inf)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var providers []apiserverv1.ProviderConfiguration
+	var transitVersion int
+	if params.ProviderName() == cke.EncryptionProviderKMS {
+		transitVersion, _, err = TransitKeyVersions(ctx, inf)
+		if err != nil {
+			return nil, "", err
+		}
+		providers = append(providers, apiserverv1.ProviderConfiguration{
+			KMS: &apiserverv1.KMSConfiguration{
+				APIVersion: "v2",
+				Name:       kmsProviderName,
+				Endpoint:   kmsPluginEndpoint,
+				Timeout:    &metav1.Duration{Duration: 3 * time.Second},
+			},
+		})
+	}
+	// aescbc keys are always kept to decrypt existing data.
+	providers = append(providers,
+		apiserverv1.ProviderConfiguration{AESCBC: aescfg},
+		apiserverv1.ProviderConfiguration{Identity: &apiserverv1.IdentityConfiguration{}},
+	)
+
+	cfg := &apiserverv1.EncryptionConfiguration{
 		Resources: []apiserverv1.ResourceConfiguration{
 			{
 				Resources: []string{"secrets"},
-				Providers: []apiserverv1.ProviderConfiguration{
-					{AESCBC: aescfg},
-					{Identity: &apiserverv1.IdentityConfiguration{}},
-				},
+				Providers: providers,
 			},
 		},
-	}, nil
+	}
+
+	redacted := cfg.DeepCopy()
+	for _, p := range redacted.Resources[0].Providers {
+		if p.AESCBC == nil {
+			continue
+		}
+		for i := range p.AESCBC.Keys {
+			p.AESCBC.Keys[i].Secret = ""
+		}
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return nil, "", err
+	}
+	if transitVersion > 0 {
+		data = append(data, fmt.Sprintf("\ntransit:%d", transitVersion)...)
+	}
+
+	return cfg, fmt.Sprintf("%x", md5.Sum(data)), nil
+}
+
+// EncryptionConfigHash returns the hash of the current EncryptionConfiguration for kube-apiserver.
+func EncryptionConfigHash(ctx context.Context, inf cke.Infrastructure, params cke.EncryptionParams) (string, error) {
+	_, hash, err := getEncryptionConfiguration(ctx, inf, params)
+	return hash, err
 }
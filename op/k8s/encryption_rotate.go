@@ -0,0 +1,211 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const rewriteSecretsPageSize = 500
+
+type encryptionKeyRotationOp struct {
+	apiserver *cke.Node
+	rotation  cke.EncryptionKeyRotation
+	done      bool
+}
+
+// EncryptionKeyRotationOp returns an Operator to advance the encryption key rotation by one phase.
+//
+// The phases proceed as follows.  API servers are restarted with the new
+// EncryptionConfiguration between the phases.
+//
+//  1. For aescbc, the new key becomes the primary key.
+//  2. All Secrets are rewritten to be encrypted with the new key.
+//  3. The old keys are retired.
+func EncryptionKeyRotationOp(apiserver *cke.Node, r *cke.EncryptionKeyRotation) cke.Operator {
+	return &encryptionKeyRotationOp{
+		apiserver: apiserver,
+		rotation:  *r,
+	}
+}
+
+func (o *encryptionKeyRotationOp) Name() string {
+	return "encryption-key-rotation"
+}
+
+func (o *encryptionKeyRotationOp) NextCommand() cke.Commander {
+	if o.done {
+		return nil
+	}
+	o.done = true
+
+	switch o.rotation.Phase {
+	case cke.EncryptionKeyAdded:
+		if o.rotation.Provider == cke.EncryptionProviderAESCBC {
+			return promoteEncryptionKeyCommand{o.rotation}
+		}
+		return rewriteSecretsCommand{o.apiserver, o.rotation}
+	case cke.EncryptionKeyPromoted:
+		return rewriteSecretsCommand{o.apiserver, o.rotation}
+	case cke.EncryptionKeyRewritten:
+		return retireEncryptionKeyCommand{o.rotation}
+	}
+
+	log.Warn("unknown encryption key rotation phase", map[string]interface{}{
+		"phase": o.rotation.Phase,
+	})
+	return nil
+}
+
+func (o *encryptionKeyRotationOp) Targets() []string {
+	return []string{o.apiserver.Address}
+}
+
+type promoteEncryptionKeyCommand struct {
+	rotation cke.EncryptionKeyRotation
+}
+
+func (c promoteEncryptionKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	aescfg, err := GetAESCBCConfiguration(ctx, inf)
+	if err != nil {
+		return err
+	}
+
+	idx := -1
+	for i, k := range aescfg.Keys {
+		if k.Name == c.rotation.KeyName {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("encryption key %s is not found", c.rotation.KeyName)
+	}
+	if idx > 0 {
+		key := aescfg.Keys[idx]
+		copy(aescfg.Keys[1:idx+1], aescfg.Keys[:idx])
+		aescfg.Keys[0] = key
+		err = PutAESCBCConfiguration(ctx, inf, aescfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.rotation.Phase = cke.EncryptionKeyPromoted
+	return inf.Storage().UpdateEncryptionKeyRotation(ctx, leaderKey, &c.rotation)
+}
+
+func (c promoteEncryptionKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "promote-encryption-key",
+		Target: c.rotation.KeyName,
+	}
+}
+
+type rewriteSecretsCommand struct {
+	apiserver *cke.Node
+	rotation  cke.EncryptionKeyRotation
+}
+
+func (c rewriteSecretsCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	cs, err := inf.K8sClient(ctx, c.apiserver)
+	if err != nil {
+		return err
+	}
+	secretsAPI := cs.CoreV1().Secrets(metav1.NamespaceAll)
+
+	var count int
+	opts := metav1.ListOptions{Limit: rewriteSecretsPageSize}
+	for {
+		secrets, err := secretsAPI.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		for i := range secrets.Items {
+			s := &secrets.Items[i]
+			_, err := cs.CoreV1().Secrets(s.Namespace).Update(ctx, s, metav1.UpdateOptions{})
+			switch {
+			case err == nil:
+				count++
+			case apierrors.IsNotFound(err), apierrors.IsConflict(err):
+				// deleted or updated by others, so it is already encrypted with the new key.
+			default:
+				return fmt.Errorf("failed to rewrite secret %s/%s: %w", s.Namespace, s.Name, err)
+			}
+		}
+
+		if secrets.Continue == "" {
+			break
+		}
+		opts.Continue = secrets.Continue
+	}
+
+	log.Info("rewrote secrets", map[string]interface{}{
+		"count": count,
+	})
+
+	c.rotation.Phase = cke.EncryptionKeyRewritten
+	return inf.Storage().UpdateEncryptionKeyRotation(ctx, leaderKey, &c.rotation)
+}
+
+func (c rewriteSecretsCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "rewrite-secrets",
+		Target: c.apiserver.Address,
+	}
+}
+
+type retireEncryptionKeyCommand struct {
+	rotation cke.EncryptionKeyRotation
+}
+
+func (c retireEncryptionKeyCommand) Run(ctx context.Context, inf cke.Infrastructure, leaderKey string) error {
+	switch c.rotation.Provider {
+	case cke.EncryptionProviderAESCBC:
+		aescfg, err := GetAESCBCConfiguration(ctx, inf)
+		if err != nil {
+			return err
+		}
+		if len(aescfg.Keys) > 1 {
+			aescfg.Keys = aescfg.Keys[:1]
+			err = PutAESCBCConfiguration(ctx, inf, aescfg)
+			if err != nil {
+				return err
+			}
+		}
+	case cke.EncryptionProviderKMS:
+		latest, minDecryption, err := TransitKeyVersions(ctx, inf)
+		if err != nil {
+			return err
+		}
+		if minDecryption < latest {
+			vc, err := inf.Vault()
+			if err != nil {
+				return err
+			}
+			_, err = vc.Logical().Write(path.Join(cke.VaultTransit, "keys", cke.VaultTransitKey, "config"), map[string]interface{}{
+				"min_decryption_version": latest,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown encryption provider: %s", c.rotation.Provider)
+	}
+
+	return inf.Storage().FinishEncryptionKeyRotation(ctx, leaderKey)
+}
+
+func (c retireEncryptionKeyCommand) Command() cke.Command {
+	return cke.Command{
+		Name:   "retire-encryption-key",
+		Target: c.rotation.Provider,
+	}
+}
@@ -0,0 +1,174 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+)
+
+type kmsPluginRestartOp struct {
+	nodes []*cke.Node
+
+	params cke.KMSPluginParams
+
+	step  int
+	files *common.FilesBuilder
+}
+
+// KMSPluginRestartOp returns an Operator to (re)start the KMS plugin for kube-apiserver.
+func KMSPluginRestartOp(nodes []*cke.Node, params cke.KMSPluginParams) cke.Operator {
+	return &kmsPluginRestartOp{
+		nodes:  nodes,
+		params: params,
+		files:  common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *kmsPluginRestartOp) Name() string {
+	return "kms-plugin-restart"
+}
+
+func (o *kmsPluginRestartOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return common.ImagePullCommand(o.nodes, cke.Image(o.params.Image))
+	case 1:
+		o.step++
+		return common.MakeDirsCommandWithMode(o.nodes, []string{kmsPluginConfigDir}, "700")
+	case 2:
+		o.step++
+		return common.MakeDirsCommand(o.nodes, []string{kmsPluginSocketDir})
+	case 3:
+		o.step++
+		return prepareKMSPluginFilesCommand{o.files}
+	case 4:
+		o.step++
+		return o.files
+	case 5:
+		o.step++
+		return common.StopContainersCommand(o.nodes, op.KMSPluginContainerName)
+	case 6:
+		o.step++
+		return common.RunContainerCommand(o.nodes,
+			op.KMSPluginContainerName, cke.Image(o.params.Image),
+			common.WithParams(KMSPluginParams()),
+			common.WithExtra(o.params.ServiceParams))
+	default:
+		return nil
+	}
+}
+
+func (o *kmsPluginRestartOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+// kmsPluginConfig is the configuration file for the KMS plugin.
+type kmsPluginConfig struct {
+	Address      string `json:"address"`
+	CACert       string `json:"ca_cert,omitempty"`
+	RoleID       string `json:"role_id"`
+	SecretID     string `json:"secret_id"`
+	TransitMount string `json:"transit_mount"`
+	KeyName      string `json:"key_name"`
+}
+
+type prepareKMSPluginFilesCommand struct {
+	files *common.FilesBuilder
+}
+
+// hostCIDR returns the CIDR notation of the single address.
+func hostCIDR(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip != nil && ip.To4() == nil {
+		return addr + "/128"
+	}
+	return addr + "/32"
+}
+
+// Run issues a secret_id for each node.  The secret_id can be used only
+// from the node and expires in cke.KMSSecretIDTTL, so a leaked config file
+// cannot be used elsewhere or for long.  The KMS plugin is restarted with
+// a new secret_id before it expires.
+func (c prepareKMSPluginFilesCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	vcfg, err := inf.Storage().GetVaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	vc, err := inf.Vault()
+	if err != nil {
+		return err
+	}
+	secret, err := vc.Logical().Read(cke.KMSSecret)
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil {
+		return errors.New("no AppRole for the KMS plugin; run ckecli vault init")
+	}
+	roleID, _ := secret.Data["role-id"].(string)
+
+	return c.files.AddFile(ctx, kmsPluginConfigFile, func(ctx context.Context, n *cke.Node) ([]byte, error) {
+		cidr := hostCIDR(n.Address)
+		secret, err := vc.Logical().WriteWithContext(ctx, "auth/approle/role/"+cke.KMSAppRole+"/secret-id", map[string]interface{}{
+			"cidr_list":         cidr,
+			"token_bound_cidrs": cidr,
+			"ttl":               int(cke.KMSSecretIDTTL.Seconds()),
+			"metadata":          fmt.Sprintf(`{"node":%q}`, n.Address),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil || secret.Data == nil {
+			return nil, errors.New("failed to issue secret_id for the KMS plugin")
+		}
+		secretID, _ := secret.Data["secret_id"].(string)
+
+		return json.Marshal(kmsPluginConfig{
+			Address:      vcfg.Endpoint,
+			CACert:       vcfg.CACert,
+			RoleID:       roleID,
+			SecretID:     secretID,
+			TransitMount: cke.VaultTransit,
+			KeyName:      cke.VaultTransitKey,
+		})
+	})
+}
+
+func (c prepareKMSPluginFilesCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "prepare-kms-plugin-files",
+	}
+}
+
+// KMSPluginParams returns parameters for the KMS plugin.
+func KMSPluginParams() cke.ServiceParams {
+	return cke.ServiceParams{
+		ExtraArguments: []string{
+			"--listen=" + kmsPluginEndpoint,
+			"--vault-config=" + kmsPluginConfigFile,
+		},
+		ExtraBinds: []cke.Mount{
+			{
+				Source:      kmsPluginConfigDir,
+				Destination: kmsPluginConfigDir,
+				ReadOnly:    true,
+			},
+			{
+				Source:      kmsPluginSocketDir,
+				Destination: kmsPluginSocketDir,
+			},
+		},
+	}
+}
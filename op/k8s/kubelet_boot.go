@@ -97,14 +97,16 @@ func (o *kubeletBootOp) NextCommand() cke.Commander {
 			"--tmpfs=/tmp",
 		}
 		paramsMap := make(map[string]cke.ServiceParams)
+		extraMap := make(map[string]cke.ServiceParams)
 		for _, n := range o.nodes {
-			params := KubeletServiceParams(n, o.params)
-			paramsMap[n.Address] = params
+			params := o.params.ForNode(n)
+			paramsMap[n.Address] = KubeletServiceParams(n, params)
+			extraMap[n.Address] = params.ServiceParams
 		}
 		return common.RunContainerCommand(o.nodes, op.KubeletContainerName, cke.KubernetesImage,
 			common.WithOpts(opts),
 			common.WithParamsMap(paramsMap),
-			common.WithExtra(o.params.ServiceParams))
+			common.WithExtraMap(extraMap))
 	case 8:
 		o.step++
 		return waitForKubeletReadyCommand{o.nodes}
@@ -181,7 +183,7 @@ func (c prepareKubeletFilesCommand) Run(ctx context.Context, inf cke.Infrastruct
 		if ns != nil {
 			running = ns.Kubelet.Config
 		}
-		cfg := GenerateKubeletConfiguration(c.params, n.Address, running)
+		cfg := GenerateKubeletConfiguration(c.params.ForNode(n), n.Address, running)
 		return encodeToYAML(cfg)
 	}
 	err := c.files.AddFile(ctx, kubeletConfigPath, g)
@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/common"
+)
+
+type kubeletCertRenewOp struct {
+	nodes []*cke.Node
+
+	cluster      string
+	nodeStatuses map[string]*cke.NodeStatus
+
+	step  int
+	files *common.FilesBuilder
+}
+
+// KubeletCertRenewOp returns an Operator to reissue the certificate of kubelet.
+//
+// kubelet is restarted with the running configuration and parameters, so this
+// can renew the certificate of kubelet that is not updated in place.
+func KubeletCertRenewOp(nodes []*cke.Node, cluster string, ns map[string]*cke.NodeStatus) cke.Operator {
+	return &kubeletCertRenewOp{
+		nodes:        nodes,
+		cluster:      cluster,
+		nodeStatuses: ns,
+		files:        common.NewFilesBuilder(nodes),
+	}
+}
+
+func (o *kubeletCertRenewOp) Name() string {
+	return "kubelet-cert-renew"
+}
+
+func (o *kubeletCertRenewOp) NextCommand() cke.Commander {
+	switch o.step {
+	case 0:
+		o.step++
+		return prepareKubeletCertCommand{o.cluster, o.files}
+	case 1:
+		o.step++
+		return o.files
+	case 2:
+		o.step++
+		opts := []string{
+			"--pid=host",
+			"--privileged",
+			"--tmpfs=/tmp",
+		}
+		// The running image and parameters are kept.
+		imgMap := make(map[string]cke.Image)
+		paramsMap := make(map[string]cke.ServiceParams)
+		extraMap := make(map[string]cke.ServiceParams)
+		for _, n := range o.nodes {
+			st := o.nodeStatuses[n.Address].Kubelet
+			imgMap[n.Address] = cke.Image(st.Image)
+			paramsMap[n.Address] = st.BuiltInParams
+			extraMap[n.Address] = st.ExtraParams
+		}
+		return common.RunContainerCommand(o.nodes, op.KubeletContainerName, cke.KubernetesImage,
+			common.WithImageMap(imgMap),
+			common.WithOpts(opts),
+			common.WithParamsMap(paramsMap),
+			common.WithExtraMap(extraMap),
+			common.WithRestart())
+	case 3:
+		o.step++
+		return waitForKubeletReadyCommand{o.nodes}
+	default:
+		return nil
+	}
+}
+
+func (o *kubeletCertRenewOp) Targets() []string {
+	ips := make([]string, len(o.nodes))
+	for i, n := range o.nodes {
+		ips[i] = n.Address
+	}
+	return ips
+}
+
+type prepareKubeletCertCommand struct {
+	cluster string
+	files   *common.FilesBuilder
+}
+
+func (c prepareKubeletCertCommand) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	return addKubeletCertificateFiles(ctx, inf, c.cluster, c.files)
+}
+
+func (c prepareKubeletCertCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "prepare-kubelet-cert",
+	}
+}
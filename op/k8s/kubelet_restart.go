@@ -55,13 +55,16 @@ func (o *kubeletRestartOp) NextCommand() cke.Commander {
 			"--tmpfs=/tmp",
 		}
 		paramsMap := make(map[string]cke.ServiceParams)
+		extraMap := make(map[string]cke.ServiceParams)
 		for _, n := range o.nodes {
-			paramsMap[n.Address] = KubeletServiceParams(n, o.params)
+			params := o.params.ForNode(n)
+			paramsMap[n.Address] = KubeletServiceParams(n, params)
+			extraMap[n.Address] = params.ServiceParams
 		}
 		return common.RunContainerCommand(o.nodes, op.KubeletContainerName, cke.KubernetesImage,
 			common.WithOpts(opts),
 			common.WithParamsMap(paramsMap),
-			common.WithExtra(o.params.ServiceParams),
+			common.WithExtraMap(extraMap),
 			common.WithRestart())
 	case 4:
 		o.step++
@@ -93,14 +96,25 @@ func (c prepareKubeletConfigCommand) Run(ctx context.Context, inf cke.Infrastruc
 		if ns != nil {
 			running = ns.Kubelet.Config
 		}
-		cfg := GenerateKubeletConfiguration(c.params, n.Address, running)
+		cfg := GenerateKubeletConfiguration(c.params.ForNode(n), n.Address, running)
 		return encodeToYAML(cfg)
 	}
 	err := c.files.AddFile(ctx, kubeletConfigPath, g)
 	if err != nil {
 		return err
 	}
+	return addKubeletCertificateFiles(ctx, inf, c.cluster, c.files)
+}
 
+func (c prepareKubeletConfigCommand) Command() cke.Command {
+	return cke.Command{
+		Name: "prepare-kubelet-config",
+	}
+}
+
+// addKubeletCertificateFiles adds the certificate, the CA certificate, and
+// the kubeconfig of kubelet to files.
+func addKubeletCertificateFiles(ctx context.Context, inf cke.Infrastructure, cluster string, files *common.FilesBuilder) error {
 	f := func(ctx context.Context, n *cke.Node) (cert, key []byte, err error) {
 		c, k, e := cke.KubernetesCA{}.IssueForKubelet(ctx, inf, n)
 		if e != nil {
@@ -108,23 +122,31 @@ func (c prepareKubeletConfigCommand) Run(ctx context.Context, inf cke.Infrastruc
 		}
 		return []byte(c), []byte(k), nil
 	}
-	err = c.files.AddKeyPair(ctx, op.K8sPKIPath("kubelet"), f)
+	err := files.AddKeyPair(ctx, op.K8sPKIPath("kubelet"), f)
 	if err != nil {
 		return err
 	}
 
+	// The CA certificate is also updated for the rotation of the Kubernetes CA.
 	caPath := op.K8sPKIPath("ca.crt")
+	ca, err := inf.Storage().GetCACertificate(ctx, cke.CAKubernetes)
+	if err != nil {
+		return err
+	}
+	caData := []byte(ca)
+	g := func(ctx context.Context, n *cke.Node) ([]byte, error) {
+		return caData, nil
+	}
+	err = files.AddFile(ctx, caPath, g)
+	if err != nil {
+		return err
+	}
+
 	tlsCertPath := op.K8sPKIPath("kubelet.crt")
 	tlsKeyPath := op.K8sPKIPath("kubelet.key")
 	g = func(ctx context.Context, n *cke.Node) ([]byte, error) {
-		cfg := kubeletKubeconfig(c.cluster, n, caPath, tlsCertPath, tlsKeyPath)
+		cfg := kubeletKubeconfig(cluster, n, caPath, tlsCertPath, tlsKeyPath)
 		return clientcmd.Write(*cfg)
 	}
-	return c.files.AddFile(ctx, kubeconfigPath, g)
-}
-
-func (c prepareKubeletConfigCommand) Command() cke.Command {
-	return cke.Command{
-		Name: "prepare-kubelet-config",
-	}
+	return files.AddFile(ctx, kubeconfigPath, g)
 }
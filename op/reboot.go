@@ -301,8 +301,9 @@ func (c rebootDeleteDaemonSetPodCommand) Run(ctx context.Context, inf cke.Infras
 //
 
 type rebootRebootOp struct {
-	finished bool
+	step int
 
+	cpNodes []*cke.Node
 	entries []*cke.RebootQueueEntry
 	config  *cke.Reboot
 
@@ -327,8 +328,10 @@ func (o *rebootRebootOp) notifyFailedNode(node string) {
 }
 
 // RebootRebootOp returns an Operator to reboot nodes.
-func RebootRebootOp(apiserver *cke.Node, entries []*cke.RebootQueueEntry, config *cke.Reboot) cke.InfoOperator {
+// If control planes are rebooted, the etcd leadership is moved away from them beforehand.
+func RebootRebootOp(apiserver *cke.Node, cpNodes []*cke.Node, entries []*cke.RebootQueueEntry, config *cke.Reboot) cke.InfoOperator {
 	return &rebootRebootOp{
+		cpNodes: cpNodes,
 		entries: entries,
 		config:  config,
 	}
@@ -339,19 +342,25 @@ func (o *rebootRebootOp) Name() string {
 }
 
 func (o *rebootRebootOp) NextCommand() cke.Commander {
-	if o.finished {
-		return nil
-	}
-	o.finished = true
-
-	return rebootRebootCommand{
-		entries:          o.entries,
-		command:          o.config.RebootCommand,
-		timeoutSeconds:   o.config.CommandTimeoutSeconds,
-		retries:          o.config.CommandRetries,
-		interval:         o.config.CommandInterval,
-		notifyFailedNode: o.notifyFailedNode,
+	switch o.step {
+	case 0:
+		o.step++
+		if targets := controlPlaneTargets(o.cpNodes, o.Targets()); len(targets) > 0 {
+			return MoveEtcdLeaderCommand(o.cpNodes, targets)
+		}
+		fallthrough
+	case 1:
+		o.step = 2
+		return rebootRebootCommand{
+			entries:          o.entries,
+			command:          o.config.RebootCommand,
+			timeoutSeconds:   o.config.CommandTimeoutSeconds,
+			retries:          o.config.CommandRetries,
+			interval:         o.config.CommandInterval,
+			notifyFailedNode: o.notifyFailedNode,
+		}
 	}
+	return nil
 }
 
 func (o *rebootRebootOp) Targets() []string {
@@ -680,10 +689,10 @@ func listProtectedNamespaces(ctx context.Context, cs kubernetes.Interface, ls *m
 	return nss, nil
 }
 
-func drainBackOff(ctx context.Context, inf cke.Infrastructure, entry *cke.RebootQueueEntry, err error) error {
+func drainBackOff(ctx context.Context, inf cke.Infrastructure, entry *cke.RebootQueueEntry, drainErr error) error {
 	log.Warn("failed to drain node", map[string]interface{}{
 		"name":      entry.Node,
-		log.FnError: err,
+		log.FnError: drainErr,
 	})
 	etcdEntry, err := inf.Storage().GetRebootsEntry(ctx, entry.Index)
 	if err != nil {
@@ -705,5 +714,10 @@ func drainBackOff(ctx context.Context, inf cke.Infrastructure, entry *cke.Reboot
 	if err != nil {
 		return err
 	}
+	cke.Notify(ctx, inf.Storage(), &cke.Notification{
+		Event:       cke.EventRebootDrainFailed,
+		Message:     fmt.Sprintf("failed to drain %s for reboot: %v", entry.Node, drainErr),
+		RebootEntry: entry,
+	})
 	return nil
 }
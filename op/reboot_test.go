@@ -0,0 +1,52 @@
+package op
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/cke"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRebootRebootOpMovesEtcdLeader(t *testing.T) {
+	cpNodes := []*cke.Node{
+		{Address: "10.0.0.11", ControlPlane: true},
+		{Address: "10.0.0.12", ControlPlane: true},
+		{Address: "10.0.0.13", ControlPlane: true},
+	}
+	config := &cke.Reboot{RebootCommand: []string{"true"}}
+
+	testCases := []struct {
+		name     string
+		entries  []*cke.RebootQueueEntry
+		expected []cke.Command
+	}{
+		{
+			name:    "control plane",
+			entries: []*cke.RebootQueueEntry{{Node: "10.0.0.12"}, {Node: "10.0.0.14"}},
+			expected: []cke.Command{
+				{Name: "move-etcd-leader", Target: "10.0.0.12"},
+				{Name: "rebootRebootCommand", Target: "10.0.0.12,10.0.0.14"},
+			},
+		},
+		{
+			name:    "worker",
+			entries: []*cke.RebootQueueEntry{{Node: "10.0.0.14"}},
+			expected: []cke.Command{
+				{Name: "rebootRebootCommand", Target: "10.0.0.14"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := RebootRebootOp(nil, cpNodes, tc.entries, config)
+			var actual []cke.Command
+			for c := o.NextCommand(); c != nil; c = o.NextCommand() {
+				actual = append(actual, c.Command())
+			}
+			if !cmp.Equal(tc.expected, actual) {
+				t.Error("unexpected commands:", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
@@ -12,18 +12,20 @@ import (
 )
 
 type repairDrainStartOp struct {
-	finished bool
+	step int
 
 	entry     *cke.RepairQueueEntry
 	config    *cke.Repair
 	apiserver *cke.Node
+	cpNodes   []*cke.Node
 }
 
-func RepairDrainStartOp(apiserver *cke.Node, entry *cke.RepairQueueEntry, config *cke.Repair) cke.Operator {
+func RepairDrainStartOp(apiserver *cke.Node, cpNodes []*cke.Node, entry *cke.RepairQueueEntry, config *cke.Repair) cke.Operator {
 	return &repairDrainStartOp{
 		entry:     entry,
 		config:    config,
 		apiserver: apiserver,
+		cpNodes:   cpNodes,
 	}
 }
 
@@ -32,10 +34,18 @@ func (o *repairDrainStartOp) Name() string {
 }
 
 func (o *repairDrainStartOp) NextCommand() cke.Commander {
-	if o.finished {
+	switch o.step {
+	case 0:
+		o.step++
+		if targets := controlPlaneTargets(o.cpNodes, o.Targets()); len(targets) > 0 {
+			return MoveEtcdLeaderCommand(o.cpNodes, targets)
+		}
+		fallthrough
+	case 1:
+		o.step = 2
+	default:
 		return nil
 	}
-	o.finished = true
 
 	attempts := 1
 	if o.config.EvictRetries != nil {
@@ -66,5 +66,13 @@ func repairDrainBackOff(ctx context.Context, inf cke.Infrastructure, entry *cke.
 	entry.LastTransitionTime = time.Now().Truncate(time.Second).UTC()
 	entry.DrainBackOffCount++
 	entry.DrainBackOffExpire = entry.LastTransitionTime.Add(time.Second * time.Duration(drainBackOffBaseSeconds+rand.Int63n(int64(drainBackOffBaseSeconds*entry.DrainBackOffCount))))
-	return inf.Storage().UpdateRepairsEntry(ctx, entry)
+	if err := inf.Storage().UpdateRepairsEntry(ctx, entry); err != nil {
+		return err
+	}
+	cke.Notify(ctx, inf.Storage(), &cke.Notification{
+		Event:       cke.EventRepairDrainFailed,
+		Message:     fmt.Sprintf("failed to drain %s for repair: %v", entry.Address, err),
+		RepairEntry: entry,
+	})
+	return nil
 }
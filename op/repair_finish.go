@@ -3,6 +3,7 @@ package op
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -105,5 +106,19 @@ func repairFinish(ctx context.Context, inf cke.Infrastructure, entry *cke.Repair
 		entry.Status = cke.RepairStatusFailed
 	}
 	entry.LastTransitionTime = time.Now().Truncate(time.Second).UTC()
-	return inf.Storage().UpdateRepairsEntry(ctx, entry)
+	if err := inf.Storage().UpdateRepairsEntry(ctx, entry); err != nil {
+		return err
+	}
+
+	n := &cke.Notification{
+		Event:       cke.EventRepairSucceeded,
+		Message:     fmt.Sprintf("repair of %s succeeded", entry.Address),
+		RepairEntry: entry,
+	}
+	if entry.Status == cke.RepairStatusFailed {
+		n.Event = cke.EventRepairFailed
+		n.Message = fmt.Sprintf("repair of %s failed", entry.Address)
+	}
+	cke.Notify(ctx, inf.Storage(), n)
+	return nil
 }
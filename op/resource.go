@@ -6,6 +6,7 @@ import (
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/log"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
@@ -49,18 +50,27 @@ func (o *resourceApplyOp) Targets() []string {
 	}
 }
 
-func (o *resourceApplyOp) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
-	cfg, err := inf.K8sConfig(ctx, o.apiserver)
+// resourceClients returns the clients to apply resources via apiserver.
+func resourceClients(ctx context.Context, inf cke.Infrastructure, apiserver *cke.Node) (dynamic.Interface, meta.RESTMapper, error) {
+	cfg, err := inf.K8sConfig(ctx, apiserver)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
 
 	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dyn, mapper, nil
+}
+
+func (o *resourceApplyOp) Run(ctx context.Context, inf cke.Infrastructure, _ string) error {
+	dyn, mapper, err := resourceClients(ctx, inf, o.apiserver)
 	if err != nil {
 		return err
 	}
@@ -1,13 +1,17 @@
 package op
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +31,7 @@ import (
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
 	proxyv1alpha1 "k8s.io/kube-proxy/config/v1alpha1"
 	schedulerv1 "k8s.io/kube-scheduler/config/v1"
 	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
@@ -44,10 +49,12 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 	}
 
 	ce := inf.Engine(node.Address)
+	status.ContainerEngine = ce.Name()
 	ss, err := ce.Inspect([]string{
 		EtcdContainerName,
 		RiversContainerName,
 		EtcdRiversContainerName,
+		KMSPluginContainerName,
 		KubeAPIServerContainerName,
 		KubeControllerManagerContainerName,
 		KubeSchedulerContainerName,
@@ -75,6 +82,16 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 	}
 	status.Rivers = ss[RiversContainerName]
 	status.EtcdRivers = ss[EtcdRiversContainerName]
+	status.KMSPlugin = ss[KMSPluginContainerName]
+	if status.KMSPlugin.Running {
+		status.KMSSecretIDIssued, err = fileModTime(agent, KMSPluginConfigPath)
+		if err != nil {
+			log.Warn("failed to read KMS plugin config", map[string]interface{}{
+				log.FnError: err,
+				"node":      node.Address,
+			})
+		}
+	}
 
 	status.APIServer = cke.KubeComponentStatus{
 		ServiceStatus: ss[KubeAPIServerContainerName],
@@ -191,9 +208,157 @@ func GetNodeStatus(ctx context.Context, inf cke.Infrastructure, node *cke.Node,
 		}
 	}
 
+	status.Certificates = getCertificates(agent, node, cluster, status)
+
 	return status, nil
 }
 
+func certificateStatus(data []byte) (cke.CertificateStatus, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return cke.CertificateStatus{}, errors.New("no PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return cke.CertificateStatus{}, err
+	}
+	return cke.CertificateStatus{NotBefore: cert.NotBefore, NotAfter: cert.NotAfter}, nil
+}
+
+// kubeconfigCertificate returns the client certificate embedded in kubeconfig.
+func kubeconfigCertificate(data []byte) ([]byte, error) {
+	cfg, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	ctx, ok := cfg.Contexts[cfg.CurrentContext]
+	if !ok {
+		return nil, errors.New("no current context in kubeconfig")
+	}
+	auth, ok := cfg.AuthInfos[ctx.AuthInfo]
+	if !ok || len(auth.ClientCertificateData) == 0 {
+		return nil, errors.New("no client certificate in kubeconfig")
+	}
+	return auth.ClientCertificateData, nil
+}
+
+type certificateFile struct {
+	path       string
+	kubeconfig bool
+}
+
+// fileMarker precedes the path of each file in the output of readFilesCommand.
+const fileMarker = "==> "
+
+// readFilesCommand returns a command line to print the existing files
+// in paths, each preceded by a line of fileMarker and its path.
+func readFilesCommand(paths []string) string {
+	cmds := make([]string, len(paths))
+	for i, p := range paths {
+		cmds[i] = fmt.Sprintf("if [ -f %[1]s ]; then echo '%[2]s%[1]s'; cat %[1]s; echo; fi", p, fileMarker)
+	}
+	return strings.Join(cmds, "; ")
+}
+
+// parseFiles parses the output of readFilesCommand into the contents keyed by paths.
+func parseFiles(data []byte, paths []string) map[string][]byte {
+	known := make(map[string]bool)
+	for _, p := range paths {
+		known[p] = true
+	}
+
+	files := make(map[string][]byte)
+	var current string
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if p, ok := bytes.CutPrefix(bytes.TrimSuffix(line, []byte("\n")), []byte(fileMarker)); ok && known[string(p)] {
+			current = string(p)
+			files[current] = nil
+			continue
+		}
+		if current == "" {
+			continue
+		}
+		files[current] = append(files[current], line...)
+	}
+	return files
+}
+
+// getCertificates reads the certificates of the running components on the node.
+// The files are read by a single command to save round trips.
+func getCertificates(agent cke.Agent, node *cke.Node, cluster *cke.Cluster, status *cke.NodeStatus) map[string]cke.CertificateStatus {
+	files := make(map[string]certificateFile)
+	if status.Etcd.Running {
+		files[cke.CertEtcdServer] = certificateFile{path: EtcdPKIPath("server.crt")}
+		files[cke.CertEtcdPeer] = certificateFile{path: EtcdPKIPath("peer.crt")}
+	}
+	if status.APIServer.Running {
+		files[cke.CertAPIServer] = certificateFile{path: K8sPKIPath("apiserver.crt")}
+		files[cke.CertAPIServerEtcdClient] = certificateFile{path: K8sPKIPath("apiserver-etcd-client.crt")}
+		files[cke.CertAggregation] = certificateFile{path: K8sPKIPath("aggregation.crt")}
+		if cluster.Options.APIServer.AuditWebhook.Enabled {
+			files[cke.CertAuditWebhook] = certificateFile{path: AuditWebhookCertPath}
+		}
+	}
+	if status.ControllerManager.Running {
+		files[cke.CertControllerManager] = certificateFile{path: ControllerManagerKubeConfigPath, kubeconfig: true}
+	}
+	if status.Scheduler.Running {
+		files[cke.CertScheduler] = certificateFile{path: SchedulerKubeConfigPath, kubeconfig: true}
+	}
+	if status.Proxy.Running {
+		files[cke.CertProxy] = certificateFile{path: "/etc/kubernetes/proxy/kubeconfig", kubeconfig: true}
+	}
+	if status.Kubelet.Running {
+		files[cke.CertKubelet] = certificateFile{path: K8sPKIPath("kubelet.crt")}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.path)
+	}
+	sort.Strings(paths)
+	cmdline := readFilesCommand(paths)
+	stdout, stderr, err := agent.Run(cmdline)
+	if err != nil {
+		log.Warn("failed to read certificates", map[string]interface{}{
+			log.FnError: err,
+			"node":      node.Address,
+			"stderr":    string(stderr),
+		})
+		return nil
+	}
+	contents := parseFiles(stdout, paths)
+
+	certs := make(map[string]cke.CertificateStatus)
+	for name, f := range files {
+		var err error
+		data, ok := contents[f.path]
+		if !ok {
+			err = errors.New("no such file: " + f.path)
+		}
+		if err == nil && f.kubeconfig {
+			data, err = kubeconfigCertificate(data)
+		}
+		var st cke.CertificateStatus
+		if err == nil {
+			st, err = certificateStatus(data)
+		}
+		if err != nil {
+			log.Warn("failed to read certificate", map[string]interface{}{
+				log.FnError:   err,
+				"node":        node.Address,
+				"certificate": name,
+			})
+			continue
+		}
+		certs[name] = st
+	}
+	return certs
+}
+
 // GetEtcdClusterStatus returns EtcdClusterStatus
 func GetEtcdClusterStatus(ctx context.Context, inf cke.Infrastructure, nodes []*cke.Node) (cke.EtcdClusterStatus, error) {
 	clusterStatus := cke.EtcdClusterStatus{}
@@ -226,8 +391,12 @@ func GetEtcdClusterStatus(ctx context.Context, inf cke.Infrastructure, nodes []*
 	clusterStatus.IsHealthy = resp.ID != clientv3.NoLease
 
 	clusterStatus.InSyncMembers = make(map[string]bool)
+	clusterStatus.MemberStatuses = make(map[string]*cke.EtcdMemberStatus)
 	for name := range clusterStatus.Members {
-		clusterStatus.InSyncMembers[name] = getEtcdMemberInSync(ctx, inf, name, resp.Revision)
+		clusterStatus.InSyncMembers[name] = EtcdMemberInSync(ctx, inf, name, resp.Revision, clusterStatus.IsLearner(name))
+		if st := getEtcdMemberStatus(ctx, cli, name); st != nil {
+			clusterStatus.MemberStatuses[name] = st
+		}
 	}
 
 	return clusterStatus, nil
@@ -272,7 +441,10 @@ func GuessMemberName(m *etcdserverpb.Member) (string, error) {
 	return h, nil
 }
 
-func getEtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address string, clusterRev int64) bool {
+// EtcdMemberInSync returns true if the etcd member has applied the cluster
+// revision clusterRev.  Learners are checked with a serializable read because
+// they do not serve linearizable reads.
+func EtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address string, clusterRev int64, learner bool) bool {
 	endpoints := []string{fmt.Sprintf("https://%s:2379", address)}
 	cli, err := inf.NewEtcdClient(ctx, endpoints)
 	if err != nil {
@@ -280,9 +452,14 @@ func getEtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address st
 	}
 	defer cli.Close()
 
+	var opts []clientv3.OpOption
+	if learner {
+		opts = append(opts, clientv3.WithSerializable())
+	}
+
 	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
 	defer cancel()
-	resp, err := cli.Get(ct, "health")
+	resp, err := cli.Get(ct, "health", opts...)
 	if err != nil {
 		return false
 	}
@@ -290,6 +467,25 @@ func getEtcdMemberInSync(ctx context.Context, inf cke.Infrastructure, address st
 	return resp.Header.Revision >= clusterRev
 }
 
+// getEtcdMemberStatus returns the status of the etcd member.
+// The cluster client is reused to query the member endpoint.
+func getEtcdMemberStatus(ctx context.Context, cli *clientv3.Client, address string) *cke.EtcdMemberStatus {
+	endpoint := fmt.Sprintf("https://%s:2379", address)
+
+	ct, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+	resp, err := cli.Status(ct, endpoint)
+	if err != nil {
+		return nil
+	}
+
+	return &cke.EtcdMemberStatus{
+		DBSize:      resp.DbSize,
+		DBSizeInUse: resp.DbSizeInUse,
+		IsLeader:    resp.Leader == resp.Header.MemberId,
+	}
+}
+
 // GetKubernetesClusterStatus returns KubernetesClusterStatus
 func GetKubernetesClusterStatus(ctx context.Context, inf cke.Infrastructure, n *cke.Node, cluster *cke.Cluster) (cke.KubernetesClusterStatus, error) {
 	clientset, err := inf.K8sClient(ctx, n)
@@ -697,3 +893,16 @@ func GetRebootQueueStatus(ctx context.Context, inf cke.Infrastructure, n *cke.No
 
 	return status, nil
 }
+
+// fileModTime returns the modification time of the file on the node.
+func fileModTime(agent cke.Agent, path string) (time.Time, error) {
+	stdout, stderr, err := agent.Run("stat -c %Y " + path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w, stderr: %s", err, stderr)
+	}
+	sec, err := strconv.ParseInt(strings.TrimSpace(string(stdout)), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
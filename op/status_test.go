@@ -41,3 +41,25 @@ func TestContainCommandOption(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFiles(t *testing.T) {
+	paths := []string{"/etc/a.crt", "/etc/b.crt", "/etc/c.crt"}
+	output := fileMarker + "/etc/a.crt\n" +
+		"-----BEGIN CERTIFICATE-----\nAAA\n-----END CERTIFICATE-----\n\n" +
+		fileMarker + "/etc/c.crt\n" +
+		"no newline\n"
+
+	files := parseFiles([]byte(output), paths)
+	if len(files) != 2 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	if string(files["/etc/a.crt"]) != "-----BEGIN CERTIFICATE-----\nAAA\n-----END CERTIFICATE-----\n\n" {
+		t.Errorf("unexpected content of a.crt: %q", files["/etc/a.crt"])
+	}
+	if _, ok := files["/etc/b.crt"]; ok {
+		t.Error("b.crt should not exist")
+	}
+	if string(files["/etc/c.crt"]) != "no newline\n" {
+		t.Errorf("unexpected content of c.crt: %q", files["/etc/c.crt"])
+	}
+}
@@ -78,3 +78,11 @@ func ProxyStopOp(nodes []*cke.Node) cke.Operator {
 		name:  KubeProxyContainerName,
 	}
 }
+
+// KMSPluginStopOp returns an Operator to stop the KMS plugin
+func KMSPluginStopOp(nodes []*cke.Node) cke.Operator {
+	return &containerStopOp{
+		nodes: nodes,
+		name:  KMSPluginContainerName,
+	}
+}
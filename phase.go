@@ -7,21 +7,24 @@ type OperationPhase string
 
 // Processing statuses of CKE server.
 const (
-	PhaseUpgradeAborted  = OperationPhase("upgrade-aborted")
-	PhaseUpgrade         = OperationPhase("upgrade")
-	PhaseRivers          = OperationPhase("rivers")
-	PhaseEtcdBootAborted = OperationPhase("etcd-boot-aborted")
-	PhaseEtcdBoot        = OperationPhase("etcd-boot")
-	PhaseEtcdStart       = OperationPhase("etcd-start")
-	PhaseEtcdWait        = OperationPhase("etcd-wait")
-	PhaseK8sStart        = OperationPhase("k8s-start")
-	PhaseEtcdMaintain    = OperationPhase("etcd-maintain")
-	PhaseK8sMaintain     = OperationPhase("k8s-maintain")
-	PhaseStopCP          = OperationPhase("stop-control-plane")
-	PhaseRepairMachines  = OperationPhase("repair-machines")
-	PhaseUncordonNodes   = OperationPhase("uncordon-nodes")
-	PhaseRebootNodes     = OperationPhase("reboot-nodes")
-	PhaseCompleted       = OperationPhase("completed")
+	PhaseUpgradeAborted     = OperationPhase("upgrade-aborted")
+	PhaseUpgrade            = OperationPhase("upgrade")
+	PhaseRivers             = OperationPhase("rivers")
+	PhaseEtcdRestoreAborted = OperationPhase("etcd-restore-aborted")
+	PhaseEtcdRestore        = OperationPhase("etcd-restore")
+	PhaseEtcdBootAborted    = OperationPhase("etcd-boot-aborted")
+	PhaseEtcdBoot           = OperationPhase("etcd-boot")
+	PhaseEtcdStart          = OperationPhase("etcd-start")
+	PhaseEtcdWait           = OperationPhase("etcd-wait")
+	PhaseK8sStart           = OperationPhase("k8s-start")
+	PhaseEngineMigration    = OperationPhase("container-engine-migration")
+	PhaseEtcdMaintain       = OperationPhase("etcd-maintain")
+	PhaseK8sMaintain        = OperationPhase("k8s-maintain")
+	PhaseStopCP             = OperationPhase("stop-control-plane")
+	PhaseRepairMachines     = OperationPhase("repair-machines")
+	PhaseUncordonNodes      = OperationPhase("uncordon-nodes")
+	PhaseRebootNodes        = OperationPhase("reboot-nodes")
+	PhaseCompleted          = OperationPhase("completed")
 )
 
 // AllOperationPhases contains all kinds of OperationPhases.
@@ -29,11 +32,14 @@ var AllOperationPhases = []OperationPhase{
 	PhaseUpgradeAborted,
 	PhaseUpgrade,
 	PhaseRivers,
+	PhaseEtcdRestoreAborted,
+	PhaseEtcdRestore,
 	PhaseEtcdBootAborted,
 	PhaseEtcdBoot,
 	PhaseEtcdStart,
 	PhaseEtcdWait,
 	PhaseK8sStart,
+	PhaseEngineMigration,
 	PhaseEtcdMaintain,
 	PhaseK8sMaintain,
 	PhaseStopCP,
@@ -47,4 +53,6 @@ var AllOperationPhases = []OperationPhase{
 type ServerStatus struct {
 	Phase     OperationPhase `json:"phase"`
 	Timestamp time.Time      `json:"timestamp"`
+	// Frozen is true if operations in Phase are blocked by the freeze.
+	Frozen bool `json:"frozen,omitempty"`
 }
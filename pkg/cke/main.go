@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -27,6 +30,9 @@ var (
 	flgSessionTTL           = pflag.String("session-ttl", "60s", "leader session's TTL")
 	flgDebugSabakan         = pflag.Bool("debug-sabakan", false, "debug sabakan integration")
 	flgMaxConcurrentUpdates = pflag.Int("max-concurrent-updates", 10, "the maximum number of components that can be updated simultaneously")
+	flgMaxConcurrentOps     = pflag.Int("max-concurrent-operations", 1, "the maximum number of independent operations that can run simultaneously")
+	flgAPITokenFile         = pflag.String("api-token-file", "", "file containing the bearer token for /api/v1/ endpoints; the endpoints are disabled if empty")
+	flgAdvertiseURL         = pflag.String("advertise-url", "", "URL of the REST API advertised to followers (default \"http://<hostname>:<port of --http>\")")
 )
 
 func loadConfig(p string) (*etcdutil.Config, error) {
@@ -43,6 +49,36 @@ func loadConfig(p string) (*etcdutil.Config, error) {
 	return cfg, nil
 }
 
+func loadAPIToken(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", p)
+	}
+	return token, nil
+}
+
+func advertiseURL() (string, error) {
+	if *flgAdvertiseURL != "" {
+		return *flgAdvertiseURL, nil
+	}
+	_, port, err := net.SplitHostPort(*flgHTTP)
+	if err != nil {
+		return "", err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return "http://" + net.JoinHostPort(hostname, port), nil
+}
+
 func debugSabakan(addon server.Integrator) {
 	well.Go(func(ctx context.Context) error {
 		ctx = context.WithValue(ctx, sabakan.WaitSecs, float64(5))
@@ -115,11 +151,28 @@ func main() {
 		log.ErrorExit(errors.New("max-concurrent-updates must be greater than 0"))
 	}
 
+	maxConcurrentOps := *flgMaxConcurrentOps
+	if maxConcurrentOps <= 0 {
+		log.ErrorExit(errors.New("max-concurrent-operations must be greater than 0"))
+	}
+
+	apiToken, err := loadAPIToken(*flgAPITokenFile)
+	if err != nil {
+		log.ErrorExit(err)
+	}
+
+	advertise, err := advertiseURL()
+	if err != nil {
+		log.ErrorExit(err)
+	}
+
 	// Controller
 	controller := server.NewController(session, addon, &server.Config{
-		Interval:             interval,
-		CertsGCInterval:      gcInterval,
-		MaxConcurrentUpdates: maxConcurrentUpdates,
+		Interval:                interval,
+		CertsGCInterval:         gcInterval,
+		MaxConcurrentUpdates:    maxConcurrentUpdates,
+		MaxConcurrentOperations: maxConcurrentOps,
+		AdvertiseURL:            advertise,
 	})
 	well.Go(controller.Run)
 
@@ -134,6 +187,7 @@ func main() {
 	server := server.Server{
 		EtcdClient: etcd,
 		Timeout:    timeout,
+		APIToken:   apiToken,
 	}
 	mux.Handle("/", server)
 	s := &well.HTTPServer{
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// caRotateCmd represents the "ca rotate" command
+var caRotateCmd = &cobra.Command{
+	Use:   "rotate NAME",
+	Short: "rotate CA",
+	Long: `Rotate CA.
+
+NAME is one of:
+    server
+    etcd-peer
+    etcd-client
+    kubernetes
+    kubernetes-aggregation
+    kubernetes-webhook
+
+This command creates a new CA for NAME in Vault PKI, or in the local
+CA backend if it is configured.
+Then, the leader of CKE will:
+
+1. distribute the bundle of the old and the new CA, and restart components,
+2. issue certificates from the new CA, and restart components,
+3. distribute the new CA only, and restart components, and
+4. delete the old CA.
+
+Only one rotation can be in progress at a time.`,
+
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("wrong number of arguments")
+		}
+
+		for _, ca := range cas {
+			if ca.key == args[0] {
+				return nil
+			}
+		}
+		return errors.New("wrong CA name: " + args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		author, err := currentAuthor()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			_, err := storage.GetCARotation(ctx)
+			switch err {
+			case nil:
+				return errors.New("CA rotation is in progress")
+			case cke.ErrNotFound:
+			default:
+				return err
+			}
+
+			oldCert, err := storage.GetCACertificate(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			var ca caParams
+			for _, c := range cas {
+				if c.key == args[0] {
+					ca = c
+					break
+				}
+			}
+			oldIssuer, newIssuer, newCert, err := cke.AddCAIssuer(ctx, inf, ca.key, ca.commonName, ttl100Year)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("created a new issuer %s for %s CA\n", newIssuer, ca.key)
+
+			now := time.Now().UTC()
+			r := &cke.CARotation{
+				Name:           ca.key,
+				Phase:          cke.CARotationAdded,
+				PhaseStarted:   now,
+				OldIssuer:      oldIssuer,
+				NewIssuer:      newIssuer,
+				OldCertificate: oldCert,
+				NewCertificate: newCert,
+				Author:         author,
+				Timestamp:      now,
+			}
+			err = storage.PutCARotation(ctx, r)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("requested to rotate %s CA\n", ca.key)
+			return nil
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	caCmd.AddCommand(caRotateCmd)
+}
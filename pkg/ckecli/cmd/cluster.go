@@ -1,6 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+	"github.com/google/go-cmp/cmp"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +19,103 @@ var clusterCmd = &cobra.Command{
 	Long:  `cluster subcommand`,
 }
 
+// checkConstraints checks the cluster configuration against the stored constraints.
+func checkConstraints(ctx context.Context, cfg *cke.Cluster) error {
+	constraints, err := storage.GetConstraints(ctx)
+	switch err {
+	case cke.ErrNotFound:
+		constraints = cke.DefaultConstraints()
+	case nil:
+	default:
+		return err
+	}
+	return constraints.Check(cfg)
+}
+
+// diffClusters writes human-readable differences between two cluster configurations.
+// It returns false if there is no difference.
+func diffClusters(w io.Writer, current, proposed *cke.Cluster) bool {
+	if current == nil {
+		current = &cke.Cluster{}
+	}
+	changed := false
+
+	currentNodes := make(map[string]*cke.Node)
+	for _, n := range current.Nodes {
+		currentNodes[n.Address] = n
+	}
+	proposedNodes := make(map[string]*cke.Node)
+	for _, n := range proposed.Nodes {
+		proposedNodes[n.Address] = n
+	}
+
+	var added, removed, modified []string
+	for addr, n := range proposedNodes {
+		cn, ok := currentNodes[addr]
+		switch {
+		case !ok:
+			added = append(added, addr)
+		case !cmp.Equal(cn, n):
+			modified = append(modified, addr)
+		}
+	}
+	for addr := range currentNodes {
+		if _, ok := proposedNodes[addr]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+
+	if len(added) > 0 {
+		changed = true
+		fmt.Fprintf(w, "Nodes added: %s\n", strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		changed = true
+		fmt.Fprintf(w, "Nodes removed: %s\n", strings.Join(removed, ", "))
+	}
+	for _, addr := range modified {
+		changed = true
+		fmt.Fprintf(w, "Node %s modified (-current +proposed):\n%s", addr, cmp.Diff(currentNodes[addr], proposedNodes[addr]))
+	}
+
+	// Compare the rest of the cluster settings apart from nodes and options.
+	currentSettings := *current
+	currentSettings.Nodes = nil
+	currentSettings.Options = cke.Options{}
+	proposedSettings := *proposed
+	proposedSettings.Nodes = nil
+	proposedSettings.Options = cke.Options{}
+
+	sections := []struct {
+		name     string
+		current  interface{}
+		proposed interface{}
+	}{
+		{"cluster", currentSettings, proposedSettings},
+		{"etcd", current.Options.Etcd, proposed.Options.Etcd},
+		{"rivers", current.Options.Rivers, proposed.Options.Rivers},
+		{"etcd-rivers", current.Options.EtcdRivers, proposed.Options.EtcdRivers},
+		{"kube-api", current.Options.APIServer, proposed.Options.APIServer},
+		{"kube-controller-manager", current.Options.ControllerManager, proposed.Options.ControllerManager},
+		{"kube-scheduler", current.Options.Scheduler, proposed.Options.Scheduler},
+		{"kube-proxy", current.Options.Proxy, proposed.Options.Proxy},
+		{"kubelet", current.Options.Kubelet, proposed.Options.Kubelet},
+	}
+	for _, s := range sections {
+		diff := cmp.Diff(s.current, s.proposed)
+		if diff == "" {
+			continue
+		}
+		changed = true
+		fmt.Fprintf(w, "Settings of %s modified (-current +proposed):\n%s", s.name, diff)
+	}
+
+	return changed
+}
+
 func init() {
 	rootCmd.AddCommand(clusterCmd)
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var clusterDiffCmd = &cobra.Command{
+	Use:   "diff REV1 REV2",
+	Short: "show differences between two revisions of cluster configuration",
+	Long: `Show differences between two revisions of cluster configuration.
+
+REV1 and REV2 are revision numbers shown by "ckecli cluster history".`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rev1, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		rev2, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			e1, err := storage.GetClusterHistoryEntry(ctx, rev1)
+			if err != nil {
+				return fmt.Errorf("revision %d: %w", rev1, err)
+			}
+			e2, err := storage.GetClusterHistoryEntry(ctx, rev2)
+			if err != nil {
+				return fmt.Errorf("revision %d: %w", rev2, err)
+			}
+
+			if !diffClusters(cmd.OutOrStdout(), e1.Cluster, e2.Cluster) {
+				fmt.Fprintln(cmd.OutOrStdout(), "No changes.")
+			}
+			return nil
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterDiffCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var clusterHistoryOptions struct {
+	Output string
+}
+
+var clusterHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "list the history of cluster configuration",
+	Long: `List the history of cluster configuration.
+
+Each revision of the configuration has its revision number, timestamp,
+author and source.  The source is either "ckecli" or "sabakan".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if clusterHistoryOptions.Output != "json" && clusterHistoryOptions.Output != "simple" {
+			return errors.New("invalid output format")
+		}
+
+		well.Go(func(ctx context.Context) error {
+			entries, err := storage.GetClusterHistory(ctx)
+			if err != nil {
+				return err
+			}
+
+			if clusterHistoryOptions.Output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "    ")
+				return enc.Encode(entries)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 1, 1, ' ', 0)
+			w.Write([]byte("Revision\tTimestamp\tAuthor\tSource\tNodes\n"))
+			for _, e := range entries {
+				nodes := 0
+				if e.Cluster != nil {
+					nodes = len(e.Cluster.Nodes)
+				}
+				w.Write([]byte(fmt.Sprintf("%d\t%s\t%s\t%s\t%d\n", e.Revision, e.Timestamp.Format(time.RFC3339), e.Author, e.Source, nodes)))
+			}
+			return w.Flush()
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	clusterHistoryCmd.Flags().StringVarP(&clusterHistoryOptions.Output, "output", "o", "simple", "Output format [json,simple]")
+	clusterCmd.AddCommand(clusterHistoryCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var clusterRollbackCmd = &cobra.Command{
+	Use:   "rollback REV",
+	Short: "restore a revision of cluster configuration",
+	Long: `Restore a revision of cluster configuration.
+
+REV is a revision number shown by "ckecli cluster history".
+The restored configuration is stored as a new revision.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rev, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			entry, err := storage.GetClusterHistoryEntry(ctx, rev)
+			if err != nil {
+				return fmt.Errorf("revision %d: %w", rev, err)
+			}
+
+			cfg := entry.Cluster
+			err = cfg.Validate(false)
+			if err != nil {
+				return err
+			}
+			err = checkConstraints(ctx, cfg)
+			if err != nil {
+				return err
+			}
+
+			author, err := currentAuthor()
+			if err != nil {
+				return err
+			}
+			return storage.PutCluster(ctx, cfg, author, cke.ClusterSourceCKECLI)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(clusterRollbackCmd)
+}
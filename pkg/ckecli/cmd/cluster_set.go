@@ -2,21 +2,34 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/server"
 	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 	"sigs.k8s.io/yaml"
 )
 
+var clusterSetOptions struct {
+	DryRun bool
+}
+
 // clusterSetCmd represents the "cluster set" command
 var clusterSetCmd = &cobra.Command{
 	Use:   "set FILE",
 	Short: "load cluster configuration",
 	Long: `Load cluster configuration from FILE and store it in etcd.
 
-The file must be either YAML or JSON.`,
+The file must be either YAML or JSON.
+
+With --dry-run, this command does not store the configuration.
+Instead, it shows the differences from the stored configuration,
+the nodes that would be regarded as outdated, and the operations
+that CKE would run next.`,
 
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -36,27 +49,70 @@ The file must be either YAML or JSON.`,
 		}
 
 		well.Go(func(ctx context.Context) error {
-			constraints, err := storage.GetConstraints(ctx)
-			switch err {
-			case cke.ErrNotFound:
-				constraints = cke.DefaultConstraints()
-				fallthrough
-			case nil:
-				err = constraints.Check(cfg)
-				if err != nil {
-					return err
-				}
-			default:
+			err := checkConstraints(ctx, cfg)
+			if err != nil {
 				return err
 			}
 
-			return storage.PutCluster(ctx, cfg)
+			if clusterSetOptions.DryRun {
+				return clusterSetDryRun(ctx, cmd.OutOrStdout(), cfg)
+			}
+
+			author, err := currentAuthor()
+			if err != nil {
+				return err
+			}
+			return storage.PutCluster(ctx, cfg, author, cke.ClusterSourceCKECLI)
 		})
 		well.Stop()
 		return well.Wait()
 	},
 }
 
+func clusterSetDryRun(ctx context.Context, out io.Writer, cfg *cke.Cluster) error {
+	current, err := storage.GetCluster(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+		current = nil
+	default:
+		return err
+	}
+	if current != nil {
+		err = cfg.ValidateTransition(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(out, "# Configuration changes")
+	if !diffClusters(out, current, cfg) {
+		fmt.Fprintln(out, "No changes.")
+	}
+
+	status, err := getClusterStatus(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\n# Outdated nodes")
+	outdated := server.FindOutdatedNodes(cfg, status)
+	if len(outdated) == 0 {
+		fmt.Fprintln(out, "None.")
+	}
+	for _, o := range outdated {
+		fmt.Fprintf(out, "%s: %s\n", o.Predicate, strings.Join(o.Nodes, ", "))
+	}
+
+	result, err := makePlan(ctx, cfg, status)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "\n# Next operations")
+	return printPlan(out, result)
+}
+
 func init() {
+	clusterSetCmd.Flags().BoolVar(&clusterSetOptions.DryRun, "dry-run", false, "show the effects of the change without storing it")
 	clusterCmd.AddCommand(clusterSetCmd)
 }
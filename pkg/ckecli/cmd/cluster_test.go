@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/cke"
+)
+
+func TestDiffClusters(t *testing.T) {
+	current := &cke.Cluster{
+		Name: "test",
+		Nodes: []*cke.Node{
+			{Address: "10.0.0.11", ControlPlane: true},
+			{Address: "10.0.0.12"},
+			{Address: "10.0.0.13"},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if diffClusters(buf, current, current) {
+		t.Errorf("unexpected difference: %s", buf.String())
+	}
+
+	proposed := &cke.Cluster{
+		Name: "test",
+		Nodes: []*cke.Node{
+			{Address: "10.0.0.11", ControlPlane: true},
+			{Address: "10.0.0.12", Labels: map[string]string{"foo": "bar"}},
+			{Address: "10.0.0.14"},
+		},
+	}
+	proposed.Options.APIServer.ExtraArguments = []string{"--v=5"}
+
+	buf.Reset()
+	if !diffClusters(buf, current, proposed) {
+		t.Fatal("difference should be detected")
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"Nodes added: 10.0.0.14\n",
+		"Nodes removed: 10.0.0.13\n",
+		"Node 10.0.0.12 modified",
+		"Settings of kube-api modified",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("output does not contain %q: %s", expected, out)
+		}
+	}
+	for _, unexpected := range []string{
+		"Node 10.0.0.11",
+		"Settings of cluster",
+		"Settings of kubelet",
+	} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("output contains %q: %s", unexpected, out)
+		}
+	}
+
+	buf.Reset()
+	if !diffClusters(buf, nil, proposed) {
+		t.Fatal("difference should be detected for the initial configuration")
+	}
+}
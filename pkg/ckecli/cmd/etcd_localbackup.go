@@ -3,17 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"go.etcd.io/etcd/etcdutl/v3/snapshot"
 )
 
 var config struct {
@@ -21,12 +20,6 @@ var config struct {
 	dir        string
 }
 
-const backupTimeFormat = "20060102-150405"
-
-func backupFilename(t time.Time) string {
-	return fmt.Sprintf("etcd-%s.backup", t.UTC().Format(backupTimeFormat))
-}
-
 var etcdLocalBackupCmd = &cobra.Command{
 	Use:   "local-backup",
 	Short: "take a snapshot of CKE-managed etcd data and save it",
@@ -58,12 +51,6 @@ exceed the maximum specified with --max-backups flag.`,
 }
 
 func backup(ctx context.Context, etcd *clientv3.Client) error {
-	r, err := etcd.Snapshot(ctx)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
 	switch fi, err := os.Stat(config.dir); {
 	case err == nil:
 		if !fi.IsDir() {
@@ -77,30 +64,11 @@ func backup(ctx context.Context, etcd *clientv3.Client) error {
 		return err
 	}
 
-	fname := backupFilename(time.Now())
-	fullName := filepath.Join(config.dir, fname)
-	w, err := os.Create(fullName)
-	if err != nil {
-		return err
-	}
-	defer w.Close()
-
-	if _, err := io.Copy(w, r); err != nil {
-		os.Remove(fullName)
-		return err
-	}
-
-	if err := w.Sync(); err != nil {
-		os.Remove(fullName)
+	fname := cke.EtcdSnapshotName(time.Now())
+	if _, _, err := cke.SaveEtcdSnapshot(ctx, etcd, filepath.Join(config.dir, fname)); err != nil {
 		return err
 	}
 
-	ss := snapshot.NewV3(nil)
-	if _, err := ss.Status(fullName); err != nil {
-		os.Remove(fullName)
-		return fmt.Errorf("failed to check status of the new backup: %w", err)
-	}
-
 	fmt.Printf("created backup %s\n", fname)
 	return nil
 }
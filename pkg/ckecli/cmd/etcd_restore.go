@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var etcdRestoreOptions struct {
+	Node string
+}
+
+var etcdRestoreCmd = &cobra.Command{
+	Use:   "restore SNAPSHOT",
+	Short: "rebuild CKE-managed etcd from a snapshot",
+	Long: `Rebuild CKE-managed etcd cluster from SNAPSHOT.
+
+SNAPSHOT is the name of a snapshot shown by "ckecli etcd snapshot list".
+
+This command requests the leader of CKE to:
+
+1. stop kube-apiserver and etcd, and remove etcd data on all reachable control planes,
+2. restore SNAPSHOT on the node specified with --node as a new etcd cluster, and
+3. add other control planes back to the etcd cluster as new members.
+
+Unless operations are already frozen, this command freezes operations
+other than the restoration, and the freeze is lifted automatically when
+the snapshot is restored.
+
+If --node is not given, the first control plane in the cluster configuration is used.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		author, err := currentAuthor()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			cluster, err := storage.GetCluster(ctx)
+			if err != nil {
+				return err
+			}
+			node := etcdRestoreOptions.Node
+			cps := cke.ControlPlanes(cluster.Nodes)
+			if node == "" && len(cps) > 0 {
+				node = cps[0].Address
+			}
+			found := false
+			for _, n := range cps {
+				if n.Address == node {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s is not a control plane", node)
+			}
+
+			cfg, err := storage.GetEtcdSnapshotConfig(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to get etcd snapshot configuration: %w", err)
+			}
+			store, err := cke.NewEtcdSnapshotStore(cfg)
+			if err != nil {
+				return err
+			}
+			snapshots, err := store.List(ctx)
+			if err != nil {
+				return err
+			}
+			found = false
+			for _, s := range snapshots {
+				if s.Name == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("snapshot %s is not found", name)
+			}
+
+			// Freeze operations unless they are already frozen.
+			var needFreeze bool
+			_, err = storage.GetFreeze(ctx)
+			switch err {
+			case nil:
+			case cke.ErrNotFound:
+				needFreeze = true
+			default:
+				return err
+			}
+
+			now := time.Now().UTC()
+			r := &cke.EtcdRestore{
+				Snapshot:  name,
+				Node:      node,
+				Author:    author,
+				Timestamp: now,
+				Freeze:    needFreeze,
+			}
+			freeze := &cke.Freeze{
+				Reason:    "restoring etcd from " + name,
+				Author:    author,
+				Timestamp: now,
+			}
+			err = storage.PutEtcdRestore(ctx, r, freeze)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("requested to restore %s on %s\n", name, node)
+			return nil
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var etcdRestoreCancelCmd = &cobra.Command{
+	Use:   "restore-cancel",
+	Short: "cancel the etcd restoration",
+	Long: `Cancel the etcd restoration requested by "ckecli etcd restore".
+
+The freeze set by "ckecli etcd restore" is kept.  Run "ckecli freeze off"
+to resume operations.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return storage.CancelEtcdRestore(ctx)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdRestoreCmd.Flags().StringVar(&etcdRestoreOptions.Node, "node", "", "the address of the control plane to restore the snapshot")
+	etcdCmd.AddCommand(etcdRestoreCmd)
+	etcdCmd.AddCommand(etcdRestoreCancelCmd)
+}
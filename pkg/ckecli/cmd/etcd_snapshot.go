@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// etcdSnapshotCmd represents the "etcd snapshot" command
+var etcdSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "snapshot subcommand",
+	Long:  `snapshot subcommand`,
+}
+
+func init() {
+	etcdCmd.AddCommand(etcdSnapshotCmd)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// etcdSnapshotDisableCmd represents the "etcd snapshot disable" command
+var etcdSnapshotDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "stop taking scheduled etcd snapshots",
+	Long: `Remove the configuration of scheduled etcd snapshots.
+
+Snapshots already taken are kept as they are.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return storage.DeleteEtcdSnapshotConfig(ctx)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdSnapshotCmd.AddCommand(etcdSnapshotDisableCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// etcdSnapshotGetCmd represents the "etcd snapshot get" command
+var etcdSnapshotGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "show the configuration of scheduled etcd snapshots",
+	Long:  `Show the configuration of scheduled etcd snapshots stored in etcd.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			cfg, err := storage.GetEtcdSnapshotConfig(ctx)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdSnapshotCmd.AddCommand(etcdSnapshotGetCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// etcdSnapshotListCmd represents the "etcd snapshot list" command
+var etcdSnapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list stored etcd snapshots",
+	Long: `List snapshots taken by the scheduled etcd snapshots in JSON format.
+
+For "file" type, the directory needs to be accessible from this host.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			cfg, err := storage.GetEtcdSnapshotConfig(ctx)
+			if err != nil {
+				return err
+			}
+
+			store, err := cke.NewEtcdSnapshotStore(cfg)
+			if err != nil {
+				return err
+			}
+			snapshots, err := store.List(ctx)
+			if err != nil {
+				return err
+			}
+			if snapshots == nil {
+				snapshots = []*cke.EtcdSnapshotInfo{}
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(snapshots)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdSnapshotCmd.AddCommand(etcdSnapshotListCmd)
+}
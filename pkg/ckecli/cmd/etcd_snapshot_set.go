@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// etcdSnapshotSetCmd represents the "etcd snapshot set" command
+var etcdSnapshotSetCmd = &cobra.Command{
+	Use:   "set FILE|-",
+	Short: "store the configuration of scheduled etcd snapshots",
+	Long: `Load the configuration of scheduled etcd snapshots from a FILE or stdin,
+and stores it in etcd.
+
+The configuration is given by a JSON object having these fields:
+
+    type:              "file" or "s3".
+    directory:         Directory to store snapshots for "file" type.
+    endpoint:          host[:port] of the S3-compatible service.
+    insecure:          Use HTTP instead of HTTPS to connect the endpoint.
+    region:            Region of the bucket.
+    bucket:            Name of the bucket.
+    prefix:            Prefix of the object names.
+    access-key-id:     Access key ID of the bucket.
+    secret-access-key: Secret access key of the bucket.
+    interval-seconds:  Interval between snapshots.  Default is 3600.
+    max-snapshots:     Maximum number of snapshots to keep.  Default is 24.
+    max-age-seconds:   Maximum age of snapshots to keep.  Default is unlimited.
+
+If the argument is "-", the JSON is read from stdin.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := os.Stdin
+		if args[0] != "-" {
+			var err error
+			f, err = os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+
+		cfg := new(cke.EtcdSnapshotConfig)
+		err := json.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return err
+		}
+		err = cfg.Validate()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return storage.PutEtcdSnapshotConfig(ctx, cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	etcdSnapshotCmd.AddCommand(etcdSnapshotSetCmd)
+}
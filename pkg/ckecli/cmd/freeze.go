@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// freezeCmd represents the freeze command
+var freezeCmd = &cobra.Command{
+	Use:   "freeze",
+	Short: "freeze subcommand",
+	Long:  `freeze subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(freezeCmd)
+}
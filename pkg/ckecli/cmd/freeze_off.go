@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var freezeOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "resume operations",
+	Long:  `Lift the freeze and resume operations of CKE.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return storage.DeleteFreeze(ctx)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	freezeCmd.AddCommand(freezeOffCmd)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var freezeOnOptions struct {
+	Reason string
+	Phases []string
+}
+
+var freezeOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "freeze operations",
+	Long: `Freeze operations of CKE.
+
+While operations are frozen, CKE keeps collecting the cluster status
+and updating metrics, but does not run any operation.
+
+If --phase is given, only the operations in the specified phases are
+blocked.  The flag can be specified multiple times.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if freezeOnOptions.Reason == "" {
+			return errors.New("--reason is required")
+		}
+
+		phases := make([]cke.OperationPhase, len(freezeOnOptions.Phases))
+		for i, p := range freezeOnOptions.Phases {
+			phase := cke.OperationPhase(p)
+			if !slices.Contains(cke.AllOperationPhases, phase) {
+				return fmt.Errorf("unknown phase: %s", p)
+			}
+			phases[i] = phase
+		}
+
+		author, err := currentAuthor()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return storage.PutFreeze(ctx, &cke.Freeze{
+				Reason:    freezeOnOptions.Reason,
+				Author:    author,
+				Timestamp: time.Now().UTC(),
+				Phases:    phases,
+			})
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	freezeOnCmd.Flags().StringVar(&freezeOnOptions.Reason, "reason", "", "the reason of the freeze")
+	freezeOnCmd.Flags().StringSliceVar(&freezeOnOptions.Phases, "phase", nil, "phase to be frozen; all phases if not specified")
+	freezeCmd.AddCommand(freezeOnCmd)
+}
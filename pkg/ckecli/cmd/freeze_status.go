@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var freezeStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the freeze",
+	Long: `Show the freeze in JSON format.
+
+If operations are not frozen, this prints "not frozen".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			f, err := storage.GetFreeze(ctx)
+			if err == cke.ErrNotFound {
+				fmt.Println("not frozen")
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(f)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	freezeCmd.AddCommand(freezeStatusCmd)
+}
@@ -3,8 +3,14 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"time"
 
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 )
@@ -12,13 +18,164 @@ import (
 var historyCount int
 var followMode bool
 
+var historyOpts struct {
+	Operation string
+	Target    string
+	Status    string
+	ErrorOnly bool
+	Since     string
+	Until     string
+}
+
+// parseHistoryTime parses RFC3339 time or a duration relative to now.
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s", s)
+	}
+	return now.Add(-d), nil
+}
+
+func makeRecordFilter(now time.Time) (*cke.RecordFilter, error) {
+	filter := &cke.RecordFilter{
+		Operation: historyOpts.Operation,
+		Target:    historyOpts.Target,
+		Status:    cke.RecordStatus(historyOpts.Status),
+		ErrorOnly: historyOpts.ErrorOnly,
+	}
+
+	switch filter.Status {
+	case "", cke.StatusNew, cke.StatusRunning, cke.StatusCancelled, cke.StatusCompleted:
+	default:
+		return nil, errors.New("unknown status: " + historyOpts.Status)
+	}
+
+	var err error
+	filter.Since, err = parseHistoryTime(historyOpts.Since, now)
+	if err != nil {
+		return nil, err
+	}
+	filter.Until, err = parseHistoryTime(historyOpts.Until, now)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// needArchive returns true if records older than those in etcd are
+// requested by --count or --since.  Without them, only etcd is searched
+// so that the whole archive is not read by default.
+func needArchive(filter *cke.RecordFilter, count, found int, records []*cke.Record) bool {
+	if count > 0 {
+		return found < count
+	}
+	if filter.Since.IsZero() {
+		return false
+	}
+	if len(records) == 0 {
+		return true
+	}
+	return !records[len(records)-1].StartAt.Before(filter.Since)
+}
+
+// findRecords returns records matching the filter in decreasing order of ID.
+// If etcd does not have enough records for --count or --since, the archive
+// is also searched.
+func findRecords(ctx context.Context, filter *cke.RecordFilter, count int) ([]*cke.Record, error) {
+	records, err := storage.GetRecords(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*cke.Record
+	for _, r := range records {
+		if !filter.Match(r) {
+			continue
+		}
+		result = append(result, r)
+		if count > 0 && len(result) == count {
+			return result, nil
+		}
+	}
+
+	if !needArchive(filter, count, len(result), records) {
+		return result, nil
+	}
+
+	cfg, err := storage.GetRecordArchiveConfig(ctx)
+	if err == cke.ErrNotFound {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The file archive is spread over the hosts that have been the leader.
+	// Reading a directory on one host would return partial records.
+	if cfg.Type == cke.RecordArchiveFile {
+		log.Warn("the file record archive is not searched; read files in the directory on each host", map[string]interface{}{
+			"directory": cfg.Directory,
+		})
+		return result, nil
+	}
+
+	archive, err := cke.NewRecordArchive(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	oldest := int64(math.MaxInt64)
+	if len(records) > 0 {
+		oldest = records[len(records)-1].ID
+	}
+	need := count - len(result)
+
+	var archived []*cke.Record
+	err = archive.Walk(ctx, func(r *cke.Record) error {
+		if r.ID >= oldest || !filter.Match(r) {
+			return nil
+		}
+		archived = append(archived, r)
+		if count > 0 && len(archived) > need*2 {
+			archived = append(archived[:0], archived[len(archived)-need:]...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the record archive: %w", err)
+	}
+
+	for i := len(archived) - 1; i >= 0; i-- {
+		result = append(result, archived[i])
+		if count > 0 && len(result) == count {
+			break
+		}
+	}
+	return result, nil
+}
+
 // historyCmd represents the history command
 var historyCmd = &cobra.Command{
 	Use:   "history",
-	Short: "show the hostname of the current history process",
-	Long:  `Show the hostname of the current history process.`,
+	Short: "show the history of operations",
+	Long: `Show the history of operations.
+
+Records are shown in decreasing order of ID.  If the record archive
+is configured and etcd does not have enough records for --count or
+--since, archived records are also searched.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := makeRecordFilter(time.Now())
+		if err != nil {
+			return err
+		}
+
 		well.Go(func(ctx context.Context) error {
 			enc := json.NewEncoder(os.Stdout)
 			enc.SetIndent("", "    ")
@@ -30,6 +187,9 @@ var historyCmd = &cobra.Command{
 				}
 
 				for r := range recordCh {
+					if !filter.Match(r) {
+						continue
+					}
 					err := enc.Encode(r)
 					if err != nil {
 						return err
@@ -38,7 +198,7 @@ var historyCmd = &cobra.Command{
 				return nil
 			}
 
-			records, err := storage.GetRecords(ctx, int64(historyCount))
+			records, err := findRecords(ctx, filter, historyCount)
 			if err != nil {
 				return err
 			}
@@ -59,5 +219,11 @@ var historyCmd = &cobra.Command{
 func init() {
 	historyCmd.Flags().IntVarP(&historyCount, "count", "n", 0, "limit the number of operations to show")
 	historyCmd.Flags().BoolVarP(&followMode, "follow", "f", false, "show operations continuously")
+	historyCmd.Flags().StringVar(&historyOpts.Operation, "operation", "", "show only operations of this name")
+	historyCmd.Flags().StringVar(&historyOpts.Target, "target", "", "show only operations targeting this node")
+	historyCmd.Flags().StringVar(&historyOpts.Status, "status", "", "show only operations of this status")
+	historyCmd.Flags().BoolVar(&historyOpts.ErrorOnly, "error-only", false, "show only failed operations")
+	historyCmd.Flags().StringVar(&historyOpts.Since, "since", "", "show operations started at or after this time (RFC3339 or duration like 24h)")
+	historyCmd.Flags().StringVar(&historyOpts.Until, "until", "", "show operations started before this time (RFC3339 or duration like 1h)")
 	rootCmd.AddCommand(historyCmd)
 }
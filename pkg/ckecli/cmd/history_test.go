@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/cke"
+)
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "", want: time.Time{}},
+		{input: "2024-04-30T00:00:00Z", want: time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)},
+		{input: "24h", want: now.Add(-24 * time.Hour)},
+		{input: "90m", want: now.Add(-90 * time.Minute)},
+		{input: "yesterday", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := parseHistoryTime(tc.input, now)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%q: error is expected", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestNeedArchive(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []*cke.Record{
+		{ID: 11, StartAt: now.Add(-time.Hour)},
+		{ID: 10, StartAt: now.Add(-2 * time.Hour)},
+	}
+
+	testCases := []struct {
+		name    string
+		filter  cke.RecordFilter
+		count   int
+		found   int
+		records []*cke.Record
+		want    bool
+	}{
+		{name: "default", records: records, found: 2, want: false},
+		{name: "enough records", count: 2, found: 2, records: records, want: false},
+		{name: "not enough records", count: 3, found: 2, records: records, want: true},
+		{name: "since in etcd", filter: cke.RecordFilter{Since: now.Add(-90 * time.Minute)}, records: records, want: false},
+		{name: "since before etcd", filter: cke.RecordFilter{Since: now.Add(-3 * time.Hour)}, records: records, want: true},
+		{name: "since with empty etcd", filter: cke.RecordFilter{Since: now.Add(-3 * time.Hour)}, want: true},
+	}
+
+	for _, tc := range testCases {
+		got := needArchive(&tc.filter, tc.count, tc.found, tc.records)
+		if got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
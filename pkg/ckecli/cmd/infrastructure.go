@@ -142,3 +142,22 @@ func (i *cliInfrastructure) Engine(addr string) cke.ContainerEngine {
 func (i *cliInfrastructure) ReleaseAgent(addr string) {
 	panic("not implemented")
 }
+
+// newServerInfrastructure returns cke.Infrastructure that can access nodes
+// in the same way as the CKE server.  The returned Infrastructure needs
+// to be closed by the caller.
+func newServerInfrastructure(ctx context.Context, cluster *cke.Cluster) (cke.Infrastructure, error) {
+	resp, err := etcdClient.Get(ctx, cke.KeyVault)
+	if err != nil {
+		return nil, err
+	}
+	// Vault is not needed if the local CA backend is configured.
+	if len(resp.Kvs) == 1 {
+		err = cke.ConnectVault(ctx, resp.Kvs[0].Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cke.NewInfrastructure(ctx, cluster, storage)
+}
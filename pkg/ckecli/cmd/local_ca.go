@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// localCACmd represents the local-ca command
+var localCACmd = &cobra.Command{
+	Use:   "local-ca",
+	Short: "local-ca subcommand",
+	Long:  `local-ca subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(localCACmd)
+}
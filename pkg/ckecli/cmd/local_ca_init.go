@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+func createLocalKeyFile(keyFile string) error {
+	_, err := os.Stat(keyFile)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	key, err := cke.GenerateLocalCAKey()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(key + "\n")
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("generated a new key in %s\n", keyFile)
+	return nil
+}
+
+func createLocalCA(ctx context.Context, cfg *cke.LocalCAConfig, ca caParams) error {
+	_, err := storage.GetLocalCA(ctx, ca.key)
+	switch err {
+	case nil:
+		return nil
+	case cke.ErrNotFound:
+	default:
+		return err
+	}
+
+	_, err = storage.GetCACertificate(ctx, ca.key)
+	switch err {
+	case nil:
+		return errors.New("CA " + ca.key + " already exists outside of the local CA backend")
+	case cke.ErrNotFound:
+	default:
+		return err
+	}
+
+	cert, err := cke.CreateLocalCA(ctx, storage, cfg, ca.key, ca.commonName, ttl100Year)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("issued root certificate for %s\n", ca.key)
+	return storage.PutCACertificate(ctx, ca.key, cert)
+}
+
+func createLocalEncryptionKey(ctx context.Context, cfg *cke.LocalCAConfig) error {
+	enckeys, err := cke.ReadLocalSecret(ctx, storage, cfg, cke.K8sSecret)
+	if err != nil {
+		return err
+	}
+	if enckeys != nil {
+		return nil
+	}
+
+	enckeys = make(map[string]interface{})
+	err = rotateK8sEncryptionKey(enckeys)
+	if err != nil {
+		return err
+	}
+	return cke.WriteLocalSecret(ctx, storage, cfg, cke.K8sSecret, enckeys)
+}
+
+// localCAInitCmd represents the "local-ca init" command
+var localCAInitCmd = &cobra.Command{
+	Use:   "init KEY_FILE",
+	Short: "configure the local CA backend",
+	Long: `Configure the local CA backend to issue certificates without Vault PKI.
+
+KEY_FILE is the absolute path of the file that holds the key to encrypt
+the private keys of CAs.  If KEY_FILE does not exist, a new key is generated.
+The same file must be placed at the same path on every host running CKE.
+
+This command creates CAs whose private keys are encrypted and stored
+in etcd, and then configures CKE to sign certificates by itself.
+It fails if the CAs have already been created in Vault PKI.
+
+This command also generates the encryption key for Kubernetes Secrets.
+SSH private keys and encryption keys are then stored in etcd encrypted
+with the same key, so CKE runs without Vault unless the "kms" encryption
+provider, which is backed by Vault transit engine, is used.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := &cke.LocalCAConfig{KeyFile: args[0]}
+		err := cfg.Validate()
+		if err != nil {
+			return err
+		}
+		err = createLocalKeyFile(cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			for _, ca := range cas {
+				err := createLocalCA(ctx, cfg, ca)
+				if err != nil {
+					return err
+				}
+			}
+			err := createLocalEncryptionKey(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			return storage.PutLocalCAConfig(ctx, cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	localCACmd.AddCommand(localCAInitCmd)
+}
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// notificationCmd represents the notification command
+var notificationCmd = &cobra.Command{
+	Use:   "notification",
+	Short: "notification subcommand",
+	Long:  `notification subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(notificationCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// notificationGetCmd represents the "notification get" command
+var notificationGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "show the notification configuration",
+	Long:  `Show the notification configuration stored in etcd.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			cfg, err := storage.GetNotificationConfig(ctx)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	notificationCmd.AddCommand(notificationGetCmd)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// notificationSetCmd represents the "notification set" command
+var notificationSetCmd = &cobra.Command{
+	Use:   "set FILE|-",
+	Short: "store the notification configuration",
+	Long: `Load the notification configuration from a FILE or stdin,
+and stores it in etcd.
+
+The configuration is given by a JSON object having "sinks" field.
+Each sink has these fields:
+
+    name:   Name of the sink.
+    type:   "webhook" or "slack".
+    url:    URL to which notifications are POSTed.
+    events: Events sent to the sink.  If empty, all events are sent.
+
+If the argument is "-", the JSON is read from stdin.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := os.Stdin
+		if args[0] != "-" {
+			var err error
+			f, err = os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+
+		cfg := new(cke.NotificationConfig)
+		err := json.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return err
+		}
+		err = cfg.Validate()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return storage.PutNotificationConfig(ctx, cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	notificationCmd.AddCommand(notificationSetCmd)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/server"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var planOptions struct {
+	Output               string
+	MaxConcurrentUpdates int
+}
+
+type plannedOperation struct {
+	Name    string   `json:"name"`
+	Targets []string `json:"targets"`
+}
+
+type planResult struct {
+	Phase      cke.OperationPhase `json:"phase"`
+	Operations []plannedOperation `json:"operations"`
+}
+
+// getClusterStatus gathers the status of nodes in cluster in the same way as the CKE server.
+func getClusterStatus(ctx context.Context, cluster *cke.Cluster) (*cke.ClusterStatus, error) {
+	clusterInf, err := newServerInfrastructure(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer clusterInf.Close()
+
+	return server.GetClusterStatus(ctx, cluster, clusterInf)
+}
+
+func makePlan(ctx context.Context, cluster *cke.Cluster, status *cke.ClusterStatus) (*planResult, error) {
+	// The server does not run operations without constraints.
+	constraints, err := storage.GetConstraints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rcs, err := storage.GetAllResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &server.Config{
+		MaxConcurrentUpdates: planOptions.MaxConcurrentUpdates,
+	}
+	ops, phase := server.DecideOps(cluster, status, constraints, rcs, config)
+
+	result := &planResult{
+		Phase:      phase,
+		Operations: make([]plannedOperation, len(ops)),
+	}
+	for i, op := range ops {
+		result.Operations[i] = plannedOperation{
+			Name:    op.Name(),
+			Targets: op.Targets(),
+		}
+	}
+	return result, nil
+}
+
+func printPlan(out io.Writer, result *planResult) error {
+	fmt.Fprintf(out, "Phase: %s\n", result.Phase)
+	w := tabwriter.NewWriter(out, 0, 1, 1, ' ', 0)
+	w.Write([]byte("Operation\tTargets\n"))
+	for _, op := range result.Operations {
+		w.Write([]byte(fmt.Sprintf("%s\t%s\n", op.Name, strings.Join(op.Targets, ","))))
+	}
+	return w.Flush()
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "show the operations that CKE would run next",
+	Long: `Show the operations that CKE would run next.
+
+This command gathers the current cluster status in the same way as
+the CKE server and decides operations for the stored cluster
+configuration.  No operation is actually executed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if planOptions.Output != "json" && planOptions.Output != "simple" {
+			return errors.New("invalid output format")
+		}
+
+		well.Go(func(ctx context.Context) error {
+			cluster, err := storage.GetCluster(ctx)
+			if err != nil {
+				return err
+			}
+			err = cluster.Validate(false)
+			if err != nil {
+				return err
+			}
+
+			status, err := getClusterStatus(ctx, cluster)
+			if err != nil {
+				return err
+			}
+
+			result, err := makePlan(ctx, cluster, status)
+			if err != nil {
+				return err
+			}
+
+			if planOptions.Output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "    ")
+				return enc.Encode(result)
+			}
+			return printPlan(cmd.OutOrStdout(), result)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&planOptions.Output, "output", "o", "json", "Output format [json,simple]")
+	planCmd.Flags().IntVar(&planOptions.MaxConcurrentUpdates, "max-concurrent-updates", 10, "the value of --max-concurrent-updates given to the CKE server")
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// recordArchiveCmd represents the record-archive command
+var recordArchiveCmd = &cobra.Command{
+	Use:   "record-archive",
+	Short: "record-archive subcommand",
+	Long:  `record-archive subcommand`,
+}
+
+func init() {
+	rootCmd.AddCommand(recordArchiveCmd)
+}
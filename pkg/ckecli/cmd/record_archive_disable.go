@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// recordArchiveDisableCmd represents the "record-archive disable" command
+var recordArchiveDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "stop archiving records",
+	Long: `Remove the record archive configuration.
+
+Records already archived are kept as they are.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return storage.DeleteRecordArchiveConfig(ctx)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	recordArchiveCmd.AddCommand(recordArchiveDisableCmd)
+}
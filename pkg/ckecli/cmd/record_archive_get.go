@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// recordArchiveGetCmd represents the "record-archive get" command
+var recordArchiveGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "show the record archive configuration",
+	Long:  `Show the record archive configuration stored in etcd.`,
+
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			cfg, err := storage.GetRecordArchiveConfig(ctx)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	recordArchiveCmd.AddCommand(recordArchiveGetCmd)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+// recordArchiveSetCmd represents the "record-archive set" command
+var recordArchiveSetCmd = &cobra.Command{
+	Use:   "set FILE|-",
+	Short: "store the record archive configuration",
+	Long: `Load the record archive configuration from a FILE or stdin,
+and stores it in etcd.
+
+The configuration is given by a JSON object having these fields:
+
+    type:              "file" or "s3".
+    directory:         Directory to store JSONL files for "file" type.
+    max-file-size:     Size in bytes to rotate JSONL files.
+    endpoint:          host[:port] of the S3-compatible service.
+    insecure:          Use HTTP instead of HTTPS to connect the endpoint.
+    region:            Region of the bucket.
+    bucket:            Name of the bucket.
+    prefix:            Prefix of the object names.
+    access-key-id:     Access key ID of the bucket.
+    secret-access-key: Secret access key of the bucket.
+
+If the argument is "-", the JSON is read from stdin.`,
+
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := os.Stdin
+		if args[0] != "-" {
+			var err error
+			f, err = os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+
+		cfg := new(cke.RecordArchiveConfig)
+		err := json.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return err
+		}
+		err = cfg.Validate()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return storage.PutRecordArchiveConfig(ctx, cfg)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	recordArchiveCmd.AddCommand(recordArchiveSetCmd)
+}
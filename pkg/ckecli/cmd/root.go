@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"os"
+	"os/user"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/etcdutil"
@@ -34,6 +35,19 @@ func loadConfig(p string) (*etcdutil.Config, error) {
 	return cfg, nil
 }
 
+// currentAuthor returns the author of changes made by ckecli.
+func currentAuthor() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return u.Username + "@" + hostname, nil
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ckecli",
@@ -46,7 +46,7 @@ func scpSubMain(ctx context.Context, args []string) error {
 		return err
 	}
 
-	pirvateKey, err := getPrivateKey(node)
+	pirvateKey, err := getPrivateKey(ctx, node)
 	if err != nil {
 		log.Error("failed to get the private key for scp", map[string]interface{}{
 			log.FnError: err,
@@ -53,21 +53,15 @@ func createFifo() (string, error) {
 	return fifoFilePath, err
 }
 
-func getPrivateKey(nodeName string) (string, error) {
-	vc, err := inf.Vault()
+func getPrivateKey(ctx context.Context, nodeName string) (string, error) {
+	privKeys, err := cke.ReadSecret(ctx, inf, cke.SSHSecret)
 	if err != nil {
 		return "", err
 	}
-
-	secret, err := vc.Logical().Read(cke.SSHSecret)
-	if err != nil {
-		return "", err
-	}
-	if secret == nil {
+	if privKeys == nil {
 		return "", errors.New("no ssh private keys")
 	}
 
-	privKeys := secret.Data
 	mykey, ok := privKeys[nodeName]
 	if !ok {
 		mykey = privKeys[""]
@@ -169,7 +163,7 @@ func sshSubMain(ctx context.Context, args []string) error {
 	defer os.Remove(pipeFilename)
 
 	node := detectSSHNode(args[0])
-	pirvateKey, err := getPrivateKey(node)
+	pirvateKey, err := getPrivateKey(ctx, node)
 	if err != nil {
 		log.Error("failed to get the private key for ssh", map[string]interface{}{
 			log.FnError: err,
@@ -1,13 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
 	vault "github.com/hashicorp/vault/api"
 	"github.com/spf13/cobra"
 	apiserverv1 "k8s.io/apiserver/pkg/apis/apiserver/v1"
@@ -18,47 +22,164 @@ var vaultEncKeyCmd = &cobra.Command{
 	Short: "generate new encryption key for Kubernetes Secrets",
 	Long: `Generate or rotate encryption keys for Kubernetes Secrets.
 
-WARNING: Key rotation is not fully implemented in this version!!
-
 This command generates new encryption keys for Kubernetes Secrets and
 rotate old keys.  The current key, if any, is retained to decrypt
-existing data.  Other old keys are removed.`,
+existing data.  Other old keys are removed.
+
+WARNING: This command does not re-encrypt existing Secrets.
+Use "ckecli vault enckey rotate" to rotate the key safely.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vc, err := inf.Vault()
-		if err != nil {
-			return err
-		}
-		err = rotateK8sEncryptionKey(vc)
+		well.Go(func(ctx context.Context) error {
+			enckeys, err := cke.ReadSecret(ctx, inf, cke.K8sSecret)
+			if err != nil {
+				return err
+			}
+			if enckeys == nil {
+				enckeys = make(map[string]interface{})
+			}
+			err = rotateK8sEncryptionKey(enckeys)
+			if err != nil {
+				return err
+			}
+			err = cke.WriteSecret(ctx, inf, cke.K8sSecret, enckeys)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("succeeded")
+			return nil
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var vaultEncKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "rotate the encryption key for Kubernetes Secrets",
+	Long: `Rotate the encryption key for Kubernetes Secrets.
+
+For aescbc provider, this command adds a new key to Vault, or to etcd
+if the local CA backend is configured.
+For kms provider, this command rotates the transit key in Vault.
+
+Then, the leader of CKE will:
+
+1. restart API servers to use the new key to encrypt data,
+2. rewrite all Secrets to encrypt them with the new key, and
+3. retire the old keys.
+
+Only one rotation can be in progress at a time.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		author, err := currentAuthor()
 		if err != nil {
 			return err
 		}
 
-		fmt.Println("succeeded")
-		return nil
+		well.Go(func(ctx context.Context) error {
+			cluster, err := storage.GetCluster(ctx)
+			if err != nil {
+				return err
+			}
+
+			_, err = storage.GetEncryptionKeyRotation(ctx)
+			switch err {
+			case nil:
+				return errors.New("encryption key rotation is in progress")
+			case cke.ErrNotFound:
+			default:
+				return err
+			}
+
+			r := &cke.EncryptionKeyRotation{
+				Provider:  cluster.Options.APIServer.Encryption.ProviderName(),
+				Phase:     cke.EncryptionKeyAdded,
+				Author:    author,
+				Timestamp: time.Now().UTC(),
+			}
+			switch r.Provider {
+			case cke.EncryptionProviderAESCBC:
+				r.KeyName, err = addK8sEncryptionKey(ctx)
+			case cke.EncryptionProviderKMS:
+				// The transit key exists only in Vault.
+				var vc *vault.Client
+				vc, err = inf.Vault()
+				if err == nil {
+					_, err = vc.Logical().Write(path.Join(cke.VaultTransit, "keys", cke.VaultTransitKey, "rotate"), nil)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			err = storage.PutEncryptionKeyRotation(ctx, r)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("requested to rotate %s encryption key\n", r.Provider)
+			return nil
+		})
+		well.Stop()
+		return well.Wait()
 	},
 }
 
 func init() {
+	vaultEncKeyCmd.AddCommand(vaultEncKeyRotateCmd)
 	vaultCmd.AddCommand(vaultEncKeyCmd)
 }
 
-func rotateK8sEncryptionKey(vc *vault.Client) error {
-	secret, err := vc.Logical().Read(cke.K8sSecret)
+// addK8sEncryptionKey adds a new aescbc key as the last key.
+// The new key is not used to encrypt data until it is promoted.
+func addK8sEncryptionKey(ctx context.Context) (string, error) {
+	enckeys, err := cke.ReadSecret(ctx, inf, cke.K8sSecret)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if enckeys == nil {
+		return "", errors.New("no encryption secrets for API server; run ckecli vault init or ckecli local-ca init")
+	}
+	data, ok := enckeys["aescbc"]
+	if !ok {
+		return "", errors.New("no aescbc keys")
 	}
 
-	var enckeys map[string]interface{}
-	if secret != nil && secret.Data != nil {
-		enckeys = secret.Data
-	} else {
-		enckeys = make(map[string]interface{})
+	var cfg apiserverv1.AESConfiguration
+	err = json.Unmarshal([]byte(data.(string)), &cfg)
+	if err != nil {
+		return "", err
 	}
 
+	newKey, err := generateKey()
+	if err != nil {
+		return "", err
+	}
+	name := time.Now().UTC().Format(time.RFC3339)
+	cfg.Keys = append(cfg.Keys, apiserverv1.Key{
+		Name:   name,
+		Secret: base64.StdEncoding.EncodeToString(newKey),
+	})
+	cfgData, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	enckeys["aescbc"] = string(cfgData)
+
+	err = cke.WriteSecret(ctx, inf, cke.K8sSecret, enckeys)
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// rotateK8sEncryptionKey generates a new aescbc key in enckeys.
+// The current key, if any, is retained to decrypt existing data.
+func rotateK8sEncryptionKey(enckeys map[string]interface{}) error {
 	var cfg apiserverv1.AESConfiguration
 	if data, ok := enckeys["aescbc"]; ok {
-		err = json.Unmarshal([]byte(data.(string)), &cfg)
+		err := json.Unmarshal([]byte(data.(string)), &cfg)
 		if err != nil {
 			return err
 		}
@@ -83,9 +204,7 @@ func rotateK8sEncryptionKey(vc *vault.Client) error {
 		return err
 	}
 	enckeys["aescbc"] = string(cfgData)
-
-	_, err = vc.Logical().Write(cke.K8sSecret, enckeys)
-	return err
+	return nil
 }
 
 // generateKey generates key for aescbc
@@ -56,6 +56,27 @@ var (
 path "cke/*"
 {
   capabilities = ["create", "read", "update", "delete", "list", "sudo"]
+}
+
+path "auth/approle/role/cke-kms/secret-id"
+{
+  capabilities = ["update"]
+}`
+
+	kmsPolicy = `
+path "cke/transit/encrypt/k8s"
+{
+  capabilities = ["update"]
+}
+
+path "cke/transit/decrypt/k8s"
+{
+  capabilities = ["update"]
+}
+
+path "cke/transit/keys/k8s"
+{
+  capabilities = ["read"]
 }`
 )
 
@@ -139,11 +160,26 @@ func initVault(ctx context.Context) error {
 		return err
 	}
 
+	err = createTransit(ctx, vc)
+	if err != nil {
+		return err
+	}
+
 	err = vc.Sys().PutPolicy("cke", ckePolicy)
 	if err != nil {
 		return err
 	}
 
+	err = vc.Sys().PutPolicy("cke-kms", kmsPolicy)
+	if err != nil {
+		return err
+	}
+
+	err = createKMSAppRole(ctx, vc)
+	if err != nil {
+		return err
+	}
+
 	cfg, err := storage.GetVaultConfig(ctx)
 	switch err {
 	case nil:
@@ -207,7 +243,13 @@ func initVault(ctx context.Context) error {
 		return nil
 	}
 
-	return rotateK8sEncryptionKey(vc2)
+	enckeys := make(map[string]interface{})
+	err = rotateK8sEncryptionKey(enckeys)
+	if err != nil {
+		return err
+	}
+	_, err = vc2.Logical().Write(cke.K8sSecret, enckeys)
+	return err
 }
 
 func createPKI(ctx context.Context, vc *vault.Client, ca caParams) error {
@@ -291,6 +333,75 @@ func createKV(ctx context.Context, vc *vault.Client) error {
 	return nil
 }
 
+func createTransit(ctx context.Context, vc *vault.Client) error {
+	mounts, err := vc.Sys().ListMounts()
+	if err != nil {
+		return err
+	}
+	_, ok1 := mounts[cke.VaultTransit]
+	_, ok2 := mounts[cke.VaultTransit+"/"]
+	if !ok1 && !ok2 {
+		err = vc.Sys().Mount(cke.VaultTransit, &vault.MountInput{Type: "transit"})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("mounted transit on %s\n", cke.VaultTransit)
+	}
+
+	keyPath := path.Join(cke.VaultTransit, "keys", cke.VaultTransitKey)
+	secret, err := vc.Logical().Read(keyPath)
+	if err != nil {
+		return err
+	}
+	if secret != nil {
+		return nil
+	}
+
+	_, err = vc.Logical().Write(keyPath, map[string]interface{}{
+		"type": "aes256-gcm96",
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created transit key %s\n", keyPath)
+	return nil
+}
+
+func createKMSAppRole(ctx context.Context, vc *vault.Client) error {
+	secret, err := vc.Logical().Read(cke.KMSSecret)
+	if err != nil {
+		return err
+	}
+	if secret != nil && secret.Data != nil {
+		return nil
+	}
+
+	_, err = vc.Logical().Write("auth/approle/role/"+cke.KMSAppRole, map[string]interface{}{
+		"policies": "cke-kms",
+		"period":   "1h",
+	})
+	if err != nil {
+		return err
+	}
+	secret, err = vc.Logical().Read("auth/approle/role/" + cke.KMSAppRole + "/role-id")
+	if err != nil {
+		return err
+	}
+	roleID := secret.Data["role_id"].(string)
+
+	// CKE issues secret_id for each node when it starts the KMS plugin.
+	_, err = vc.Logical().Write(cke.KMSSecret, map[string]interface{}{
+		"role-id": roleID,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("created AppRole for the KMS plugin")
+	return nil
+}
+
 var vaultInitCfg struct {
 	caCertFile string
 	endpoint   string
@@ -309,6 +420,8 @@ Vault will be configured to:
       PKI secrets under cke/.
     * creates AppRole for CKE.
     * have initial encryption key for Kubernetes Secrets.
+    * have "k8s" transit key under cke/transit and "cke-kms" policy
+      and AppRole for the KMS plugin of kube-apiserver.
 
 This command will ask username and password for Vault authentication
 when VAULT_TOKEN environment variable is not set.`,
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"io"
 	"os"
 
 	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +20,9 @@ var vaultSSHPrivKeyCmd = &cobra.Command{
 
 If --host is not specified, the key will be used as the default key.
 
+If the local CA backend is configured by "ckecli local-ca init",
+the key is stored in etcd encrypted with the local CA key instead.
+
 FILE should be a SSH private key file.
 If FILE is -, the contents are read from stdin.`,
 
@@ -38,26 +43,20 @@ If FILE is -, the contents are read from stdin.`,
 			return err
 		}
 
-		vc, err := inf.Vault()
-		if err != nil {
-			return err
-		}
-
-		secret, err := vc.Logical().Read(cke.SSHSecret)
-		if err != nil {
-			return err
-		}
-
-		var privkeys map[string]interface{}
-		if secret != nil && secret.Data != nil {
-			privkeys = secret.Data
-		} else {
-			privkeys = make(map[string]interface{})
-		}
-		privkeys[vaultSSHPrivKeyHost] = string(data)
+		well.Go(func(ctx context.Context) error {
+			privkeys, err := cke.ReadSecret(ctx, inf, cke.SSHSecret)
+			if err != nil {
+				return err
+			}
+			if privkeys == nil {
+				privkeys = make(map[string]interface{})
+			}
+			privkeys[vaultSSHPrivKeyHost] = string(data)
 
-		_, err = vc.Logical().Write(cke.SSHSecret, privkeys)
-		return err
+			return cke.WriteSecret(ctx, inf, cke.SSHSecret, privkeys)
+		})
+		well.Stop()
+		return well.Wait()
 	},
 }
 
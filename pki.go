@@ -2,10 +2,13 @@ package cke
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/netutil"
@@ -15,6 +18,26 @@ import (
 // CNAPIServer is the common name of API server for aggregation
 const CNAPIServer = "front-proxy-client"
 
+// CNAuditWebhook is the common name of API server for the audit webhook backend
+const CNAuditWebhook = "kube-apiserver-audit"
+
+// AuditWebhookCertTTL is the lifetime of the client certificate for the audit webhook backend.
+// CKE renews the certificate when less than one third of the lifetime remains.
+const AuditWebhookCertTTL = 30 * 24 * time.Hour
+
+var auditWebhookCertRenewalThreshold = 2.0 / 3
+
+// AuditWebhookCertRenewal is the renewal rule for the client certificate for the
+// audit webhook backend.  This is applied regardless of the cert_renewal configuration.
+var AuditWebhookCertRenewal = CertRenewal{
+	Enabled:   true,
+	Threshold: &auditWebhookCertRenewalThreshold,
+}
+
+// CertificateBackdate is subtracted from NotBefore of certificates to tolerate clock skew.
+// This is the default of not_before_duration of Vault PKI roles.
+const CertificateBackdate = 30 * time.Second
+
 // CA keys for etcd storage.
 const (
 	CAServer                = "server"
@@ -49,6 +72,7 @@ const (
 	RoleKubelet               = "kubelet"
 	RoleKubeProxy             = "kube-proxy"
 	RoleServiceAccount        = "service-account"
+	RoleAuditWebhook          = "audit-webhook"
 )
 
 // AdminGroup is the group name of cluster admin users
@@ -116,7 +140,7 @@ func (e EtcdCA) IssueServerCert(ctx context.Context, inf Infrastructure, node *N
 		"cke-etcd.kube-system",
 		"cke-etcd.kube-system.svc",
 	}
-	return issueCertificate(inf, CAServer, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAServer, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -132,7 +156,7 @@ func (e EtcdCA) IssueServerCert(ctx context.Context, inf Infrastructure, node *N
 
 // IssuePeerCert issues TLS certificates for mutual peer authentication.
 func (e EtcdCA) IssuePeerCert(ctx context.Context, inf Infrastructure, node *Node) (crt, key string, err error) {
-	return issueCertificate(inf, CAEtcdPeer, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAEtcdPeer, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -147,7 +171,7 @@ func (e EtcdCA) IssuePeerCert(ctx context.Context, inf Infrastructure, node *Nod
 
 // IssueForAPIServer issues TLC client certificate for Kubernetes.
 func (e EtcdCA) IssueForAPIServer(ctx context.Context, inf Infrastructure, node *Node) (crt, key string, err error) {
-	return issueCertificate(inf, CAEtcdClient, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAEtcdClient, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -162,7 +186,7 @@ func (e EtcdCA) IssueForAPIServer(ctx context.Context, inf Infrastructure, node
 
 // IssueRoot issues certificate for root user.
 func (e EtcdCA) IssueRoot(ctx context.Context, inf Infrastructure) (cert, key string, err error) {
-	return issueCertificate(inf, CAEtcdClient, RoleAdmin, false,
+	return issueCertificate(ctx, inf, CAEtcdClient, RoleAdmin, false,
 		map[string]interface{}{
 			"ttl":            "2h",
 			"max_ttl":        "24h",
@@ -177,8 +201,8 @@ func (e EtcdCA) IssueRoot(ctx context.Context, inf Infrastructure) (cert, key st
 }
 
 // IssueEtcdClientCertificate issues TLS client certificate for a user.
-func IssueEtcdClientCertificate(inf Infrastructure, username, ttl string) (cert, key string, err error) {
-	return issueCertificate(inf, CAEtcdClient, RoleSystem, false,
+func IssueEtcdClientCertificate(ctx context.Context, inf Infrastructure, username, ttl string) (cert, key string, err error) {
+	return issueCertificate(ctx, inf, CAEtcdClient, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -197,7 +221,7 @@ type KubernetesCA struct{}
 
 // IssueUserCert issues client certificate for user.
 func (k KubernetesCA) IssueUserCert(ctx context.Context, inf Infrastructure, userName, groupName string, ttl string) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleAdmin, true,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleAdmin, true,
 		map[string]interface{}{
 			"ttl":               "2h",
 			"max_ttl":           "48h",
@@ -227,7 +251,7 @@ func (k KubernetesCA) IssueForAPIServer(ctx context.Context, inf Infrastructure,
 	}
 	kubeSvcAddr := netutil.IPAdd(ip, 1)
 
-	return issueCertificate(inf, CAKubernetes, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -244,7 +268,7 @@ func (k KubernetesCA) IssueForAPIServer(ctx context.Context, inf Infrastructure,
 
 // IssueForScheduler issues TLS certificate for kube-scheduler.
 func (k KubernetesCA) IssueForScheduler(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleKubeScheduler, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubeScheduler, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -260,7 +284,7 @@ func (k KubernetesCA) IssueForScheduler(ctx context.Context, inf Infrastructure)
 
 // IssueForControllerManager issues TLS certificate for kube-controller-manager.
 func (k KubernetesCA) IssueForControllerManager(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleKubeControllerManager, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubeControllerManager, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -282,7 +306,7 @@ func (k KubernetesCA) IssueForKubelet(ctx context.Context, inf Infrastructure, n
 		altNames = "localhost," + nodename
 	}
 
-	return issueCertificate(inf, CAKubernetes, RoleKubelet, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubelet, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -300,7 +324,7 @@ func (k KubernetesCA) IssueForKubelet(ctx context.Context, inf Infrastructure, n
 
 // IssueForProxy issues TLS certificate for kube-proxy.
 func (k KubernetesCA) IssueForProxy(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleKubeProxy, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleKubeProxy, false,
 		map[string]interface{}{
 			"ttl":               "87600h",
 			"max_ttl":           "87600h",
@@ -316,7 +340,7 @@ func (k KubernetesCA) IssueForProxy(ctx context.Context, inf Infrastructure) (cr
 
 // IssueForServiceAccount issues TLS certificate to sign service account tokens.
 func (k KubernetesCA) IssueForServiceAccount(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
-	return issueCertificate(inf, CAKubernetes, RoleServiceAccount, false,
+	return issueCertificate(ctx, inf, CAKubernetes, RoleServiceAccount, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -332,12 +356,30 @@ func (k KubernetesCA) IssueForServiceAccount(ctx context.Context, inf Infrastruc
 		})
 }
 
+// IssueForAuditWebhook issues TLS client certificate for API servers to send
+// audit events to the audit webhook backend.
+func (k KubernetesCA) IssueForAuditWebhook(ctx context.Context, inf Infrastructure) (crt, key string, err error) {
+	ttl := AuditWebhookCertTTL.String()
+	return issueCertificate(ctx, inf, CAKubernetes, RoleAuditWebhook, false,
+		map[string]interface{}{
+			"ttl":               ttl,
+			"max_ttl":           ttl,
+			"enforce_hostnames": "false",
+			"allow_any_name":    "true",
+			"server_flag":       "false",
+		},
+		map[string]interface{}{
+			"common_name":          CNAuditWebhook,
+			"exclude_cn_from_sans": "true",
+		})
+}
+
 // AggregationCA is a certificate authority for kubernetes aggregation API server
 type AggregationCA struct{}
 
 // IssueClientCertificate issues TLS client certificate for API server
 func (a AggregationCA) IssueClientCertificate(ctx context.Context, inf Infrastructure) (cert, key string, err error) {
-	return issueCertificate(inf, CAKubernetesAggregation, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAKubernetesAggregation, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":            "87600h",
 			"max_ttl":        "87600h",
@@ -357,7 +399,7 @@ type WebhookCA struct{}
 // `namespace` and `name` specifies the namespace/name of a webhook Service.
 func (WebhookCA) IssueCertificate(ctx context.Context, inf Infrastructure, namespace, name string) (cert, key string, err error) {
 	altNames := []string{name, name + "." + namespace, name + "." + namespace + ".svc"}
-	return issueCertificate(inf, CAWebhook, RoleSystem, false,
+	return issueCertificate(ctx, inf, CAWebhook, RoleSystem, false,
 		map[string]interface{}{
 			"ttl":               "175200h",
 			"max_ttl":           "175200h",
@@ -373,7 +415,28 @@ func (WebhookCA) IssueCertificate(ctx context.Context, inf Infrastructure, names
 		})
 }
 
-func issueCertificate(inf Infrastructure, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+// localCAConfig returns the local CA configuration, or nil if Vault PKI is used.
+func localCAConfig(ctx context.Context, inf Infrastructure) (*LocalCAConfig, error) {
+	cfg, err := inf.Storage().GetLocalCAConfig(ctx)
+	switch err {
+	case nil:
+		return cfg, nil
+	case ErrNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func issueCertificate(ctx context.Context, inf Infrastructure, ca, role string, onetime bool, roleOpts, certOpts map[string]interface{}) (crt, key string, err error) {
+	cfg, err := localCAConfig(ctx, inf)
+	if err != nil {
+		return "", "", err
+	}
+	if cfg != nil {
+		return issueLocalCertificate(ctx, inf.Storage(), cfg, ca, roleOpts, certOpts)
+	}
+
 	pkiKey := VaultPKIKey(ca)
 	client, err := inf.Vault()
 	if err != nil {
@@ -398,3 +461,117 @@ func issueCertificate(inf Infrastructure, ca, role string, onetime bool, roleOpt
 	key = secret.Data["private_key"].(string)
 	return crt, key, err
 }
+
+// AddCAIssuer creates a new root CA for ca as a non-default issuer.
+// The current default issuer keeps issuing certificates until
+// SetDefaultCAIssuer is called.
+func AddCAIssuer(ctx context.Context, inf Infrastructure, ca, commonName, ttl string) (oldIssuer, newIssuer, newCert string, err error) {
+	cfg, err := localCAConfig(ctx, inf)
+	if err != nil {
+		return "", "", "", err
+	}
+	if cfg != nil {
+		return addLocalCAIssuer(ctx, inf.Storage(), cfg, ca, commonName, ttl)
+	}
+
+	vc, err := inf.Vault()
+	if err != nil {
+		return "", "", "", err
+	}
+	pkiKey := VaultPKIKey(ca)
+	secret, err := vc.Logical().Read(path.Join(pkiKey, "config", "issuers"))
+	if err != nil {
+		return "", "", "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", "", "", errors.New("no issuers in " + pkiKey + "; Vault 1.11 or later is required")
+	}
+	oldIssuer, _ = secret.Data["default"].(string)
+	if oldIssuer == "" {
+		return "", "", "", errors.New("no default issuer in " + pkiKey)
+	}
+
+	// Pin the current issuer so that it is not replaced by the new one.
+	_, err = vc.Logical().Write(path.Join(pkiKey, "config", "issuers"), map[string]interface{}{
+		"default":                       oldIssuer,
+		"default_follows_latest_issuer": false,
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+
+	secret, err = vc.Logical().Write(path.Join(pkiKey, "root", "rotate", "internal"), map[string]interface{}{
+		"common_name": commonName,
+		"ttl":         ttl,
+		"format":      "pem",
+	})
+	if err != nil {
+		return "", "", "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", "", "", errors.New("failed to create a new issuer in " + pkiKey)
+	}
+	newIssuer, _ = secret.Data["issuer_id"].(string)
+	newCert, _ = secret.Data["certificate"].(string)
+	if newIssuer == "" || newCert == "" {
+		return "", "", "", fmt.Errorf("failed to create a new issuer: %#v", secret.Warnings)
+	}
+	return oldIssuer, newIssuer, newCert, nil
+}
+
+// SetDefaultCAIssuer makes issuer the default issuer of ca.
+func SetDefaultCAIssuer(ctx context.Context, inf Infrastructure, ca, issuer string) error {
+	cfg, err := localCAConfig(ctx, inf)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		return setDefaultLocalCAIssuer(ctx, inf.Storage(), ca, issuer)
+	}
+
+	vc, err := inf.Vault()
+	if err != nil {
+		return err
+	}
+	_, err = vc.Logical().Write(path.Join(VaultPKIKey(ca), "config", "issuers"), map[string]interface{}{
+		"default": issuer,
+	})
+	return err
+}
+
+// DeleteCAIssuer deletes issuer of ca along with its private key.
+// It does nothing if the issuer does not exist.
+func DeleteCAIssuer(ctx context.Context, inf Infrastructure, ca, issuer string) error {
+	cfg, err := localCAConfig(ctx, inf)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		return deleteLocalCAIssuer(ctx, inf.Storage(), ca, issuer)
+	}
+
+	vc, err := inf.Vault()
+	if err != nil {
+		return err
+	}
+	pkiKey := VaultPKIKey(ca)
+	issuerPath := path.Join(pkiKey, "issuer", issuer)
+	secret, err := vc.Logical().Read(issuerPath)
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+	_, err = vc.Logical().Delete(issuerPath)
+	if err != nil {
+		return err
+	}
+	if keyID, _ := secret.Data["key_id"].(string); keyID != "" {
+		_, err = vc.Logical().Delete(path.Join(pkiKey, "key", keyID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
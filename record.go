@@ -1,6 +1,7 @@
 package cke
 
 import (
+	"slices"
 	"time"
 )
 
@@ -68,3 +69,36 @@ func (r *Record) SetError(e error) {
 	r.Error = e.Error()
 	r.EndAt = time.Now().UTC()
 }
+
+// RecordFilter selects records.  Zero-valued fields match any records.
+type RecordFilter struct {
+	Operation string
+	Target    string
+	Status    RecordStatus
+	ErrorOnly bool
+	Since     time.Time
+	Until     time.Time
+}
+
+// Match returns true if r satisfies all conditions of the filter.
+func (f *RecordFilter) Match(r *Record) bool {
+	if f.Operation != "" && r.Operation != f.Operation {
+		return false
+	}
+	if f.Target != "" && !slices.Contains(r.Targets, f.Target) {
+		return false
+	}
+	if f.Status != "" && r.Status != f.Status {
+		return false
+	}
+	if f.ErrorOnly && r.Error == "" {
+		return false
+	}
+	if !f.Since.IsZero() && r.StartAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.StartAt.Before(f.Until) {
+		return false
+	}
+	return true
+}
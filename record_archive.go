@@ -0,0 +1,253 @@
+package cke
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+)
+
+// Record archive types
+const (
+	RecordArchiveFile = "file"
+	RecordArchiveS3   = "s3"
+)
+
+// DefaultRecordArchiveMaxFileSize is the default size to rotate archive files.
+const DefaultRecordArchiveMaxFileSize = 64 << 20
+
+// RecordArchiveConfig is the configuration of the record archive.
+type RecordArchiveConfig struct {
+	// Type is either "file" or "s3".
+	Type string `json:"type"`
+
+	// Directory is the directory to store JSONL files for "file" type.
+	Directory string `json:"directory,omitempty"`
+
+	// MaxFileSize is the size in bytes to rotate JSONL files for "file" type.
+	MaxFileSize int64 `json:"max-file-size,omitempty"`
+
+	// S3Config is the configuration of the bucket for "s3" type.
+	S3Config
+}
+
+// Validate validates the record archive configuration.
+func (c *RecordArchiveConfig) Validate() error {
+	switch c.Type {
+	case RecordArchiveFile:
+		if len(c.Directory) == 0 {
+			return errors.New("directory is empty")
+		}
+		if !filepath.IsAbs(c.Directory) {
+			return errors.New("directory must be an absolute path")
+		}
+		if c.MaxFileSize < 0 {
+			return errors.New("max-file-size must not be negative")
+		}
+	case RecordArchiveS3:
+		return c.S3Config.Validate()
+	default:
+		return fmt.Errorf("unknown type: %s", c.Type)
+	}
+	return nil
+}
+
+// RecordArchive is an append-only storage of records pruned from etcd.
+type RecordArchive interface {
+	// Append stores records.  Records must be sorted by ID in increasing order.
+	Append(ctx context.Context, records []*Record) error
+
+	// Walk calls fn for each archived record in increasing order of ID.
+	Walk(ctx context.Context, fn func(*Record) error) error
+}
+
+// NewRecordArchive creates a RecordArchive from the configuration.
+func NewRecordArchive(c *RecordArchiveConfig) (RecordArchive, error) {
+	switch c.Type {
+	case RecordArchiveFile:
+		maxSize := c.MaxFileSize
+		if maxSize == 0 {
+			maxSize = DefaultRecordArchiveMaxFileSize
+		}
+		return &fileRecordArchive{dir: c.Directory, maxSize: maxSize}, nil
+	case RecordArchiveS3:
+		return newS3RecordArchive(&c.S3Config)
+	}
+	return nil, errors.New("unknown record archive type: " + c.Type)
+}
+
+var recordArchive atomic.Value
+
+var recordArchiveFailures atomic.Int64
+
+// RecordArchiveFailures returns the number of failures to archive records.
+func RecordArchiveFailures() int64 {
+	return recordArchiveFailures.Load()
+}
+
+type recordArchiveHolder struct {
+	archive RecordArchive
+}
+
+func getRecordArchive() RecordArchive {
+	v := recordArchive.Load()
+	if v == nil {
+		return nil
+	}
+	return v.(recordArchiveHolder).archive
+}
+
+// ConnectRecordArchive configures the record archive used when records are
+// pruned from etcd.  data is JSON of RecordArchiveConfig.
+func ConnectRecordArchive(data []byte) error {
+	c := new(RecordArchiveConfig)
+	err := json.Unmarshal(data, c)
+	if err != nil {
+		return err
+	}
+	err = c.Validate()
+	if err != nil {
+		return err
+	}
+
+	archive, err := NewRecordArchive(c)
+	if err != nil {
+		return err
+	}
+	recordArchive.Store(recordArchiveHolder{archive})
+	return nil
+}
+
+// DisconnectRecordArchive stops archiving records.
+func DisconnectRecordArchive() {
+	recordArchive.Store(recordArchiveHolder{})
+}
+
+// walkRecords decodes JSONL records from r and calls fn for records
+// whose IDs are greater than *lastID.  Records archived twice are skipped.
+func walkRecords(r io.Reader, lastID *int64, fn func(*Record) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		record := new(Record)
+		err := dec.Decode(record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if record.ID <= *lastID {
+			continue
+		}
+		*lastID = record.ID
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func encodeRecords(w io.Writer, records []*Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileRecordArchive stores records in JSONL files named after the first ID.
+type fileRecordArchive struct {
+	dir     string
+	maxSize int64
+}
+
+const recordArchiveFilePattern = "records-*.jsonl"
+
+func recordArchiveName(r *Record) string {
+	return fmt.Sprintf("records-%016x.jsonl", r.ID)
+}
+
+func (a *fileRecordArchive) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(a.dir, recordArchiveFilePattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (a *fileRecordArchive) Append(ctx context.Context, records []*Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+
+	files, err := a.files()
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(a.dir, recordArchiveName(records[0]))
+	if len(files) > 0 {
+		last := files[len(files)-1]
+		fi, err := os.Stat(last)
+		if err != nil {
+			return err
+		}
+		if fi.Size() < a.maxSize {
+			target = last
+		}
+	}
+
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := encodeRecords(w, records); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (a *fileRecordArchive) Walk(ctx context.Context, fn func(*Record) error) error {
+	files, err := a.files()
+	if err != nil {
+		return err
+	}
+
+	var lastID int64
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := func() error {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return walkRecords(bufio.NewReader(f), &lastID, fn)
+		}()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
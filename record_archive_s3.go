@@ -0,0 +1,74 @@
+package cke
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3RecordArchive stores each batch of records as an object in a bucket.
+// Object names contain the first and the last IDs so that listing
+// objects returns records in increasing order of ID.
+type s3RecordArchive struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3RecordArchive(c *S3Config) (RecordArchive, error) {
+	client, err := NewS3Client(c)
+	if err != nil {
+		return nil, err
+	}
+	return &s3RecordArchive{
+		client: client,
+		bucket: c.Bucket,
+		prefix: c.Prefix,
+	}, nil
+}
+
+func (a *s3RecordArchive) Append(ctx context.Context, records []*Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	if err := encodeRecords(buf, records); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%srecords-%016x-%016x.jsonl", a.prefix, records[0].ID, records[len(records)-1].ID)
+	_, err := a.client.PutObject(ctx, a.bucket, name, buf, int64(buf.Len()), minio.PutObjectOptions{
+		ContentType: "application/x-ndjson",
+	})
+	return err
+}
+
+func (a *s3RecordArchive) Walk(ctx context.Context, fn func(*Record) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lastID int64
+	for obj := range a.client.ListObjects(ctx, a.bucket, minio.ListObjectsOptions{
+		Prefix: a.prefix + "records-",
+	}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+
+		err := func() error {
+			o, err := a.client.GetObject(ctx, a.bucket, obj.Key, minio.GetObjectOptions{})
+			if err != nil {
+				return err
+			}
+			defer o.Close()
+			return walkRecords(o, &lastID, fn)
+		}()
+		if err != nil {
+			return fmt.Errorf("%s: %w", obj.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package cke
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordArchiveConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     RecordArchiveConfig
+		wantErr bool
+	}{
+		{
+			name: "file",
+			cfg:  RecordArchiveConfig{Type: RecordArchiveFile, Directory: "/var/lib/cke/records"},
+		},
+		{
+			name:    "file without directory",
+			cfg:     RecordArchiveConfig{Type: RecordArchiveFile},
+			wantErr: true,
+		},
+		{
+			name:    "file with relative directory",
+			cfg:     RecordArchiveConfig{Type: RecordArchiveFile, Directory: "records"},
+			wantErr: true,
+		},
+		{
+			name: "s3",
+			cfg: RecordArchiveConfig{
+				Type: RecordArchiveS3,
+				S3Config: S3Config{
+					Endpoint:        "s3.example.com",
+					Bucket:          "cke",
+					AccessKeyID:     "id",
+					SecretAccessKey: "secret",
+				},
+			},
+		},
+		{
+			name: "s3 with URL endpoint",
+			cfg: RecordArchiveConfig{
+				Type: RecordArchiveS3,
+				S3Config: S3Config{
+					Endpoint:        "https://s3.example.com/",
+					Bucket:          "cke",
+					AccessKeyID:     "id",
+					SecretAccessKey: "secret",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "s3 without bucket",
+			cfg: RecordArchiveConfig{
+				Type: RecordArchiveS3,
+				S3Config: S3Config{
+					Endpoint:        "s3.example.com",
+					AccessKeyID:     "id",
+					SecretAccessKey: "secret",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			cfg:     RecordArchiveConfig{Type: "tape"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("error is expected")
+			}
+			if !tc.wantErr && err != nil {
+				t.Error("unexpected error:", err)
+			}
+		})
+	}
+}
+
+func TestFileRecordArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := NewRecordArchive(&RecordArchiveConfig{
+		Type:        RecordArchiveFile,
+		Directory:   filepath.Join(dir, "records"),
+		MaxFileSize: 500,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var batch []*Record
+	for i := int64(1); i <= 10; i++ {
+		batch = append(batch, NewRecord(i, "op", []string{"10.0.0.1"}))
+		if i%3 == 0 {
+			if err := archive.Append(ctx, batch); err != nil {
+				t.Fatal(err)
+			}
+			batch = nil
+		}
+	}
+	if err := archive.Append(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// records archived twice should be ignored.
+	if err := archive.Append(ctx, []*Record{NewRecord(9, "op", nil), NewRecord(10, "op", nil)}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "records", "records-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Error("files are not rotated:", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "records", "records-0000000000000001.jsonl")); err != nil {
+		t.Error(err)
+	}
+
+	var ids []int64
+	err = archive.Walk(ctx, func(r *Record) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 10 {
+		t.Fatal("unexpected records:", ids)
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Error("unexpected order:", ids)
+			break
+		}
+	}
+}
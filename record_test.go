@@ -0,0 +1,44 @@
+package cke
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecordFilter(t *testing.T) {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	r := NewRecord(1, "kubelet-restart", []string{"10.0.0.1", "10.0.0.2"})
+	r.StartAt = base
+	r.Complete()
+
+	failed := NewRecord(2, "reboot-drain-start", []string{"10.0.0.3"})
+	failed.StartAt = base.Add(time.Hour)
+	failed.SetError(errors.New("drain failed"))
+
+	testCases := []struct {
+		name   string
+		filter RecordFilter
+		want   []bool
+	}{
+		{"empty", RecordFilter{}, []bool{true, true}},
+		{"operation", RecordFilter{Operation: "kubelet-restart"}, []bool{true, false}},
+		{"target", RecordFilter{Target: "10.0.0.2"}, []bool{true, false}},
+		{"status", RecordFilter{Status: StatusCancelled}, []bool{false, true}},
+		{"error only", RecordFilter{ErrorOnly: true}, []bool{false, true}},
+		{"since", RecordFilter{Since: base.Add(time.Minute)}, []bool{false, true}},
+		{"until", RecordFilter{Until: base.Add(time.Hour)}, []bool{true, false}},
+		{"since and until", RecordFilter{Since: base, Until: base.Add(time.Minute)}, []bool{true, false}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, rec := range []*Record{r, failed} {
+				if got := tc.filter.Match(rec); got != tc.want[i] {
+					t.Errorf("Match(record %d) = %v, want %v", rec.ID, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package cke
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config is the configuration to access a bucket of an S3-compatible service.
+type S3Config struct {
+	// Endpoint is the host[:port] of the S3-compatible service.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Insecure disables TLS to connect to Endpoint.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// Region is the region of the bucket.
+	Region string `json:"region,omitempty"`
+
+	// Bucket is the name of the bucket.
+	Bucket string `json:"bucket,omitempty"`
+
+	// Prefix is prepended to the object names.
+	Prefix string `json:"prefix,omitempty"`
+
+	// AccessKeyID is the access key to the bucket.
+	AccessKeyID string `json:"access-key-id,omitempty"`
+
+	// SecretAccessKey is the secret key to the bucket.
+	SecretAccessKey string `json:"secret-access-key,omitempty"`
+}
+
+// Validate validates the S3 configuration.
+func (c *S3Config) Validate() error {
+	if len(c.Endpoint) == 0 {
+		return errors.New("endpoint is empty")
+	}
+	if strings.Contains(c.Endpoint, "/") {
+		return errors.New("endpoint must be host[:port]")
+	}
+	if len(c.Bucket) == 0 {
+		return errors.New("bucket is empty")
+	}
+	if len(c.AccessKeyID) == 0 {
+		return errors.New("access-key-id is empty")
+	}
+	if len(c.SecretAccessKey) == 0 {
+		return errors.New("secret-access-key is empty")
+	}
+	return nil
+}
+
+// NewS3Client creates a client for the S3-compatible service.
+func NewS3Client(c *S3Config) (*minio.Client, error) {
+	return minio.New(c.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(c.AccessKeyID, c.SecretAccessKey, ""),
+		Secure: !c.Insecure,
+		Region: c.Region,
+	})
+}
@@ -3,6 +3,7 @@ package sabakan
 import (
 	"context"
 	"errors"
+	"os"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -150,7 +151,11 @@ func (ig integrator) runGenerator(ctx context.Context, leaderKey string, cluster
 		return nil
 	}
 
-	return st.PutClusterWithTemplateRevision(ctx, newc, rev, leaderKey)
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	return st.PutClusterWithTemplateRevision(ctx, newc, rev, leaderKey, hostname)
 }
 
 func (ig integrator) runRepairer(ctx context.Context, clusterStatus *cke.ClusterStatus) error {
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cybozu-go/cke"
+)
+
+const (
+	apiPrefix = "/api/v1/"
+
+	// proxiedHeader is set to requests forwarded from a follower to
+	// prevent them from being forwarded again.
+	proxiedHeader = "X-Cke-Proxied"
+
+	defaultRecordsCount = 20
+	maxRecordsCount     = 1000
+)
+
+func (s Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if s.APIToken == "" {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		renderError(r.Context(), w, APIErrUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		renderError(r.Context(), w, APIErrBadMethod)
+		return
+	}
+
+	var handler func(http.ResponseWriter, *http.Request)
+	switch r.URL.Path[len(apiPrefix):] {
+	case "status":
+		handler = s.handleStatus
+	case "nodes":
+		handler = s.handleNodes
+	case "reboot-queue":
+		handler = s.handleRebootQueue
+	case "repair-queue":
+		handler = s.handleRepairQueue
+	case "records":
+		handler = s.handleRecords
+	default:
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+
+	if !state.isLeader() {
+		s.proxyToLeader(w, r)
+		return
+	}
+	handler(w, r)
+}
+
+func (s Server) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.APIToken)) == 1
+}
+
+func (s Server) proxyToLeader(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(proxiedHeader) != "" {
+		renderError(r.Context(), w, APIErrNoLeader)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.Timeout)
+	defer cancel()
+
+	storage := cke.Storage{Client: s.EtcdClient}
+	endpoint, err := storage.GetLeaderEndpoint(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+		renderError(r.Context(), w, APIErrNoLeader)
+		return
+	default:
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set(proxiedHeader, "true")
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		renderError(r.Context(), w, APIError{http.StatusBadGateway, "failed to forward the request to the leader", err})
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+func (s Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st := state.getStatus()
+	if st == nil {
+		renderError(r.Context(), w, APIErrUnavailable)
+		return
+	}
+	renderJSON(w, st, http.StatusOK)
+}
+
+func (s Server) handleNodes(w http.ResponseWriter, r *http.Request) {
+	if state.getStatus() == nil {
+		renderError(r.Context(), w, APIErrUnavailable)
+		return
+	}
+	nodes := state.getNodes()
+	if nodes == nil {
+		nodes = []*NodeSummary{}
+	}
+	renderJSON(w, nodes, http.StatusOK)
+}
+
+func (s Server) handleRebootQueue(w http.ResponseWriter, r *http.Request) {
+	if state.getStatus() == nil {
+		renderError(r.Context(), w, APIErrUnavailable)
+		return
+	}
+	entries := state.getRebootQueue()
+	if entries == nil {
+		entries = []*cke.RebootQueueEntry{}
+	}
+	renderJSON(w, entries, http.StatusOK)
+}
+
+func (s Server) handleRepairQueue(w http.ResponseWriter, r *http.Request) {
+	if state.getStatus() == nil {
+		renderError(r.Context(), w, APIErrUnavailable)
+		return
+	}
+	entries := state.getRepairQueue()
+	if entries == nil {
+		entries = []*cke.RepairQueueEntry{}
+	}
+	renderJSON(w, entries, http.StatusOK)
+}
+
+func (s Server) handleRecords(w http.ResponseWriter, r *http.Request) {
+	count := int64(defaultRecordsCount)
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > maxRecordsCount {
+			renderError(r.Context(), w, BadRequest("invalid count: "+v))
+			return
+		}
+		count = n
+	}
+
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			renderError(r.Context(), w, BadRequest("invalid before: "+v))
+			return
+		}
+		before = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.Timeout)
+	defer cancel()
+
+	storage := cke.Storage{Client: s.EtcdClient}
+	var records []*cke.Record
+	var err error
+	if before > 0 {
+		records, err = storage.GetRecordsBefore(ctx, before, count)
+	} else {
+		records, err = storage.GetRecords(ctx, count)
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	if records == nil {
+		records = []*cke.Record{}
+	}
+	renderJSON(w, records, http.StatusOK)
+}
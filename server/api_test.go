@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/cke"
+)
+
+func testAPIRequest(s Server, method, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestAPI(t *testing.T) {
+	defer state.setLeader(false)
+
+	disabled := Server{Timeout: time.Second}
+	w := testAPIRequest(disabled, http.MethodGet, "/api/v1/status", "token")
+	if w.Code != http.StatusNotFound {
+		t.Error("API should be disabled without token:", w.Code)
+	}
+
+	s := Server{Timeout: time.Second, APIToken: "token"}
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/status", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Error("request without token should be unauthorized:", w.Code)
+	}
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/status", "wrong")
+	if w.Code != http.StatusUnauthorized {
+		t.Error("request with wrong token should be unauthorized:", w.Code)
+	}
+	w = testAPIRequest(s, http.MethodPut, "/api/v1/status", "token")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("PUT should not be allowed:", w.Code)
+	}
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/foo", "token")
+	if w.Code != http.StatusNotFound {
+		t.Error("unknown endpoint should not be found:", w.Code)
+	}
+
+	state.setLeader(true)
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/status", "token")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error("status should be unavailable before the first check:", w.Code)
+	}
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/records?count=0", "token")
+	if w.Code != http.StatusBadRequest {
+		t.Error("count=0 should be a bad request:", w.Code)
+	}
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/records?before=abc", "token")
+	if w.Code != http.StatusBadRequest {
+		t.Error("before=abc should be a bad request:", w.Code)
+	}
+
+	cluster := &cke.Cluster{
+		Nodes: []*cke.Node{
+			{Address: "10.0.0.11", Hostname: "cp1", ControlPlane: true},
+			{Address: "10.0.0.12", Hostname: "worker1"},
+		},
+	}
+	cs := &cke.ClusterStatus{
+		NodeStatuses: map[string]*cke.NodeStatus{
+			"10.0.0.11": {
+				SSHConnected: true,
+				APIServer: cke.KubeComponentStatus{
+					ServiceStatus: cke.ServiceStatus{Running: true, Image: "cke-tools"},
+					IsHealthy:     true,
+				},
+				Rivers: cke.ServiceStatus{Running: true},
+			},
+			"10.0.0.12": {
+				SSHConnected: false,
+			},
+		},
+		RebootQueue: cke.RebootQueueStatus{
+			Entries: []*cke.RebootQueueEntry{{Index: 1, Node: "10.0.0.12"}},
+		},
+	}
+	state.update(&cke.ServerStatus{Phase: cke.PhaseCompleted}, cluster, cs)
+
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/status", "token")
+	if w.Code != http.StatusOK {
+		t.Fatal("failed to get status:", w.Code)
+	}
+	st := new(cke.ServerStatus)
+	if err := json.Unmarshal(w.Body.Bytes(), st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Phase != cke.PhaseCompleted {
+		t.Error("unexpected phase:", st.Phase)
+	}
+
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/nodes", "token")
+	if w.Code != http.StatusOK {
+		t.Fatal("failed to get nodes:", w.Code)
+	}
+	var nodes []*NodeSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatal("unexpected number of nodes:", len(nodes))
+	}
+	if !nodes[0].SSHConnected || !nodes[0].ControlPlane || nodes[0].Hostname != "cp1" {
+		t.Error("unexpected node summary:", nodes[0])
+	}
+	if svc := nodes[0].Services["kube-apiserver"]; !svc.Running || !svc.Healthy || svc.Image != "cke-tools" {
+		t.Error("unexpected kube-apiserver summary:", svc)
+	}
+	if svc := nodes[0].Services["rivers"]; !svc.Running || !svc.Healthy {
+		t.Error("unexpected rivers summary:", svc)
+	}
+	if svc := nodes[0].Services["kubelet"]; svc.Running || svc.Healthy {
+		t.Error("unexpected kubelet summary:", svc)
+	}
+	if nodes[1].SSHConnected {
+		t.Error("unexpected node summary:", nodes[1])
+	}
+
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/reboot-queue", "token")
+	if w.Code != http.StatusOK {
+		t.Fatal("failed to get reboot queue:", w.Code)
+	}
+	var reboots []*cke.RebootQueueEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &reboots); err != nil {
+		t.Fatal(err)
+	}
+	if len(reboots) != 1 || reboots[0].Node != "10.0.0.12" {
+		t.Error("unexpected reboot queue:", reboots)
+	}
+
+	w = testAPIRequest(s, http.MethodGet, "/api/v1/repair-queue", "token")
+	if w.Code != http.StatusOK {
+		t.Fatal("failed to get repair queue:", w.Code)
+	}
+	if w.Body.String() != "[]\n" {
+		t.Error("unexpected repair queue:", w.Body.String())
+	}
+
+	state.setLeader(false)
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set(proxiedHeader, "true")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error("proxied request to a follower should fail:", w.Code)
+	}
+}
@@ -35,10 +35,13 @@ func BadRequest(reason string) APIError {
 // Common API errors
 var (
 	APIErrBadRequest     = APIError{http.StatusBadRequest, "invalid request", nil}
+	APIErrUnauthorized   = APIError{http.StatusUnauthorized, "unauthorized", nil}
 	APIErrForbidden      = APIError{http.StatusForbidden, "forbidden", nil}
 	APIErrNotFound       = APIError{http.StatusNotFound, "requested resource is not found", nil}
 	APIErrBadMethod      = APIError{http.StatusMethodNotAllowed, "method not allowed", nil}
 	APIErrConflict       = APIError{http.StatusConflict, "conflicted", nil}
 	APIErrLengthRequired = APIError{http.StatusLengthRequired, "content-length is required", nil}
 	APIErrTooLargeAsset  = APIError{http.StatusRequestEntityTooLarge, "too large asset", nil}
+	APIErrUnavailable    = APIError{http.StatusServiceUnavailable, "service unavailable", nil}
+	APIErrNoLeader       = APIError{http.StatusServiceUnavailable, "leader is not available", nil}
 )
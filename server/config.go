@@ -10,4 +10,10 @@ type Config struct {
 	CertsGCInterval time.Duration
 	// MaxConcurrentUpdates is the maximum number of concurrent updates.
 	MaxConcurrentUpdates int
+	// MaxConcurrentOperations is the maximum number of operations run in parallel.
+	// Operations run in parallel only when their targets do not overlap.
+	MaxConcurrentOperations int
+	// AdvertiseURL is the URL of the REST API of this server.
+	// Followers forward REST API requests to the leader's URL.
+	AdvertiseURL string
 }
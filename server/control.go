@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -65,6 +66,18 @@ func (c Controller) Run(ctx context.Context) error {
 		"session": c.session.Lease(),
 	})
 	metrics.UpdateLeader(true)
+	state.setLeader(true)
+	defer state.setLeader(false)
+
+	if c.config.AdvertiseURL != "" {
+		storage := cke.Storage{
+			Client: c.session.Client(),
+		}
+		err := storage.SetLeaderEndpoint(ctx, c.session.Lease(), c.config.AdvertiseURL)
+		if err != nil {
+			return fmt.Errorf("failed to set the leader endpoint: %w", err)
+		}
+	}
 
 	// Release the leader before terminating.
 	defer func() {
@@ -181,6 +194,22 @@ func (c Controller) runLoop(ctx context.Context, leaderKey string) error {
 		}
 	})
 
+	env.Go(func(ctx context.Context) error {
+		ticker := time.NewTicker(etcdSnapshotCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			err := c.runEtcdSnapshot(ctx)
+			if err != nil {
+				return err
+			}
+		}
+	})
+
 	env.Stop()
 	return env.Wait()
 }
@@ -323,15 +352,30 @@ func (c Controller) runOnce(ctx context.Context, leaderKey string, tick <-chan t
 
 	ops, phase := DecideOps(cluster, status, constraints, rcs, c.config)
 
+	freeze, err := storage.GetFreeze(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+		freeze = nil
+	default:
+		return err
+	}
+	frozen := freeze != nil && freeze.Blocks(phase)
+
 	st := &cke.ServerStatus{
 		Phase:     phase,
 		Timestamp: ts,
+		Frozen:    frozen,
 	}
 	err = storage.SetStatus(ctx, c.session.Lease(), st)
 	if err != nil {
 		return err
 	}
 	metrics.UpdateOperationPhase(phase, ts)
+	metrics.UpdateOperationFrozen(frozen)
+	metrics.UpdateEtcdMemberStatuses(status.Etcd.MemberStatuses)
+	metrics.UpdateCertificates(status.NodeStatuses)
+	state.update(st, cluster, status)
 
 	if len(ops) == 0 {
 		wait = true
@@ -341,6 +385,20 @@ func (c Controller) runOnce(ctx context.Context, leaderKey string, tick <-chan t
 		return nil
 	}
 
+	// Skip operations while frozen, but keep the addon working.
+	if frozen {
+		wait = true
+		log.Info("operations are frozen", map[string]interface{}{
+			"phase":  phase,
+			"reason": freeze.Reason,
+			"author": freeze.Author,
+		})
+		if c.addon != nil {
+			return c.addon.Do(ctx, leaderKey, status)
+		}
+		return nil
+	}
+
 	// Reflect sabakan machine status when CKE does not need to do
 	// anything except for rebooting nodes.
 	if c.addon != nil && phase == cke.PhaseRebootNodes {
@@ -349,35 +407,56 @@ func (c Controller) runOnce(ctx context.Context, leaderKey string, tick <-chan t
 		}
 	}
 
-	for _, op := range ops {
-		err := runOp(ctx, op, leaderKey, storage, inf)
-		switch err {
-		case nil:
-		case errCommandFailure:
-			wait = true
-			return nil
-		default:
-			return err
-		}
+	err = runOps(ctx, ops, c.config.MaxConcurrentOperations, func(ctx context.Context, op cke.Operator) error {
+		return runOp(ctx, op, leaderKey, storage, inf)
+	})
+	switch err {
+	case nil:
+	case errCommandFailure:
+		wait = true
+		return nil
+	default:
+		return err
 	}
 
 	return nil
 }
 
-func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.Storage, inf cke.Infrastructure) error {
-	// register operation record
+// recordMu serializes the allocation of record IDs among concurrent operations.
+var recordMu sync.Mutex
+
+func registerRecord(ctx context.Context, op cke.Operator, leaderKey string, storage cke.Storage) (*cke.Record, error) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+
 	id, err := storage.NextRecordID(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	record := cke.NewRecord(id, op.Name(), op.Targets())
 	err = storage.RegisterRecord(ctx, leaderKey, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.Storage, inf cke.Infrastructure) error {
+	// register operation record
+	record, err := registerRecord(ctx, op, leaderKey, storage)
 	if err != nil {
 		return err
 	}
 	log.Info("begin new operation", map[string]interface{}{
 		"op": op.Name(),
 	})
+	cke.Notify(ctx, storage, &cke.Notification{
+		Event:   cke.EventOperationStarted,
+		Message: fmt.Sprintf("operation %s started: targets=%v", op.Name(), op.Targets()),
+		Record:  record,
+	})
+
+	startAt := time.Now()
 
 	for {
 		commander := op.NextCommand()
@@ -388,6 +467,7 @@ func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.S
 		// check the context before proceed
 		select {
 		case <-ctx.Done():
+			metrics.ObserveOperation(op.Name(), metrics.OperationCancelled, time.Since(startAt))
 			record.Cancel()
 			err = storage.UpdateRecord(ctx, leaderKey, record)
 			if err != nil {
@@ -414,10 +494,13 @@ func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.S
 			"op":      op.Name(),
 			"command": commander.Command().String(),
 		})
+		commandStartAt := time.Now()
 		err = commander.Run(ctx, inf, leaderKey)
+		metrics.ObserveCommand(op.Name(), commander.Command().Name, time.Since(commandStartAt))
 		if err == nil {
 			continue
 		}
+		metrics.ObserveOperation(op.Name(), metrics.OperationFailed, time.Since(startAt))
 		log.Error("command failed", map[string]interface{}{
 			log.FnError: err,
 			"op":        op.Name(),
@@ -428,6 +511,11 @@ func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.S
 		if err2 != nil {
 			return err2
 		}
+		cke.Notify(ctx, storage, &cke.Notification{
+			Event:   cke.EventOperationFailed,
+			Message: fmt.Sprintf("operation %s failed: %v", op.Name(), err),
+			Record:  record,
+		})
 
 		// return errCommandFailure instead of err as command failure need to be
 		// handled gracefully.
@@ -443,9 +531,15 @@ func runOp(ctx context.Context, op cke.Operator, leaderKey string, storage cke.S
 	if err != nil {
 		return err
 	}
+	metrics.ObserveOperation(op.Name(), metrics.OperationCompleted, time.Since(startAt))
 	log.Info("operation completed", map[string]interface{}{
 		"op": op.Name(),
 	})
+	cke.Notify(ctx, storage, &cke.Notification{
+		Event:   cke.EventOperationCompleted,
+		Message: fmt.Sprintf("operation %s completed", op.Name()),
+		Record:  record,
+	})
 	return nil
 }
 
@@ -454,6 +548,16 @@ func (c Controller) runTidyExpiredCertificates(ctx context.Context) error {
 		Client: c.session.Client(),
 	}
 
+	// Certificates issued by the local CA backend are not stored.
+	_, err := storage.GetLocalCAConfig(ctx)
+	switch err {
+	case nil:
+		return nil
+	case cke.ErrNotFound:
+	default:
+		return err
+	}
+
 	cfg, err := storage.GetVaultConfig(ctx)
 	if err != nil {
 		log.Warn("failed to get vault config. skip tidy", map[string]interface{}{
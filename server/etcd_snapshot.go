@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/cybozu-go/cke/metrics"
+	"github.com/cybozu-go/log"
+)
+
+// etcdSnapshotCheckInterval is the interval to check whether
+// a new snapshot of the CKE-managed etcd should be taken.
+const etcdSnapshotCheckInterval = time.Minute
+
+// runEtcdSnapshot takes a snapshot of the CKE-managed etcd if the last
+// snapshot is older than the configured interval, then removes snapshots
+// by the retention policy.  Failures are logged and retried later.
+func (c Controller) runEtcdSnapshot(ctx context.Context) error {
+	storage := cke.Storage{
+		Client: c.session.Client(),
+	}
+
+	cfg, err := storage.GetEtcdSnapshotConfig(ctx)
+	switch err {
+	case nil:
+	case cke.ErrNotFound:
+		return nil
+	default:
+		return err
+	}
+
+	store, err := cke.NewEtcdSnapshotStore(cfg)
+	if err != nil {
+		log.Error("failed to create etcd snapshot store", map[string]interface{}{
+			log.FnError: err,
+		})
+		metrics.ObserveEtcdSnapshot(0, time.Now(), false)
+		return nil
+	}
+
+	snapshots, err := store.List(ctx)
+	if err != nil {
+		log.Error("failed to list etcd snapshots", map[string]interface{}{
+			log.FnError: err,
+		})
+		metrics.ObserveEtcdSnapshot(0, time.Now(), false)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if len(snapshots) > 0 && now.Sub(snapshots[len(snapshots)-1].Time) < cfg.GetInterval() {
+		return nil
+	}
+
+	info, err := c.takeEtcdSnapshot(ctx, storage, cfg, store, now)
+	if err != nil {
+		log.Error("failed to take etcd snapshot", map[string]interface{}{
+			log.FnError: err,
+		})
+		metrics.ObserveEtcdSnapshot(0, now, false)
+		return nil
+	}
+	log.Info("took etcd snapshot", map[string]interface{}{
+		"name":   info.Name,
+		"size":   info.Size,
+		"sha256": info.Checksum,
+	})
+	metrics.ObserveEtcdSnapshot(info.Size, now, true)
+
+	snapshots = append(snapshots, info)
+	for _, s := range cke.ExpiredEtcdSnapshots(snapshots, cfg, now) {
+		err := store.Remove(ctx, s.Name)
+		if err != nil {
+			log.Error("failed to remove etcd snapshot", map[string]interface{}{
+				"name":      s.Name,
+				log.FnError: err,
+			})
+			return nil
+		}
+		log.Info("removed etcd snapshot", map[string]interface{}{
+			"name": s.Name,
+		})
+	}
+	return nil
+}
+
+func (c Controller) takeEtcdSnapshot(ctx context.Context, storage cke.Storage, cfg *cke.EtcdSnapshotConfig, store cke.EtcdSnapshotStore, now time.Time) (*cke.EtcdSnapshotInfo, error) {
+	cluster, err := storage.GetCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The etcd client needs only the certificates, so SSH is not used.
+	inf := cke.NewInfrastructureWithoutSSH(ctx, cluster, storage)
+	defer inf.Close()
+
+	var endpoints []string
+	for _, n := range cluster.Nodes {
+		if n.ControlPlane {
+			endpoints = append(endpoints, fmt.Sprintf("https://%s:2379", n.Address))
+		}
+	}
+	etcd, err := inf.NewEtcdClient(ctx, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	defer etcd.Close()
+
+	// Save the snapshot in the same file system as the store if possible
+	// to avoid copying it.
+	var tmpDir string
+	if cfg.Type == cke.EtcdSnapshotFile {
+		if err := os.MkdirAll(cfg.Directory, 0755); err != nil {
+			return nil, err
+		}
+		tmpDir = cfg.Directory
+	}
+	f, err := os.CreateTemp(tmpDir, ".etcd-snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := f.Name()
+	f.Close()
+	defer os.Remove(tmpName)
+
+	size, checksum, err := cke.SaveEtcdSnapshot(ctx, etcd, tmpName)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cke.EtcdSnapshotName(now)
+	if err := store.Put(ctx, name, tmpName, checksum); err != nil {
+		return nil, err
+	}
+	return &cke.EtcdSnapshotInfo{
+		Name:     name,
+		Time:     now.Truncate(time.Second),
+		Size:     size,
+		Checksum: checksum,
+	}, nil
+}
@@ -7,12 +7,20 @@ import (
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
+	"github.com/cybozu-go/cke/op/k8s"
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/well"
 )
 
 // GetClusterStatus consults the whole cluster and constructs *ClusterStatus.
 func (c Controller) GetClusterStatus(ctx context.Context, cluster *cke.Cluster, inf cke.Infrastructure) (*cke.ClusterStatus, error) {
+	return GetClusterStatus(ctx, cluster, inf)
+}
+
+// GetClusterStatus consults the whole cluster and constructs *ClusterStatus.
+// This can be used outside of the controller, e.g. by ckecli, as it does
+// not modify anything.
+func GetClusterStatus(ctx context.Context, cluster *cke.Cluster, inf cke.Infrastructure) (*cke.ClusterStatus, error) {
 	var mu sync.Mutex
 	statuses := make(map[string]*cke.NodeStatus)
 
@@ -45,6 +53,41 @@ func (c Controller) GetClusterStatus(ctx context.Context, cluster *cke.Cluster,
 	cs.ConfigVersion = version
 	cs.NodeStatuses = statuses
 
+	restore, err := inf.Storage().GetEtcdRestore(ctx)
+	switch err {
+	case nil:
+		cs.EtcdRestore = restore
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	rotation, err := inf.Storage().GetEncryptionKeyRotation(ctx)
+	switch err {
+	case nil:
+		cs.Encryption.Rotation = rotation
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	// The hash should be computed after loading the rotation request
+	// so that it reflects the new key added for the rotation.
+	hash, err := k8s.EncryptionConfigHash(ctx, inf, cluster.Options.APIServer.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	cs.Encryption.ConfigHash = hash
+
+	caRotation, err := inf.Storage().GetCARotation(ctx)
+	switch err {
+	case nil:
+		cs.CARotation = caRotation
+	case cke.ErrNotFound:
+	default:
+		return nil, err
+	}
+
 	var etcdRunning bool
 	for _, n := range cke.ControlPlanes(cluster.Nodes) {
 		ns := statuses[n.Address]
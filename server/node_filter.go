@@ -2,6 +2,7 @@ package server
 
 import (
 	"strings"
+	"time"
 
 	"github.com/cybozu-go/cke"
 	"github.com/cybozu-go/cke/op"
@@ -158,6 +159,7 @@ func (nf *NodeFilter) EtcdIsGood() bool {
 // EtcdIsGoodForRepair returns true like EtcdIsGood, but tolerates up to one
 // out-of-sync member running on an SSH-unreachable control plane node, since
 // such a member is the result of a control plane failure to be repaired.
+// Learners do not count as in-sync members because they do not vote.
 func (nf *NodeFilter) EtcdIsGoodForRepair(controlPlaneCount int) bool {
 	st := nf.status.Etcd
 	if !st.IsHealthy {
@@ -165,7 +167,7 @@ func (nf *NodeFilter) EtcdIsGoodForRepair(controlPlaneCount int) bool {
 	}
 	inSyncCP := 0
 	for address, inSync := range st.InSyncMembers {
-		if inSync {
+		if inSync && !st.IsLearner(address) {
 			inSyncCP++
 			continue
 		}
@@ -252,12 +254,32 @@ func (nf *NodeFilter) EtcdUnstartedMembers() (nodes []*cke.Node) {
 	return nodes
 }
 
-// EtcdUnmarkedMembers returns nodes that are working as in-sync members
+// EtcdLearnerMembers returns control plane nodes that are started as learners
+// but not promoted yet.
+func (nf *NodeFilter) EtcdLearnerMembers() (nodes []*cke.Node) {
+	st := nf.status.Etcd
+	for k, v := range st.Members {
+		if !v.IsLearner || len(v.Name) == 0 {
+			continue
+		}
+		n, ok := nf.nodeMap[k]
+		if !ok {
+			continue
+		}
+		if !n.ControlPlane {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// EtcdUnmarkedMembers returns nodes that are working as in-sync voting members
 // of the etcd cluster but not marked as added members.
 func (nf *NodeFilter) EtcdUnmarkedMembers() (nodes []*cke.Node) {
 	st := nf.status.Etcd
 	for k, v := range st.InSyncMembers {
-		if !v {
+		if !v || st.IsLearner(k) {
 			continue
 		}
 		n, ok := nf.nodeMap[k]
@@ -316,8 +338,11 @@ func etcdEqualParams(running, current cke.ServiceParams) bool {
 }
 
 // EtcdOutdatedMembers returns nodes that are running etcd with outdated image or params.
+// In static pod mode, nodes running etcd as a container are also returned
+// once kubelet runs static pods on them.
 func (nf *NodeFilter) EtcdOutdatedMembers() (nodes []*cke.Node) {
 	currentExtra := nf.cluster.Options.Etcd.ServiceParams
+	staticPod := nf.cluster.ControlPlaneMode == cke.ControlPlaneModeStaticPod
 
 	for _, n := range nf.ControlPlaneNodes() {
 		st := nf.nodeStatus(n).Etcd
@@ -325,7 +350,11 @@ func (nf *NodeFilter) EtcdOutdatedMembers() (nodes []*cke.Node) {
 			continue
 		}
 		currentBuiltIn := etcd.BuiltInParams(n, []string{}, "new")
+		kubelet := nf.nodeStatus(n).Kubelet
 		switch {
+		// etcd bootstrapped as a container is restarted as a static pod once kubelet runs static pods.
+		case staticPod && !st.StaticPod && kubelet.Running && kubelet.Config != nil && kubelet.Config.StaticPodPath == cke.StaticPodManifestDir:
+			fallthrough
 		case cke.EtcdImage.Name() != st.Image:
 			fallthrough
 		case !etcdEqualParams(st.BuiltInParams, currentBuiltIn):
@@ -337,6 +366,31 @@ func (nf *NodeFilter) EtcdOutdatedMembers() (nodes []*cke.Node) {
 	return nodes
 }
 
+// EtcdFragmentedMembers returns control plane nodes whose etcd database needs
+// to be defragmented.  The leader, if included, is placed at the end.
+func (nf *NodeFilter) EtcdFragmentedMembers() (nodes []*cke.Node) {
+	params := nf.cluster.Options.Etcd
+	var leader *cke.Node
+	for _, n := range nf.ControlPlaneNodes() {
+		if !nf.nodeStatus(n).Etcd.Running {
+			continue
+		}
+		st := nf.status.Etcd.MemberStatuses[n.Address]
+		if !params.NeedsDefrag(st) {
+			continue
+		}
+		if st.IsLeader {
+			leader = n
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	if leader != nil {
+		nodes = append(nodes, leader)
+	}
+	return nodes
+}
+
 // HealthyAPIServer returns one of the control plane nodes that is running healthy API server.
 // If there is no healthy API server, it returns `nil`.
 func (nf *NodeFilter) HealthyAPIServer() *cke.Node {
@@ -387,7 +441,7 @@ func (nf *NodeFilter) APIServerOutdated(targets []*cke.Node) (nodes []*cke.Node)
 	for _, n := range targets {
 		st := nf.nodeStatus(n).APIServer
 		currentBuiltIn := k8s.APIServerParams(n.Address, nf.cluster.ServiceSubnet,
-			currentExtra.AuditLogEnabled, currentExtra.AuditLogPolicy, currentExtra.AuditLogPath, kubeletConfig.ClusterDomain)
+			currentExtra, kubeletConfig.ClusterDomain, nf.status.Encryption.ConfigHash)
 		switch {
 		case !st.Running:
 			// stopped nodes are excluded
@@ -402,6 +456,138 @@ func (nf *NodeFilter) APIServerOutdated(targets []*cke.Node) (nodes []*cke.Node)
 	return nodes
 }
 
+// CertificateRenewalDue filters nodes that have any of the named certificates
+// to be renewed according to the cert_renewal configuration.
+// The certificate for the audit webhook is also renewed by cke.AuditWebhookCertRenewal.
+func (nf *NodeFilter) CertificateRenewalDue(targets []*cke.Node, names ...string) (nodes []*cke.Node) {
+	renewal := nf.cluster.CertRenewal
+
+	now := time.Now()
+	for _, n := range targets {
+		certs := nf.nodeStatus(n).Certificates
+		for _, name := range names {
+			st, ok := certs[name]
+			if !ok {
+				continue
+			}
+			due := renewal.NeedsRenewal(st, now)
+			if name == cke.CertAuditWebhook {
+				due = due || cke.AuditWebhookCertRenewal.NeedsRenewal(st, now)
+			}
+			if due {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// CARotationPending filters nodes that have any of the named certificates
+// to be reissued in the current phase of the CA rotation.
+// Certificates unrelated to the CA being rotated are ignored.
+func (nf *NodeFilter) CARotationPending(targets []*cke.Node, names ...string) (nodes []*cke.Node) {
+	r := nf.status.CARotation
+	if r == nil {
+		return nil
+	}
+
+	related := make(map[string]bool)
+	for _, name := range r.Certificates() {
+		related[name] = true
+	}
+	for _, n := range targets {
+		certs := nf.nodeStatus(n).Certificates
+		for _, name := range names {
+			st, ok := certs[name]
+			if ok && related[name] && r.Pending(st) {
+				nodes = append(nodes, n)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// CertificateOutdated filters nodes that have any of the named certificates
+// to be reissued for renewal or for the CA rotation.
+func (nf *NodeFilter) CertificateOutdated(targets []*cke.Node, names ...string) (nodes []*cke.Node) {
+	outdated := make(map[string]bool)
+	for _, n := range nf.CertificateRenewalDue(targets, names...) {
+		outdated[n.Address] = true
+	}
+	for _, n := range nf.CARotationPending(targets, names...) {
+		outdated[n.Address] = true
+	}
+	for _, n := range targets {
+		if outdated[n.Address] {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// KMSPluginStopped filters nodes that are not running the KMS plugin.
+// This returns nil if the KMS provider is not used.
+func (nf *NodeFilter) KMSPluginStopped(targets []*cke.Node) (nodes []*cke.Node) {
+	if nf.cluster.Options.APIServer.Encryption.ProviderName() != cke.EncryptionProviderKMS {
+		return nil
+	}
+
+	for _, n := range targets {
+		if !nf.nodeStatus(n).KMSPlugin.Running {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// KMSPluginOutdated filters nodes that are running the KMS plugin with outdated image or params,
+// or with secret_id that needs to be renewed.
+// This returns nil if the KMS provider is not used.
+func (nf *NodeFilter) KMSPluginOutdated(targets []*cke.Node) (nodes []*cke.Node) {
+	if nf.cluster.Options.APIServer.Encryption.ProviderName() != cke.EncryptionProviderKMS {
+		return nil
+	}
+
+	currentBuiltIn := k8s.KMSPluginParams()
+	currentExtra := nf.cluster.Options.APIServer.Encryption.KMSPlugin
+	renewBefore := time.Now().Add(-cke.KMSSecretIDRenewAfter)
+
+	for _, n := range targets {
+		st := nf.nodeStatus(n).KMSPlugin
+		issued := nf.nodeStatus(n).KMSSecretIDIssued
+		switch {
+		case !st.Running:
+			// stopped nodes are excluded
+		case !issued.IsZero() && issued.Before(renewBefore):
+			fallthrough
+		case currentExtra.Image != st.Image:
+			fallthrough
+		case !currentBuiltIn.Equal(st.BuiltInParams):
+			fallthrough
+		case !currentExtra.ServiceParams.Equal(st.ExtraParams):
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// KMSPluginRunningUnexpectedly filters nodes that are running the KMS plugin
+// while the KMS provider is not used.
+func (nf *NodeFilter) KMSPluginRunningUnexpectedly(targets []*cke.Node) (nodes []*cke.Node) {
+	if nf.cluster.Options.APIServer.Encryption.ProviderName() == cke.EncryptionProviderKMS {
+		return nil
+	}
+
+	for _, n := range targets {
+		if nf.nodeStatus(n).KMSPlugin.Running {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
 // ControllerManagerStopped filters nodes that are not running controller manager.
 func (nf *NodeFilter) ControllerManagerStopped(targets []*cke.Node) (nodes []*cke.Node) {
 	for _, n := range targets {
@@ -414,8 +600,8 @@ func (nf *NodeFilter) ControllerManagerStopped(targets []*cke.Node) (nodes []*ck
 
 // ControllerManagerOutdated filters nodes that are running controller manager with outdated image or params.
 func (nf *NodeFilter) ControllerManagerOutdated(targets []*cke.Node) (nodes []*cke.Node) {
-	currentBuiltIn := k8s.ControllerManagerParams(nf.cluster.Name, nf.cluster.ServiceSubnet)
 	currentExtra := nf.cluster.Options.ControllerManager
+	currentBuiltIn := k8s.ControllerManagerParams(nf.cluster.Name, nf.cluster.ServiceSubnet, currentExtra)
 
 	for _, n := range targets {
 		st := nf.nodeStatus(n).ControllerManager
@@ -426,7 +612,7 @@ func (nf *NodeFilter) ControllerManagerOutdated(targets []*cke.Node) (nodes []*c
 			fallthrough
 		case !currentBuiltIn.Equal(st.BuiltInParams):
 			fallthrough
-		case !currentExtra.Equal(st.ExtraParams):
+		case !currentExtra.ServiceParams.Equal(st.ExtraParams):
 			nodes = append(nodes, n)
 		}
 	}
@@ -492,6 +678,26 @@ func (nf *NodeFilter) KubeletStopped(targets []*cke.Node) (nodes []*cke.Node) {
 	return nodes
 }
 
+// KubeletStaticPodDisabled filters nodes that are running kubelet without
+// reading static pod manifests.
+// This returns nil if the control plane does not run as static pods.
+func (nf *NodeFilter) KubeletStaticPodDisabled(targets []*cke.Node) (nodes []*cke.Node) {
+	if nf.cluster.ControlPlaneMode != cke.ControlPlaneModeStaticPod {
+		return nil
+	}
+
+	for _, n := range targets {
+		st := nf.nodeStatus(n).Kubelet
+		if !st.Running || st.Config == nil {
+			continue
+		}
+		if st.Config.StaticPodPath != cke.StaticPodManifestDir {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
 // RegisteredNodes filters nodes that are registered on Kubernetes out of targets.
 func (nf *NodeFilter) RegisteredNodes(targets []*cke.Node) (nodes []*cke.Node) {
 	registered := make(map[string]bool)
@@ -509,10 +715,9 @@ func (nf *NodeFilter) RegisteredNodes(targets []*cke.Node) (nodes []*cke.Node) {
 
 // KubeletOutdated filters nodes that are running kubelet with outdated image or params.
 func (nf *NodeFilter) KubeletOutdated(targets []*cke.Node) (nodes []*cke.Node) {
-	currentOpts := nf.cluster.Options.Kubelet
-	currentExtra := nf.cluster.Options.Kubelet.ServiceParams
-
 	for _, n := range targets {
+		currentOpts := nf.cluster.EffectiveKubeletParams().ForNode(n)
+		currentExtra := currentOpts.ServiceParams
 		st := nf.nodeStatus(n).Kubelet
 		currentConfig := k8s.GenerateKubeletConfiguration(currentOpts, n.Address, st.Config)
 		currentBuiltIn := k8s.KubeletServiceParams(n, currentOpts)
@@ -884,6 +1089,22 @@ func (nf *NodeFilter) SSHConnected(targets []*cke.Node) (nodes []*cke.Node) {
 	return nodes
 }
 
+// ContainerEngineOutdated filters nodes whose system containers run in
+// a container engine other than the one in the cluster configuration.
+func (nf *NodeFilter) ContainerEngineOutdated(targets []*cke.Node) (nodes []*cke.Node) {
+	engine := nf.cluster.ContainerEngineName()
+	for _, n := range targets {
+		st := nf.nodeStatus(n)
+		if !st.SSHConnected || st.ContainerEngine == "" {
+			continue
+		}
+		if st.ContainerEngine != engine {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
 // SSHNotCnnected filters nodes that cannot be connected to via SSH from targets.
 func (nf *NodeFilter) SSHNotConnected(targets []*cke.Node) (nodes []*cke.Node) {
 	for _, n := range targets {
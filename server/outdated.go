@@ -0,0 +1,67 @@
+package server
+
+import (
+	"github.com/cybozu-go/cke"
+)
+
+// OutdatedNodes represents nodes selected by one of "Outdated" predicates of NodeFilter.
+type OutdatedNodes struct {
+	Predicate string   `json:"predicate"`
+	Nodes     []string `json:"nodes"`
+}
+
+// outdatedPredicates are the predicates of NodeFilter evaluated by FindOutdatedNodes
+// except for OutdatedAttrsNodes.  name must be the method name of NodeFilter.
+var outdatedPredicates = []struct {
+	name  string
+	nodes func(nf *NodeFilter) []*cke.Node
+}{
+	{"ContainerEngineOutdated", func(nf *NodeFilter) []*cke.Node { return nf.ContainerEngineOutdated(nf.AllNodes()) }},
+	{"RiversOutdated", func(nf *NodeFilter) []*cke.Node { return nf.RiversOutdated(nf.AllNodes()) }},
+	{"EtcdRiversOutdated", func(nf *NodeFilter) []*cke.Node { return nf.EtcdRiversOutdated(nf.ControlPlaneNodes()) }},
+	{"EtcdOutdatedMembers", func(nf *NodeFilter) []*cke.Node { return nf.EtcdOutdatedMembers() }},
+	{"KMSPluginOutdated", func(nf *NodeFilter) []*cke.Node { return nf.KMSPluginOutdated(nf.ControlPlaneNodes()) }},
+	{"APIServerOutdated", func(nf *NodeFilter) []*cke.Node { return nf.APIServerOutdated(nf.ControlPlaneNodes()) }},
+	{"ControllerManagerOutdated", func(nf *NodeFilter) []*cke.Node { return nf.ControllerManagerOutdated(nf.ControlPlaneNodes()) }},
+	{"SchedulerOutdated", func(nf *NodeFilter) []*cke.Node {
+		return nf.SchedulerOutdated(nf.ControlPlaneNodes(), nf.cluster.Options.Scheduler)
+	}},
+	{"KubeletStaticPodDisabled", func(nf *NodeFilter) []*cke.Node { return nf.KubeletStaticPodDisabled(nf.ControlPlaneNodes()) }},
+	{"KubeletOutdated", func(nf *NodeFilter) []*cke.Node { return nf.KubeletOutdated(nf.AllNodes()) }},
+	{"ProxyOutdated", func(nf *NodeFilter) []*cke.Node { return nf.ProxyOutdated(nf.AllNodes(), nf.cluster.Options.Proxy) }},
+	{"CertificateOutdated", func(nf *NodeFilter) []*cke.Node {
+		return nf.CertificateOutdated(nf.AllNodes(), cke.AllCertificates...)
+	}},
+}
+
+// FindOutdatedNodes evaluates "Outdated" predicates of NodeFilter
+// for the cluster and its status, and returns non-empty results.
+//
+// Nodes are represented by their addresses, except for OutdatedAttrsNodes
+// which returns Kubernetes Node names.
+func FindOutdatedNodes(c *cke.Cluster, cs *cke.ClusterStatus) []OutdatedNodes {
+	nf := NewNodeFilter(c, cs)
+
+	var result []OutdatedNodes
+	for _, p := range outdatedPredicates {
+		nodes := p.nodes(nf)
+		if len(nodes) == 0 {
+			continue
+		}
+		addresses := make([]string, len(nodes))
+		for i, n := range nodes {
+			addresses[i] = n.Address
+		}
+		result = append(result, OutdatedNodes{Predicate: p.name, Nodes: addresses})
+	}
+
+	if kns := nf.OutdatedAttrsNodes(); len(kns) > 0 {
+		names := make([]string, len(kns))
+		for i, kn := range kns {
+			names[i] = kn.Name
+		}
+		result = append(result, OutdatedNodes{Predicate: "OutdatedAttrsNodes", Nodes: names})
+	}
+
+	return result
+}
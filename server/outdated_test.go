@@ -0,0 +1,107 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/cke"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFindOutdatedNodes(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Input    testData
+		Expected []OutdatedNodes
+	}{
+		{
+			Name:     "UpToDate",
+			Input:    newData().withK8sReady(),
+			Expected: nil,
+		},
+		{
+			Name: "APIServer",
+			Input: newData().withK8sReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.ExtraArguments = []string{"--v=5"}
+			}),
+			Expected: []OutdatedNodes{
+				{Predicate: "APIServerOutdated", Nodes: []string{nodeNames[0], nodeNames[1], nodeNames[2]}},
+			},
+		},
+		{
+			Name: "EtcdAndControllerManager",
+			Input: newData().withK8sReady().with(func(d testData) {
+				d.Cluster.Options.Etcd.ExtraArguments = []string{"--experimental-peer-skip-client-san-verification"}
+				d.Cluster.Options.ControllerManager.ExtraEnvvar = map[string]string{"env1": "val1"}
+			}),
+			Expected: []OutdatedNodes{
+				{Predicate: "EtcdOutdatedMembers", Nodes: []string{nodeNames[0], nodeNames[1], nodeNames[2]}},
+				{Predicate: "ControllerManagerOutdated", Nodes: []string{nodeNames[0], nodeNames[1], nodeNames[2]}},
+			},
+		},
+		{
+			Name: "NodeLabels",
+			Input: newData().withK8sReady().with(func(d testData) {
+				d.Cluster.Nodes[4].Labels = map[string]string{"foo": "bar"}
+			}),
+			Expected: []OutdatedNodes{
+				{Predicate: "OutdatedAttrsNodes", Nodes: []string{nodeNames[4]}},
+			},
+		},
+		{
+			Name: "ContainerEngine",
+			Input: newData().withK8sReady().with(func(d testData) {
+				d.Cluster.ContainerEngine = cke.ContainerEngineContainerd
+				d.NodeStatus(d.Cluster.Nodes[5]).ContainerEngine = cke.ContainerEngineDocker
+			}),
+			Expected: []OutdatedNodes{
+				{Predicate: "ContainerEngineOutdated", Nodes: []string{nodeNames[5]}},
+			},
+		},
+		{
+			Name: "Certificate",
+			Input: newData().withK8sReady().with(func(d testData) {
+				d.Cluster.CertRenewal.Enabled = true
+				d.NodeStatus(d.Cluster.Nodes[4]).Certificates = map[string]cke.CertificateStatus{
+					cke.CertKubelet: {
+						NotBefore: time.Now().Add(-365 * 24 * time.Hour),
+						NotAfter:  time.Now().Add(time.Hour),
+					},
+				}
+			}),
+			Expected: []OutdatedNodes{
+				{Predicate: "CertificateOutdated", Nodes: []string{nodeNames[4]}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			actual := FindOutdatedNodes(c.Input.Cluster, c.Input.Status)
+			if !cmp.Equal(c.Expected, actual) {
+				t.Errorf("unexpected result: %s", cmp.Diff(c.Expected, actual))
+			}
+		})
+	}
+}
+
+func TestOutdatedPredicates(t *testing.T) {
+	listed := map[string]bool{"OutdatedAttrsNodes": true}
+	for _, p := range outdatedPredicates {
+		listed[p.name] = true
+	}
+
+	typ := reflect.TypeOf(&NodeFilter{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		name := typ.Method(i).Name
+		if strings.Contains(name, "Outdated") && !listed[name] {
+			t.Errorf("%s is not evaluated by FindOutdatedNodes", name)
+		}
+		delete(listed, name)
+	}
+	for name := range listed {
+		t.Errorf("%s is not a method of NodeFilter", name)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+
+	"github.com/cybozu-go/cke"
+)
+
+// opsConflict returns true if two operators must not run concurrently.
+// Operators without targets conflict with any operator.
+func opsConflict(a, b cke.Operator) bool {
+	ta := a.Targets()
+	tb := b.Targets()
+	if len(ta) == 0 || len(tb) == 0 {
+		return true
+	}
+
+	targets := make(map[string]bool, len(ta))
+	for _, t := range ta {
+		targets[t] = true
+	}
+	for _, t := range tb {
+		if targets[t] {
+			return true
+		}
+	}
+	return false
+}
+
+type opResult struct {
+	index int
+	err   error
+}
+
+// runOps runs operators by calling run for each of them.
+//
+// Up to limit operators run concurrently.  An operator starts only after
+// all the preceding operators that conflict with it have finished, so the
+// order of operators on the same target is kept.
+//
+// Once an operator fails, no more operators are started.  runOps waits for
+// running operators to finish, then returns the error.  If there are multiple
+// errors, errors other than errCommandFailure take precedence.
+func runOps(ctx context.Context, ops []cke.Operator, limit int, run func(context.Context, cke.Operator) error) error {
+	if limit < 1 {
+		limit = 1
+	}
+
+	finished := make([]bool, len(ops))
+	started := make([]bool, len(ops))
+	resultCh := make(chan opResult)
+	running := 0
+	var firstErr error
+
+	canStart := func(i int) bool {
+		for j := 0; j < i; j++ {
+			if !finished[j] && opsConflict(ops[j], ops[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	next := 0 // the first operator that has not been started
+	for {
+		if firstErr == nil {
+			for i := next; i < len(ops) && running < limit; i++ {
+				if started[i] || !canStart(i) {
+					continue
+				}
+				started[i] = true
+				running++
+				go func(i int) {
+					resultCh <- opResult{index: i, err: run(ctx, ops[i])}
+				}(i)
+			}
+			for next < len(ops) && started[next] {
+				next++
+			}
+		}
+
+		if running == 0 {
+			return firstErr
+		}
+
+		res := <-resultCh
+		running--
+		finished[res.index] = true
+		if res.err != nil && (firstErr == nil || firstErr == errCommandFailure) {
+			firstErr = res.err
+		}
+	}
+}
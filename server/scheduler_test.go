@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/cke"
+)
+
+type testOp struct {
+	name    string
+	targets []string
+	err     error
+}
+
+func (o *testOp) Name() string {
+	return o.name
+}
+
+func (o *testOp) NextCommand() cke.Commander {
+	return nil
+}
+
+func (o *testOp) Targets() []string {
+	return o.targets
+}
+
+type opRecorder struct {
+	mu          sync.Mutex
+	running     map[string]bool
+	maxRunning  int
+	finished    []string
+	overlapping [][2]string
+}
+
+func (r *opRecorder) run(ctx context.Context, op cke.Operator) error {
+	r.mu.Lock()
+	for name := range r.running {
+		if name == op.Name() {
+			continue
+		}
+		r.overlapping = append(r.overlapping, [2]string{name, op.Name()})
+	}
+	r.running[op.Name()] = true
+	if len(r.running) > r.maxRunning {
+		r.maxRunning = len(r.running)
+	}
+	r.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	r.mu.Lock()
+	delete(r.running, op.Name())
+	r.finished = append(r.finished, op.Name())
+	r.mu.Unlock()
+	return op.(*testOp).err
+}
+
+func newOpRecorder() *opRecorder {
+	return &opRecorder{running: make(map[string]bool)}
+}
+
+func TestRunOps(t *testing.T) {
+	t.Run("Serial", func(t *testing.T) {
+		ops := []cke.Operator{
+			&testOp{name: "a", targets: []string{"n1"}},
+			&testOp{name: "b", targets: []string{"n2"}},
+			&testOp{name: "c", targets: []string{"n3"}},
+		}
+		r := newOpRecorder()
+		err := runOps(context.Background(), ops, 1, r.run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.maxRunning != 1 {
+			t.Error("operations ran concurrently", r.maxRunning)
+		}
+		if len(r.finished) != 3 || r.finished[0] != "a" || r.finished[1] != "b" || r.finished[2] != "c" {
+			t.Error("unexpected order", r.finished)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		ops := []cke.Operator{
+			&testOp{name: "a", targets: []string{"n1"}},
+			&testOp{name: "b", targets: []string{"n2"}},
+			&testOp{name: "c", targets: []string{"n1", "n3"}},
+			&testOp{name: "d", targets: []string{"n4"}},
+			&testOp{name: "e"},
+		}
+		r := newOpRecorder()
+		err := runOps(context.Background(), ops, 10, r.run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.finished) != 5 {
+			t.Fatal("not all operations finished", r.finished)
+		}
+		if r.maxRunning != 3 {
+			t.Error("unexpected concurrency", r.maxRunning)
+		}
+		for _, pair := range r.overlapping {
+			switch {
+			case pair[0] == "a" && pair[1] == "c", pair[0] == "c" && pair[1] == "a":
+				t.Error("conflicting operations ran concurrently", pair)
+			case pair[0] == "e" || pair[1] == "e":
+				t.Error("operation without targets ran concurrently", pair)
+			}
+		}
+		if r.finished[4] != "e" {
+			t.Error("operation without targets should run last", r.finished)
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		ops := []cke.Operator{
+			&testOp{name: "a", targets: []string{"n1"}},
+			&testOp{name: "b", targets: []string{"n2"}},
+			&testOp{name: "c", targets: []string{"n3"}},
+			&testOp{name: "d", targets: []string{"n4"}},
+		}
+		r := newOpRecorder()
+		err := runOps(context.Background(), ops, 2, r.run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.maxRunning != 2 {
+			t.Error("unexpected concurrency", r.maxRunning)
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		fatal := errors.New("fatal")
+		ops := []cke.Operator{
+			&testOp{name: "a", targets: []string{"n1"}, err: errCommandFailure},
+			&testOp{name: "b", targets: []string{"n2"}, err: fatal},
+			&testOp{name: "c", targets: []string{"n1"}},
+			&testOp{name: "d", targets: []string{"n3"}},
+		}
+		r := newOpRecorder()
+		err := runOps(context.Background(), ops, 2, r.run)
+		if err != fatal {
+			t.Error("unexpected error", err)
+		}
+		if len(r.finished) != 2 {
+			t.Error("operations should not start after failure", r.finished)
+		}
+
+		r = newOpRecorder()
+		err = runOps(context.Background(), ops[:1], 2, r.run)
+		if err != errCommandFailure {
+			t.Error("unexpected error", err)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cybozu-go/cke"
@@ -14,6 +15,9 @@ import (
 type Server struct {
 	EtcdClient *clientv3.Client
 	Timeout    time.Duration
+	// APIToken is the bearer token required to access /api/v1/ endpoints.
+	// If empty, the endpoints are disabled.
+	APIToken string
 }
 
 type version struct {
@@ -29,6 +33,8 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.handleVersion(w, r)
 	} else if r.Method == http.MethodGet && r.URL.Path == "/health" {
 		s.handleHealth(w, r)
+	} else if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		s.handleAPI(w, r)
 	} else {
 		renderError(r.Context(), w, APIErrNotFound)
 	}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/cybozu-go/cke"
+)
+
+// ServiceSummary is a summary of a service running on a node.
+type ServiceSummary struct {
+	Running bool   `json:"running"`
+	Healthy bool   `json:"healthy"`
+	Image   string `json:"image,omitempty"`
+}
+
+// NodeSummary is a summary of the status of a node.
+type NodeSummary struct {
+	Address      string                    `json:"address"`
+	Hostname     string                    `json:"hostname,omitempty"`
+	ControlPlane bool                      `json:"control_plane"`
+	SSHConnected bool                      `json:"ssh_connected"`
+	Services     map[string]ServiceSummary `json:"services"`
+}
+
+func serviceSummary(ss cke.ServiceStatus, healthy bool) ServiceSummary {
+	return ServiceSummary{
+		Running: ss.Running,
+		Healthy: ss.Running && healthy,
+		Image:   ss.Image,
+	}
+}
+
+// summarizeNodes creates NodeSummary for each node in the cluster.
+func summarizeNodes(cluster *cke.Cluster, cs *cke.ClusterStatus) []*NodeSummary {
+	summaries := make([]*NodeSummary, 0, len(cluster.Nodes))
+	for _, n := range cluster.Nodes {
+		ns, ok := cs.NodeStatuses[n.Address]
+		if !ok {
+			continue
+		}
+		summaries = append(summaries, &NodeSummary{
+			Address:      n.Address,
+			Hostname:     n.Hostname,
+			ControlPlane: n.ControlPlane,
+			SSHConnected: ns.SSHConnected,
+			Services: map[string]ServiceSummary{
+				"etcd":                    serviceSummary(ns.Etcd.ServiceStatus, ns.Etcd.IsAddedMember),
+				"rivers":                  serviceSummary(ns.Rivers, true),
+				"etcd-rivers":             serviceSummary(ns.EtcdRivers, true),
+				"kube-apiserver":          serviceSummary(ns.APIServer.ServiceStatus, ns.APIServer.IsHealthy),
+				"kube-controller-manager": serviceSummary(ns.ControllerManager.ServiceStatus, ns.ControllerManager.IsHealthy),
+				"kube-scheduler":          serviceSummary(ns.Scheduler.ServiceStatus, ns.Scheduler.IsHealthy),
+				"kube-proxy":              serviceSummary(ns.Proxy.ServiceStatus, ns.Proxy.IsHealthy),
+				"kubelet":                 serviceSummary(ns.Kubelet.ServiceStatus, ns.Kubelet.IsHealthy),
+			},
+		})
+	}
+	return summaries
+}
+
+// leaderState keeps the latest results of the main loop of the leader.
+type leaderState struct {
+	mu          sync.RWMutex
+	leader      bool
+	status      *cke.ServerStatus
+	nodes       []*NodeSummary
+	rebootQueue []*cke.RebootQueueEntry
+	repairQueue []*cke.RepairQueueEntry
+}
+
+var state = &leaderState{}
+
+func (s *leaderState) setLeader(leader bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.leader = leader
+	if !leader {
+		s.status = nil
+		s.nodes = nil
+		s.rebootQueue = nil
+		s.repairQueue = nil
+	}
+}
+
+func (s *leaderState) isLeader() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leader
+}
+
+func (s *leaderState) update(st *cke.ServerStatus, cluster *cke.Cluster, cs *cke.ClusterStatus) {
+	nodes := summarizeNodes(cluster, cs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = st
+	s.nodes = nodes
+	s.rebootQueue = cs.RebootQueue.Entries
+	s.repairQueue = cs.RepairQueue.Entries
+}
+
+func (s *leaderState) getStatus() *cke.ServerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+func (s *leaderState) getNodes() []*NodeSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodes
+}
+
+func (s *leaderState) getRebootQueue() []*cke.RebootQueueEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rebootQueue
+}
+
+func (s *leaderState) getRepairQueue() []*cke.RepairQueueEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.repairQueue
+}
@@ -23,7 +23,14 @@ import (
 func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constraints, resources []cke.ResourceDefinition, config *Config) ([]cke.Operator, cke.OperationPhase) {
 	nf := NewNodeFilter(c, cs)
 
-	// 0. Execute upgrade operation if necessary
+	// 0. Restore etcd cluster from a snapshot, if requested.
+	// This is decided first because the restoration runs under the freeze
+	// that blocks all other phases.
+	if cs.EtcdRestore != nil {
+		return etcdRestoreOps(c, cs.EtcdRestore, nf)
+	}
+
+	// 1. Execute upgrade operation if necessary
 	if cs.ConfigVersion != cke.ConfigVersion {
 		// Upgrade operations run only when all CPs are SSH reachable
 		if len(nf.SSHNotConnected(nf.ControlPlaneNodes())) > 0 {
@@ -33,14 +40,14 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 		return []cke.Operator{op.UpgradeOp(cs.ConfigVersion, nf.ControlPlaneNodes())}, cke.PhaseUpgrade
 	}
 
-	// 1. Run or restart rivers.  This guarantees:
+	// 2. Run or restart rivers.  This guarantees:
 	// - CKE tools image is pulled on all nodes.
 	// - Rivers runs on all nodes and will proxy requests only to control plane nodes.
 	if ops := riversOps(c, nf, config.MaxConcurrentUpdates); len(ops) > 0 {
 		return ops, cke.PhaseRivers
 	}
 
-	// 2. Bootstrap etcd cluster, if not yet.
+	// 3. Bootstrap etcd cluster, if not yet.
 	if !nf.EtcdBootstrapped() {
 		// Etcd boot operations run only when all CPs are SSH reachable
 		if len(nf.SSHNotConnected(nf.ControlPlaneNodes())) > 0 {
@@ -50,44 +57,49 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 		return []cke.Operator{etcd.BootOp(nf.ControlPlaneNodes(), c.Options.Etcd)}, cke.PhaseEtcdBoot
 	}
 
-	// 3. Start etcd containers.
+	// 4. Start etcd containers.
 	if nodes := nf.SSHConnected(nf.EtcdStopped(nf.ControlPlaneNodes())); len(nodes) > 0 {
 		return []cke.Operator{etcd.StartOp(nodes, c.Options.Etcd)}, cke.PhaseEtcdStart
 	}
 
-	// 4. Wait for etcd cluster to become ready
+	// 5. Wait for etcd cluster to become ready
 	if !cs.Etcd.IsHealthy {
 		return []cke.Operator{etcd.WaitClusterOp(nf.ControlPlaneNodes())}, cke.PhaseEtcdWait
 	}
 
-	// 5. Run or restart kubernetes components.
+	// 6. Run or restart kubernetes components.
 	if ops := k8sOps(c, nf, cs, config.MaxConcurrentUpdates); len(ops) > 0 {
 		return ops, cke.PhaseK8sStart
 	}
 
-	// 6. Maintain etcd cluster, only when all CPs are SSH reachable.
+	// 7. Migrate system containers to the configured container engine one node at a time.
+	if o := engineMigrationOp(c, nf); o != nil {
+		return []cke.Operator{o}, cke.PhaseEngineMigration
+	}
+
+	// 8. Maintain etcd cluster, only when all CPs are SSH reachable.
 	if len(nf.SSHNotConnected(nf.ControlPlaneNodes())) == 0 {
 		if o := etcdMaintOp(c, nf); o != nil {
 			return []cke.Operator{o}, cke.PhaseEtcdMaintain
 		}
 	}
 
-	// 7. Maintain k8s resources.
+	// 9. Maintain k8s resources.
 	if ops := k8sMaintOps(c, cs, resources, nf); len(ops) > 0 {
 		return ops, cke.PhaseK8sMaintain
 	}
 
-	// 8. Stop and delete control plane services running on non control plane nodes.
+	// 10. Stop and delete control plane services running on non control plane nodes.
 	if ops := cleanOps(c, nf); len(ops) > 0 {
 		return ops, cke.PhaseStopCP
 	}
 
-	// 9. Uncordon nodes if nodes are cordoned by CKE.
+	// 11. Uncordon nodes if nodes are cordoned by CKE.
 	if o := rebootUncordonOp(cs, nf); o != nil {
 		return []cke.Operator{o}, cke.PhaseUncordonNodes
 	}
 
-	// 10. Repair machines if repair requests have been arrived to the repair queue, and the number of unreachable nodes is less than a threshold.
+	// 12. Repair machines if repair requests have been arrived to the repair queue, and the number of unreachable nodes is less than a threshold.
 	if ops, phaseRepair := repairOps(c, cs, constraints, nf); phaseRepair {
 		if !nf.EtcdIsGoodForRepair(constraints.ControlPlaneCount) {
 			log.Warn("cannot repair machines because etcd cluster is not responding, is out of sync without a control plane failure, or the control plane is degraded by more than one node", nil)
@@ -96,7 +108,7 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 		return ops, cke.PhaseRepairMachines
 	}
 
-	// 11. Reboot nodes if reboot request has been arrived to the reboot queue, and the number of unreachable nodes is less than a threshold.
+	// 13. Reboot nodes if reboot request has been arrived to the reboot queue, and the number of unreachable nodes is less than a threshold.
 	if ops := rebootOps(c, cs, constraints, nf); len(ops) > 0 {
 		if !nf.EtcdIsGood() {
 			log.Warn("cannot reboot nodes because etcd cluster is not responding and in-sync", nil)
@@ -108,6 +120,20 @@ func DecideOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 	return nil, cke.PhaseCompleted
 }
 
+func engineMigrationOp(c *cke.Cluster, nf *NodeFilter) cke.Operator {
+	nodes := nf.ContainerEngineOutdated(nf.AllNodes())
+	if len(nodes) == 0 {
+		return nil
+	}
+	// Migration stops etcd on a control plane node, so it waits for the
+	// previously migrated node to rejoin the etcd cluster.
+	if len(nf.SSHNotConnected(nf.ControlPlaneNodes())) > 0 || !nf.EtcdIsGood() {
+		log.Warn("cannot migrate container engine until etcd is good", nil)
+		return nil
+	}
+	return op.EngineMigrationOp(nodes[0], c.Options.Etcd)
+}
+
 func riversOps(c *cke.Cluster, nf *NodeFilter, maxConcurrentUpdates int) (ops []cke.Operator) {
 	if nodes := nf.SSHConnected(nf.RiversStopped(nf.AllNodes())); len(nodes) > 0 {
 		max := maxConcurrentUpdates
@@ -154,7 +180,7 @@ func apiserverOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus) (ops []
 			ops = append(ops, masterEndpointOps(c, cs, nf, nil)...)
 		}
 		kubeletConfig := k8s.GenerateKubeletConfiguration(c.Options.Kubelet, "0.0.0.0", nil)
-		ops = append(ops, k8s.APIServerRestartOp(nodes, c.ServiceSubnet, c.Options.APIServer, kubeletConfig.ClusterDomain))
+		ops = append(ops, k8s.APIServerRestartOp(nodes, c.ServiceSubnet, c.Options.APIServer, kubeletConfig.ClusterDomain, cs.Encryption.ConfigHash))
 	}
 	if len(ops) > 0 {
 		return ops, true
@@ -174,11 +200,14 @@ func apiserverOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus) (ops []
 	}
 
 	// Updating kube-apiservers one by one.
-	if nodes := nf.SSHConnected(nf.APIServerOutdated(nf.ControlPlaneNodes())); len(nodes) > 0 {
+	// kube-apiservers are also restarted one by one to reissue their certificates.
+	nodes = nf.SSHConnected(nf.APIServerOutdated(nf.ControlPlaneNodes()))
+	nodes = append(nodes, nf.SSHConnected(nf.CertificateOutdated(nf.ControlPlaneNodes(), apiserverCertificates...))...)
+	if len(nodes) > 0 {
 		target := nodes[0] // just one
 		ops = append(ops, masterEndpointOps(c, cs, nf, []string{target.Address})...)
 		kubeletConfig := k8s.GenerateKubeletConfiguration(c.Options.Kubelet, "0.0.0.0", nil)
-		ops = append(ops, k8s.APIServerRestartOp([]*cke.Node{target}, c.ServiceSubnet, c.Options.APIServer, kubeletConfig.ClusterDomain))
+		ops = append(ops, k8s.APIServerRestartOp([]*cke.Node{target}, c.ServiceSubnet, c.Options.APIServer, kubeletConfig.ClusterDomain, cs.Encryption.ConfigHash))
 		return ops, true
 	}
 
@@ -188,25 +217,70 @@ func apiserverOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus) (ops []
 	return ops, false
 }
 
+var apiserverCertificates = []string{cke.CertAPIServer, cke.CertAPIServerEtcdClient, cke.CertAggregation}
+
+func kmsPluginOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
+	params := c.Options.APIServer.Encryption.KMSPlugin
+	if nodes := nf.SSHConnected(nf.KMSPluginStopped(nf.ControlPlaneNodes())); len(nodes) > 0 {
+		ops = append(ops, k8s.KMSPluginRestartOp(nodes, params))
+	}
+	// Restart outdated plugins one by one so that API servers can encrypt and decrypt data.
+	if nodes := nf.SSHConnected(nf.KMSPluginOutdated(nf.ControlPlaneNodes())); len(nodes) > 0 {
+		ops = append(ops, k8s.KMSPluginRestartOp(nodes[:1], params))
+	}
+	return ops
+}
+
 func k8sOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus, maxConcurrentUpdates int) (ops []cke.Operator) {
+	// The KMS plugin should be running before kube-apiserver starts.
+	if ops := kmsPluginOps(c, nf); len(ops) > 0 {
+		return ops
+	}
+
+	// When the control plane runs as static pods, kubelet should be running
+	// on control plane nodes before kube-apiserver starts.
+	if c.ControlPlaneMode == cke.ControlPlaneModeStaticPod {
+		if nodes := nf.SSHConnected(nf.KubeletStopped(nf.ControlPlaneNodes())); len(nodes) > 0 {
+			apiServer := nf.HealthyAPIServer()
+			var registered []*cke.Node
+			if apiServer != nil {
+				registered = nf.RegisteredNodes(nodes)
+			}
+			return []cke.Operator{k8s.KubeletBootOp(nodes, registered, apiServer, c.Name, c.EffectiveKubeletParams(), cs.NodeStatuses)}
+		}
+		// Kubelet not reading static pod manifests is restarted even if in-place update is disabled.
+		if nodes := nf.SSHConnected(nf.KubeletStaticPodDisabled(nf.ControlPlaneNodes())); len(nodes) > 0 {
+			return []cke.Operator{k8s.KubeletRestartOp(nodes, c.Name, c.EffectiveKubeletParams(), cs.NodeStatuses)}
+		}
+	}
+
 	apiserverOps, skipOtherOps := apiserverOps(c, nf, cs)
 	if skipOtherOps {
 		return apiserverOps
 	}
 	ops = append(ops, apiserverOps...)
 
+	// kube-apiserver reloads the renewed certificate without restarting.
+	if nodes := nf.SSHConnected(nf.CertificateRenewalDue(nf.ControlPlaneNodes(), cke.CertAuditWebhook)); len(nodes) > 0 {
+		ops = append(ops, k8s.AuditWebhookCertRenewOp(nodes))
+	}
+
 	// Other CP components
 	if nodes := nf.SSHConnected(nf.ControllerManagerStopped(nf.ControlPlaneNodes())); len(nodes) > 0 {
 		ops = append(ops, k8s.ControllerManagerBootOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager))
 	}
 	if nodes := nf.SSHConnected(nf.ControllerManagerOutdated(nf.ControlPlaneNodes())); len(nodes) > 0 {
 		ops = append(ops, k8s.ControllerManagerRestartOp(nodes, c.Name, c.ServiceSubnet, c.Options.ControllerManager))
+	} else if nodes := nf.SSHConnected(nf.CertificateOutdated(nf.ControlPlaneNodes(), cke.CertControllerManager)); len(nodes) > 0 {
+		ops = append(ops, k8s.ControllerManagerRestartOp(nodes[:1], c.Name, c.ServiceSubnet, c.Options.ControllerManager))
 	}
 	if nodes := nf.SSHConnected(nf.SchedulerStopped(nf.ControlPlaneNodes())); len(nodes) > 0 {
 		ops = append(ops, k8s.SchedulerBootOp(nodes, c.Name, c.Options.Scheduler))
 	}
 	if nodes := nf.SSHConnected(nf.SchedulerOutdated(nf.ControlPlaneNodes(), c.Options.Scheduler)); len(nodes) > 0 {
 		ops = append(ops, k8s.SchedulerRestartOp(nodes, c.Name, c.Options.Scheduler))
+	} else if nodes := nf.SSHConnected(nf.CertificateOutdated(nf.ControlPlaneNodes(), cke.CertScheduler)); len(nodes) > 0 {
+		ops = append(ops, k8s.SchedulerRestartOp(nodes[:1], c.Name, c.Options.Scheduler))
 	}
 
 	// For all nodes
@@ -216,21 +290,33 @@ func k8sOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus, maxConcurrent
 		if len(nodes) < max {
 			max = len(nodes)
 		}
-		ops = append(ops, k8s.KubeletRestartOp(nodes[:max], c.Name, c.Options.Kubelet, cs.NodeStatuses))
+		ops = append(ops, k8s.KubeletRestartOp(nodes[:max], c.Name, c.EffectiveKubeletParams(), cs.NodeStatuses))
 	}
 	if nodes := nf.SSHConnected(nf.KubeletStopped(nf.AllNodes())); len(nodes) > 0 {
 		max := maxConcurrentUpdates
 		if len(nodes) < max {
 			max = len(nodes)
 		}
-		ops = append(ops, k8s.KubeletBootOp(nodes[:max], nf.RegisteredNodes(nodes[:max]), apiServer, c.Name, c.Options.Kubelet, cs.NodeStatuses))
+		ops = append(ops, k8s.KubeletBootOp(nodes[:max], nf.RegisteredNodes(nodes[:max]), apiServer, c.Name, c.EffectiveKubeletParams(), cs.NodeStatuses))
 	}
 	if nodes := nf.SSHConnected(nf.KubeletOutdated(nf.AllNodes())); len(nodes) > 0 && c.Options.Kubelet.InPlaceUpdate {
 		max := maxConcurrentUpdates
 		if len(nodes) < max {
 			max = len(nodes)
 		}
-		ops = append(ops, k8s.KubeletRestartOp(nodes[:max], c.Name, c.Options.Kubelet, cs.NodeStatuses))
+		ops = append(ops, k8s.KubeletRestartOp(nodes[:max], c.Name, c.EffectiveKubeletParams(), cs.NodeStatuses))
+	} else if nodes := nf.SSHConnected(nf.CertificateOutdated(nf.AllNodes(), cke.CertKubelet)); len(nodes) > 0 {
+		// Reissue certificates even if in-place update is disabled, as expired or untrusted certificates break the node.
+		// Outdated kubelet is restarted with the running configuration to keep it as is.
+		max := maxConcurrentUpdates
+		if len(nodes) < max {
+			max = len(nodes)
+		}
+		if outdated := nf.KubeletOutdated(nodes[:max]); len(outdated) > 0 {
+			ops = append(ops, k8s.KubeletCertRenewOp(outdated, c.Name, cs.NodeStatuses))
+		} else {
+			ops = append(ops, k8s.KubeletRestartOp(nodes[:max], c.Name, c.EffectiveKubeletParams(), cs.NodeStatuses))
+		}
 	}
 	if nodes := nf.SSHConnected(nf.ProxyStopped(nf.AllNodes())); len(nodes) > 0 {
 		max := maxConcurrentUpdates
@@ -245,6 +331,12 @@ func k8sOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus, maxConcurrent
 			max = len(nodes)
 		}
 		ops = append(ops, k8s.KubeProxyRestartOp(nodes[:max], c.Name, "", c.Options.Proxy))
+	} else if nodes := nf.SSHConnected(nf.CertificateOutdated(nf.AllNodes(), cke.CertProxy)); len(nodes) > 0 {
+		max := maxConcurrentUpdates
+		if len(nodes) < max {
+			max = len(nodes)
+		}
+		ops = append(ops, k8s.KubeProxyRestartOp(nodes[:max], c.Name, "", c.Options.Proxy))
 	}
 	if nodes := nf.SSHConnected(nf.ProxyRunningUnexpectedly(nf.AllNodes())); len(nodes) > 0 {
 		max := maxConcurrentUpdates
@@ -256,6 +348,54 @@ func k8sOps(c *cke.Cluster, nf *NodeFilter, cs *cke.ClusterStatus, maxConcurrent
 	return ops
 }
 
+// etcdRestoreOps first removes etcd data on SSH-reachable control planes,
+// then restores the snapshot on the requested node.
+// The snapshot is not restored until all control planes are reachable and
+// their data are removed, because unreachable control planes would keep
+// running etcd with the old data.
+func etcdRestoreOps(c *cke.Cluster, r *cke.EtcdRestore, nf *NodeFilter) ([]cke.Operator, cke.OperationPhase) {
+	var target *cke.Node
+	for _, n := range nf.ControlPlaneNodes() {
+		if n.Address == r.Node {
+			target = n
+			break
+		}
+	}
+	if target == nil {
+		log.Warn("cannot restore etcd on a non control plane node", map[string]interface{}{
+			"node": r.Node,
+		})
+		return nil, cke.PhaseEtcdRestoreAborted
+	}
+	if !nf.nodeStatus(target).SSHConnected {
+		log.Warn("cannot restore etcd on an unreachable node", map[string]interface{}{
+			"node": r.Node,
+		})
+		return nil, cke.PhaseEtcdRestoreAborted
+	}
+
+	var dirty []*cke.Node
+	for _, n := range nf.SSHConnected(nf.ControlPlaneNodes()) {
+		st := nf.nodeStatus(n)
+		if st.Etcd.Running || st.Etcd.HasData || st.Etcd.IsAddedMember || st.APIServer.Running {
+			dirty = append(dirty, n)
+		}
+	}
+	if len(dirty) > 0 {
+		return []cke.Operator{etcd.RestorePrepareOp(dirty, c.Options.Etcd)}, cke.PhaseEtcdRestore
+	}
+
+	for _, n := range nf.ControlPlaneNodes() {
+		if !nf.nodeStatus(n).SSHConnected {
+			log.Warn("cannot restore etcd until all control planes are reachable", map[string]interface{}{
+				"node": n.Address,
+			})
+			return nil, cke.PhaseEtcdRestoreAborted
+		}
+	}
+	return []cke.Operator{etcd.RestoreOp(target, c.Options.Etcd, r)}, cke.PhaseEtcdRestore
+}
+
 func etcdMaintOp(c *cke.Cluster, nf *NodeFilter) cke.Operator {
 	// this function is called only when all the CPs are reachable.
 	// so, filtering by SSHConnected() is not required.
@@ -269,6 +409,9 @@ func etcdMaintOp(c *cke.Cluster, nf *NodeFilter) cke.Operator {
 	if nodes := nf.EtcdUnstartedMembers(); len(nodes) > 0 {
 		return etcd.AddMemberOp(nf.ControlPlaneNodes(), nodes[0], c.Options.Etcd)
 	}
+	if nodes := nf.EtcdLearnerMembers(); len(nodes) > 0 {
+		return etcd.PromoteMemberOp(nf.ControlPlaneNodes(), nodes[0])
+	}
 	if nodes := nf.EtcdUnmarkedMembers(); len(nodes) > 0 {
 		return etcd.MarkMemberOp(nodes)
 	}
@@ -294,6 +437,12 @@ func etcdMaintOp(c *cke.Cluster, nf *NodeFilter) cke.Operator {
 	if nodes := nf.EtcdOutdatedMembers(); len(nodes) > 0 {
 		return etcd.RestartOp(nf.ControlPlaneNodes(), nodes[0], c.Options.Etcd)
 	}
+	if nodes := nf.CertificateOutdated(nf.ControlPlaneNodes(), cke.CertEtcdServer, cke.CertEtcdPeer); len(nodes) > 0 {
+		return etcd.RestartOp(nf.ControlPlaneNodes(), nodes[0], c.Options.Etcd)
+	}
+	if nodes := nf.EtcdFragmentedMembers(); len(nodes) > 0 {
+		return etcd.DefragOp(nf.ControlPlaneNodes(), nodes[0])
+	}
 
 	return nil
 }
@@ -306,6 +455,23 @@ func k8sMaintOps(c *cke.Cluster, cs *cke.ClusterStatus, resources []cke.Resource
 		return []cke.Operator{op.KubeWaitOp(apiServer)}
 	}
 
+	// Advance the encryption key rotation after all API servers are restarted
+	// with the current configuration.  API servers on unreachable nodes may not
+	// have been restarted.
+	if r := cs.Encryption.Rotation; r != nil && len(nf.SSHNotConnected(nf.ControlPlaneNodes())) == 0 {
+		if len(nf.APIServerOutdated(nf.ControlPlaneNodes())) == 0 {
+			ops = append(ops, k8s.EncryptionKeyRotationOp(apiServer, r))
+		}
+	}
+
+	// Advance the CA rotation after all components are restarted in the current phase.
+	// Components on unreachable nodes may not have been restarted.
+	if r := cs.CARotation; r != nil && r.PhaseElapsed(time.Now()) && len(nf.SSHNotConnected(nf.AllNodes())) == 0 {
+		if len(nf.CARotationPending(nf.AllNodes(), r.Certificates()...)) == 0 {
+			ops = append(ops, op.CARotationOp(apiServer, r, c.TrustedRESTMappings))
+		}
+	}
+
 	ops = append(ops, decideResourceOps(apiServer, c.TrustedRESTMappings, ks, resources, ks.IsReady(c))...)
 
 	ops = append(ops, decideClusterDNSOps(apiServer, c, ks)...)
@@ -682,7 +848,7 @@ func decideResourceOps(apiServer *cke.Node, trustedMappings []cke.TrustedRESTMap
 }
 
 func cleanOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
-	var apiServers, controllerManagers, schedulers, etcds, etcdRivers []*cke.Node
+	var apiServers, controllerManagers, schedulers, etcds, etcdRivers, kmsPlugins []*cke.Node
 
 	for _, n := range c.Nodes {
 		if !nf.status.NodeStatuses[n.Address].SSHConnected || n.ControlPlane {
@@ -705,7 +871,11 @@ func cleanOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
 		if st.EtcdRivers.Running {
 			etcdRivers = append(etcdRivers, n)
 		}
+		if st.KMSPlugin.Running {
+			kmsPlugins = append(kmsPlugins, n)
+		}
 	}
+	kmsPlugins = append(kmsPlugins, nf.SSHConnected(nf.KMSPluginRunningUnexpectedly(nf.ControlPlaneNodes()))...)
 
 	if len(apiServers) > 0 {
 		ops = append(ops, op.APIServerStopOp(apiServers))
@@ -722,6 +892,9 @@ func cleanOps(c *cke.Cluster, nf *NodeFilter) (ops []cke.Operator) {
 	if len(etcdRivers) > 0 {
 		ops = append(ops, op.EtcdRiversStopOp(etcdRivers))
 	}
+	if len(kmsPlugins) > 0 {
+		ops = append(ops, op.KMSPluginStopOp(kmsPlugins))
+	}
 	return ops
 }
 
@@ -868,7 +1041,7 @@ func repairOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 				continue
 			}
 			// DrainBackOffExpire has been confirmed, so start drain now.
-			ops = append(ops, op.RepairDrainStartOp(nf.HealthyAPIServer(), entry, &c.Repair))
+			ops = append(ops, op.RepairDrainStartOp(nf.HealthyAPIServer(), nf.ControlPlaneNodes(), entry, &c.Repair))
 		case cke.RepairStepStatusDraining:
 			if !rqs.Enabled {
 				ops = append(ops, op.RepairDrainTimeoutOp(entry))
@@ -929,7 +1102,7 @@ func rebootOps(c *cke.Cluster, cs *cke.ClusterStatus, constraints *cke.Constrain
 	if len(cs.RebootQueue.DrainCompleted) > 0 {
 		// After eviction of normal pods, evict "OnDelete" daemonset pods.
 		ops = append(ops, op.RebootDeleteDaemonSetPodOp(nf.HealthyAPIServer(), cs.RebootQueue.DrainCompleted, &c.Reboot))
-		ops = append(ops, op.RebootRebootOp(nf.HealthyAPIServer(), cs.RebootQueue.DrainCompleted, &c.Reboot))
+		ops = append(ops, op.RebootRebootOp(nf.HealthyAPIServer(), nf.ControlPlaneNodes(), cs.RebootQueue.DrainCompleted, &c.Reboot))
 	}
 	if len(cs.RebootQueue.NextCandidates) > 0 {
 		allNodes := nf.AllNodes()
@@ -261,13 +261,95 @@ func (d testData) withHealthyEtcd() testData {
 	return d
 }
 
+func (d testData) withEtcdDefrag() testData {
+	d.Cluster.Options.Etcd.Defrag.FragmentationThreshold = 0.5
+	st := &d.Status.Etcd
+	st.MemberStatuses = make(map[string]*cke.EtcdMemberStatus)
+	for i, n := range d.ControlPlane() {
+		st.MemberStatuses[n.Address] = &cke.EtcdMemberStatus{
+			DBSize:      500 << 20,
+			DBSizeInUse: 400 << 20,
+			IsLeader:    i == 0,
+		}
+	}
+	return d
+}
+
 func (d testData) withAPIServer(serviceSubnet, domain string) testData {
 	for _, n := range d.ControlPlane() {
 		st := &d.NodeStatus(n).APIServer
 		st.Running = true
 		st.IsHealthy = true
 		st.Image = cke.KubernetesImage.Name()
-		st.BuiltInParams = k8s.APIServerParams(n.Address, serviceSubnet, false, "", "", domain)
+		st.BuiltInParams = k8s.APIServerParams(n.Address, serviceSubnet, cke.APIServerParams{}, domain, "")
+	}
+	return d
+}
+
+func (d testData) withAuditWebhook(certExpiry time.Time) testData {
+	d.Cluster.Options.APIServer.AuditLogPolicy = "apiVersion: audit.k8s.io/v1\nkind: Policy\n"
+	d.Cluster.Options.APIServer.AuditWebhook = cke.AuditWebhookParams{
+		Enabled: true,
+		Server:  "https://audit.example.com/events",
+	}
+	for _, n := range d.ControlPlane() {
+		st := d.NodeStatus(n)
+		st.APIServer.BuiltInParams = k8s.APIServerParams(n.Address, testServiceSubnet, d.Cluster.Options.APIServer, testDefaultDNSDomain, "")
+		if st.Certificates == nil {
+			st.Certificates = make(map[string]cke.CertificateStatus)
+		}
+		st.Certificates[cke.CertAuditWebhook] = cke.CertificateStatus{
+			NotBefore: certExpiry.Add(-cke.AuditWebhookCertTTL),
+			NotAfter:  certExpiry,
+		}
+	}
+	return d
+}
+
+func (d testData) withCertRenewal(notBefore, notAfter time.Time) testData {
+	d.Cluster.CertRenewal.Enabled = true
+	return d.withCertificates(notBefore, notAfter)
+}
+
+func (d testData) withCertificates(notBefore, notAfter time.Time) testData {
+	cert := cke.CertificateStatus{NotBefore: notBefore, NotAfter: notAfter}
+	for _, n := range d.Cluster.Nodes {
+		st := d.NodeStatus(n)
+		st.Certificates = map[string]cke.CertificateStatus{
+			cke.CertKubelet: cert,
+			cke.CertProxy:   cert,
+		}
+		if n.ControlPlane {
+			for _, name := range []string{cke.CertEtcdServer, cke.CertEtcdPeer, cke.CertAPIServer, cke.CertAPIServerEtcdClient,
+				cke.CertAggregation, cke.CertControllerManager, cke.CertScheduler} {
+				st.Certificates[name] = cert
+			}
+		}
+	}
+	return d
+}
+
+func (d testData) withCARotation(name string, phase cke.CARotationPhase, phaseStarted time.Time) testData {
+	d.Status.CARotation = &cke.CARotation{
+		Name:         name,
+		Phase:        phase,
+		PhaseStarted: phaseStarted,
+	}
+	return d
+}
+
+func (d testData) withKMSPlugin() testData {
+	d.Cluster.Options.APIServer.Encryption = cke.EncryptionParams{
+		Provider:  cke.EncryptionProviderKMS,
+		KMSPlugin: cke.KMSPluginParams{Image: "kms-plugin:1.0.0"},
+	}
+	for _, n := range d.ControlPlane() {
+		st := &d.NodeStatus(n).KMSPlugin
+		st.Running = true
+		st.Image = "kms-plugin:1.0.0"
+		st.BuiltInParams = k8s.KMSPluginParams()
+		d.NodeStatus(n).KMSSecretIDIssued = time.Now().Add(-time.Hour)
+		d.NodeStatus(n).APIServer.BuiltInParams = k8s.APIServerParams(n.Address, testServiceSubnet, d.Cluster.Options.APIServer, testDefaultDNSDomain, "")
 	}
 	return d
 }
@@ -284,7 +366,7 @@ func (d testData) withControllerManager(name, serviceSubnet string) testData {
 		st.Running = true
 		st.IsHealthy = true
 		st.Image = cke.KubernetesImage.Name()
-		st.BuiltInParams = k8s.ControllerManagerParams(name, serviceSubnet)
+		st.BuiltInParams = k8s.ControllerManagerParams(name, serviceSubnet, d.Cluster.Options.ControllerManager)
 	}
 	return d
 }
@@ -810,6 +892,59 @@ func TestDecideOps(t *testing.T) {
 			ExpectedOps:   []opData{{"etcd-rivers-bootstrap", 1}, {"etcd-rivers-restart", 1}},
 			ExpectedPhase: cke.PhaseRivers,
 		},
+		{
+			Name: "EtcdRestorePrepare",
+			Input: newData().withRivers().withEtcdRivers().withHealthyEtcd().withAPIServer(testServiceSubnet, testDefaultDNSDomain).with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.ControlPlane()[1].Address}
+			}),
+			ExpectedOps:   []opData{{"etcd-restore-prepare", 3}},
+			ExpectedPhase: cke.PhaseEtcdRestore,
+		},
+		{
+			Name: "EtcdRestorePrepareReachable",
+			Input: newData().withRivers().withEtcdRivers().withUnhealthyEtcd().withSSHNotConnectedCP(0).with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.ControlPlane()[1].Address}
+			}),
+			ExpectedOps:   []opData{{"etcd-restore-prepare", 2}},
+			ExpectedPhase: cke.PhaseEtcdRestore,
+		},
+		{
+			Name: "EtcdRestore",
+			Input: newData().withRivers().withEtcdRivers().with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.ControlPlane()[1].Address}
+			}),
+			ExpectedOps:   []opData{{"etcd-restore", 1}},
+			ExpectedPhase: cke.PhaseEtcdRestore,
+		},
+		{
+			Name: "EtcdRestoreBeforeRivers",
+			Input: newData().with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.ControlPlane()[1].Address}
+			}),
+			ExpectedOps:   []opData{{"etcd-restore", 1}},
+			ExpectedPhase: cke.PhaseEtcdRestore,
+		},
+		{
+			Name: "EtcdRestoreWaitUnreachable",
+			Input: newData().withRivers().withEtcdRivers().withSSHNotConnectedCP(0).with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.ControlPlane()[1].Address}
+			}),
+			ExpectedPhase: cke.PhaseEtcdRestoreAborted,
+		},
+		{
+			Name: "EtcdRestoreUnreachable",
+			Input: newData().withRivers().withEtcdRivers().withSSHNotConnectedCP(1).with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.ControlPlane()[1].Address}
+			}),
+			ExpectedPhase: cke.PhaseEtcdRestoreAborted,
+		},
+		{
+			Name: "EtcdRestoreNonCP",
+			Input: newData().withRivers().withEtcdRivers().with(func(d testData) {
+				d.Status.EtcdRestore = &cke.EtcdRestore{Snapshot: "etcd-20240102-030405.backup", Node: d.NonCPWorkers()[0].Address}
+			}),
+			ExpectedPhase: cke.PhaseEtcdRestoreAborted,
+		},
 		{
 			Name:          "EtcdBootstrap",
 			Input:         newData().withRivers().withEtcdRivers(),
@@ -878,6 +1013,43 @@ func TestDecideOps(t *testing.T) {
 			},
 			ExpectedPhase: cke.PhaseK8sStart,
 		},
+		{
+			// kubelet on control planes is started first to run static pods.
+			Name: "StaticPodBootKubelet",
+			Input: newData().withRivers().withEtcdRivers().withHealthyEtcd().with(func(d testData) {
+				d.Cluster.ControlPlaneMode = cke.ControlPlaneModeStaticPod
+			}),
+			ExpectedOps: []opData{
+				{"kubelet-bootstrap", 3},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "StaticPodRestartKubelet",
+			Input: newData().withRivers().withEtcdRivers().withHealthyEtcd().
+				withKubelet(testDefaultDNSDomain, "", false).with(func(d testData) {
+				d.Cluster.ControlPlaneMode = cke.ControlPlaneModeStaticPod
+				d.Cluster.Options.Kubelet.InPlaceUpdate = false
+			}),
+			ExpectedOps: []opData{
+				{"kubelet-restart", 3},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "StaticPodBootAPIServer",
+			Input: newData().withRivers().withEtcdRivers().withHealthyEtcd().
+				withKubelet(testDefaultDNSDomain, "", false).with(func(d testData) {
+				d.Cluster.ControlPlaneMode = cke.ControlPlaneModeStaticPod
+				for _, n := range d.Cluster.Nodes {
+					d.NodeStatus(n).Kubelet.Config.StaticPodPath = cke.StaticPodManifestDir
+				}
+			}),
+			ExpectedOps: []opData{
+				{"kube-apiserver-restart", 3},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
 		{
 			Name:  "BootAPIServer2",
 			Input: newData().withRivers().withEtcdRivers().withHealthyEtcd().withSSHNotConnectedCP(0),
@@ -1164,6 +1336,31 @@ func TestDecideOps(t *testing.T) {
 			},
 			ExpectedPhase: cke.PhaseK8sStart,
 		},
+		{
+			Name: "RestartControllerManagerConfig",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.ControllerManager.Config = &cke.ControllerManagerConfig{
+					FeatureGates: map[string]bool{"Foo": true},
+					Concurrency:  map[string]int{"deployment": 10},
+				}
+			}),
+			ExpectedOps: []opData{
+				{"kube-controller-manager-restart", 3},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "ControllerManagerConfigUpToDate",
+			Input: newData().with(func(d testData) {
+				d.Cluster.Options.ControllerManager.Config = &cke.ControllerManagerConfig{
+					Controllers:  []string{"*", "-bootstrapsigner"},
+					FeatureGates: map[string]bool{"Foo": true, "Bar": false},
+					Concurrency:  map[string]int{"deployment": 10, "gc": 30},
+				}
+			}).withK8sResourceReady(),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
 		{
 			Name: "RestartScheduler",
 			Input: newData().withAllServices().with(func(d testData) {
@@ -1363,6 +1560,58 @@ func TestDecideOps(t *testing.T) {
 			},
 			ExpectedPhase: cke.PhaseK8sMaintain,
 		},
+		{
+			Name: "RestartKubelet14",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.NonCPWorkers()[1].Labels = map[string]string{"cke.cybozu.com/role": "ss"}
+				d.Cluster.Options.Kubelet.Overrides = []cke.KubeletOverride{
+					{
+						Name: "ss",
+						Role: "ss",
+						ServiceParams: cke.ServiceParams{
+							ExtraArguments: []string{"--v=2"},
+						},
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"maxPods": 200,
+							},
+						},
+					},
+				}
+			}),
+			ExpectedOps: []opData{
+				// Only the selected node is restarted.
+				{"kubelet-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "RestartKubelet15",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Cluster.Options.Kubelet.Config = nil
+				for _, n := range d.Cluster.Nodes {
+					st := &d.NodeStatus(n).Kubelet
+					st.Config = k8s.GenerateKubeletConfiguration(d.Cluster.Options.Kubelet, n.Address, st.Config)
+				}
+				d.NonCPWorkers()[1].Labels = map[string]string{"cke.cybozu.com/role": "ss"}
+				d.Cluster.Options.Kubelet.Overrides = []cke.KubeletOverride{
+					{
+						Name: "ss",
+						Role: "ss",
+						Config: &unstructured.Unstructured{
+							Object: map[string]interface{}{
+								"maxPods": 50,
+							},
+						},
+					},
+				}
+			}),
+			ExpectedOps: []opData{
+				// Overrides work without the base configuration.
+				{"kubelet-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
 		{
 			Name: "RestartProxy",
 			Input: newData().withAllServices().with(func(d testData) {
@@ -2574,6 +2823,15 @@ func TestDecideOps(t *testing.T) {
 			ExpectedOps:   []opData{{"etcd-mark-member", 1}},
 			ExpectedPhase: cke.PhaseEtcdMaintain,
 		},
+		{
+			Name: "EtcdPromote",
+			Input: newData().withAllServices().with(func(d testData) {
+				d.Status.Etcd.Members["10.0.0.13"].IsLearner = true
+				d.Status.NodeStatuses["10.0.0.13"].Etcd.IsAddedMember = false
+			}),
+			ExpectedOps:   []opData{{"etcd-promote-member", 1}},
+			ExpectedPhase: cke.PhaseEtcdMaintain,
+		},
 		{
 			Name: "EtcdIsNotGood",
 			Input: newData().withK8sResourceReady().with(func(d testData) {
@@ -2630,6 +2888,43 @@ func TestDecideOps(t *testing.T) {
 			ExpectedOps:   []opData{{"etcd-restart", 1}},
 			ExpectedPhase: cke.PhaseEtcdMaintain,
 		},
+		{
+			Name: "EtcdDefrag",
+			Input: newData().withAllServices().withEtcdDefrag().with(func(d testData) {
+				d.Status.Etcd.MemberStatuses["10.0.0.12"].DBSizeInUse = 100 << 20
+			}),
+			ExpectedOps:   []opData{{"etcd-defrag", 1}},
+			ExpectedPhase: cke.PhaseEtcdMaintain,
+		},
+		{
+			Name: "EtcdDefragQuota",
+			Input: newData().withAllServices().withEtcdDefrag().with(func(d testData) {
+				d.Cluster.Options.Etcd.Defrag.FragmentationThreshold = 0
+				d.Cluster.Options.Etcd.Defrag.QuotaThreshold = 0.25
+				d.Status.Etcd.MemberStatuses["10.0.0.12"].DBSize = 600 << 20
+				d.Status.Etcd.MemberStatuses["10.0.0.12"].DBSizeInUse = 400 << 20
+			}),
+			ExpectedOps:   []opData{{"etcd-defrag", 1}},
+			ExpectedPhase: cke.PhaseEtcdMaintain,
+		},
+		{
+			Name: "EtcdDefragDisabled",
+			Input: newData().withK8sResourceReady().withEtcdDefrag().with(func(d testData) {
+				d.Cluster.Options.Etcd.Defrag = cke.EtcdDefragParams{}
+				d.Status.Etcd.MemberStatuses["10.0.0.12"].DBSizeInUse = 100 << 20
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "EtcdDefragNotGood",
+			Input: newData().withK8sResourceReady().withEtcdDefrag().with(func(d testData) {
+				d.Status.Etcd.MemberStatuses["10.0.0.12"].DBSizeInUse = 100 << 20
+				d.Status.Etcd.InSyncMembers["10.0.0.13"] = false
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
 		{
 			Name: "Clean",
 			Input: newData().withK8sResourceReady().with(func(d testData) {
@@ -2653,6 +2948,438 @@ func TestDecideOps(t *testing.T) {
 			},
 			ExpectedPhase: cke.PhaseStopCP,
 		},
+		{
+			Name: "KMSPluginBoot",
+			Input: newData().withK8sResourceReady().withKMSPlugin().with(func(d testData) {
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).KMSPlugin.Running = false
+				}
+			}),
+			ExpectedOps:   []opData{{"kms-plugin-restart", 3}},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "KMSPluginRestart",
+			Input: newData().withK8sResourceReady().withKMSPlugin().with(func(d testData) {
+				d.Cluster.Options.APIServer.Encryption.KMSPlugin.Image = "kms-plugin:1.1.0"
+			}),
+			ExpectedOps:   []opData{{"kms-plugin-restart", 1}},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "KMSPluginRenewSecretID",
+			Input: newData().withK8sResourceReady().withKMSPlugin().with(func(d testData) {
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).KMSSecretIDIssued = time.Now().Add(-cke.KMSSecretIDRenewAfter - time.Minute)
+				}
+			}),
+			ExpectedOps:   []opData{{"kms-plugin-restart", 1}},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name:          "KMSPluginRunning",
+			Input:         newData().withK8sResourceReady().withKMSPlugin(),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "KMSPluginStop",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.NodeStatus(d.ControlPlane()[0]).KMSPlugin.Running = true
+				d.Status.NodeStatuses["10.0.0.14"].KMSPlugin.Running = true
+			}),
+			ExpectedOps:   []opData{{"stop-kms-plugin", 2}},
+			ExpectedPhase: cke.PhaseStopCP,
+		},
+		{
+			Name: "RestartAPIServerEncryptionConfig",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Encryption.ConfigHash = "new"
+			}),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "RestartAPIServerAuthentication",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Authentication = &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "apiserver.config.k8s.io/v1",
+						"kind":       "AuthenticationConfiguration",
+					},
+				}
+			}),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "RestartAPIServerAdmission",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.Admission = &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "apiserver.config.k8s.io/v1",
+						"kind":       "AdmissionConfiguration",
+					},
+				}
+			}),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "RestartAPIServerAuditWebhook",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.Options.APIServer.AuditLogPolicy = "apiVersion: audit.k8s.io/v1\nkind: Policy\n"
+				d.Cluster.Options.APIServer.AuditWebhook = cke.AuditWebhookParams{
+					Enabled: true,
+					Server:  "https://audit.example.com/events",
+				}
+			}),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name:          "AuditWebhookCertValid",
+			Input:         newData().withK8sResourceReady().withAuditWebhook(time.Now().Add(cke.AuditWebhookCertTTL)),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "AuditWebhookCertRenew",
+			Input: newData().withK8sResourceReady().withAuditWebhook(time.Now().Add(cke.AuditWebhookCertTTL)).with(func(d testData) {
+				expiry := time.Now().Add(time.Hour)
+				d.NodeStatus(d.ControlPlane()[1]).Certificates[cke.CertAuditWebhook] = cke.CertificateStatus{
+					NotBefore: expiry.Add(-cke.AuditWebhookCertTTL),
+					NotAfter:  expiry,
+				}
+			}),
+			ExpectedOps:   []opData{{"audit-webhook-cert-renew", 1}},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name:          "CertRenewalNotDue",
+			Input:         newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "CertRenewalDisabled",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-29*24*time.Hour), time.Now().Add(24*time.Hour)).with(func(d testData) {
+				d.Cluster.CertRenewal.Enabled = false
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "CertRenewalAPIServer",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)).with(func(d testData) {
+				d.NodeStatus(d.ControlPlane()[1]).Certificates[cke.CertAggregation] = cke.CertificateStatus{
+					NotBefore: time.Now().Add(-29 * 24 * time.Hour),
+					NotAfter:  time.Now().Add(24 * time.Hour),
+				}
+			}),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CertRenewalControllerManager",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)).with(func(d testData) {
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).Certificates[cke.CertControllerManager] = cke.CertificateStatus{
+						NotBefore: time.Now().Add(-29 * 24 * time.Hour),
+						NotAfter:  time.Now().Add(24 * time.Hour),
+					}
+				}
+			}),
+			ExpectedOps: []opData{
+				// one by one
+				{"kube-controller-manager-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CertRenewalKubelet",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)).with(func(d testData) {
+				// Certificates are renewed even if in-place update is disabled.
+				d.Cluster.Options.Kubelet.InPlaceUpdate = false
+				for _, n := range d.NonCPWorkers() {
+					d.NodeStatus(n).Certificates[cke.CertKubelet] = cke.CertificateStatus{
+						NotBefore: time.Now().Add(-29 * 24 * time.Hour),
+						NotAfter:  time.Now().Add(24 * time.Hour),
+					}
+				}
+			}),
+			ExpectedOps: []opData{
+				{"kubelet-restart", 3},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CertRenewalKubeletOutdated",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)).with(func(d testData) {
+				// Outdated kubelet is restarted with the running configuration if in-place update is disabled.
+				d.Cluster.Options.Kubelet.InPlaceUpdate = false
+				for _, n := range d.NonCPWorkers() {
+					d.NodeStatus(n).Certificates[cke.CertKubelet] = cke.CertificateStatus{
+						NotBefore: time.Now().Add(-29 * 24 * time.Hour),
+						NotAfter:  time.Now().Add(24 * time.Hour),
+					}
+				}
+				d.NodeStatus(d.NonCPWorkers()[0]).Kubelet.Config.ClusterDomain = "neco.local"
+			}),
+			ExpectedOps: []opData{
+				{"kubelet-cert-renew", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CertRenewalKubeletOutdated2",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)).with(func(d testData) {
+				// Up-to-date kubelet is restarted with the current configuration after outdated one is renewed.
+				d.Cluster.Options.Kubelet.InPlaceUpdate = false
+				for _, n := range d.NonCPWorkers()[1:] {
+					d.NodeStatus(n).Certificates[cke.CertKubelet] = cke.CertificateStatus{
+						NotBefore: time.Now().Add(-29 * 24 * time.Hour),
+						NotAfter:  time.Now().Add(24 * time.Hour),
+					}
+				}
+				d.NodeStatus(d.NonCPWorkers()[0]).Kubelet.Config.ClusterDomain = "neco.local"
+			}),
+			ExpectedOps: []opData{
+				{"kubelet-restart", 2},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CertRenewalEtcd",
+			Input: newData().withK8sResourceReady().withCertRenewal(time.Now().Add(-time.Hour), time.Now().Add(30*24*time.Hour)).with(func(d testData) {
+				d.NodeStatus(d.ControlPlane()[2]).Certificates[cke.CertEtcdPeer] = cke.CertificateStatus{
+					NotBefore: time.Now().Add(-29 * 24 * time.Hour),
+					NotAfter:  time.Now().Add(24 * time.Hour),
+				}
+			}),
+			ExpectedOps:   []opData{{"etcd-restart", 1}},
+			ExpectedPhase: cke.PhaseEtcdMaintain,
+		},
+		{
+			Name:          "CARotationAdded",
+			Input:         newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAKubernetes, cke.CARotationAdded, time.Now()),
+			ExpectedOps:   []opData{{"ca-rotation", 1}},
+			ExpectedPhase: cke.PhaseK8sMaintain,
+		},
+		{
+			Name:  "CARotationBundledAPIServer",
+			Input: newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAKubernetes, cke.CARotationBundled, time.Now().Add(-time.Minute)),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CARotationBundledKubelet",
+			Input: newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAKubernetes, cke.CARotationBundled, time.Now().Add(-time.Minute)).with(func(d testData) {
+				d.Cluster.Options.Kubelet.InPlaceUpdate = false
+				for _, n := range d.Cluster.Nodes {
+					for name, st := range d.NodeStatus(n).Certificates {
+						if name != cke.CertKubelet {
+							st.NotBefore = time.Now()
+							d.NodeStatus(n).Certificates[name] = st
+						}
+					}
+				}
+			}),
+			ExpectedOps: []opData{
+				{"kubelet-restart", 5},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "CARotationSwitchedEtcd",
+			Input: newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAServer, cke.CARotationSwitched, time.Now().Add(-time.Minute)).with(func(d testData) {
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).Certificates[cke.CertAPIServerEtcdClient] = cke.CertificateStatus{
+						NotBefore: time.Now(),
+						NotAfter:  time.Now().Add(365 * 24 * time.Hour),
+					}
+				}
+			}),
+			ExpectedOps:   []opData{{"etcd-restart", 1}},
+			ExpectedPhase: cke.PhaseEtcdMaintain,
+		},
+		{
+			// Certificates unrelated to the CA are not reissued.
+			Name:          "CARotationDropped",
+			Input:         newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAEtcdPeer, cke.CARotationDropped, time.Now().Add(-2*time.Hour)),
+			ExpectedOps:   []opData{{"ca-rotation", 1}},
+			ExpectedPhase: cke.PhaseK8sMaintain,
+		},
+		{
+			Name: "CARotationWaitUnreachableNode",
+			Input: newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAEtcdPeer, cke.CARotationDropped, time.Now().Add(-2*time.Hour)).with(func(d testData) {
+				d.NodeStatus(d.NonCPWorkers()[0]).SSHConnected = false
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			// Components are not restarted for the webhook CA.
+			Name:          "CARotationWebhook",
+			Input:         newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAWebhook, cke.CARotationBundled, time.Now().Add(-cke.CARotationMinPhaseDuration)),
+			ExpectedOps:   []opData{{"ca-rotation", 1}},
+			ExpectedPhase: cke.PhaseK8sMaintain,
+		},
+		{
+			// The phase lasts for the minimum duration even if nothing is restarted.
+			Name:          "CARotationWebhookWait",
+			Input:         newData().withK8sResourceReady().withCertificates(time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAWebhook, cke.CARotationBundled, time.Now().Add(-time.Minute)),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			// Certificates issued in the phase are not reissued again even if backdated.
+			Name:          "CARotationBackdated",
+			Input:         newData().withK8sResourceReady().withCertificates(time.Now().Add(-cke.CARotationMinPhaseDuration-cke.CertificateBackdate+time.Second), time.Now().Add(365*24*time.Hour)).withCARotation(cke.CAEtcdPeer, cke.CARotationSwitched, time.Now().Add(-cke.CARotationMinPhaseDuration)),
+			ExpectedOps:   []opData{{"ca-rotation", 1}},
+			ExpectedPhase: cke.PhaseK8sMaintain,
+		},
+		{
+			Name: "StaticPodCompleted",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.ControlPlaneMode = cke.ControlPlaneModeStaticPod
+				for _, n := range d.Cluster.Nodes {
+					d.NodeStatus(n).Kubelet.Config.StaticPodPath = cke.StaticPodManifestDir
+				}
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).Etcd.StaticPod = true
+				}
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			// etcd bootstrapped as containers is restarted as static pods one by one.
+			Name: "StaticPodRestartEtcd",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.ControlPlaneMode = cke.ControlPlaneModeStaticPod
+				for _, n := range d.Cluster.Nodes {
+					d.NodeStatus(n).Kubelet.Config.StaticPodPath = cke.StaticPodManifestDir
+				}
+				d.NodeStatus(d.ControlPlane()[0]).Etcd.StaticPod = true
+			}),
+			ExpectedOps:   []opData{{"etcd-restart", 1}},
+			ExpectedPhase: cke.PhaseEtcdMaintain,
+		},
+		{
+			// kubelet reading no static pod manifests is updated.
+			Name: "StaticPodKubeletOutdated",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.ControlPlaneMode = cke.ControlPlaneModeStaticPod
+				for _, n := range d.ControlPlane() {
+					d.NodeStatus(n).Kubelet.Config.StaticPodPath = cke.StaticPodManifestDir
+				}
+			}),
+			ExpectedOps:   []opData{{"kubelet-restart", 3}},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
+		{
+			Name: "EngineMigration",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.ContainerEngine = cke.ContainerEngineContainerd
+				for _, n := range d.Cluster.Nodes {
+					d.NodeStatus(n).ContainerEngine = cke.ContainerEngineDocker
+				}
+			}),
+			ExpectedOps:   []opData{{"container-engine-migration", 1}},
+			ExpectedPhase: cke.PhaseEngineMigration,
+		},
+		{
+			// The next node is not migrated until the migrated etcd member becomes in-sync.
+			Name: "EngineMigrationWaitEtcd",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.ContainerEngine = cke.ContainerEngineContainerd
+				for _, n := range d.Cluster.Nodes[1:] {
+					d.NodeStatus(n).ContainerEngine = cke.ContainerEngineDocker
+				}
+				d.NodeStatus(d.Cluster.Nodes[0]).ContainerEngine = cke.ContainerEngineContainerd
+				d.Status.Etcd.InSyncMembers[d.Cluster.Nodes[0].Address] = false
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "EngineMigrationCompleted",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Cluster.ContainerEngine = cke.ContainerEngineContainerd
+				for _, n := range d.Cluster.Nodes {
+					d.NodeStatus(n).ContainerEngine = cke.ContainerEngineContainerd
+				}
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "EncryptionKeyRotation",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Encryption.Rotation = &cke.EncryptionKeyRotation{
+					Provider: cke.EncryptionProviderAESCBC,
+					KeyName:  "new",
+					Phase:    cke.EncryptionKeyAdded,
+				}
+			}),
+			ExpectedOps:   []opData{{"encryption-key-rotation", 1}},
+			ExpectedPhase: cke.PhaseK8sMaintain,
+		},
+		{
+			Name: "EncryptionKeyRotationUnreachable",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.NodeStatus(d.ControlPlane()[2]).SSHConnected = false
+				d.Status.Encryption.Rotation = &cke.EncryptionKeyRotation{
+					Provider: cke.EncryptionProviderAESCBC,
+					KeyName:  "new",
+					Phase:    cke.EncryptionKeyAdded,
+				}
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseCompleted,
+		},
+		{
+			Name: "EncryptionKeyRotationWaitAPIServer",
+			Input: newData().withK8sResourceReady().with(func(d testData) {
+				d.Status.Encryption.ConfigHash = "new"
+				d.Status.Encryption.Rotation = &cke.EncryptionKeyRotation{
+					Provider: cke.EncryptionProviderAESCBC,
+					KeyName:  "new",
+					Phase:    cke.EncryptionKeyAdded,
+				}
+			}),
+			ExpectedOps: []opData{
+				{"update-kubernetes-endpoints", 1},
+				{"update-kubernetes-endpointslice", 1},
+				{"kube-apiserver-restart", 1},
+			},
+			ExpectedPhase: cke.PhaseK8sStart,
+		},
 		{
 			Name: "Upgrade",
 			Input: newData().withNodes(corev1.Node{
@@ -2766,6 +3493,17 @@ func TestDecideOps(t *testing.T) {
 			ExpectedOps:   nil,
 			ExpectedPhase: cke.PhaseRepairMachines,
 		},
+		{
+			Name: "RepairBlockedByEtcdLearner",
+			Input: newData().withK8sResourceReady().withRepairConfig().withRepairEntries([]*cke.RepairQueueEntry{
+				{Address: nodeNames[0], MachineType: "type1", Operation: "op1"},
+			}).withSSHNotConnectedCP(0).withNotReadyMasterEndpoint(0).with(func(d testData) {
+				d.Status.Etcd.InSyncMembers[nodeNames[0]] = false
+				d.Status.Etcd.Members[nodeNames[1]].IsLearner = true
+			}),
+			ExpectedOps:   nil,
+			ExpectedPhase: cke.PhaseRepairMachines,
+		},
 		{
 			Name: "RepairBlockedByMissingControlPlane",
 			Input: newData().withK8sResourceReady().withRepairConfig().withRepairEntries([]*cke.RepairQueueEntry{
@@ -3484,3 +4222,22 @@ func TestDecideOps(t *testing.T) {
 		})
 	}
 }
+
+func TestEtcdFragmentedMembers(t *testing.T) {
+	d := newData().withAllServices().withEtcdDefrag().with(func(d testData) {
+		for _, st := range d.Status.Etcd.MemberStatuses {
+			st.DBSizeInUse = 100 << 20
+		}
+	})
+	nf := NewNodeFilter(d.Cluster, d.Status)
+
+	nodes := nf.EtcdFragmentedMembers()
+	var actual []string
+	for _, n := range nodes {
+		actual = append(actual, n.Address)
+	}
+	expected := []string{"10.0.0.12", "10.0.0.13", "10.0.0.11"}
+	if !cmp.Equal(expected, actual) {
+		t.Error("the leader should be defragmented last:", cmp.Diff(expected, actual))
+	}
+}
@@ -27,6 +27,19 @@ func initStateless(ctx context.Context, etcd *clientv3.Client, ch chan<- struct{
 		}
 	}
 
+	resp, err = etcd.Get(ctx, cke.KeyRecordArchive, clientv3.WithRev(rev))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 1 {
+		err = cke.ConnectRecordArchive(resp.Kvs[0].Value)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		cke.DisconnectRecordArchive()
+	}
+
 	return rev, nil
 }
 
@@ -43,11 +56,24 @@ func startWatcher(ctx context.Context, etcd *clientv3.Client, ch chan<- struct{}
 		}
 
 		for _, ev := range resp.Events {
+			key := string(ev.Kv.Key)
+
+			// Resume operations as soon as the freeze is lifted.
+			if ev.Type == clientv3.EventTypeDelete && key == cke.KeyFreeze {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			if ev.Type == clientv3.EventTypeDelete && key == cke.KeyRecordArchive {
+				cke.DisconnectRecordArchive()
+				continue
+			}
 			if ev.Type != clientv3.EventTypePut {
 				continue
 			}
 
-			key := string(ev.Kv.Key)
 			switch {
 			case key == cke.KeyCluster || strings.HasPrefix(key, cke.KeyResourcePrefix):
 				select {
@@ -59,6 +85,11 @@ func startWatcher(ctx context.Context, etcd *clientv3.Client, ch chan<- struct{}
 				if err != nil {
 					return err
 				}
+			case key == cke.KeyRecordArchive:
+				err = cke.ConnectRecordArchive(ev.Kv.Value)
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
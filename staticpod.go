@@ -0,0 +1,643 @@
+package cke
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+// Control plane deployment modes.
+const (
+	ControlPlaneModeContainer = "container"
+	ControlPlaneModeStaticPod = "static-pod"
+)
+
+const (
+	// StaticPodManifestDir is the directory for static pod manifests read by kubelet.
+	StaticPodManifestDir = "/etc/kubernetes/manifests"
+
+	// staticPodCRINamespace is the containerd namespace where kubelet runs containers.
+	staticPodCRINamespace = "k8s.io"
+
+	// staticPodStartTimeout is the time to wait for kubelet to create the container
+	// of a static pod after the manifest is written.  This covers image pulls.
+	staticPodStartTimeout = 5 * time.Minute
+
+	// staticPodKubeletConfigPath is the path of the configuration file of kubelet.
+	staticPodKubeletConfigPath = "/etc/kubernetes/kubelet/config.yml"
+
+	// staticPodStopTimeout is the time to wait for kubelet to stop the container
+	// of a static pod after the manifest is removed.
+	staticPodStopTimeout = 2 * time.Minute
+
+	// StaticPodRunAtAnnotation is the annotation to record the time when
+	// the manifest is written.  This makes kubelet restart the pod even
+	// if nothing else is changed.
+	StaticPodRunAtAnnotation = "cke.cybozu.com/run-at"
+)
+
+// StaticPodComponents is the list of system containers that run as static
+// pods when ControlPlaneModeStaticPod is selected.
+// The names are the same as the container names.
+var StaticPodComponents = []string{
+	"etcd",
+	"kube-apiserver",
+	"kube-controller-manager",
+	"kube-scheduler",
+}
+
+// staticPodBootstrapComponents is the list of StaticPodComponents that are
+// run by the base container engine while kubelet is not running static pods
+// on the node.
+// CKE bootstraps etcd before kubelet and kube-apiserver that depends on etcd,
+// and later restarts the etcd members one by one as static pods.
+var staticPodBootstrapComponents = []string{
+	"etcd",
+}
+
+// StaticPodManifestPath returns the path of the static pod manifest for the named component.
+func StaticPodManifestPath(name string) string {
+	return filepath.Join(StaticPodManifestDir, name+".yaml")
+}
+
+// StaticPods returns a ContainerEngine that runs StaticPodComponents as
+// kubelet static pods.  Other containers are run by base.
+// Components in staticPodBootstrapComponents are run by base while kubelet
+// is not running static pods, and Inspect returns their status from base in that case.
+//
+// criEndpoint is the endpoint of containerd used by kubelet.  The state of
+// the static pods is read from containerd through it.
+func StaticPods(agent Agent, base ContainerEngine, criEndpoint string) ContainerEngine {
+	names := make(map[string]bool)
+	for _, n := range StaticPodComponents {
+		names[n] = true
+	}
+	bootstrap := make(map[string]bool)
+	for _, n := range staticPodBootstrapComponents {
+		bootstrap[n] = true
+	}
+	return staticPods{
+		ContainerEngine: base,
+		agent:           agent,
+		names:           names,
+		bootstrap:       bootstrap,
+		criAddress:      strings.TrimPrefix(criEndpoint, "unix://"),
+	}
+}
+
+type staticPods struct {
+	ContainerEngine
+	agent      Agent
+	names      map[string]bool
+	bootstrap  map[string]bool
+	criAddress string
+}
+
+// staticPodVolume returns the volume and its mount for a bind mount.
+func staticPodVolume(i int, m Mount) (corev1.Volume, corev1.VolumeMount) {
+	name := fmt.Sprintf("bind-%d", i)
+	vol := corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: m.Source},
+		},
+	}
+	vm := corev1.VolumeMount{
+		Name:      name,
+		MountPath: m.Destination,
+		ReadOnly:  m.ReadOnly,
+	}
+	var propagation corev1.MountPropagationMode
+	switch m.Propagation {
+	case PropagationShared, PropagationRShared:
+		propagation = corev1.MountPropagationBidirectional
+	case PropagationSlave, PropagationRSlave:
+		propagation = corev1.MountPropagationHostToContainer
+	}
+	if len(propagation) > 0 {
+		vm.MountPropagation = &propagation
+	}
+	return vol, vm
+}
+
+// staticPodTmpfs returns the volume and its mount for a tmpfs.
+func staticPodTmpfs(i int, dst string) (corev1.Volume, corev1.VolumeMount) {
+	name := fmt.Sprintf("tmpfs-%d", i)
+	vol := corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+		},
+	}
+	return vol, corev1.VolumeMount{Name: name, MountPath: dst}
+}
+
+// staticPodManifest returns the static pod for the named component.
+// opts are docker options given to RunSystem.
+func staticPodManifest(name string, img Image, opts []string, params, extra ServiceParams) (*corev1.Pod, error) {
+	label, err := json.Marshal(ckeLabel{
+		BuiltInParams: params,
+		ExtraParams:   extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	privileged := false
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "kube-system",
+			Labels: map[string]string{
+				"component": name,
+				"tier":      "control-plane",
+			},
+			Annotations: map[string]string{
+				CKELabelName: string(label),
+			},
+		},
+		Spec: corev1.PodSpec{
+			HostNetwork:       true,
+			PriorityClassName: "system-node-critical",
+		},
+	}
+
+	var tmpfs []string
+	var binds []Mount
+	for i := 0; i < len(opts); i++ {
+		o := opts[i]
+		switch {
+		case o == "--pid=host":
+			pod.Spec.HostPID = true
+		case o == "--privileged":
+			privileged = true
+		case strings.HasPrefix(o, "--tmpfs="):
+			tmpfs = append(tmpfs, strings.TrimPrefix(o, "--tmpfs="))
+		case o == "--mount":
+			if i+1 >= len(opts) {
+				return nil, errors.New("no value for --mount")
+			}
+			i++
+			fields := make(map[string]string)
+			for _, f := range strings.Split(opts[i], ",") {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) == 2 {
+					fields[kv[0]] = kv[1]
+				}
+			}
+			switch fields["type"] {
+			case "tmpfs":
+				tmpfs = append(tmpfs, fields["dst"])
+			case "bind":
+				binds = append(binds, Mount{Source: fields["src"], Destination: fields["dst"]})
+			default:
+				return nil, errors.New("unsupported mount for static pods: " + opts[i])
+			}
+		default:
+			return nil, errors.New("unsupported option for static pods: " + o)
+		}
+	}
+
+	container := corev1.Container{
+		Name:            name,
+		Image:           img.Name(),
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            append(append([]string{}, params.ExtraArguments...), extra.ExtraArguments...),
+		SecurityContext: &corev1.SecurityContext{
+			Privileged:             ptr.To(privileged),
+			ReadOnlyRootFilesystem: ptr.To(true),
+		},
+	}
+
+	env := make(map[string]string)
+	for k, v := range params.ExtraEnvvar {
+		env[k] = v
+	}
+	for k, v := range extra.ExtraEnvvar {
+		env[k] = v
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		container.Env = append(container.Env, corev1.EnvVar{Name: k, Value: env[k]})
+	}
+
+	binds = append(append(append([]Mount{}, params.ExtraBinds...), extra.ExtraBinds...), binds...)
+	for i, m := range binds {
+		vol, vm := staticPodVolume(i, m)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+		container.VolumeMounts = append(container.VolumeMounts, vm)
+	}
+	for i, dst := range tmpfs {
+		vol, vm := staticPodTmpfs(i, dst)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+		container.VolumeMounts = append(container.VolumeMounts, vm)
+	}
+
+	pod.Spec.Containers = []corev1.Container{container}
+	return pod, nil
+}
+
+func (c staticPods) manifestBinds() []Mount {
+	return []Mount{{
+		Source:      StaticPodManifestDir,
+		Destination: filepath.Join("/mnt", StaticPodManifestDir),
+		Label:       LabelPrivate,
+	}}
+}
+
+// kubeletRunsStaticPods returns true if kubelet is running on the node and
+// reads static pod manifests from StaticPodManifestDir.
+func (c staticPods) kubeletRunsStaticPods() (bool, error) {
+	ss, err := c.ContainerEngine.Inspect([]string{"kubelet"})
+	if err != nil {
+		return false, err
+	}
+	if !ss["kubelet"].Running {
+		return false, nil
+	}
+
+	cmdline := "cat " + staticPodKubeletConfigPath
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return false, fmt.Errorf("%w, cmdline: %s, stderr: %s", err, cmdline, stderr)
+	}
+	var cfg struct {
+		StaticPodPath string `json:"staticPodPath"`
+	}
+	err = yaml.Unmarshal(stdout, &cfg)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", staticPodKubeletConfigPath, err)
+	}
+	return cfg.StaticPodPath == StaticPodManifestDir, nil
+}
+
+// volumePath returns the path of the named volume of the base engine.
+func (c staticPods) volumePath(name string) (string, error) {
+	if c.ContainerEngine.Name() == ContainerEngineContainerd {
+		return ContainerdVolumePath(name), nil
+	}
+	cmdline := "docker volume inspect --format '{{.Mountpoint}}' " + name
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return "", fmt.Errorf("%w, cmdline: %s, stderr: %s", err, cmdline, stderr)
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// bindVolumes replaces volume mounts in opts with bind mounts of the volume directories.
+func (c staticPods) bindVolumes(opts []string) ([]string, error) {
+	ret := make([]string, len(opts))
+	copy(ret, opts)
+	for i := 0; i+1 < len(ret); i++ {
+		if ret[i] != "--mount" || !strings.HasPrefix(ret[i+1], "type=volume,") {
+			continue
+		}
+		i++
+		fields := strings.Split(ret[i], ",")
+		for j, f := range fields {
+			switch {
+			case f == "type=volume":
+				fields[j] = "type=bind"
+			case strings.HasPrefix(f, "src="):
+				path, err := c.volumePath(strings.TrimPrefix(f, "src="))
+				if err != nil {
+					return nil, err
+				}
+				fields[j] = "src=" + path
+			}
+		}
+		ret[i] = strings.Join(fields, ",")
+	}
+	return ret, nil
+}
+
+func (c staticPods) RunSystem(name string, img Image, opts []string, params, extra ServiceParams) error {
+	if !c.names[name] {
+		return c.ContainerEngine.RunSystem(name, img, opts, params, extra)
+	}
+
+	if c.bootstrap[name] {
+		running, err := c.kubeletRunsStaticPods()
+		if err != nil {
+			return err
+		}
+		if !running {
+			// Remove the stale manifest so that kubelet does not run the
+			// static pod along with the container when it starts.
+			if _, err := c.removeManifest(name); err != nil {
+				return err
+			}
+			return c.ContainerEngine.RunSystem(name, img, opts, params, extra)
+		}
+	}
+
+	// Remove the container run by the base engine, if any, to migrate
+	// from ControlPlaneModeContainer.
+	exists, err := c.ContainerEngine.Exists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = c.ContainerEngine.Kill(name)
+		if err != nil {
+			return err
+		}
+		err = c.ContainerEngine.Remove(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts, err = c.bindVolumes(opts)
+	if err != nil {
+		return err
+	}
+	pod, err := staticPodManifest(name, img, opts, params, extra)
+	if err != nil {
+		return err
+	}
+	pod.Annotations[StaticPodRunAtAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := yaml.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	hdr := &tar.Header{
+		Name: StaticPodManifestPath(name),
+		Mode: 0644,
+		Size: int64(len(data)),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return c.ContainerEngine.RunWithInput(ToolsImage, c.manifestBinds(), "write_files", buf.String(), "/mnt")
+}
+
+func (c staticPods) Exists(name string) (bool, error) {
+	if !c.names[name] {
+		return c.ContainerEngine.Exists(name)
+	}
+	pod, err := c.readManifest(name)
+	if err != nil {
+		return false, err
+	}
+	if pod == nil && c.bootstrap[name] {
+		return c.ContainerEngine.Exists(name)
+	}
+	return pod != nil, nil
+}
+
+// Stop removes the manifest and waits for kubelet to stop the pod.
+func (c staticPods) Stop(name string) error {
+	if !c.names[name] {
+		return c.ContainerEngine.Stop(name)
+	}
+	if err := c.stopPod(name); err != nil {
+		return err
+	}
+	return c.inBase(name, c.ContainerEngine.Stop)
+}
+
+func (c staticPods) Kill(name string) error {
+	if !c.names[name] {
+		return c.ContainerEngine.Kill(name)
+	}
+	if err := c.stopPod(name); err != nil {
+		return err
+	}
+	return c.inBase(name, c.ContainerEngine.Kill)
+}
+
+func (c staticPods) Remove(name string) error {
+	if !c.names[name] {
+		return c.ContainerEngine.Remove(name)
+	}
+	if _, err := c.removeManifest(name); err != nil {
+		return err
+	}
+	return c.inBase(name, c.ContainerEngine.Remove)
+}
+
+// inBase calls f for the named component if it is run by the base engine.
+func (c staticPods) inBase(name string, f func(string) error) error {
+	if !c.bootstrap[name] {
+		return nil
+	}
+	exists, err := c.ContainerEngine.Exists(name)
+	if err != nil || !exists {
+		return err
+	}
+	return f(name)
+}
+
+// stopPod removes the manifest and waits for kubelet to stop the container
+// of the static pod so that its data can be removed safely.
+func (c staticPods) stopPod(name string) error {
+	removed, err := c.removeManifest(name)
+	if err != nil || !removed {
+		return err
+	}
+
+	deadline := time.Now().Add(staticPodStopTimeout)
+	for {
+		tasks, err := c.taskStatuses()
+		if err != nil {
+			return err
+		}
+		running, _, err := c.running(name, tasks)
+		if err != nil {
+			return err
+		}
+		if !running {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for kubelet to stop %s", name)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// removeManifest removes the manifest of the named static pod.
+// removed is false if the manifest does not exist.
+func (c staticPods) removeManifest(name string) (removed bool, err error) {
+	pod, err := c.readManifest(name)
+	if err != nil || pod == nil {
+		return false, err
+	}
+	// The tools image has no command to remove a file.
+	target := filepath.Join("/mnt", StaticPodManifestPath(name))
+	err = c.ContainerEngine.Run(KubernetesImage, c.manifestBinds(), "rm", "-f", target)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readManifest returns the static pod in the manifest, or nil if the manifest does not exist.
+func (c staticPods) readManifest(name string) (*corev1.Pod, error) {
+	path := StaticPodManifestPath(name)
+	cmdline := fmt.Sprintf("if [ -f %s ]; then cat %s; fi", path, path)
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return nil, fmt.Errorf("%w, cmdline: %s, stderr: %s", err, cmdline, stderr)
+	}
+	if len(bytes.TrimSpace(stdout)) == 0 {
+		return nil, nil
+	}
+
+	pod := &corev1.Pod{}
+	err = yaml.Unmarshal(stdout, pod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return pod, nil
+}
+
+// ctr runs ctr command for the containerd namespace of kubelet.
+func (c staticPods) ctr(args ...string) ([]byte, error) {
+	cmdline := "ctr --address " + c.criAddress + " --namespace " + staticPodCRINamespace + " " + strings.Join(args, " ")
+	stdout, stderr, err := c.agent.Run(cmdline)
+	if err != nil {
+		return nil, fmt.Errorf("%w, cmdline: %s, stdout: %s, stderr: %s", err, cmdline, stdout, stderr)
+	}
+	return stdout, nil
+}
+
+// running returns true if the container of the named static pod is running.
+// created is false if kubelet has not created the container.
+//
+// This reads the state from containerd instead of kubelet API because
+// kubelet authorizes API requests with kube-apiserver, which may be down.
+func (c staticPods) running(name string, tasks map[string]string) (running, created bool, err error) {
+	filter := fmt.Sprintf(`labels."io.kubernetes.pod.namespace"==kube-system,labels."io.kubernetes.container.name"==%s`, name)
+	stdout, err := c.ctr("container", "list", "--quiet", shellQuote(filter))
+	if err != nil {
+		return false, false, err
+	}
+	ids := strings.Fields(string(stdout))
+	for _, id := range ids {
+		if tasks[id] == "RUNNING" {
+			return true, true, nil
+		}
+	}
+	return false, len(ids) > 0, nil
+}
+
+// taskStatuses returns the statuses of tasks keyed by container IDs.
+func (c staticPods) taskStatuses() (map[string]string, error) {
+	stdout, err := c.ctr("task", "list")
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]string)
+	for _, line := range strings.Split(string(stdout), "\n") {
+		// TASK PID STATUS
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "TASK" {
+			continue
+		}
+		statuses[fields[0]] = fields[2]
+	}
+	return statuses, nil
+}
+
+// Inspect returns the status of static pods from their manifests.
+// A static pod is considered running if its manifest exists and kubelet
+// is running its container.  Crash-looping pods are not running.
+// Pods are considered running for staticPodStartTimeout after the manifests
+// are written until kubelet creates their containers.
+// The status of staticPodBootstrapComponents without manifests is read from
+// the base engine.
+func (c staticPods) Inspect(names []string) (map[string]ServiceStatus, error) {
+	var others []string
+	var tasks map[string]string
+	statuses := make(map[string]ServiceStatus)
+	for _, name := range names {
+		if !c.names[name] {
+			others = append(others, name)
+			continue
+		}
+
+		pod, err := c.readManifest(name)
+		if err != nil {
+			return nil, err
+		}
+		if pod == nil && c.bootstrap[name] {
+			others = append(others, name)
+			continue
+		}
+		if pod == nil || len(pod.Spec.Containers) == 0 {
+			continue
+		}
+
+		var params ckeLabel
+		err = json.Unmarshal([]byte(pod.Annotations[CKELabelName]), &params)
+		if err != nil {
+			return nil, err
+		}
+		if tasks == nil {
+			tasks, err = c.taskStatuses()
+			if err != nil {
+				return nil, err
+			}
+		}
+		running, created, err := c.running(name, tasks)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			runAt, err := time.Parse(time.RFC3339Nano, pod.Annotations[StaticPodRunAtAnnotation])
+			running = err == nil && time.Since(runAt) < staticPodStartTimeout
+		}
+		statuses[name] = ServiceStatus{
+			Running:       running,
+			Image:         pod.Spec.Containers[0].Image,
+			BuiltInParams: params.BuiltInParams,
+			ExtraParams:   params.ExtraParams,
+			StaticPod:     true,
+		}
+	}
+
+	if len(others) > 0 {
+		ss, err := c.ContainerEngine.Inspect(others)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ss {
+			statuses[k] = v
+		}
+	}
+
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	return statuses, nil
+}
@@ -0,0 +1,305 @@
+package cke
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestStaticPodManifest(t *testing.T) {
+	t.Parallel()
+
+	params := ServiceParams{
+		ExtraArguments: []string{"kube-apiserver", "--v=1"},
+		ExtraBinds: []Mount{
+			{Source: "/etc/kubernetes", Destination: "/etc/kubernetes", ReadOnly: true},
+			{Source: "/var/lib/kubelet", Destination: "/var/lib/kubelet", Propagation: PropagationRShared},
+		},
+		ExtraEnvvar: map[string]string{"FOO": "foo"},
+	}
+	extra := ServiceParams{
+		ExtraArguments: []string{"--v=2"},
+		ExtraEnvvar:    map[string]string{"BAR": "bar"},
+	}
+	pod, err := staticPodManifest("kube-apiserver", KubernetesImage, []string{"--mount", "type=tmpfs,dst=/run/kubernetes"}, params, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pod.Name != "kube-apiserver" || pod.Namespace != "kube-system" {
+		t.Error("unexpected name", pod.Namespace, pod.Name)
+	}
+	if !pod.Spec.HostNetwork {
+		t.Error("host network should be used")
+	}
+	if len(pod.Spec.Containers) != 1 {
+		t.Fatal("unexpected containers", pod.Spec.Containers)
+	}
+	c := pod.Spec.Containers[0]
+	if c.Image != KubernetesImage.Name() {
+		t.Error("unexpected image", c.Image)
+	}
+	if !cmp.Equal(c.Args, []string{"kube-apiserver", "--v=1", "--v=2"}) {
+		t.Error("unexpected args", c.Args)
+	}
+	expectedEnv := []corev1.EnvVar{{Name: "BAR", Value: "bar"}, {Name: "FOO", Value: "foo"}}
+	if !cmp.Equal(c.Env, expectedEnv) {
+		t.Error("unexpected env", cmp.Diff(c.Env, expectedEnv))
+	}
+
+	bidirectional := corev1.MountPropagationBidirectional
+	expectedMounts := []corev1.VolumeMount{
+		{Name: "bind-0", MountPath: "/etc/kubernetes", ReadOnly: true},
+		{Name: "bind-1", MountPath: "/var/lib/kubelet", MountPropagation: &bidirectional},
+		{Name: "tmpfs-0", MountPath: "/run/kubernetes"},
+	}
+	if !cmp.Equal(c.VolumeMounts, expectedMounts) {
+		t.Error("unexpected volume mounts", cmp.Diff(c.VolumeMounts, expectedMounts))
+	}
+	if len(pod.Spec.Volumes) != 3 || pod.Spec.Volumes[0].HostPath.Path != "/etc/kubernetes" || pod.Spec.Volumes[2].EmptyDir == nil {
+		t.Error("unexpected volumes", pod.Spec.Volumes)
+	}
+	if pod.Annotations[CKELabelName] == "" {
+		t.Error("parameters should be recorded in the annotation")
+	}
+
+	pod, err = staticPodManifest("kubelet", KubernetesImage, []string{"--pid=host", "--privileged", "--tmpfs=/tmp"}, params, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pod.Spec.HostPID || !*pod.Spec.Containers[0].SecurityContext.Privileged {
+		t.Error("host PID namespace and privileged mode should be used")
+	}
+
+	_, err = staticPodManifest("kube-apiserver", KubernetesImage, []string{"--mount", "type=volume,src=foo,dst=/foo"}, params, extra)
+	if err == nil {
+		t.Error("volumes should not be supported")
+	}
+
+	pod, err = staticPodManifest("etcd", EtcdImage, []string{"--mount", "type=bind,src=/var/lib/cke/volumes/etcd-cke,dst=/var/lib/etcd"}, params, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol := pod.Spec.Volumes[2]; vol.HostPath == nil || vol.HostPath.Path != "/var/lib/cke/volumes/etcd-cke" {
+		t.Error("unexpected volume", vol)
+	}
+	if vm := pod.Spec.Containers[0].VolumeMounts[2]; vm.MountPath != "/var/lib/etcd" || vm.ReadOnly {
+		t.Error("unexpected volume mount", vm)
+	}
+}
+
+// ctrAgent is an Agent that returns the outputs of ctr commands.
+type ctrAgent struct {
+	nopAgent
+	outputs  map[string]string
+	commands *[]string
+}
+
+func (a ctrAgent) Run(command string) ([]byte, []byte, error) {
+	*a.commands = append(*a.commands, command)
+	for suffix, out := range a.outputs {
+		if strings.HasSuffix(command, suffix) {
+			return []byte(out), nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func TestStaticPodsInspect(t *testing.T) {
+	t.Parallel()
+
+	pod, err := staticPodManifest("kube-apiserver", KubernetesImage, nil, ServiceParams{ExtraArguments: []string{"kube-apiserver"}}, ServiceParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := yaml.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.Name = "kube-scheduler"
+	schedManifest, err := yaml.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod.Name = "kube-controller-manager"
+	pod.Annotations[StaticPodRunAtAnnotation] = time.Now().UTC().Format(time.RFC3339Nano)
+	cmManifest, err := yaml.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	agent := ctrAgent{
+		outputs: map[string]string{
+			"kube-apiserver.yaml; fi":          string(manifest),
+			"kube-scheduler.yaml; fi":          string(schedManifest),
+			"kube-controller-manager.yaml; fi": string(cmManifest),
+			" task list":                       "TASK PID STATUS\nabc 100 RUNNING\ndef 0 STOPPED\n",
+			`container.name"==kube-apiserver'`: "abc\n",
+			`container.name"==kube-scheduler'`: "def\n",
+		},
+		commands: &commands,
+	}
+
+	ce := StaticPods(agent, nil, "unix:///run/containerd/containerd.sock")
+	statuses, err := ce.Inspect([]string{"kube-apiserver", "kube-controller-manager", "kube-scheduler"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses["kube-apiserver"].Running {
+		t.Error("kube-apiserver should be running")
+	}
+	if st := statuses["kube-apiserver"]; st.Image != KubernetesImage.Name() || !cmp.Equal(st.BuiltInParams.ExtraArguments, []string{"kube-apiserver"}) {
+		t.Error("unexpected status", st)
+	}
+	// pod being started
+	if !statuses["kube-controller-manager"].Running {
+		t.Error("kube-controller-manager should be running until the timeout")
+	}
+	// crash-looping pod
+	if st, ok := statuses["kube-scheduler"]; !ok || st.Running {
+		t.Error("kube-scheduler should exist but not be running", st)
+	}
+
+	pod.Annotations[StaticPodRunAtAnnotation] = time.Now().Add(-staticPodStartTimeout).UTC().Format(time.RFC3339Nano)
+	cmManifest, err = yaml.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.outputs["kube-controller-manager.yaml; fi"] = string(cmManifest)
+	statuses, err = ce.Inspect([]string{"kube-controller-manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, ok := statuses["kube-controller-manager"]; !ok || st.Running {
+		t.Error("kube-controller-manager should not be running after the timeout", st)
+	}
+
+	for _, c := range commands {
+		if strings.HasPrefix(c, "ctr ") && !strings.HasPrefix(c, "ctr --address /run/containerd/containerd.sock --namespace k8s.io ") {
+			t.Error("unexpected ctr command", c)
+		}
+	}
+}
+
+// baseEngine is a ContainerEngine that records calls to it.
+type baseEngine struct {
+	ContainerEngine
+	statuses map[string]ServiceStatus
+	calls    *[]string
+}
+
+func (e baseEngine) Name() string {
+	return ContainerEngineContainerd
+}
+
+func (e baseEngine) RunSystem(name string, img Image, opts []string, params, extra ServiceParams) error {
+	*e.calls = append(*e.calls, "run-system "+name)
+	return nil
+}
+
+func (e baseEngine) Run(img Image, binds []Mount, command string, args ...string) error {
+	*e.calls = append(*e.calls, "run "+command+" "+strings.Join(args, " "))
+	return nil
+}
+
+func (e baseEngine) RunWithInput(img Image, binds []Mount, command, input string, args ...string) error {
+	*e.calls = append(*e.calls, "run "+command+" "+input)
+	return nil
+}
+
+func (e baseEngine) Kill(name string) error {
+	*e.calls = append(*e.calls, "kill "+name)
+	return nil
+}
+
+func (e baseEngine) Remove(name string) error {
+	*e.calls = append(*e.calls, "remove "+name)
+	return nil
+}
+
+func (e baseEngine) Exists(name string) (bool, error) {
+	_, ok := e.statuses[name]
+	return ok, nil
+}
+
+func (e baseEngine) Inspect(names []string) (map[string]ServiceStatus, error) {
+	statuses := make(map[string]ServiceStatus)
+	for _, n := range names {
+		if st, ok := e.statuses[n]; ok {
+			statuses[n] = st
+		}
+	}
+	return statuses, nil
+}
+
+func TestStaticPodsBootstrap(t *testing.T) {
+	t.Parallel()
+
+	var commands, calls []string
+	agent := ctrAgent{
+		outputs:  map[string]string{},
+		commands: &commands,
+	}
+	base := baseEngine{
+		statuses: map[string]ServiceStatus{
+			"etcd": {Running: true, Image: EtcdImage.Name()},
+		},
+		calls: &calls,
+	}
+	ce := StaticPods(agent, base, "unix:///run/containerd/containerd.sock")
+	opts := []string{"--mount", "type=volume,src=etcd-cke,dst=/var/lib/etcd"}
+
+	// etcd is run by the base engine while kubelet is not running.
+	statuses, err := ce.Inspect([]string{"etcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := statuses["etcd"]; !st.Running || st.StaticPod {
+		t.Error("etcd should be running as a container", st)
+	}
+	err = ce.RunSystem("etcd", EtcdImage, opts, ServiceParams{}, ServiceParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(calls, []string{"run-system etcd"}) {
+		t.Error("etcd should be run by the base engine", calls)
+	}
+
+	// etcd is run as a static pod once kubelet runs static pods.
+	calls = nil
+	base.statuses["kubelet"] = ServiceStatus{Running: true}
+	agent.outputs["kubelet/config.yml"] = "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\nstaticPodPath: /etc/kubernetes/manifests\n"
+	err = ce.RunSystem("etcd", EtcdImage, opts, ServiceParams{}, ServiceParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 || calls[0] != "kill etcd" || calls[1] != "remove etcd" || !strings.HasPrefix(calls[2], "run write_files ") {
+		t.Fatal("etcd container should be replaced with a static pod", calls)
+	}
+	if !strings.Contains(calls[2], "path: "+ContainerdVolumePath("etcd-cke")) {
+		t.Error("the volume directory should be mounted", calls[2])
+	}
+
+	pod, err := staticPodManifest("etcd", EtcdImage, nil, ServiceParams{}, ServiceParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := yaml.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.outputs["etcd.yaml; fi"] = string(manifest)
+	delete(base.statuses, "etcd")
+	statuses, err = ce.Inspect([]string{"etcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := statuses["etcd"]; !st.StaticPod || st.Image != EtcdImage.Name() {
+		t.Error("etcd should be a static pod", st)
+	}
+}
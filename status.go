@@ -1,6 +1,8 @@
 package cke
 
 import (
+	"time"
+
 	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
@@ -11,9 +13,24 @@ import (
 
 // EtcdClusterStatus is the status of the etcd cluster.
 type EtcdClusterStatus struct {
-	IsHealthy     bool
-	Members       map[string]*etcdserverpb.Member
-	InSyncMembers map[string]bool
+	IsHealthy      bool
+	Members        map[string]*etcdserverpb.Member
+	InSyncMembers  map[string]bool
+	MemberStatuses map[string]*EtcdMemberStatus
+}
+
+// IsLearner returns true if the named member is a learner, i.e. a non-voting
+// member that has not been promoted yet.
+func (s EtcdClusterStatus) IsLearner(name string) bool {
+	m, ok := s.Members[name]
+	return ok && m.IsLearner
+}
+
+// EtcdMemberStatus is the status reported by an etcd member.
+type EtcdMemberStatus struct {
+	DBSize      int64
+	DBSizeInUse int64
+	IsLeader    bool
 }
 
 // ClusterDNSStatus contains cluster resolver status.
@@ -91,30 +108,97 @@ type ClusterStatus struct {
 	Kubernetes  KubernetesClusterStatus
 	RepairQueue RepairQueueStatus
 	RebootQueue RebootQueueStatus
+
+	// EtcdRestore is non-nil if the etcd restoration is requested.
+	EtcdRestore *EtcdRestore
+
+	Encryption EncryptionStatus
+
+	// CARotation is non-nil if a CA rotation is in progress.
+	CARotation *CARotation
+}
+
+// EncryptionStatus represents the status of encryption of Kubernetes Secrets.
+type EncryptionStatus struct {
+	// ConfigHash is the hash of the current EncryptionConfiguration for kube-apiserver.
+	ConfigHash string
+
+	// Rotation is non-nil if the encryption key rotation is in progress.
+	Rotation *EncryptionKeyRotation
 }
 
 // NodeStatus status of a node.
 type NodeStatus struct {
-	SSHConnected      bool
+	SSHConnected bool
+
+	// ContainerEngine is the name of the container engine that runs system containers.
+	// This differs from the cluster configuration while the node is not migrated.
+	ContainerEngine string
+
 	Etcd              EtcdStatus
 	Rivers            ServiceStatus
 	EtcdRivers        ServiceStatus
+	KMSPlugin         ServiceStatus
 	APIServer         KubeComponentStatus
 	ControllerManager KubeComponentStatus
 	Scheduler         SchedulerStatus
 	Proxy             ProxyStatus
 	Kubelet           KubeletStatus
+
+	// KMSSecretIDIssued is the time when secret_id for the KMS plugin was issued.
+	// This is zero if the KMS plugin is not running or unknown.
+	KMSSecretIDIssued time.Time
+
+	// Certificates are the certificates of the running components keyed by Cert* names.
+	// Certificates that cannot be read are not included.
+	Certificates map[string]CertificateStatus
+}
+
+// Names of certificates in NodeStatus.Certificates.
+const (
+	CertEtcdServer          = "etcd-server"
+	CertEtcdPeer            = "etcd-peer"
+	CertAPIServer           = "apiserver"
+	CertAPIServerEtcdClient = "apiserver-etcd-client"
+	CertAggregation         = "aggregation"
+	CertControllerManager   = "controller-manager"
+	CertScheduler           = "scheduler"
+	CertProxy               = "proxy"
+	CertKubelet             = "kubelet"
+	CertAuditWebhook        = "audit-webhook"
+)
+
+// AllCertificates is the list of names of certificates in NodeStatus.Certificates.
+var AllCertificates = []string{
+	CertEtcdServer,
+	CertEtcdPeer,
+	CertAPIServer,
+	CertAPIServerEtcdClient,
+	CertAggregation,
+	CertControllerManager,
+	CertScheduler,
+	CertProxy,
+	CertKubelet,
+	CertAuditWebhook,
+}
+
+// CertificateStatus represents the validity period of a certificate on a node.
+type CertificateStatus struct {
+	NotBefore time.Time
+	NotAfter  time.Time
 }
 
 // ServiceStatus represents statuses of a service.
 //
 // If Running is false, the service is not running on the node.
 // ExtraXX are extra parameters of the running service, if any.
+// StaticPod is true if the service runs as a kubelet static pod.
 type ServiceStatus struct {
 	Running       bool
 	Image         string
 	BuiltInParams ServiceParams
 	ExtraParams   ServiceParams
+	StaticPod     bool
 }
 
 // EtcdStatus is the status of kubelet.
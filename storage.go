@@ -9,7 +9,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cybozu-go/log"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/clientv3util"
 )
@@ -27,17 +29,30 @@ const (
 	KeyAutoRepairDisabled       = "auto-repair/disabled"
 	KeyAutoRepairQueryVariables = "auto-repair/query-variables"
 	KeyCA                       = "ca/"
+	KeyCARotation               = "ca-rotation"
 	KeyConfigVersion            = "config-version"
 	KeyCluster                  = "cluster"
 	KeyClusterRevision          = "cluster-revision"
+	KeyClusterHistoryPrefix     = "cluster-history/data/"
+	KeyClusterHistoryWriteIndex = "cluster-history/write-index"
 	KeyConstraints              = "constraints"
+	KeyEncryptionKeyRotation    = "encryption-key-rotation"
+	KeyEtcdRestore              = "etcd-restore"
+	KeyEtcdSnapshot             = "etcd-snapshot"
+	KeyFreeze                   = "freeze"
 	KeyLeader                   = "leader/"
+	KeyLeaderEndpoint           = "leader-endpoint"
+	KeyLocalCAConfig            = "local-ca/config"
+	KeyLocalCAPrefix            = "local-ca/ca/"
+	KeyLocalSecretPrefix        = "local-ca/secret/"
+	KeyNotification             = "notification"
 	KeyRebootsDisabled          = "reboots/disabled"
 	KeyRebootsRunning           = "reboots/running"
 	KeyRebootsPrefix            = "reboots/data/"
 	KeyRebootsWriteIndex        = "reboots/write-index"
 	KeyRecords                  = "records/"
 	KeyRecordID                 = "records"
+	KeyRecordArchive            = "records-archive"
 	KeyRepairsDisabled          = "repairs/disabled"
 	KeyRepairsPrefix            = "repairs/data/"
 	KeyRepairsWriteIndex        = "repairs/write-index"
@@ -53,6 +68,7 @@ const (
 )
 
 const maxRecords = 1000
+const maxClusterHistory = 100
 const recordChanLength = 100
 const initialDisplayCount = 20
 
@@ -103,43 +119,568 @@ func (s Storage) PutConfigVersion(ctx context.Context, leaderKey string) error {
 }
 
 // PutCluster stores *Cluster into etcd.
-func (s Storage) PutCluster(ctx context.Context, c *Cluster) error {
+// The configuration is also kept in the cluster history along with author and source.
+func (s Storage) PutCluster(ctx context.Context, c *Cluster, author, source string) error {
+	return s.putCluster(ctx, c, author, source, "")
+}
+
+// PutClusterWithTemplateRevision stores *Cluster into etcd along with a revision number.
+// The configuration is also kept in the cluster history as generated by sabakan integration.
+func (s Storage) PutClusterWithTemplateRevision(ctx context.Context, c *Cluster, rev int64, leaderKey, author string) error {
+	return s.putCluster(ctx, c, author, ClusterSourceSabakan, leaderKey,
+		clientv3.OpPut(KeyClusterRevision, strconv.FormatInt(rev, 10)))
+}
+
+func clusterHistoryKey(rev int64) string {
+	return fmt.Sprintf("%s%016x", KeyClusterHistoryPrefix, rev)
+}
+
+func (s Storage) putCluster(ctx context.Context, c *Cluster, author, source, leaderKey string, extraOps ...clientv3.Op) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+RETRY:
+	var clusterRev int64
+	resp, err := s.Get(ctx, KeyCluster)
+	if err != nil {
+		return err
+	}
+	if resp.Count != 0 {
+		old := new(Cluster)
+		err = json.Unmarshal(resp.Kvs[0].Value, old)
+		if err != nil {
+			return err
+		}
+		err = c.ValidateTransition(old)
+		if err != nil {
+			return err
+		}
+		clusterRev = resp.Kvs[0].ModRevision
+	}
+
+	writeIndex := int64(1)
+	var writeIndexRev int64
+	resp, err = s.Get(ctx, KeyClusterHistoryWriteIndex)
+	if err != nil {
+		return err
+	}
+	if resp.Count != 0 {
+		value, err := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+		if err != nil {
+			return err
+		}
+		writeIndex = value
+		writeIndexRev = resp.Kvs[0].ModRevision
+	}
+
+	entry := &ClusterHistoryEntry{
+		Revision:  writeIndex,
+		Timestamp: time.Now().UTC(),
+		Author:    author,
+		Source:    source,
+		Cluster:   c,
+	}
+	entryData, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	cmps := []clientv3.Cmp{
+		clientv3.Compare(clientv3.ModRevision(KeyCluster), "=", clusterRev),
+		clientv3.Compare(clientv3.ModRevision(KeyClusterHistoryWriteIndex), "=", writeIndexRev),
+	}
+	if leaderKey != "" {
+		cmps = append(cmps, clientv3util.KeyExists(leaderKey))
+	}
+	ops := []clientv3.Op{
+		clientv3.OpPut(KeyCluster, string(data)),
+		clientv3.OpPut(clusterHistoryKey(writeIndex), string(entryData)),
+		clientv3.OpPut(KeyClusterHistoryWriteIndex, strconv.FormatInt(writeIndex+1, 10)),
+	}
+	ops = append(ops, extraOps...)
+
+	txnResp, err := s.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		if leaderKey != "" {
+			resp, err := s.Get(ctx, leaderKey)
+			if err != nil {
+				return err
+			}
+			if resp.Count == 0 {
+				return ErrNoLeader
+			}
+		}
+		goto RETRY
+	}
+
+	return s.maintClusterHistory(ctx, maxClusterHistory)
+}
+
+func (s Storage) maintClusterHistory(ctx context.Context, max int64) error {
+	resp, err := s.Get(ctx, KeyClusterHistoryPrefix,
+		clientv3.WithPrefix(),
+		clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Kvs) <= int(max) {
+		return nil
+	}
+
+	startKey := string(resp.Kvs[0].Key)
+	endKey := string(resp.Kvs[len(resp.Kvs)-int(max)].Key)
+	_, err = s.Delete(ctx, startKey, clientv3.WithRange(endKey))
+	return err
+}
+
+// GetClusterHistory loads the history of the cluster configuration
+// in ascending order of the revision.
+func (s Storage) GetClusterHistory(ctx context.Context) ([]*ClusterHistoryEntry, error) {
+	resp, err := s.Get(ctx, KeyClusterHistoryPrefix,
+		clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*ClusterHistoryEntry, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		e := new(ClusterHistoryEntry)
+		err = json.Unmarshal(kv.Value, e)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// GetClusterHistoryEntry loads a revision of the cluster configuration.
+// If the revision is not found in the history, this returns ErrNotFound.
+func (s Storage) GetClusterHistoryEntry(ctx context.Context, rev int64) (*ClusterHistoryEntry, error) {
+	resp, err := s.Get(ctx, clusterHistoryKey(rev))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	e := new(ClusterHistoryEntry)
+	err = json.Unmarshal(resp.Kvs[0].Value, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetCluster loads *Cluster from etcd.
+// If cluster configuration has not been stored, this returns ErrNotFound.
+func (s Storage) GetCluster(ctx context.Context) (*Cluster, error) {
+	resp, err := s.Get(ctx, KeyCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	c := new(Cluster)
+	err = json.Unmarshal(resp.Kvs[0].Value, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetClusterWithRevision loads *Cluster from etcd as well as the stored
+// revision number.  The revision number was stored with *Cluster by
+// PutClusterWithTemplateRevision().
+func (s Storage) GetClusterWithRevision(ctx context.Context) (*Cluster, int64, error) {
+	resp, err := s.Txn(ctx).
+		Then(
+			clientv3.OpGet(KeyCluster),
+			clientv3.OpGet(KeyClusterRevision),
+		).Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !resp.Succeeded {
+		panic("transaction without if condition failed")
+	}
+
+	gresp0 := resp.Responses[0].GetResponseRange()
+	gresp1 := resp.Responses[1].GetResponseRange()
+	if len(gresp0.Kvs) == 0 {
+		return nil, 0, ErrNotFound
+	}
+
+	c := new(Cluster)
+	err = json.Unmarshal(gresp0.Kvs[0].Value, c)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rev int64
+	if len(gresp1.Kvs) > 0 {
+		rev, err = strconv.ParseInt(string(gresp1.Kvs[0].Value), 10, 64)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return c, rev, nil
+}
+
+// PutConstraints stores *Constraints into etcd.
+func (s Storage) PutConstraints(ctx context.Context, c *Constraints) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyConstraints, string(data))
+	return err
+}
+
+// GetConstraints loads *Constraints from etcd.
+// If constraints have not been stored, this returns ErrNotFound.
+func (s Storage) GetConstraints(ctx context.Context) (*Constraints, error) {
+	resp, err := s.Get(ctx, KeyConstraints)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	c := new(Constraints)
+	err = json.Unmarshal(resp.Kvs[0].Value, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetFreeze loads *Freeze from etcd.
+// If operations are not frozen, this returns ErrNotFound.
+func (s Storage) GetFreeze(ctx context.Context) (*Freeze, error) {
+	resp, err := s.Get(ctx, KeyFreeze)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	f := new(Freeze)
+	err = json.Unmarshal(resp.Kvs[0].Value, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// PutFreeze stores *Freeze into etcd to freeze operations.
+func (s Storage) PutFreeze(ctx context.Context, f *Freeze) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyFreeze, string(data))
+	return err
+}
+
+// DeleteFreeze removes *Freeze from etcd to resume operations.
+func (s Storage) DeleteFreeze(ctx context.Context) error {
+	_, err := s.Delete(ctx, KeyFreeze)
+	return err
+}
+
+// PutVaultConfig stores *VaultConfig into etcd.
+func (s Storage) PutVaultConfig(ctx context.Context, c *VaultConfig) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyVault, string(data))
+	return err
+}
+
+// GetVaultConfig loads *VaultConfig from etcd.
+func (s Storage) GetVaultConfig(ctx context.Context) (*VaultConfig, error) {
+	resp, err := s.Get(ctx, KeyVault)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	cfg := new(VaultConfig)
+	err = json.Unmarshal(resp.Kvs[0].Value, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// PutLocalCAConfig stores *LocalCAConfig into etcd.
+func (s Storage) PutLocalCAConfig(ctx context.Context, c *LocalCAConfig) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyLocalCAConfig, string(data))
+	return err
+}
+
+// GetLocalCAConfig loads *LocalCAConfig from etcd.
+// ErrNotFound is returned if the local CA backend is not configured.
+func (s Storage) GetLocalCAConfig(ctx context.Context) (*LocalCAConfig, error) {
+	resp, err := s.Get(ctx, KeyLocalCAConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	cfg := new(LocalCAConfig)
+	err = json.Unmarshal(resp.Kvs[0].Value, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// PutLocalCA stores *LocalCA of the local CA backend into etcd.
+func (s Storage) PutLocalCA(ctx context.Context, name string, ca *LocalCA) error {
+	data, err := json.Marshal(ca)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyLocalCAPrefix+name, string(data))
+	return err
+}
+
+// GetLocalCA loads *LocalCA of the local CA backend from etcd.
+func (s Storage) GetLocalCA(ctx context.Context, name string) (*LocalCA, error) {
+	resp, err := s.Get(ctx, KeyLocalCAPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	ca := new(LocalCA)
+	err = json.Unmarshal(resp.Kvs[0].Value, ca)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// PutLocalSecret stores an encrypted secret of the local CA backend into etcd.
+func (s Storage) PutLocalSecret(ctx context.Context, name string, data []byte) error {
+	_, err := s.Put(ctx, KeyLocalSecretPrefix+name, string(data))
+	return err
+}
+
+// GetLocalSecret loads an encrypted secret of the local CA backend from etcd.
+func (s Storage) GetLocalSecret(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.Get(ctx, KeyLocalSecretPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+// UpdateLocalCA updates *LocalCA of the local CA backend in etcd.
+// update is called with the current value and may modify it.
+// If the value is modified concurrently, update is called again with the new value.
+// If the CA is not found, this returns ErrNotFound.
+func (s Storage) UpdateLocalCA(ctx context.Context, name string, update func(*LocalCA) error) error {
+	key := KeyLocalCAPrefix + name
+
+RETRY:
+	resp, err := s.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if resp.Count == 0 {
+		return ErrNotFound
+	}
+
+	ca := new(LocalCA)
+	err = json.Unmarshal(resp.Kvs[0].Value, ca)
+	if err != nil {
+		return err
+	}
+	err = update(ca)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(ca)
+	if err != nil {
+		return err
+	}
+
+	rev := resp.Kvs[0].ModRevision
+	txnResp, err := s.Txn(ctx).
+		If(
+			clientv3.Compare(clientv3.ModRevision(key), "=", rev),
+		).
+		Then(
+			clientv3.OpPut(key, string(data)),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		goto RETRY
+	}
+
+	return nil
+}
+
+// PutNotificationConfig stores *NotificationConfig into etcd.
+func (s Storage) PutNotificationConfig(ctx context.Context, c *NotificationConfig) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(ctx, KeyNotification, string(data))
+	return err
+}
+
+// GetNotificationConfig loads *NotificationConfig from etcd.
+// If the configuration is not found, this returns ErrNotFound.
+func (s Storage) GetNotificationConfig(ctx context.Context) (*NotificationConfig, error) {
+	resp, err := s.Get(ctx, KeyNotification)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	cfg := new(NotificationConfig)
+	err = json.Unmarshal(resp.Kvs[0].Value, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// PutRecordArchiveConfig stores *RecordArchiveConfig into etcd.
+func (s Storage) PutRecordArchiveConfig(ctx context.Context, c *RecordArchiveConfig) error {
 	data, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.Put(ctx, KeyCluster, string(data))
+	_, err = s.Put(ctx, KeyRecordArchive, string(data))
 	return err
 }
 
-// PutClusterWithTemplateRevision stores *Cluster into etcd along with a revision number.
-func (s Storage) PutClusterWithTemplateRevision(ctx context.Context, c *Cluster, rev int64, leaderKey string) error {
-	data, err := json.Marshal(c)
+// GetRecordArchiveConfig loads *RecordArchiveConfig from etcd.
+// If the configuration is not found, this returns ErrNotFound.
+func (s Storage) GetRecordArchiveConfig(ctx context.Context) (*RecordArchiveConfig, error) {
+	resp, err := s.Get(ctx, KeyRecordArchive)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	cfg := new(RecordArchiveConfig)
+	err = json.Unmarshal(resp.Kvs[0].Value, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// DeleteRecordArchiveConfig removes the record archive configuration.
+func (s Storage) DeleteRecordArchiveConfig(ctx context.Context) error {
+	_, err := s.Delete(ctx, KeyRecordArchive)
+	return err
+}
+
+// PutEtcdRestore stores *EtcdRestore into etcd.
+// If r.Freeze is true, freeze is also stored to block other operations.
+// This fails if the freeze has been set or removed since r.Freeze was decided.
+func (s Storage) PutEtcdRestore(ctx context.Context, r *EtcdRestore, freeze *Freeze) error {
+	data, err := json.Marshal(r)
 	if err != nil {
 		return err
 	}
+	ops := []clientv3.Op{clientv3.OpPut(KeyEtcdRestore, string(data))}
+	freezeCmp := clientv3util.KeyExists(KeyFreeze)
+	if r.Freeze {
+		freezeData, err := json.Marshal(freeze)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, clientv3.OpPut(KeyFreeze, string(freezeData)))
+		freezeCmp = clientv3util.KeyMissing(KeyFreeze)
+	}
 
 	resp, err := s.Txn(ctx).
-		If(clientv3util.KeyExists(leaderKey)).
-		Then(
-			clientv3.OpPut(KeyCluster, string(data)),
-			clientv3.OpPut(KeyClusterRevision, strconv.FormatInt(rev, 10)),
-		).Commit()
+		If(clientv3util.KeyMissing(KeyEtcdRestore), freezeCmp).
+		Then(ops...).
+		Else(clientv3.OpGet(KeyEtcdRestore, clientv3.WithCountOnly())).
+		Commit()
 	if err != nil {
 		return err
 	}
-
 	if !resp.Succeeded {
-		return ErrNoLeader
+		if resp.Responses[0].GetResponseRange().Count > 0 {
+			return errors.New("etcd restoration is already requested")
+		}
+		return errors.New("the freeze has been changed; try again")
 	}
 	return nil
 }
 
-// GetCluster loads *Cluster from etcd.
-// If cluster configuration has not been stored, this returns ErrNotFound.
-func (s Storage) GetCluster(ctx context.Context) (*Cluster, error) {
-	resp, err := s.Get(ctx, KeyCluster)
+// GetEtcdRestore loads *EtcdRestore from etcd.
+// If no restoration is requested, this returns ErrNotFound.
+func (s Storage) GetEtcdRestore(ctx context.Context) (*EtcdRestore, error) {
+	resp, err := s.Get(ctx, KeyEtcdRestore)
 	if err != nil {
 		return nil, err
 	}
@@ -148,69 +689,143 @@ func (s Storage) GetCluster(ctx context.Context) (*Cluster, error) {
 		return nil, ErrNotFound
 	}
 
-	c := new(Cluster)
-	err = json.Unmarshal(resp.Kvs[0].Value, c)
+	r := new(EtcdRestore)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
 	if err != nil {
 		return nil, err
 	}
+	return r, nil
+}
 
-	return c, nil
+// FinishEtcdRestore removes the restoration request.
+// If the freeze was set for the restoration, it is also removed.
+func (s Storage) FinishEtcdRestore(ctx context.Context, leaderKey string, r *EtcdRestore) error {
+	ops := []clientv3.Op{clientv3.OpDelete(KeyEtcdRestore)}
+	if r.Freeze {
+		ops = append(ops, clientv3.OpDelete(KeyFreeze))
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
 }
 
-// GetClusterWithRevision loads *Cluster from etcd as well as the stored
-// revision number.  The revision number was stored with *Cluster by
-// PutClusterWithTemplateRevision().
-func (s Storage) GetClusterWithRevision(ctx context.Context) (*Cluster, int64, error) {
+// CancelEtcdRestore removes the restoration request.
+// The freeze is kept as it is.
+func (s Storage) CancelEtcdRestore(ctx context.Context) error {
+	_, err := s.Delete(ctx, KeyEtcdRestore)
+	return err
+}
+
+// PutEncryptionKeyRotation stores *EncryptionKeyRotation into etcd.
+// This returns an error if another rotation is in progress.
+func (s Storage) PutEncryptionKeyRotation(ctx context.Context, r *EncryptionKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
 	resp, err := s.Txn(ctx).
-		Then(
-			clientv3.OpGet(KeyCluster),
-			clientv3.OpGet(KeyClusterRevision),
-		).Commit()
+		If(clientv3util.KeyMissing(KeyEncryptionKeyRotation)).
+		Then(clientv3.OpPut(KeyEncryptionKeyRotation, string(data))).
+		Commit()
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 	if !resp.Succeeded {
-		panic("transaction without if condition failed")
+		return errors.New("encryption key rotation is in progress")
 	}
+	return nil
+}
 
-	gresp0 := resp.Responses[0].GetResponseRange()
-	gresp1 := resp.Responses[1].GetResponseRange()
-	if len(gresp0.Kvs) == 0 {
-		return nil, 0, ErrNotFound
+// GetEncryptionKeyRotation loads *EncryptionKeyRotation from etcd.
+// If no rotation is in progress, this returns ErrNotFound.
+func (s Storage) GetEncryptionKeyRotation(ctx context.Context) (*EncryptionKeyRotation, error) {
+	resp, err := s.Get(ctx, KeyEncryptionKeyRotation)
+	if err != nil {
+		return nil, err
 	}
 
-	c := new(Cluster)
-	err = json.Unmarshal(gresp0.Kvs[0].Value, c)
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := new(EncryptionKeyRotation)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	return r, nil
+}
 
-	var rev int64
-	if len(gresp1.Kvs) > 0 {
-		rev, err = strconv.ParseInt(string(gresp1.Kvs[0].Value), 10, 64)
-		if err != nil {
-			return nil, 0, err
-		}
+// UpdateEncryptionKeyRotation updates the progress of the rotation.
+func (s Storage) UpdateEncryptionKeyRotation(ctx context.Context, leaderKey string, r *EncryptionKeyRotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
 	}
 
-	return c, rev, nil
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyEncryptionKeyRotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
 }
 
-// PutConstraints stores *Constraints into etcd.
-func (s Storage) PutConstraints(ctx context.Context, c *Constraints) error {
-	data, err := json.Marshal(c)
+// FinishEncryptionKeyRotation removes the rotation request.
+func (s Storage) FinishEncryptionKeyRotation(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyEncryptionKeyRotation)).
+		Commit()
 	if err != nil {
 		return err
 	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
 
-	_, err = s.Put(ctx, KeyConstraints, string(data))
-	return err
+// PutCARotation stores *CARotation into etcd.
+// This returns an error if another rotation is in progress.
+func (s Storage) PutCARotation(ctx context.Context, r *CARotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyMissing(KeyCARotation)).
+		Then(clientv3.OpPut(KeyCARotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return errors.New("CA rotation is in progress")
+	}
+	return nil
 }
 
-// GetConstraints loads *Constraints from etcd.
-// If constraints have not been stored, this returns ErrNotFound.
-func (s Storage) GetConstraints(ctx context.Context) (*Constraints, error) {
-	resp, err := s.Get(ctx, KeyConstraints)
+// GetCARotation loads *CARotation from etcd.
+// If no rotation is in progress, this returns ErrNotFound.
+func (s Storage) GetCARotation(ctx context.Context) (*CARotation, error) {
+	resp, err := s.Get(ctx, KeyCARotation)
 	if err != nil {
 		return nil, err
 	}
@@ -219,29 +834,64 @@ func (s Storage) GetConstraints(ctx context.Context) (*Constraints, error) {
 		return nil, ErrNotFound
 	}
 
-	c := new(Constraints)
-	err = json.Unmarshal(resp.Kvs[0].Value, c)
+	r := new(CARotation)
+	err = json.Unmarshal(resp.Kvs[0].Value, r)
 	if err != nil {
 		return nil, err
 	}
+	return r, nil
+}
 
-	return c, nil
+// UpdateCARotation updates the progress of the rotation.
+func (s Storage) UpdateCARotation(ctx context.Context, leaderKey string, r *CARotation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpPut(KeyCARotation, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
 }
 
-// PutVaultConfig stores *VaultConfig into etcd.
-func (s Storage) PutVaultConfig(ctx context.Context, c *VaultConfig) error {
+// FinishCARotation removes the rotation request.
+func (s Storage) FinishCARotation(ctx context.Context, leaderKey string) error {
+	resp, err := s.Txn(ctx).
+		If(clientv3util.KeyExists(leaderKey)).
+		Then(clientv3.OpDelete(KeyCARotation)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrNoLeader
+	}
+	return nil
+}
+
+// PutEtcdSnapshotConfig stores *EtcdSnapshotConfig into etcd.
+func (s Storage) PutEtcdSnapshotConfig(ctx context.Context, c *EtcdSnapshotConfig) error {
 	data, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.Put(ctx, KeyVault, string(data))
+	_, err = s.Put(ctx, KeyEtcdSnapshot, string(data))
 	return err
 }
 
-// GetVaultConfig loads *VaultConfig from etcd.
-func (s Storage) GetVaultConfig(ctx context.Context) (*VaultConfig, error) {
-	resp, err := s.Get(ctx, KeyVault)
+// GetEtcdSnapshotConfig loads *EtcdSnapshotConfig from etcd.
+// If the configuration is not found, this returns ErrNotFound.
+func (s Storage) GetEtcdSnapshotConfig(ctx context.Context) (*EtcdSnapshotConfig, error) {
+	resp, err := s.Get(ctx, KeyEtcdSnapshot)
 	if err != nil {
 		return nil, err
 	}
@@ -250,14 +900,20 @@ func (s Storage) GetVaultConfig(ctx context.Context) (*VaultConfig, error) {
 		return nil, ErrNotFound
 	}
 
-	cfg := new(VaultConfig)
-	err = json.Unmarshal(resp.Kvs[0].Value, &cfg)
+	cfg := new(EtcdSnapshotConfig)
+	err = json.Unmarshal(resp.Kvs[0].Value, cfg)
 	if err != nil {
 		return nil, err
 	}
 	return cfg, nil
 }
 
+// DeleteEtcdSnapshotConfig removes the etcd snapshot configuration.
+func (s Storage) DeleteEtcdSnapshotConfig(ctx context.Context) error {
+	_, err := s.Delete(ctx, KeyEtcdSnapshot)
+	return err
+}
+
 // GetCACertificate loads CA certificate from etcd.
 func (s Storage) GetCACertificate(ctx context.Context, name string) (string, error) {
 	return s.getStringValue(ctx, KeyCA+name)
@@ -302,6 +958,34 @@ func (s Storage) PutServiceAccountData(ctx context.Context, leaderKey, cert, key
 	return nil
 }
 
+// GetRecordsBefore loads at most count records whose IDs are less than before.
+// The returned records are sorted by record ID in decreasing order.
+func (s Storage) GetRecordsBefore(ctx context.Context, before, count int64) ([]*Record, error) {
+	opts := []clientv3.OpOption{
+		clientv3.WithRange(recordKey(&Record{ID: before})),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend),
+	}
+	if count > 0 {
+		opts = append(opts, clientv3.WithLimit(count))
+	}
+	resp, err := s.Get(ctx, KeyRecords, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*Record, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		r := new(Record)
+		err = json.Unmarshal(kv.Value, r)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = r
+	}
+
+	return records, nil
+}
+
 // GetRecords loads list of *Record from etcd.
 // The returned records are sorted by record ID in decreasing order.
 func (s Storage) GetRecords(ctx context.Context, count int64) ([]*Record, error) {
@@ -461,6 +1145,11 @@ func (s Storage) NextRecordID(ctx context.Context) (int64, error) {
 }
 
 func (s Storage) maintRecords(ctx context.Context, leaderKey string, max int64) error {
+	archive := getRecordArchive()
+	if archive != nil {
+		return s.archiveRecords(ctx, leaderKey, max, archive)
+	}
+
 	resp, err := s.Get(ctx, KeyRecords,
 		clientv3.WithPrefix(),
 		clientv3.WithKeysOnly(),
@@ -476,7 +1165,61 @@ func (s Storage) maintRecords(ctx context.Context, leaderKey string, max int64)
 
 	startKey := string(resp.Kvs[0].Key)
 	endKey := string(resp.Kvs[len(resp.Kvs)-int(max)].Key)
+	return s.deleteRecords(ctx, leaderKey, startKey, endKey)
+}
+
+// archiveRecords stores old records into the archive before deleting them.
+// To avoid archiving records one by one, this waits until the number of
+// records exceeds max by 10%.
+//
+// If the archive keeps failing, records are deleted without archiving once
+// they exceed twice the max so that etcd does not run out of space.
+func (s Storage) archiveRecords(ctx context.Context, leaderKey string, max int64, archive RecordArchive) error {
+	resp, err := s.Get(ctx, KeyRecords,
+		clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Kvs) <= int(max+max/10) {
+		return nil
+	}
+
+	kvs := resp.Kvs[:len(resp.Kvs)-int(max)]
+	records := make([]*Record, len(kvs))
+	for i, kv := range kvs {
+		r := new(Record)
+		err := json.Unmarshal(kv.Value, r)
+		if err != nil {
+			return err
+		}
+		records[i] = r
+	}
+
+	err = archive.Append(ctx, records)
+	if err != nil {
+		recordArchiveFailures.Add(1)
+		if len(resp.Kvs) <= int(max*2) {
+			// Keep records in etcd until they are archived successfully.
+			log.Warn("failed to archive records", map[string]interface{}{
+				log.FnError: err,
+			})
+			return nil
+		}
+		log.Error("failed to archive records; deleting them without archiving", map[string]interface{}{
+			log.FnError: err,
+			"count":     len(records),
+		})
+	}
+
+	startKey := string(resp.Kvs[0].Key)
+	endKey := string(resp.Kvs[len(resp.Kvs)-int(max)].Key)
+	return s.deleteRecords(ctx, leaderKey, startKey, endKey)
+}
 
+func (s Storage) deleteRecords(ctx context.Context, leaderKey, startKey, endKey string) error {
 	tresp, err := s.Txn(ctx).
 		If(clientv3util.KeyExists(leaderKey)).
 		Then(clientv3.OpDelete(startKey, clientv3.WithRange(endKey))).
@@ -487,6 +1230,19 @@ func (s Storage) maintRecords(ctx context.Context, leaderKey string, max int64)
 	return err
 }
 
+// SetLeaderEndpoint stores the URL of the REST API of the current leader.
+// The key will be removed when the lease expires.
+func (s Storage) SetLeaderEndpoint(ctx context.Context, lease clientv3.LeaseID, url string) error {
+	_, err := s.Put(ctx, KeyLeaderEndpoint, url, clientv3.WithLease(lease))
+	return err
+}
+
+// GetLeaderEndpoint returns the URL of the REST API of the current leader.
+// If the URL is not found, this returns ("", ErrNotFound).
+func (s Storage) GetLeaderEndpoint(ctx context.Context) (string, error) {
+	return s.getStringValue(ctx, KeyLeaderEndpoint)
+}
+
 // GetLeaderHostname returns the current leader's host name.
 // It returns non-nil error when there is no leader.
 func (s Storage) GetLeaderHostname(ctx context.Context) (string, error) {
@@ -1,12 +1,17 @@
 package cke
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	vault "github.com/hashicorp/vault/api"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
@@ -76,7 +81,7 @@ func testStorageCluster(t *testing.T) {
 			"8.8.4.4",
 		},
 	}
-	err = storage.PutCluster(ctx, c)
+	err = storage.PutCluster(ctx, c, "test", ClusterSourceCKECLI)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -89,6 +94,113 @@ func testStorageCluster(t *testing.T) {
 	if !cmp.Equal(c, got) {
 		t.Fatalf("got invalid cluster: %v", got)
 	}
+
+	c.ContainerEngine = ContainerEngineContainerd
+	err = storage.PutCluster(ctx, c, "test", ClusterSourceCKECLI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := *c
+	c2.ContainerEngine = ""
+	err = storage.PutCluster(ctx, &c2, "test", ClusterSourceCKECLI)
+	if err == nil {
+		t.Error("container_engine should not be changed from containerd")
+	}
+	got, err = storage.GetCluster(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ContainerEngine != ContainerEngineContainerd {
+		t.Error("cluster should not be updated", got.ContainerEngine)
+	}
+}
+
+func testStorageClusterHistory(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	entries, err := storage.GetClusterHistory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Error("history is not empty", entries)
+	}
+	_, err = storage.GetClusterHistoryEntry(ctx, 1)
+	if err != ErrNotFound {
+		t.Error("unexpected error", err)
+	}
+
+	c1 := &Cluster{Name: "c1"}
+	err = storage.PutCluster(ctx, c1, "alice", ClusterSourceCKECLI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderKey := e.Key()
+
+	c2 := &Cluster{Name: "c2"}
+	err = storage.PutClusterWithTemplateRevision(ctx, c2, 10, leaderKey, "host1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = storage.GetClusterHistory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("unexpected number of entries", len(entries))
+	}
+	if entries[0].Revision != 1 || entries[0].Author != "alice" || entries[0].Source != ClusterSourceCKECLI || !cmp.Equal(entries[0].Cluster, c1) {
+		t.Error("unexpected entry", entries[0])
+	}
+	if entries[1].Revision != 2 || entries[1].Author != "host1" || entries[1].Source != ClusterSourceSabakan || !cmp.Equal(entries[1].Cluster, c2) {
+		t.Error("unexpected entry", entries[1])
+	}
+
+	entry, err := storage.GetClusterHistoryEntry(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(entry.Cluster, c1) {
+		t.Error("unexpected cluster", entry.Cluster)
+	}
+
+	err = e.Resign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.PutClusterWithTemplateRevision(ctx, c2, 11, leaderKey, "host1")
+	if err != ErrNoLeader {
+		t.Error("unexpected error", err)
+	}
+
+	err = storage.maintClusterHistory(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = storage.GetClusterHistory(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Revision != 2 {
+		t.Error("old entries are not removed", entries)
+	}
 }
 
 func testStorageConstraints(t *testing.T) {
@@ -130,6 +242,458 @@ func checkLeaderKey(ctx context.Context, s Storage, leaderKey string) (bool, err
 	return len(resp.Kvs) > 0, nil
 }
 
+func testStorageFreeze(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetFreeze(ctx)
+	if err != ErrNotFound {
+		t.Fatal("freeze found.")
+	}
+
+	f := &Freeze{
+		Reason:    "datacenter maintenance",
+		Author:    "alice",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		Phases:    []OperationPhase{PhaseRebootNodes},
+	}
+	err = storage.PutFreeze(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := storage.GetFreeze(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(f, got) {
+		t.Error("unexpected freeze", cmp.Diff(f, got))
+	}
+
+	err = storage.DeleteFreeze(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.GetFreeze(ctx)
+	if err != ErrNotFound {
+		t.Error("freeze is not deleted", err)
+	}
+}
+
+func testStorageEtcdRestore(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	r := &EtcdRestore{
+		Snapshot:  "etcd-20240102-030405.backup",
+		Node:      "10.0.0.11",
+		Author:    "alice",
+		Timestamp: now,
+		Freeze:    true,
+	}
+	freeze := &Freeze{
+		Reason:    "restoring etcd",
+		Author:    "alice",
+		Timestamp: now,
+	}
+
+	// the freeze is set by someone else after r.Freeze is decided.
+	err := storage.PutFreeze(ctx, &Freeze{Reason: "maintenance", Author: "bob", Timestamp: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.PutEtcdRestore(ctx, r, freeze)
+	if err == nil {
+		t.Error("restoration should fail when the freeze exists")
+	}
+
+	// the freeze is removed after r.Freeze is decided.
+	err = storage.DeleteFreeze(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Freeze = false
+	err = storage.PutEtcdRestore(ctx, r, freeze)
+	if err == nil {
+		t.Error("restoration should fail when the freeze is missing")
+	}
+
+	r.Freeze = true
+	err = storage.PutEtcdRestore(ctx, r, freeze)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := storage.GetEtcdRestore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(r, got) {
+		t.Error("unexpected restoration", cmp.Diff(r, got))
+	}
+	gotFreeze, err := storage.GetFreeze(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(freeze, gotFreeze) {
+		t.Error("unexpected freeze", cmp.Diff(freeze, gotFreeze))
+	}
+
+	r.Freeze = false
+	err = storage.PutEtcdRestore(ctx, r, freeze)
+	if err == nil || err.Error() != "etcd restoration is already requested" {
+		t.Error("restoration should not be requested twice", err)
+	}
+}
+
+func testStorageEncryptionKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetEncryptionKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Fatal("rotation found.")
+	}
+
+	r := &EncryptionKeyRotation{
+		Provider:  EncryptionProviderAESCBC,
+		KeyName:   "key2",
+		Phase:     EncryptionKeyAdded,
+		Author:    "alice",
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+	err = storage.PutEncryptionKeyRotation(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.PutEncryptionKeyRotation(ctx, r)
+	if err == nil {
+		t.Error("rotation should not be requested twice")
+	}
+
+	got, err := storage.GetEncryptionKeyRotation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(r, got) {
+		t.Error("unexpected rotation", cmp.Diff(r, got))
+	}
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderKey := e.Key()
+
+	r.Phase = EncryptionKeyPromoted
+	err = storage.UpdateEncryptionKeyRotation(ctx, leaderKey, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = storage.GetEncryptionKeyRotation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Phase != EncryptionKeyPromoted {
+		t.Error("phase is not updated", got.Phase)
+	}
+
+	err = storage.FinishEncryptionKeyRotation(ctx, "wrong")
+	if err != ErrNoLeader {
+		t.Error("unexpected error", err)
+	}
+	err = storage.FinishEncryptionKeyRotation(ctx, leaderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.GetEncryptionKeyRotation(ctx)
+	if err != ErrNotFound {
+		t.Error("rotation is not finished", err)
+	}
+}
+
+func testStorageCARotation(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetCARotation(ctx)
+	if err != ErrNotFound {
+		t.Fatal("rotation found.")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	r := &CARotation{
+		Name:           CAKubernetes,
+		Phase:          CARotationAdded,
+		PhaseStarted:   now,
+		OldIssuer:      "old-issuer",
+		NewIssuer:      "new-issuer",
+		OldCertificate: "old",
+		NewCertificate: "new",
+		Author:         "alice",
+		Timestamp:      now,
+	}
+	err = storage.PutCARotation(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.PutCARotation(ctx, r)
+	if err == nil {
+		t.Error("rotation should not be requested twice")
+	}
+
+	got, err := storage.GetCARotation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(r, got) {
+		t.Error("unexpected rotation", cmp.Diff(r, got))
+	}
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderKey := e.Key()
+
+	r.Phase = CARotationBundled
+	err = storage.UpdateCARotation(ctx, "wrong", r)
+	if err != ErrNoLeader {
+		t.Error("unexpected error", err)
+	}
+	err = storage.UpdateCARotation(ctx, leaderKey, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = storage.GetCARotation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Phase != CARotationBundled {
+		t.Error("phase is not updated", got.Phase)
+	}
+
+	err = storage.FinishCARotation(ctx, leaderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.GetCARotation(ctx)
+	if err != ErrNotFound {
+		t.Error("rotation is not finished", err)
+	}
+}
+
+func testStorageLocalCA(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	_, err := storage.GetLocalCAConfig(ctx)
+	if err != ErrNotFound {
+		t.Fatal("local CA config found.")
+	}
+	_, err = storage.GetLocalCA(ctx, CAKubernetes)
+	if err != ErrNotFound {
+		t.Fatal("local CA found.")
+	}
+
+	cfg := newTestLocalCAConfig(t)
+	err = storage.PutLocalCAConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotCfg, err := storage.GetLocalCAConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(cfg, gotCfg) {
+		t.Error("unexpected config", cmp.Diff(cfg, gotCfg))
+	}
+
+	oldCert, err := CreateLocalCA(ctx, storage, cfg, CAKubernetes, "kubernetes CA", "876000h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := storage.GetLocalCA(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIssuer := ca.Default
+	if len(ca.Issuers) != 1 || ca.Issuers[oldIssuer].Certificate != oldCert {
+		t.Error("unexpected local CA", ca)
+	}
+
+	old, newIssuer, newCert, err := addLocalCAIssuer(ctx, storage, cfg, CAKubernetes, "kubernetes CA", "876000h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old != oldIssuer || newIssuer == oldIssuer {
+		t.Error("unexpected issuers", old, newIssuer)
+	}
+	ca, err = storage.GetLocalCA(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.Default != oldIssuer || len(ca.Issuers) != 2 {
+		t.Error("new issuer should not be the default", ca.Default)
+	}
+
+	err = deleteLocalCAIssuer(ctx, storage, CAKubernetes, oldIssuer)
+	if err == nil {
+		t.Error("default issuer should not be deleted")
+	}
+	err = setDefaultLocalCAIssuer(ctx, storage, CAKubernetes, newIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, _, err := issueLocalCertificate(ctx, storage, cfg, CAKubernetes,
+		map[string]interface{}{"ttl": "1h"},
+		map[string]interface{}{"common_name": "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parseTestCertificate(t, crt)
+	if cert.CheckSignatureFrom(parseTestCertificate(t, newCert)) != nil {
+		t.Error("certificate should be issued by the new issuer")
+	}
+
+	err = deleteLocalCAIssuer(ctx, storage, CAKubernetes, oldIssuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = deleteLocalCAIssuer(ctx, storage, CAKubernetes, oldIssuer)
+	if err != nil {
+		t.Error("deleting a deleted issuer should succeed", err)
+	}
+	ca, err = storage.GetLocalCA(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ca.Issuers) != 1 || ca.Default != newIssuer {
+		t.Error("unexpected local CA after deletion", ca)
+	}
+
+	// concurrent updates should not be lost
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("issuer-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := storage.UpdateLocalCA(ctx, CAKubernetes, func(lca *LocalCA) error {
+				lca.Issuers[id] = &LocalCAIssuer{Certificate: id}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	ca, err = storage.GetLocalCA(ctx, CAKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ca.Issuers) != 11 {
+		t.Error("concurrent updates are lost", len(ca.Issuers))
+	}
+
+	err = storage.UpdateLocalCA(ctx, CAServer, func(lca *LocalCA) error { return nil })
+	if err != ErrNotFound {
+		t.Error("updating a non-existent CA should return ErrNotFound", err)
+	}
+}
+
+func testStorageLocalSecret(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	noVault := func() (*vault.Client, error) {
+		return nil, errors.New("vault is not connected")
+	}
+
+	_, err := readSecret(ctx, storage, noVault, SSHSecret)
+	if err == nil {
+		t.Error("secret should be read from Vault without the local CA backend")
+	}
+
+	cfg := newTestLocalCAConfig(t)
+	err = storage.PutLocalCAConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := readSecret(ctx, storage, noVault, SSHSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != nil {
+		t.Error("secret should not exist", secret)
+	}
+
+	expected := map[string]interface{}{"": "default key", "node1": "node1 key"}
+	err = WriteLocalSecret(ctx, storage, cfg, SSHSecret, expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := storage.GetLocalSecret(ctx, SSHSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("node1 key")) {
+		t.Error("secret is not encrypted")
+	}
+
+	secret, err = readSecret(ctx, storage, noVault, SSHSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(expected, secret) {
+		t.Error("unexpected secret", cmp.Diff(expected, secret))
+	}
+
+	other := newTestLocalCAConfig(t)
+	_, err = ReadLocalSecret(ctx, storage, other, SSHSecret)
+	if err == nil {
+		t.Error("secret should not be decrypted with another key")
+	}
+}
+
 func testStorageRecord(t *testing.T) {
 	t.Parallel()
 
@@ -224,6 +788,25 @@ func testStorageRecord(t *testing.T) {
 		t.Error("length mismatch", len(got))
 	}
 
+	got, err = storage.GetRecordsBefore(ctx, 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 10 {
+		t.Error("length mismatch", len(got))
+	}
+	if got[0].ID != 99 || got[9].ID != 90 {
+		t.Error("unexpected records", got[0].ID, got[9].ID)
+	}
+
+	got, err = storage.GetRecordsBefore(ctx, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Error("length mismatch", len(got))
+	}
+
 	ch1, err := storage.WatchRecords(ctx, 0)
 	if err != nil {
 		t.Fatal(err)
@@ -347,6 +930,176 @@ func testStorageRecord(t *testing.T) {
 	}
 }
 
+func testStorageRecordArchive(t *testing.T) {
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderKey := e.Key()
+
+	cfg := &RecordArchiveConfig{
+		Type:      RecordArchiveFile,
+		Directory: t.TempDir(),
+	}
+	err = storage.PutRecordArchiveConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := storage.GetRecordArchiveConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(cfg, got) {
+		t.Error("unexpected config", cmp.Diff(cfg, got))
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ConnectRecordArchive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectRecordArchive()
+
+	for i := int64(1); i <= 20; i++ {
+		record := NewRecord(i, fmt.Sprintf("my-operation-%d", i), []string{})
+		err = storage.RegisterRecord(ctx, leaderKey, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.maintRecords(ctx, leaderKey, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := storage.GetRecords(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records are pruned to 10 when the number exceeds 11.
+	if len(records) != 10 && len(records) != 11 {
+		t.Fatal("unexpected number of records in etcd:", len(records))
+	}
+
+	archive, err := NewRecordArchive(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	err = archive.Walk(ctx, func(r *Record) error {
+		ids = append(ids, r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids)+len(records) != 20 {
+		t.Fatal("records are lost:", ids, len(records))
+	}
+	if ids[len(ids)-1]+1 != records[len(records)-1].ID {
+		t.Error("archive and etcd are not contiguous:", ids, records[len(records)-1].ID)
+	}
+
+	err = storage.DeleteRecordArchiveConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = storage.GetRecordArchiveConfig(ctx)
+	if err != ErrNotFound {
+		t.Error("config is not deleted", err)
+	}
+}
+
+type failingRecordArchive struct{}
+
+func (failingRecordArchive) Append(ctx context.Context, records []*Record) error {
+	return errors.New("unavailable")
+}
+
+func (failingRecordArchive) Walk(ctx context.Context, fn func(*Record) error) error {
+	return errors.New("unavailable")
+}
+
+func testStorageRecordArchiveFailure(t *testing.T) {
+	t.Parallel()
+
+	client := newEtcdClient(t)
+	defer client.Close()
+	storage := Storage{client}
+	ctx := context.Background()
+
+	s, err := concurrency.NewSession(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	e := concurrency.NewElection(s, KeyLeader)
+	err = e.Campaign(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderKey := e.Key()
+
+	failures := RecordArchiveFailures()
+	for i := int64(1); i <= 20; i++ {
+		record := NewRecord(i, fmt.Sprintf("my-operation-%d", i), []string{})
+		err = storage.RegisterRecord(ctx, leaderKey, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.archiveRecords(ctx, leaderKey, 10, failingRecordArchive{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := storage.GetRecords(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// records are kept up to twice the max while the archive is failing.
+	if len(records) != 20 {
+		t.Fatal("unexpected number of records in etcd:", len(records))
+	}
+	if RecordArchiveFailures()-failures != 9 {
+		t.Error("failures are not counted:", RecordArchiveFailures()-failures)
+	}
+
+	record := NewRecord(21, "my-operation-21", []string{})
+	err = storage.RegisterRecord(ctx, leaderKey, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.archiveRecords(ctx, leaderKey, 10, failingRecordArchive{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = storage.GetRecords(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 {
+		t.Fatal("records are not deleted:", len(records))
+	}
+	if records[9].ID != 12 {
+		t.Error("unexpected oldest record:", records[9].ID)
+	}
+}
+
 func testStorageMaint(t *testing.T) {
 	t.Parallel()
 
@@ -552,7 +1305,7 @@ func testStorageSabakan(t *testing.T) {
 		t.Error(`tmpl2.Name != tmpl.Name`, tmpl2.Name)
 	}
 
-	err = s.PutCluster(ctx, tmpl)
+	err = s.PutCluster(ctx, tmpl, "test", ClusterSourceCKECLI)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -567,7 +1320,7 @@ func testStorageSabakan(t *testing.T) {
 		t.Error("unexpected revision:", rev2)
 	}
 
-	err = s.PutClusterWithTemplateRevision(ctx, tmpl, rev, KeySabakanTemplate)
+	err = s.PutClusterWithTemplateRevision(ctx, tmpl, rev, KeySabakanTemplate, "test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1045,6 +1798,24 @@ func testStatus(t *testing.T) {
 		t.Error("wrong phase:", status.Phase)
 	}
 
+	_, err = s.GetLeaderEndpoint(ctx)
+	if err != ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	err = s.SetLeaderEndpoint(ctx, resp.ID, "http://10.0.0.1:10180")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint, err := s.GetLeaderEndpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "http://10.0.0.1:10180" {
+		t.Error("wrong endpoint:", endpoint)
+	}
+
 	_, err = client.Revoke(ctx, resp.ID)
 	if err != nil {
 		t.Fatal(err)
@@ -1054,13 +1825,27 @@ func testStatus(t *testing.T) {
 	if err != ErrNotFound {
 		t.Error("err is not ErrNotFound. err=", err)
 	}
+
+	_, err = s.GetLeaderEndpoint(ctx)
+	if err != ErrNotFound {
+		t.Error("err is not ErrNotFound. err=", err)
+	}
 }
 
 func TestStorage(t *testing.T) {
 	t.Run("ConfigVersion", testConfigVersion)
 	t.Run("Cluster", testStorageCluster)
+	t.Run("ClusterHistory", testStorageClusterHistory)
 	t.Run("Constraints", testStorageConstraints)
+	t.Run("Freeze", testStorageFreeze)
+	t.Run("EtcdRestore", testStorageEtcdRestore)
+	t.Run("EncryptionKeyRotation", testStorageEncryptionKeyRotation)
+	t.Run("CARotation", testStorageCARotation)
+	t.Run("LocalCA", testStorageLocalCA)
+	t.Run("LocalSecret", testStorageLocalSecret)
 	t.Run("Record", testStorageRecord)
+	t.Run("RecordArchive", testStorageRecordArchive)
+	t.Run("RecordArchiveFailure", testStorageRecordArchiveFailure)
 	t.Run("Maint", testStorageMaint)
 	t.Run("Resource", testStorageResource)
 	t.Run("Sabakan", testStorageSabakan)
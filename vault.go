@@ -25,6 +25,25 @@ const SSHSecret = CKESecret + "/ssh"
 // K8sSecret is the path of encryption keys used for Kubernetes Secrets.
 const K8sSecret = CKESecret + "/k8s"
 
+// KMSSecret is the path of AppRole role_id for the KMS plugin.
+const KMSSecret = CKESecret + "/kms"
+
+// KMSAppRole is the name of AppRole for the KMS plugin.
+const KMSAppRole = "cke-kms"
+
+// KMSSecretIDTTL is the TTL of secret_id issued for the KMS plugin on each node.
+const KMSSecretIDTTL = 24 * time.Hour
+
+// KMSSecretIDRenewAfter is the age of secret_id after which CKE restarts
+// the KMS plugin with a new secret_id.
+const KMSSecretIDRenewAfter = KMSSecretIDTTL / 2
+
+// VaultTransit is the path of transit secret engine for CKE.
+const VaultTransit = "cke/transit"
+
+// VaultTransitKey is the name of the transit key to encrypt Kubernetes Secrets.
+const VaultTransitKey = "k8s"
+
 type anyMap = map[string]interface{}
 
 // VaultConfig is data to store in etcd